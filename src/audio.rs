@@ -15,7 +15,7 @@ use std::cell::RefCell;
 use std::sync::atomic::{AtomicBool, AtomicU64, Ordering};
 #[cfg(windows)]
 use windows::{
-    Win32::Media::Audio::Endpoints::IAudioEndpointVolume,
+    Win32::Media::Audio::Endpoints::{IAudioEndpointVolume, IAudioMeterInformation},
     Win32::Media::Audio::{
         EDataFlow, ERole, IMMDeviceEnumerator, IMMNotificationClient, IMMNotificationClient_Impl,
         MMDeviceEnumerator, eConsole, eRender,
@@ -53,6 +53,8 @@ thread_local! {
     /// Cached audio endpoint volume interface - avoids recreating 3 COM objects per call.
     /// Invalidated on any COM error or when the default audio device changes.
     static CACHED_ENDPOINT: RefCell<Option<IAudioEndpointVolume>> = const { RefCell::new(None) };
+    /// Cached peak meter for the same device; invalidated alongside the endpoint.
+    static CACHED_METER: RefCell<Option<IAudioMeterInformation>> = const { RefCell::new(None) };
     /// The device-change generation this thread's cache was built against.
     static LAST_DEVICE_GEN: Cell<u64> = const { Cell::new(0) };
 }
@@ -227,6 +229,46 @@ fn invalidate_endpoint_cache() {
     CACHED_ENDPOINT.with(|cell| {
         *cell.borrow_mut() = None;
     });
+    CACHED_METER.with(|cell| {
+        *cell.borrow_mut() = None;
+    });
+}
+
+/// Get (or create and cache) the default render device's peak meter. None when
+/// there is no render device (e.g. every output disabled or unplugged).
+#[cfg(windows)]
+fn get_peak_meter() -> Option<IAudioMeterInformation> {
+    // Runs the device-change check and COM init; the meter shares its cache.
+    get_endpoint_volume()?;
+
+    CACHED_METER.with(|cell| {
+        if let Some(ref meter) = *cell.borrow() {
+            return Some(meter.clone());
+        }
+        unsafe {
+            let enumerator: IMMDeviceEnumerator =
+                CoCreateInstance(&MMDeviceEnumerator, None, CLSCTX_ALL).ok()?;
+            let device = enumerator.GetDefaultAudioEndpoint(eRender, eConsole).ok()?;
+            let meter: IAudioMeterInformation = device.Activate(CLSCTX_ALL, None).ok()?;
+            *cell.borrow_mut() = Some(meter.clone());
+            Some(meter)
+        }
+    })
+}
+
+/// Current master peak level of the default output (0-100): the loudest sample
+/// in the device's most recent processing period, after the volume slider.
+/// Returns None if there is no render device.
+#[cfg(windows)]
+pub fn get_peak() -> Option<f32> {
+    let meter = get_peak_meter()?;
+    match unsafe { meter.GetPeakValue() } {
+        Ok(peak) => Some(peak * 100.0),
+        Err(_) => {
+            invalidate_endpoint_cache();
+            None
+        }
+    }
 }
 
 /// Get current system volume (0-100)
@@ -0,0 +1,262 @@
+//! Signed commands (`command_auth`).
+//!
+//! Commands only run when they arrive on the agent's own topics, but anyone
+//! who can publish to the broker can publish there too. With
+//! `command_auth.hmac_key` set, a command from MQTT (all of them, or just
+//! those in `command_auth.commands`) must carry a signature:
+//!
+//! `{"payload": "<payload>", "ts": <unix seconds>, "sig": "<hex>"}`
+//!
+//! where `sig` is HMAC-SHA256 with the key over
+//! `<command>\n<ts>\n<reply_to>\n<correlation_id>\n<payload>`. `payload` must
+//! be a string (omitted = empty), so both ends sign the same bytes. `ts` must
+//! be within `max_skew_secs` of this PC's clock, and each signature is only
+//! accepted once, so a captured message can't be replayed. `reply_to` and
+//! `correlation_id` (a string or number) may sit alongside for the reply
+//! envelope; they are signed too (empty when absent), so a captured request
+//! can't be redirected to another reply topic. Commands dispatched locally
+//! (game hooks, `GameMode`) come from our own config and aren't checked.
+
+use anyhow::{anyhow, bail};
+use serde_json::Value;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+
+use crate::config::CommandAuthConfig;
+
+/// Signatures already accepted, so each one works only once.
+#[derive(Default)]
+pub(crate) struct CommandAuth {
+    /// Signature -> unix time after which its `ts` is out of range anyway.
+    seen: HashMap<[u8; 32], u64>,
+}
+
+impl CommandAuth {
+    /// The payload to run `name` with: `payload` unchanged when `name`
+    /// needn't be signed, else the verified inner payload (still wrapped
+    /// if it came with a `reply_to`). Err says why it was refused.
+    pub(crate) fn check(
+        &mut self,
+        name: &str,
+        payload: &str,
+        config: &CommandAuthConfig,
+        now: u64,
+    ) -> anyhow::Result<String> {
+        if !config.requires(name) {
+            return Ok(payload.to_string());
+        }
+        let Ok(Value::Object(mut msg)) = serde_json::from_str::<Value>(payload.trim()) else {
+            bail!("not signed");
+        };
+        let sig = match msg.remove("sig") {
+            Some(Value::String(s)) => decode_hex(&s).ok_or_else(|| anyhow!("malformed sig"))?,
+            _ => bail!("not signed"),
+        };
+        let ts = msg
+            .remove("ts")
+            .and_then(|v| v.as_u64())
+            .ok_or_else(|| anyhow!("missing ts"))?;
+        let inner = match msg.get("payload") {
+            None | Some(Value::Null) => String::new(),
+            Some(Value::String(s)) => s.clone(),
+            Some(_) => bail!("signed payload must be a string"),
+        };
+        let reply_to = match msg.get("reply_to") {
+            None | Some(Value::Null) => "",
+            Some(Value::String(s)) => s.as_str(),
+            Some(_) => bail!("signed reply_to must be a string"),
+        };
+        let correlation_id = match msg.get("correlation_id") {
+            None | Some(Value::Null) => String::new(),
+            Some(Value::String(s)) => s.clone(),
+            Some(n @ Value::Number(_)) => n.to_string(),
+            Some(_) => bail!("signed correlation_id must be a string or number"),
+        };
+
+        let skew = config.max_skew_secs();
+        if now.abs_diff(ts) > skew {
+            bail!("ts is more than {}s from this PC's clock", skew);
+        }
+        let signed = signed_bytes(name, ts, reply_to, &correlation_id, &inner);
+        let expected = hmac_sha256(config.hmac_key.as_bytes(), &signed);
+        // Compare every byte, so the time taken doesn't give away how much
+        // of a forged signature was right.
+        if expected
+            .iter()
+            .zip(&sig)
+            .fold(0, |acc, (a, b)| acc | (a ^ b))
+            != 0
+        {
+            bail!("bad signature");
+        }
+        self.seen.retain(|_, expires| *expires >= now);
+        if self.seen.insert(sig, ts + skew).is_some() {
+            bail!("signature already used");
+        }
+
+        Ok(if msg.contains_key("reply_to") {
+            Value::Object(msg).to_string()
+        } else {
+            inner
+        })
+    }
+}
+
+/// Seconds since the Unix epoch, as `check` wants it.
+pub(crate) fn unix_now() -> u64 {
+    std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .map_or(0, |d| d.as_secs())
+}
+
+/// What gets signed: `<command>\n<ts>\n<reply_to>\n<correlation_id>\n<payload>`.
+fn signed_bytes(
+    name: &str,
+    ts: u64,
+    reply_to: &str,
+    correlation_id: &str,
+    payload: &str,
+) -> Vec<u8> {
+    format!("{name}\n{ts}\n{reply_to}\n{correlation_id}\n{payload}").into_bytes()
+}
+
+/// HMAC-SHA256 (RFC 2104) on top of the sha2 crate the updater already uses.
+fn hmac_sha256(key: &[u8], msg: &[u8]) -> [u8; 32] {
+    const BLOCK: usize = 64;
+    let mut block = [0u8; BLOCK];
+    if key.len() > BLOCK {
+        block[..32].copy_from_slice(&Sha256::digest(key));
+    } else {
+        block[..key.len()].copy_from_slice(key);
+    }
+    let pad = |byte: u8| block.map(|b| b ^ byte);
+    let inner = Sha256::new()
+        .chain_update(pad(0x36))
+        .chain_update(msg)
+        .finalize();
+    let outer = Sha256::new()
+        .chain_update(pad(0x5c))
+        .chain_update(inner)
+        .finalize();
+    let mut out = [0u8; 32];
+    out.copy_from_slice(&outer);
+    out
+}
+
+/// 64 hex digits (either case) to 32 bytes.
+fn decode_hex(s: &str) -> Option<[u8; 32]> {
+    let s = s.trim().as_bytes();
+    if s.len() != 64 {
+        return None;
+    }
+    let mut out = [0u8; 32];
+    for (byte, pair) in out.iter_mut().zip(s.chunks_exact(2)) {
+        *byte = u8::from_str_radix(std::str::from_utf8(pair).ok()?, 16).ok()?;
+    }
+    Some(out)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const KEY: &str = "0123456789abcdef";
+    const NOW: u64 = 1_700_000_000;
+
+    fn config(commands: &[&str]) -> CommandAuthConfig {
+        CommandAuthConfig {
+            hmac_key: KEY.to_string(),
+            commands: commands.iter().map(|c| c.to_string()).collect(),
+            max_skew_secs: 0,
+        }
+    }
+
+    fn sign(name: &str, ts: u64, payload: &str) -> String {
+        sign_reply(name, ts, "", "", payload)
+    }
+
+    fn sign_reply(name: &str, ts: u64, reply_to: &str, id: &str, payload: &str) -> String {
+        hmac_sha256(
+            KEY.as_bytes(),
+            &signed_bytes(name, ts, reply_to, id, payload),
+        )
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect()
+    }
+
+    #[test]
+    fn test_hmac_sha256_rfc4231() {
+        // RFC 4231 test case 2.
+        let mac = hmac_sha256(b"Jefe", b"what do ya want for nothing?");
+        assert_eq!(
+            decode_hex("5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"),
+            Some(mac)
+        );
+    }
+
+    #[test]
+    fn test_signed_command_accepted_once() {
+        let mut auth = CommandAuth::default();
+        let cfg = config(&[]);
+        let msg = serde_json::json!({
+            "payload": "steam:730",
+            "ts": NOW - 5,
+            "sig": sign("Launch", NOW - 5, "steam:730"),
+        })
+        .to_string();
+        assert_eq!(auth.check("Launch", &msg, &cfg, NOW).unwrap(), "steam:730");
+        // The same message again is a replay.
+        assert!(auth.check("Launch", &msg, &cfg, NOW).is_err());
+        // Signed for a different command.
+        let msg = serde_json::json!({"ts": NOW, "sig": sign("Lock", NOW, "")}).to_string();
+        assert!(auth.check("Shutdown", &msg, &cfg, NOW).is_err());
+        assert!(auth.check("Lock", &msg, &cfg, NOW).is_ok());
+    }
+
+    #[test]
+    fn test_unsigned_stale_and_unlisted() {
+        let mut auth = CommandAuth::default();
+        let cfg = config(&["Shutdown"]);
+        assert!(auth.check("Shutdown", "PRESS", &cfg, NOW).is_err());
+        // Not in `commands`: passes through untouched.
+        assert_eq!(auth.check("Lock", "PRESS", &cfg, NOW).unwrap(), "PRESS");
+        let stale = serde_json::json!({"ts": NOW - 61, "sig": sign("Shutdown", NOW - 61, "")});
+        assert!(
+            auth.check("Shutdown", &stale.to_string(), &cfg, NOW)
+                .is_err()
+        );
+        // No key: nothing is checked.
+        let off = CommandAuthConfig::default();
+        assert_eq!(auth.check("Shutdown", "PRESS", &off, NOW).unwrap(), "PRESS");
+    }
+
+    #[test]
+    fn test_reply_envelope_kept() {
+        let mut auth = CommandAuth::default();
+        let msg = serde_json::json!({
+            "payload": "hi",
+            "reply_to": "tools/replies",
+            "correlation_id": 7,
+            "ts": NOW,
+            "sig": sign_reply("Echo", NOW, "tools/replies", "7", "hi"),
+        });
+        let out = auth
+            .check("Echo", &msg.to_string(), &config(&[]), NOW)
+            .unwrap();
+        let (payload, reply) =
+            crate::commands::reply::unwrap_envelope(&out, &crate::config::Config::default());
+        assert_eq!(payload, "hi");
+        assert!(reply.is_some());
+
+        // A captured request can't be pointed at another reply topic.
+        let mut redirected = msg;
+        redirected["reply_to"] = "attacker/replies".into();
+        redirected["ts"] = (NOW + 1).into();
+        redirected["sig"] = sign("Echo", NOW + 1, "hi").into();
+        assert!(
+            auth.check("Echo", &redirected.to_string(), &config(&[]), NOW)
+                .is_err()
+        );
+    }
+}
@@ -1,8 +1,14 @@
 //! Custom command execution - user-defined commands from config
+//!
+//! Commands are fire-and-forget unless they set `wait`: then the run blocks
+//! until the process exits (or is killed at `timeout_secs`) and a non-zero
+//! exit fails it, so a `reply_to` caller learns when it actually finished.
 #![allow(dead_code)] // Platform-specific execution
 
 use log::{debug, error, info};
+use std::process::Child;
 use std::sync::Arc;
+use std::time::{Duration, Instant};
 
 use crate::AppState;
 use crate::config::{CustomCommand, CustomCommandType};
@@ -15,6 +21,12 @@ use std::process::Command;
 #[cfg(windows)]
 const CREATE_NO_WINDOW: u32 = 0x08000000;
 
+/// Timeout for a `wait` command without `timeout_secs`.
+const DEFAULT_WAIT_TIMEOUT_SECS: u64 = 60;
+
+/// How often a `wait` command's exit status is checked.
+const WAIT_POLL: Duration = Duration::from_millis(100);
+
 /// Execute a custom command by name
 /// Returns Ok(true) if command was found and executed, Ok(false) if not found
 pub async fn execute_custom_command(state: &Arc<AppState>, name: &str) -> anyhow::Result<bool> {
@@ -45,7 +57,7 @@ pub async fn execute_custom_command(state: &Arc<AppState>, name: &str) -> anyhow
 
     drop(config); // Release lock before executing
 
-    info!("Executing custom command: {} (admin={})", name, cmd.admin);
+    info!(command = name; "Executing custom command: {} (admin={})", name, cmd.admin);
 
     // Execute based on type
     match cmd.command_type {
@@ -66,8 +78,10 @@ async fn execute_powershell(cmd: &CustomCommand) -> anyhow::Result<()> {
         .ok_or_else(|| anyhow::anyhow!("No script for powershell command"))?
         .clone();
     let admin = cmd.admin;
+    let wait = wait_timeout(cmd);
 
     tokio::task::spawn_blocking(move || {
+        let mut command = Command::new("powershell");
         if admin {
             // Run elevated via Start-Process -Verb RunAs
             // Use -EncodedCommand (base64-encoded UTF-16LE) to avoid metacharacter injection
@@ -78,19 +92,11 @@ async fn execute_powershell(cmd: &CustomCommand) -> anyhow::Result<()> {
                 "Start-Process powershell -Verb RunAs -ArgumentList '-NoProfile -EncodedCommand {}'",
                 encoded
             );
-
-            Command::new("powershell")
-                .args(["-NoProfile", "-Command", &ps_cmd])
-                .creation_flags(CREATE_NO_WINDOW)
-                .spawn()?;
+            command.args(["-NoProfile", "-Command", &elevated(ps_cmd, wait.is_some())]);
         } else {
-            Command::new("powershell")
-                .args(["-NoProfile", "-Command", &script])
-                .creation_flags(CREATE_NO_WINDOW)
-                .spawn()?;
+            command.args(["-NoProfile", "-Command", &script]);
         }
-
-        Ok::<_, anyhow::Error>(())
+        run(command, wait)
     })
     .await??;
 
@@ -112,9 +118,10 @@ async fn execute_executable(cmd: &CustomCommand) -> anyhow::Result<()> {
         .clone();
     let args = cmd.args.clone().unwrap_or_default();
     let admin = cmd.admin;
+    let wait = wait_timeout(cmd);
 
     tokio::task::spawn_blocking(move || {
-        if admin {
+        let command = if admin {
             // Run elevated via Start-Process -Verb RunAs.  Both `path` and
             // each arg go inside single-quoted PowerShell strings, so any
             // literal `'` in them would break out; double them per
@@ -132,18 +139,15 @@ async fn execute_executable(cmd: &CustomCommand) -> anyhow::Result<()> {
                 escaped_path, args_str
             );
 
-            Command::new("powershell")
-                .args(["-NoProfile", "-Command", &ps_cmd])
-                .creation_flags(CREATE_NO_WINDOW)
-                .spawn()?;
+            let mut command = Command::new("powershell");
+            command.args(["-NoProfile", "-Command", &elevated(ps_cmd, wait.is_some())]);
+            command
         } else {
-            Command::new(&path)
-                .args(&args)
-                .creation_flags(CREATE_NO_WINDOW)
-                .spawn()?;
-        }
-
-        Ok::<_, anyhow::Error>(())
+            let mut command = Command::new(&path);
+            command.args(&args);
+            command
+        };
+        run(command, wait)
     })
     .await??;
 
@@ -161,17 +165,18 @@ async fn execute_executable(cmd: &CustomCommand) -> anyhow::Result<()> {
         .clone();
     let args = cmd.args.clone().unwrap_or_default();
     let admin = cmd.admin;
+    let wait = wait_timeout(cmd);
 
     tokio::task::spawn_blocking(move || {
-        // .status() waits and reaps; .spawn() alone would leak zombies on
-        // Linux (Windows reaps via Child::drop, Linux doesn't).
-        if admin {
-            Command::new("sudo").arg(&path).args(&args).status()?;
+        let mut command = if admin {
+            let mut sudo = Command::new("sudo");
+            sudo.arg(&path);
+            sudo
         } else {
-            Command::new(&path).args(&args).status()?;
-        }
-
-        Ok::<_, anyhow::Error>(())
+            Command::new(&path)
+        };
+        command.args(&args);
+        run(command, wait)
     })
     .await??;
 
@@ -187,27 +192,25 @@ async fn execute_shell(cmd: &CustomCommand) -> anyhow::Result<()> {
         .ok_or_else(|| anyhow::anyhow!("No command for shell command"))?
         .clone();
     let admin = cmd.admin;
+    let wait = wait_timeout(cmd);
 
     tokio::task::spawn_blocking(move || {
-        if admin {
+        let process = if admin {
             let escaped = command.replace('\'', "''").replace('"', r#"\""#);
             let ps_cmd = format!(
                 "Start-Process cmd -Verb RunAs -ArgumentList '/c {}'",
                 escaped
             );
 
-            Command::new("powershell")
-                .args(["-NoProfile", "-Command", &ps_cmd])
-                .creation_flags(CREATE_NO_WINDOW)
-                .spawn()?;
+            let mut process = Command::new("powershell");
+            process.args(["-NoProfile", "-Command", &elevated(ps_cmd, wait.is_some())]);
+            process
         } else {
-            Command::new("cmd")
-                .args(["/c", &command])
-                .creation_flags(CREATE_NO_WINDOW)
-                .spawn()?;
-        }
-
-        Ok::<_, anyhow::Error>(())
+            let mut process = Command::new("cmd");
+            process.args(["/c", &command]);
+            process
+        };
+        run(process, wait)
     })
     .await??;
 
@@ -224,18 +227,142 @@ async fn execute_shell(cmd: &CustomCommand) -> anyhow::Result<()> {
         .ok_or_else(|| anyhow::anyhow!("No command for shell command"))?
         .clone();
     let admin = cmd.admin;
+    let wait = wait_timeout(cmd);
 
     tokio::task::spawn_blocking(move || {
-        // .status() waits and reaps; see execute_executable for details.
-        if admin {
-            Command::new("sudo").args(["sh", "-c", &command]).status()?;
+        let process = if admin {
+            let mut sudo = Command::new("sudo");
+            sudo.args(["sh", "-c", &command]);
+            sudo
         } else {
-            Command::new("sh").args(["-c", &command]).status()?;
-        }
-
-        Ok::<_, anyhow::Error>(())
+            let mut sh = Command::new("sh");
+            sh.args(["-c", &command]);
+            sh
+        };
+        run(process, wait)
     })
     .await??;
 
     Ok(())
 }
+
+/// The timeout to wait out, or `None` for a fire-and-forget command.
+fn wait_timeout(cmd: &CustomCommand) -> Option<Duration> {
+    cmd.wait
+        .then(|| Duration::from_secs(cmd.timeout_secs.unwrap_or(DEFAULT_WAIT_TIMEOUT_SECS)))
+}
+
+/// For a `wait` command, make the `Start-Process -Verb RunAs` line wait for
+/// the elevated process and pass its exit code on; PowerShell returns as soon
+/// as UAC has started it otherwise.
+fn elevated(start_process: String, wait: bool) -> String {
+    if wait {
+        format!("$p = {} -Wait -PassThru; exit $p.ExitCode", start_process)
+    } else {
+        start_process
+    }
+}
+
+/// Start `command`; with a timeout, block until it exits.
+#[cfg(windows)]
+fn run(mut command: Command, wait: Option<Duration>) -> anyhow::Result<()> {
+    let child = command.creation_flags(CREATE_NO_WINDOW).spawn()?;
+    match wait {
+        Some(timeout) => wait_for_exit(child, timeout),
+        None => Ok(()),
+    }
+}
+
+/// Start `command`; with a timeout, block until it exits.
+#[cfg(unix)]
+fn run(mut command: std::process::Command, wait: Option<Duration>) -> anyhow::Result<()> {
+    match wait {
+        Some(timeout) => wait_for_exit(command.spawn()?, timeout),
+        None => {
+            // .status() waits and reaps; .spawn() alone would leak zombies on
+            // Linux (Windows reaps via Child::drop, Linux doesn't).
+            command.status()?;
+            Ok(())
+        }
+    }
+}
+
+/// Wait for `child` to exit, killing it once `timeout` has passed. Only the
+/// direct child is killed; anything it started (`cmd /c`, `sh -c`) may
+/// outlive it.
+fn wait_for_exit(mut child: Child, timeout: Duration) -> anyhow::Result<()> {
+    let deadline = Instant::now() + timeout;
+    loop {
+        if let Some(status) = child.try_wait()? {
+            return check_exit(status.code());
+        }
+        if Instant::now() >= deadline {
+            let _ = child.kill();
+            let _ = child.wait();
+            anyhow::bail!("timed out after {}s", timeout.as_secs());
+        }
+        std::thread::sleep(WAIT_POLL);
+    }
+}
+
+/// Exit code 0 is success; no code at all means a signal ended it.
+fn check_exit(code: Option<i32>) -> anyhow::Result<()> {
+    match code {
+        Some(0) => Ok(()),
+        Some(code) => anyhow::bail!("exited with code {}", code),
+        None => anyhow::bail!("terminated by a signal"),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn command(wait: bool, timeout_secs: Option<u64>) -> CustomCommand {
+        CustomCommand {
+            name: "backup".to_string(),
+            command_type: CustomCommandType::Shell,
+            icon: None,
+            admin: false,
+            script: None,
+            path: None,
+            args: None,
+            command: Some("backup.bat".to_string()),
+            wait,
+            timeout_secs,
+        }
+    }
+
+    #[test]
+    fn test_wait_timeout() {
+        assert_eq!(wait_timeout(&command(false, Some(5))), None);
+        assert_eq!(
+            wait_timeout(&command(true, None)),
+            Some(Duration::from_secs(DEFAULT_WAIT_TIMEOUT_SECS))
+        );
+        assert_eq!(
+            wait_timeout(&command(true, Some(600))),
+            Some(Duration::from_secs(600))
+        );
+    }
+
+    #[test]
+    fn test_elevated() {
+        let start = "Start-Process cmd -Verb RunAs".to_string();
+        assert_eq!(elevated(start.clone(), false), start);
+        assert_eq!(
+            elevated(start, true),
+            "$p = Start-Process cmd -Verb RunAs -Wait -PassThru; exit $p.ExitCode"
+        );
+    }
+
+    #[test]
+    fn test_check_exit() {
+        assert!(check_exit(Some(0)).is_ok());
+        assert_eq!(
+            check_exit(Some(2)).unwrap_err().to_string(),
+            "exited with code 2"
+        );
+        assert!(check_exit(None).is_err());
+    }
+}
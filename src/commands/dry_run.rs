@@ -41,6 +41,7 @@ async fn resolve_action(name: &str, payload: &str, state: &Arc<AppState>) -> Str
             format!("keybind:{keybind}")
         }
         "Wake" => "native:wake".to_string(),
+        "ResetIdle" => "native:reset_idle".to_string(),
         "Lock" => "native:lock".to_string(),
         "Shutdown" => "native:shutdown".to_string(),
         "Sleep" => "native:sleep".to_string(),
@@ -49,9 +50,21 @@ async fn resolve_action(name: &str, payload: &str, state: &Arc<AppState>) -> Str
         "Logoff" => "native:logoff".to_string(),
         "MonitorOff" => "native:monitor_off".to_string(),
         "MonitorOn" => "native:monitor_on".to_string(),
+        "MonitorStandby" => "native:monitor_standby".to_string(),
         "CloseGame" => "native:close_game".to_string(),
+        "SetPriority" => format!("native:set_priority:{payload}"),
+        "ServiceControl" => format!("native:service_control:{payload}"),
+        "ReadRegistry" => format!("native:read_registry:{payload}"),
+        "MoveWindow" => format!("native:move_window:{payload}"),
+        "FocusWindow" => format!("native:focus_window:{payload}"),
+        "MouseMove" => format!("native:mouse_move:{payload}"),
+        "MouseClick" => format!("native:mouse_click:{payload}"),
+        "RestartExplorer" => "native:restart_explorer".to_string(),
         "Screensaver" => "native:screensaver".to_string(),
         "RefreshSteamGames" => "native:refresh_steam_games".to_string(),
+        "CheckUpdate" => "native:check_update".to_string(),
+        "Echo" => format!("native:echo:{payload}"),
+        "SelfTest" => "native:self_test".to_string(),
         "MediaPlayPause" => "media:play_pause".to_string(),
         "MediaNext" => "media:next".to_string(),
         "MediaPrevious" => "media:previous".to_string(),
@@ -65,6 +78,22 @@ async fn resolve_action(name: &str, payload: &str, state: &Arc<AppState>) -> Str
                 format!("volume:mute:{mute}")
             }
         }
+        "Mute" => match crate::commands::switch::SwitchAction::parse(payload) {
+            Some(action) => format!("switch:mute:{action:?}").to_lowercase(),
+            None => "switch:mute:invalid".to_string(),
+        },
+        "NightLight" => match crate::commands::switch::SwitchAction::parse(payload) {
+            Some(action) => format!("switch:night_light:{action:?}").to_lowercase(),
+            None => "switch:night_light:invalid".to_string(),
+        },
+        "KeepAwake" => match crate::commands::switch::SwitchAction::parse(payload) {
+            Some(action) => format!("switch:keep_awake:{action:?}").to_lowercase(),
+            None => "switch:keep_awake:invalid".to_string(),
+        },
+        "GameMode" => match crate::commands::switch::SwitchAction::parse(payload) {
+            Some(action) => format!("switch:game_mode:{action:?}").to_lowercase(),
+            None => "switch:game_mode:invalid".to_string(),
+        },
         "notification" => format!("notification:{payload}"),
         _ => {
             // Config-defined custom command takes priority over shell resolution,
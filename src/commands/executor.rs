@@ -4,15 +4,19 @@ use log::{debug, error, info, warn};
 use std::os::windows::process::CommandExt;
 use std::process::Command;
 use std::sync::Arc;
-use tokio::sync::{Semaphore, broadcast};
+use std::time::Instant;
+use tokio::sync::broadcast;
 
+use super::auth::{CommandAuth, unix_now};
 use super::custom::execute_custom_command;
 use super::launcher::expand_launcher_shortcut;
+use super::rate_limit::CommandRateLimiter;
+use super::reply::unwrap_envelope;
 use crate::AppState;
 use crate::audio::{self, MediaKey};
 use crate::mqtt::CommandReceiver;
 use crate::notification;
-use crate::power::{monitor_off, wake_display};
+use crate::power::{dismiss_screensaver, monitor_off, monitor_standby, reset_idle, wake_display};
 use crate::steam::SteamGameDiscovery;
 
 /// Maximum time to wait for Steam to appear in the process list (seconds).
@@ -26,7 +30,6 @@ const STEAM_WAIT_TIMEOUT_SECS: u64 = 90;
 const STEAM_INIT_DELAY_SECS: u64 = 12;
 
 const CREATE_NO_WINDOW: u32 = 0x08000000;
-const MAX_CONCURRENT_COMMANDS: usize = 5;
 
 /// Predefined commands
 fn get_predefined_command(name: &str) -> Option<&'static str> {
@@ -34,8 +37,8 @@ fn get_predefined_command(name: &str) -> Option<&'static str> {
         "Screensaver" => Some(r#"%windir%\System32\scrnsave.scr /s"#),
         // These are handled natively in execute_command
         "Wake" | "Lock" | "Hibernate" | "Restart" | "Shutdown" | "Sleep" | "Logoff"
-        | "MonitorOff" | "MonitorOn" | "CloseGame" | "VolumeSet" | "VolumeMute"
-        | "MediaPlayPause" | "MediaNext" | "MediaPrevious" | "MediaStop" => None,
+        | "MonitorOff" | "MonitorOn" | "MonitorStandby" | "CloseGame" | "VolumeSet"
+        | "VolumeMute" | "MediaPlayPause" | "MediaNext" | "MediaPrevious" | "MediaStop" => None,
         _ => None,
     }
 }
@@ -43,7 +46,8 @@ fn get_predefined_command(name: &str) -> Option<&'static str> {
 pub struct CommandExecutor {
     state: Arc<AppState>,
     command_rx: CommandReceiver,
-    semaphore: Arc<Semaphore>,
+    rate_limiter: CommandRateLimiter,
+    auth: CommandAuth,
 }
 
 impl CommandExecutor {
@@ -51,7 +55,8 @@ impl CommandExecutor {
         Self {
             state,
             command_rx,
-            semaphore: Arc::new(Semaphore::new(MAX_CONCURRENT_COMMANDS)),
+            rate_limiter: CommandRateLimiter::default(),
+            auth: CommandAuth::default(),
         }
     }
 
@@ -66,11 +71,57 @@ impl CommandExecutor {
                     break;
                 }
                 Some(cmd) = self.command_rx.recv() => {
-                    // Rate limit with semaphore
-                    let permit = match self.semaphore.clone().try_acquire_owned() {
-                        Ok(p) => p,
-                        Err(_) => {
+                    // Signature check (see commands::auth) before anything
+                    // acts on the payload; a refused command gets no reply,
+                    // since its reply_to is as untrusted as the rest.
+                    let raw = if cmd.local {
+                        cmd.payload.clone()
+                    } else {
+                        let config = self.state.config.read().await;
+                        let checked =
+                            self.auth.check(&cmd.name, &cmd.payload, &config.command_auth, unix_now());
+                        drop(config);
+                        match checked {
+                            Ok(raw) => raw,
+                            Err(e) => {
+                                warn!(command = cmd.name.as_str(); "Rejected command '{}': {}", cmd.name, e);
+                                continue;
+                            }
+                        }
+                    };
+                    let config = self.state.config.read().await;
+                    let (payload, reply) = unwrap_envelope(&raw, &config);
+                    drop(config);
+                    // An envelope's inner payload is passed on as sent.
+                    let from_button = cmd.from_button && reply.is_none();
+
+                    // Per-command budget first, so a command dropped here doesn't
+                    // briefly hold a concurrency slot.
+                    let limit = self.state.config.read().await.rate_limit_for(&cmd.name);
+                    if let Some(limit) = limit
+                        && !self.rate_limiter.try_acquire(&cmd.name, limit, Instant::now())
+                    {
+                        warn!(
+                            "Command '{}' over its rate limit ({} per {}s), dropping",
+                            cmd.name, limit.max, limit.per_secs
+                        );
+                        self.state.command_slots.note_rate_limited();
+                        if let Some(reply) = &reply {
+                            let dropped = Err(anyhow::anyhow!("rate limited"));
+                            reply.send(&self.state.mqtt, &cmd.name, &dropped).await;
+                        }
+                        continue;
+                    }
+
+                    // Concurrency cap (see commands::slots)
+                    let permit = match self.state.command_slots.try_acquire() {
+                        Some(p) => p,
+                        None => {
                             warn!("Command rate limited, dropping: {}", cmd.name);
+                            if let Some(reply) = &reply {
+                                let dropped = Err(anyhow::anyhow!("too many commands running"));
+                                reply.send(&self.state.mqtt, &cmd.name, &dropped).await;
+                            }
                             continue;
                         }
                     };
@@ -78,9 +129,24 @@ impl CommandExecutor {
                     let state = Arc::clone(&self.state);
                     tokio::spawn(async move {
                         let _permit = permit; // Keep permit alive until done
-                        if let Err(e) = Self::execute_command(&cmd.name, &cmd.payload, &state).await {
+                        // ReadRegistry, Echo and SelfTest have a result to reply with.
+                        let outcome = if cmd.name == "ReadRegistry" {
+                            crate::commands::registry::run(&payload, &state).await
+                        } else if cmd.name == "Echo" {
+                            crate::commands::echo(&payload, &state).await
+                        } else if cmd.name == "SelfTest" {
+                            crate::commands::selftest::run(&state).await
+                        } else {
+                            Self::execute_command(&cmd.name, &payload, from_button, &state)
+                                .await
+                                .map(|()| serde_json::Value::Null)
+                        };
+                        if let Err(e) = &outcome {
                             error!("Command error: {}", e);
                         }
+                        if let Some(reply) = reply {
+                            reply.send(&state.mqtt, &cmd.name, &outcome).await;
+                        }
                     });
                 }
             }
@@ -90,17 +156,18 @@ impl CommandExecutor {
     async fn execute_command(
         name: &str,
         payload: &str,
+        from_button: bool,
         state: &Arc<AppState>,
     ) -> anyhow::Result<()> {
-        // Normalize payload
-        let payload = payload.trim();
-        let payload = if payload.eq_ignore_ascii_case("PRESS") {
-            ""
+        // Normalize payload: HA's button PRESS is blanked only for button
+        // presses, so custom subscriptions and local dispatches keep "press".
+        let payload = if from_button {
+            crate::commands::normalize_payload(payload, &state.config.read().await.button_payloads)
         } else {
-            payload
+            payload.trim()
         };
 
-        info!("Executing command: {} (payload: {:?})", name, payload);
+        info!(command = name; "Executing command: {} (payload: {:?})", name, payload);
 
         // Dry-run: report what the command would do to the test topic, but
         // perform no OS side effect. Lets the test kit exercise every command
@@ -118,6 +185,10 @@ impl CommandExecutor {
             return Ok(());
         }
 
+        if crate::commands::switch::is_switch(name) {
+            return crate::commands::switch::run(name, payload, state).await;
+        }
+
         match name {
             // Discord: Leave the current voice channel by simulating a keybind
             // (default: Ctrl+F6, Discord's "Disconnect from Voice Channel").
@@ -139,7 +210,16 @@ impl CommandExecutor {
                 // wake_display broadcasts SendMessageW, which blocks until every
                 // top-level window responds; keep it off the single-threaded
                 // runtime (same as MonitorOff/MonitorOn below).
-                tokio::task::spawn_blocking(wake_display);
+                if state.config.read().await.wake_turns_on_display {
+                    tokio::task::spawn_blocking(wake_display);
+                } else {
+                    tokio::task::spawn_blocking(dismiss_screensaver);
+                }
+                return Ok(());
+            }
+            "ResetIdle" => {
+                // SendInput sleeps between key-down and key-up; keep it off the runtime.
+                tokio::task::spawn_blocking(reset_idle);
                 return Ok(());
             }
             "notification" => {
@@ -160,7 +240,11 @@ impl CommandExecutor {
                 return Ok(());
             }
             "Shutdown" => {
-                shutdown();
+                crate::commands::announce_shutdown(state).await;
+                if let Err(e) = shutdown() {
+                    crate::commands::cancel_shutdown_announcement(state).await;
+                    anyhow::bail!("ExitWindowsEx refused the shutdown: {}", e);
+                }
                 return Ok(());
             }
             "Sleep" => {
@@ -204,6 +288,10 @@ impl CommandExecutor {
                 tokio::task::spawn_blocking(monitor_off);
                 return Ok(());
             }
+            "MonitorStandby" => {
+                tokio::task::spawn_blocking(monitor_standby);
+                return Ok(());
+            }
             "MonitorOn" => {
                 // Monitor-on is the display wake sequence (process scan +
                 // broadcast + sleep); offload it too.
@@ -214,6 +302,60 @@ impl CommandExecutor {
                 close_running_games(state).await;
                 return Ok(());
             }
+            "SetPriority" => {
+                let (process, class) = crate::commands::priority::parse_payload(payload)?;
+                let changed = tokio::task::spawn_blocking(move || {
+                    crate::commands::priority::set_priority(&process, class)
+                })
+                .await??;
+                info!("Priority set to {:?} on {} process(es)", class, changed);
+                return Ok(());
+            }
+            "ServiceControl" => {
+                let allowed = state.config.read().await.controllable_services.clone();
+                let (service, action) = crate::commands::service::parse_payload(payload, &allowed)?;
+                info!("ServiceControl: {} '{}'", action.as_str(), service);
+                tokio::task::spawn_blocking(move || {
+                    crate::commands::service::control(&service, action)
+                })
+                .await??;
+                return Ok(());
+            }
+            "MoveWindow" => {
+                let req = crate::commands::window::parse_payload(payload)?;
+                info!(
+                    "MoveWindow: '{}' to {},{} {}x{}",
+                    req.process, req.x, req.y, req.w, req.h
+                );
+                tokio::task::spawn_blocking(move || crate::commands::window::move_window(&req))
+                    .await??;
+                return Ok(());
+            }
+            "FocusWindow" => {
+                let process = crate::commands::parse_process_name(payload)?;
+                info!("FocusWindow: '{}'", process);
+                tokio::task::spawn_blocking(move || {
+                    crate::commands::window::focus_window(&process)
+                })
+                .await??;
+                return Ok(());
+            }
+            "MouseMove" | "MouseClick" => {
+                let is_move = name == "MouseMove";
+                let req = crate::commands::mouse::parse_payload(payload, is_move)?;
+                info!("{}: {:?}", name, req);
+                tokio::task::spawn_blocking(move || match req.position() {
+                    Some((x, y)) if is_move => crate::commands::mouse::move_cursor(x, y),
+                    _ => crate::commands::mouse::click(&req),
+                })
+                .await??;
+                return Ok(());
+            }
+            "RestartExplorer" => {
+                // Polls for up to half a minute waiting on the new shell.
+                tokio::task::spawn_blocking(crate::commands::explorer::restart).await??;
+                return Ok(());
+            }
             "VolumeSet" => {
                 if let Ok(level) = payload.parse::<f32>() {
                     tokio::task::spawn_blocking(move || audio::set_volume(level));
@@ -249,6 +391,10 @@ impl CommandExecutor {
                 tokio::task::spawn_blocking(|| audio::send_media_key(MediaKey::Stop));
                 return Ok(());
             }
+            "CheckUpdate" => {
+                crate::commands::check_update(state).await?;
+                return Ok(());
+            }
             "RefreshSteamGames" => {
                 info!("Refreshing Steam game library...");
                 match SteamGameDiscovery::discover_async().await {
@@ -596,18 +742,18 @@ pub(crate) fn resolve_command_action(
     payload: &str,
     allow_raw_commands: bool,
 ) -> CommandAction {
-    // Normalize payload (same as execute_command)
-    let payload = payload.trim();
-    let payload = if payload.eq_ignore_ascii_case("PRESS") {
-        ""
-    } else {
-        payload
-    };
+    // Normalize payload (as execute_command does for a button press, default
+    // button_payloads)
+    let payload = crate::commands::normalize_payload(
+        payload,
+        &crate::config::Config::default().button_payloads,
+    );
 
     // Native commands
     match name {
         "DiscordLeaveChannel" => return CommandAction::Native("DiscordLeaveChannel"),
         "Wake" => return CommandAction::Native("Wake"),
+        "ResetIdle" => return CommandAction::Native("ResetIdle"),
         "Lock" => return CommandAction::Native("Lock"),
         "Shutdown" => return CommandAction::Native("Shutdown"),
         "Sleep" => return CommandAction::Native("Sleep"),
@@ -616,6 +762,7 @@ pub(crate) fn resolve_command_action(
         "Logoff" => return CommandAction::Native("Logoff"),
         "MonitorOff" => return CommandAction::Native("MonitorOff"),
         "MonitorOn" => return CommandAction::Native("MonitorOn"),
+        "MonitorStandby" => return CommandAction::Native("MonitorStandby"),
         "CloseGame" => return CommandAction::Native("CloseGame"),
         "notification" => {
             if payload.is_empty() {
@@ -886,7 +1033,7 @@ fn lock_workstation() {
 }
 
 /// Shutdown system (native, no PowerShell)
-fn shutdown() {
+fn shutdown() -> windows::core::Result<()> {
     use windows::Win32::Foundation::{HANDLE, LUID};
     use windows::Win32::Security::{
         AdjustTokenPrivileges, LUID_AND_ATTRIBUTES, LookupPrivilegeValueW, SE_PRIVILEGE_ENABLED,
@@ -921,16 +1068,34 @@ fn shutdown() {
             }
         }
 
-        let _ = ExitWindowsEx(EWX_SHUTDOWN | EWX_POWEROFF, SHUTDOWN_REASON(0));
+        ExitWindowsEx(EWX_SHUTDOWN | EWX_POWEROFF, SHUTDOWN_REASON(0))
     }
 }
 
-/// Log off the current user session (native, no PowerShell).
-/// EWX_LOGOFF needs no special privilege, unlike shutdown/restart.
+/// Log off the interactive user session (native, no PowerShell).
+/// EWX_LOGOFF needs no special privilege, unlike shutdown/restart, but it
+/// only ever logs off the caller's own session: run as a service (session 0)
+/// it would do nothing, so there the console session is logged off via WTS.
 fn logoff() {
+    use windows::Win32::System::RemoteDesktop::{
+        WTS_CURRENT_SERVER_HANDLE, WTSGetActiveConsoleSessionId, WTSLogoffSession,
+    };
     use windows::Win32::System::Shutdown::{EWX_LOGOFF, ExitWindowsEx, SHUTDOWN_REASON};
+
     unsafe {
-        let _ = ExitWindowsEx(EWX_LOGOFF, SHUTDOWN_REASON(0));
+        if !crate::proclist::in_session_0() {
+            let _ = ExitWindowsEx(EWX_LOGOFF, SHUTDOWN_REASON(0));
+            return;
+        }
+        // 0xFFFFFFFF: nobody at the console (e.g. mid-switch).
+        let console = WTSGetActiveConsoleSessionId();
+        if console == u32::MAX {
+            warn!("Logoff: no active console session");
+            return;
+        }
+        if let Err(e) = WTSLogoffSession(WTS_CURRENT_SERVER_HANDLE, console, false) {
+            warn!("Logoff: WTSLogoffSession({}) failed: {}", console, e);
+        }
     }
 }
 
@@ -1457,6 +1622,14 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_action_reset_idle() {
+        assert_eq!(
+            resolve_command_action("ResetIdle", "PRESS", false),
+            CommandAction::Native("ResetIdle")
+        );
+    }
+
     #[test]
     fn test_action_lock() {
         assert_eq!(
@@ -4,19 +4,21 @@ use log::{debug, error, info, warn};
 use std::os::unix::process::CommandExt;
 use std::process::Command;
 use std::sync::Arc;
-use tokio::sync::Semaphore;
+use std::time::Instant;
 
+use super::auth::{CommandAuth, unix_now};
 use super::custom::execute_custom_command;
 use super::launcher_linux::expand_launcher_shortcut;
+use super::rate_limit::CommandRateLimiter;
+use super::reply::unwrap_envelope;
 use crate::AppState;
 use crate::audio::{self, MediaKey};
 use crate::mqtt::CommandReceiver;
 use crate::notification;
-use crate::power::sync_mqtt::{SyncMqttConfig, parse_broker_url, sync_mqtt_publish_sleep};
-use crate::power::{monitor_off, wake_display};
+use crate::power::sync_mqtt::{SyncMqttConfig, sync_mqtt_publish_sleep};
+use crate::power::{dismiss_screensaver, monitor_off, monitor_standby, reset_idle, wake_display};
 use crate::steam::SteamGameDiscovery;
 
-const MAX_CONCURRENT_COMMANDS: usize = 5;
 /// How long to wait for Steam to come up before launching anyway.
 const STEAM_WAIT_TIMEOUT_SECS: u64 = 90;
 /// Grace period after Steam appears, for it to finish initializing.
@@ -26,7 +28,8 @@ const STEAM_INIT_DELAY_SECS: u64 = 12;
 fn get_predefined_command(name: &str) -> Option<&'static str> {
     match name {
         "Screensaver" => Some("xdg-screensaver activate"),
-        "Wake" | "Sleep" | "Hibernate" | "MonitorOff" | "MonitorOn" | "CloseGame" => None, // Handled natively
+        "Wake" | "Sleep" | "Hibernate" | "MonitorOff" | "MonitorOn" | "MonitorStandby"
+        | "CloseGame" => None, // Handled natively
         "Shutdown" => Some("systemctl poweroff"),
         "Lock" => Some("loginctl lock-session"),
         "Restart" => Some("systemctl reboot"),
@@ -38,7 +41,8 @@ fn get_predefined_command(name: &str) -> Option<&'static str> {
 pub struct CommandExecutor {
     state: Arc<AppState>,
     command_rx: CommandReceiver,
-    semaphore: Arc<Semaphore>,
+    rate_limiter: CommandRateLimiter,
+    auth: CommandAuth,
 }
 
 impl CommandExecutor {
@@ -46,7 +50,8 @@ impl CommandExecutor {
         Self {
             state,
             command_rx,
-            semaphore: Arc::new(Semaphore::new(MAX_CONCURRENT_COMMANDS)),
+            rate_limiter: CommandRateLimiter::default(),
+            auth: CommandAuth::default(),
         }
     }
 
@@ -61,11 +66,57 @@ impl CommandExecutor {
                     break;
                 }
                 Some(cmd) = self.command_rx.recv() => {
-                    // Rate limit with semaphore
-                    let permit = match self.semaphore.clone().try_acquire_owned() {
-                        Ok(p) => p,
-                        Err(_) => {
+                    // Signature check (see commands::auth) before anything
+                    // acts on the payload; a refused command gets no reply,
+                    // since its reply_to is as untrusted as the rest.
+                    let raw = if cmd.local {
+                        cmd.payload.clone()
+                    } else {
+                        let config = self.state.config.read().await;
+                        let checked =
+                            self.auth.check(&cmd.name, &cmd.payload, &config.command_auth, unix_now());
+                        drop(config);
+                        match checked {
+                            Ok(raw) => raw,
+                            Err(e) => {
+                                warn!(command = cmd.name.as_str(); "Rejected command '{}': {}", cmd.name, e);
+                                continue;
+                            }
+                        }
+                    };
+                    let config = self.state.config.read().await;
+                    let (payload, reply) = unwrap_envelope(&raw, &config);
+                    drop(config);
+                    // An envelope's inner payload is passed on as sent.
+                    let from_button = cmd.from_button && reply.is_none();
+
+                    // Per-command budget first, so a command dropped here doesn't
+                    // briefly hold a concurrency slot.
+                    let limit = self.state.config.read().await.rate_limit_for(&cmd.name);
+                    if let Some(limit) = limit
+                        && !self.rate_limiter.try_acquire(&cmd.name, limit, Instant::now())
+                    {
+                        warn!(
+                            "Command '{}' over its rate limit ({} per {}s), dropping",
+                            cmd.name, limit.max, limit.per_secs
+                        );
+                        self.state.command_slots.note_rate_limited();
+                        if let Some(reply) = &reply {
+                            let dropped = Err(anyhow::anyhow!("rate limited"));
+                            reply.send(&self.state.mqtt, &cmd.name, &dropped).await;
+                        }
+                        continue;
+                    }
+
+                    // Concurrency cap (see commands::slots)
+                    let permit = match self.state.command_slots.try_acquire() {
+                        Some(p) => p,
+                        None => {
                             warn!("Command rate limited, dropping: {}", cmd.name);
+                            if let Some(reply) = &reply {
+                                let dropped = Err(anyhow::anyhow!("too many commands running"));
+                                reply.send(&self.state.mqtt, &cmd.name, &dropped).await;
+                            }
                             continue;
                         }
                     };
@@ -73,9 +124,24 @@ impl CommandExecutor {
                     let state_clone = self.state.clone();
                     tokio::spawn(async move {
                         let _permit = permit;
-                        if let Err(e) = Self::execute_command(&cmd.name, &cmd.payload, &state_clone).await {
+                        // ReadRegistry, Echo and SelfTest have a result to reply with.
+                        let outcome = if cmd.name == "ReadRegistry" {
+                            crate::commands::registry::run(&payload, &state_clone).await
+                        } else if cmd.name == "Echo" {
+                            crate::commands::echo(&payload, &state_clone).await
+                        } else if cmd.name == "SelfTest" {
+                            crate::commands::selftest::run(&state_clone).await
+                        } else {
+                            Self::execute_command(&cmd.name, &payload, from_button, &state_clone)
+                                .await
+                                .map(|()| serde_json::Value::Null)
+                        };
+                        if let Err(e) = &outcome {
                             error!("Command error: {}", e);
                         }
+                        if let Some(reply) = reply {
+                            reply.send(&state_clone.mqtt, &cmd.name, &outcome).await;
+                        }
                     });
                 }
             }
@@ -85,16 +151,17 @@ impl CommandExecutor {
     async fn execute_command(
         name: &str,
         payload: &str,
+        from_button: bool,
         state: &Arc<AppState>,
     ) -> anyhow::Result<()> {
-        let payload = payload.trim();
-        let payload = if payload.eq_ignore_ascii_case("PRESS") {
-            ""
+        // HA's button PRESS is blanked only for button presses (see executor.rs).
+        let payload = if from_button {
+            crate::commands::normalize_payload(payload, &state.config.read().await.button_payloads)
         } else {
-            payload
+            payload.trim()
         };
 
-        info!("Executing command: {} (payload: {:?})", name, payload);
+        info!(command = name; "Executing command: {} (payload: {:?})", name, payload);
 
         // Dry-run: report what the command would do to the test topic, but
         // perform no OS side effect. Shares the canonical resolver with the
@@ -112,6 +179,33 @@ impl CommandExecutor {
             return Ok(());
         }
 
+        if crate::commands::switch::is_switch(name) {
+            return crate::commands::switch::run(name, payload, state).await;
+        }
+
+        // Shutdown is the predefined `systemctl poweroff`, run here after the
+        // sleep_state announcement (and optional grace countdown) and waited on,
+        // so a refused poweroff (polkit, an inhibitor) clears the announcement.
+        if name == "Shutdown" {
+            crate::commands::announce_shutdown(state).await;
+            let cmd = get_predefined_command(name).unwrap_or("systemctl poweroff");
+            let status = tokio::task::spawn_blocking(move || {
+                Command::new("bash").args(["-c", cmd]).status()
+            })
+            .await?;
+            match status {
+                Ok(s) if s.success() => return Ok(()),
+                Ok(s) => {
+                    crate::commands::cancel_shutdown_announcement(state).await;
+                    anyhow::bail!("'{}' exited with {}", cmd, s);
+                }
+                Err(e) => {
+                    crate::commands::cancel_shutdown_announcement(state).await;
+                    return Err(e.into());
+                }
+            }
+        }
+
         // ── Native commands (no shell needed) ──────────────────────────
         match name {
             "DiscordLeaveChannel" => {
@@ -130,28 +224,22 @@ impl CommandExecutor {
             "Wake" => {
                 // wake_display spawns and waits on xdotool/xset/dbus-send; keep
                 // it off the single-threaded runtime.
-                tokio::task::spawn_blocking(wake_display);
+                if state.config.read().await.wake_turns_on_display {
+                    tokio::task::spawn_blocking(wake_display);
+                } else {
+                    tokio::task::spawn_blocking(dismiss_screensaver);
+                }
+                return Ok(());
+            }
+            "ResetIdle" => {
+                // xdotool/dbus-send are waited on; keep it off the runtime.
+                tokio::task::spawn_blocking(reset_idle);
                 return Ok(());
             }
             "Sleep" | "Hibernate" => {
                 // Pre-publish sleep state via sync TCP before the NIC goes down,
                 // matching the Windows behavior in power/events.rs.
-                let cfg = {
-                    let config = state.config.read().await;
-                    let (host, port, use_tls) = parse_broker_url(&config.mqtt.broker);
-                    SyncMqttConfig {
-                        host,
-                        port,
-                        use_tls,
-                        user: config.mqtt.user.clone(),
-                        pass: config.mqtt.pass.clone(),
-                        client_id: format!("{}-sleep", config.client_id()),
-                        sleep_topic: format!(
-                            "homeassistant/sensor/{}/sleep_state/state",
-                            config.device_name
-                        ),
-                    }
-                };
+                let cfg = SyncMqttConfig::from_config(&*state.config.read().await);
                 // Off the runtime: a broker connect timeout would otherwise stall
                 // the single-threaded runtime.
                 match tokio::task::spawn_blocking(move || sync_mqtt_publish_sleep(&cfg)).await {
@@ -183,6 +271,10 @@ impl CommandExecutor {
                 tokio::task::spawn_blocking(monitor_off);
                 return Ok(());
             }
+            "MonitorStandby" => {
+                tokio::task::spawn_blocking(monitor_standby);
+                return Ok(());
+            }
             "MonitorOn" => {
                 tokio::task::spawn_blocking(wake_display);
                 return Ok(());
@@ -191,6 +283,41 @@ impl CommandExecutor {
                 close_running_games(state).await;
                 return Ok(());
             }
+            "SetPriority" => {
+                let (process, class) = crate::commands::priority::parse_payload(payload)?;
+                let changed = tokio::task::spawn_blocking(move || {
+                    crate::commands::priority::set_priority(&process, class)
+                })
+                .await??;
+                info!("Priority set to {:?} on {} process(es)", class, changed);
+                return Ok(());
+            }
+            "ServiceControl" => {
+                let allowed = state.config.read().await.controllable_services.clone();
+                let (service, action) = crate::commands::service::parse_payload(payload, &allowed)?;
+                info!("ServiceControl: {} '{}'", action.as_str(), service);
+                tokio::task::spawn_blocking(move || {
+                    crate::commands::service::control(&service, action)
+                })
+                .await??;
+                return Ok(());
+            }
+            "MoveWindow" => {
+                // Validate anyway so a bad payload reads as such in the log.
+                crate::commands::window::parse_payload(payload)?;
+                anyhow::bail!("MoveWindow is only supported on Windows");
+            }
+            "FocusWindow" => {
+                crate::commands::parse_process_name(payload)?;
+                anyhow::bail!("FocusWindow is only supported on Windows");
+            }
+            "MouseMove" | "MouseClick" => {
+                crate::commands::mouse::parse_payload(payload, name == "MouseMove")?;
+                anyhow::bail!("{} is only supported on Windows", name);
+            }
+            "RestartExplorer" => {
+                anyhow::bail!("RestartExplorer is only supported on Windows");
+            }
             "notification" => {
                 if !payload.is_empty() {
                     // notify-send/gdbus .status() block; keep them off the runtime.
@@ -234,6 +361,10 @@ impl CommandExecutor {
                 tokio::task::spawn_blocking(|| audio::send_media_key(MediaKey::Stop));
                 return Ok(());
             }
+            "CheckUpdate" => {
+                crate::commands::check_update(state).await?;
+                return Ok(());
+            }
             "RefreshSteamGames" => {
                 info!("Refreshing Steam game library...");
                 match SteamGameDiscovery::discover_async().await {
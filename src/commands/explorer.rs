@@ -0,0 +1,113 @@
+//! `RestartExplorer` command - bring back a hung taskbar and desktop shell.
+//!
+//! Ends every `explorer.exe` in the agent's own session (another signed-in
+//! user's shell is left alone), then waits for the taskbar window to come
+//! back. Winlogon normally relaunches the shell by itself; if it hasn't
+//! within `RELAUNCH_WAIT` the agent starts `explorer.exe`, so the desktop is
+//! never left without one. The command fails if the taskbar still isn't back
+//! after `SHELL_WAIT`. Windows only, and not from session 0: a service can't
+//! see or start the user's shell.
+#![cfg_attr(not(windows), allow(dead_code))]
+
+use std::time::{Duration, Instant};
+
+const EXPLORER: &str = "explorer.exe";
+/// How long ended shells get to actually exit.
+const EXIT_WAIT: Duration = Duration::from_secs(5);
+/// How long Windows gets to relaunch the shell before we start it.
+const RELAUNCH_WAIT: Duration = Duration::from_secs(5);
+/// How long the taskbar gets to appear once a shell is starting.
+const SHELL_WAIT: Duration = Duration::from_secs(20);
+const POLL: Duration = Duration::from_millis(250);
+
+/// Poll `done` every `POLL` until it holds or `timeout` passes.
+fn wait_for(timeout: Duration, mut done: impl FnMut() -> bool) -> bool {
+    let deadline = Instant::now() + timeout;
+    loop {
+        if done() {
+            return true;
+        }
+        if Instant::now() >= deadline {
+            return false;
+        }
+        std::thread::sleep(POLL);
+    }
+}
+
+/// Restart the shell and wait for the taskbar. Blocks for up to half a
+/// minute; run it off the runtime.
+#[cfg(windows)]
+pub(crate) fn restart() -> anyhow::Result<()> {
+    use log::info;
+
+    use crate::proclist::session_of;
+
+    let session = session_of(std::process::id())
+        .ok_or_else(|| anyhow::anyhow!("can't determine the agent's session"))?;
+    if session == 0 {
+        anyhow::bail!("RestartExplorer can't reach the desktop from session 0 (service)");
+    }
+
+    let processes = crate::proclist::snapshot()?;
+    let mut ended = Vec::new();
+    for p in crate::proclist::named(&processes, EXPLORER) {
+        if session_of(p.pid) != Some(session) {
+            continue;
+        }
+        info!("RestartExplorer: ending {} (PID {})", p.name, p.pid);
+        if crate::proclist::terminate(p.pid) {
+            ended.push(p.pid);
+        }
+    }
+    if ended.is_empty() {
+        info!("RestartExplorer: no shell running, starting one");
+    } else {
+        // The old taskbar window goes with its process; wait for that so it
+        // isn't mistaken for the new one.
+        wait_for(EXIT_WAIT, || {
+            crate::proclist::snapshot().is_ok_and(|now| !now.iter().any(|p| ended.contains(&p.pid)))
+        });
+    }
+
+    if ended.is_empty() || !wait_for(RELAUNCH_WAIT, taskbar_up) {
+        if !ended.is_empty() {
+            info!("RestartExplorer: shell didn't relaunch itself, starting it");
+        }
+        let windir = std::env::var_os("windir").unwrap_or_else(|| r"C:\Windows".into());
+        std::process::Command::new(std::path::Path::new(&windir).join(EXPLORER)).spawn()?;
+    }
+    if !wait_for(SHELL_WAIT, taskbar_up) {
+        anyhow::bail!(
+            "explorer.exe started but the taskbar didn't appear within {}s",
+            SHELL_WAIT.as_secs()
+        );
+    }
+    info!("RestartExplorer: shell is back");
+    Ok(())
+}
+
+/// Whether the taskbar (`Shell_TrayWnd`) exists on our desktop.
+#[cfg(windows)]
+fn taskbar_up() -> bool {
+    use windows::Win32::UI::WindowsAndMessaging::FindWindowW;
+    use windows::core::{PCWSTR, w};
+
+    // SAFETY: both arguments are static or null strings.
+    unsafe { FindWindowW(w!("Shell_TrayWnd"), PCWSTR::null()) }.is_ok_and(|hwnd| !hwnd.is_invalid())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_wait_for() {
+        let mut polls = 0;
+        assert!(wait_for(Duration::from_secs(5), || {
+            polls += 1;
+            polls == 2
+        }));
+        assert_eq!(polls, 2);
+        assert!(!wait_for(Duration::ZERO, || false));
+    }
+}
@@ -0,0 +1,70 @@
+//! `GameMode` switch: a named macro over the other commands.
+//!
+//! Turning it on hands the `game_mode.on` commands to the executor in order,
+//! through `MqttClient::dispatch_local` like game hooks, so each one is still
+//! gated by its own feature flag and `command_rate_limits`; turning it off
+//! does the same with `game_mode.off`. With `keep_awake` sleep, the
+//! screensaver and the display timeout are held off while it's on (see
+//! keep_awake.rs; independent of the `KeepAwake` switch). The state
+//! lives in memory: it starts off, and quitting the agent drops the
+//! keep-awake hold but doesn't run the `off` commands.
+
+use log::{info, warn};
+use std::sync::atomic::{AtomicBool, Ordering};
+
+use super::keep_awake;
+use super::switch::SwitchAction;
+use crate::AppState;
+
+static ACTIVE: AtomicBool = AtomicBool::new(false);
+
+/// Held while game mode keeps the PC awake; dropping it lets it sleep again.
+static KEEP_AWAKE: std::sync::Mutex<Option<keep_awake::Hold>> = std::sync::Mutex::new(None);
+
+pub(crate) fn is_active() -> bool {
+    ACTIVE.load(Ordering::SeqCst)
+}
+
+/// Apply `action` and return the resulting state.
+pub(crate) async fn apply(action: SwitchAction, state: &AppState) -> anyhow::Result<bool> {
+    let config = state.config.read().await.game_mode.clone();
+    let on = match action {
+        SwitchAction::On => true,
+        SwitchAction::Off => false,
+        SwitchAction::Toggle => !is_active(),
+    };
+    // Claim the transition first, so a second press while this one is being
+    // applied sees the new state and doesn't dispatch the same steps again.
+    if ACTIVE.swap(on, Ordering::SeqCst) == on {
+        return Ok(on);
+    }
+
+    let steps = if on { &config.on } else { &config.off };
+    info!(
+        "Game mode {}: dispatching {} command(s)",
+        if on { "on" } else { "off" },
+        steps.len()
+    );
+    for step in steps {
+        info!("Game mode -> {} {}", step.command, step.payload);
+        state
+            .mqtt
+            .dispatch_local(step.command.trim(), &step.payload);
+    }
+
+    let guard = if on && config.keep_awake {
+        let guard = tokio::task::spawn_blocking(|| keep_awake::hold("Game mode is on")).await?;
+        if guard.is_none() {
+            warn!("Game mode: could not keep the PC awake");
+        }
+        guard
+    } else {
+        None
+    };
+    let mut held = KEEP_AWAKE.lock().unwrap_or_else(|e| e.into_inner());
+    // A press that flipped it back while the hold was being taken wins.
+    if is_active() == on {
+        *held = guard;
+    }
+    Ok(on)
+}
@@ -0,0 +1,97 @@
+//! Keeping the PC awake: holds off sleep, the screensaver and the display
+//! timeout while a [`Hold`] is alive.
+//!
+//! Used by the `KeepAwake` switch (a hold kept here, so HA sees and sets its
+//! state) and by `GameMode` with `keep_awake` (which keeps its own hold). The
+//! state lives in memory: it starts off, and quitting the agent drops it.
+
+use log::{info, warn};
+use std::sync::Mutex;
+
+/// The `KeepAwake` switch's hold; `Some` while the switch is on.
+static SWITCH_HOLD: Mutex<Option<Hold>> = Mutex::new(None);
+
+/// Whether the `KeepAwake` switch is on.
+pub(crate) fn is_active() -> bool {
+    SWITCH_HOLD
+        .lock()
+        .unwrap_or_else(|e| e.into_inner())
+        .is_some()
+}
+
+/// Turn the `KeepAwake` switch on or off. False if the hold couldn't be
+/// taken. Blocking: call via `spawn_blocking`.
+pub(crate) fn set(on: bool) -> bool {
+    let mut held = SWITCH_HOLD.lock().unwrap_or_else(|e| e.into_inner());
+    if on == held.is_some() {
+        return true;
+    }
+    if on {
+        let Some(hold) = hold("Keep awake is on") else {
+            warn!("KeepAwake: could not keep the PC awake");
+            return false;
+        };
+        *held = Some(hold);
+    } else {
+        *held = None;
+    }
+    info!("KeepAwake {}", if on { "on" } else { "off" });
+    true
+}
+
+/// Stops the keep-awake thread when dropped.
+#[cfg(windows)]
+pub(crate) type Hold = std::sync::mpsc::Sender<()>;
+
+/// The logind inhibitor lock; released when the fd is closed.
+#[cfg(unix)]
+pub(crate) type Hold = zbus::zvariant::OwnedFd;
+
+/// SetThreadExecutionState only lasts as long as the calling thread, so a
+/// small thread holds it until the returned sender is dropped.
+#[cfg(windows)]
+pub(crate) fn hold(_why: &str) -> Option<Hold> {
+    use windows::Win32::System::Power::{
+        ES_CONTINUOUS, ES_DISPLAY_REQUIRED, ES_SYSTEM_REQUIRED, EXECUTION_STATE,
+        SetThreadExecutionState,
+    };
+
+    let (tx, rx) = std::sync::mpsc::channel::<()>();
+    let (ready_tx, ready_rx) = std::sync::mpsc::channel::<bool>();
+    std::thread::Builder::new()
+        .name("keep-awake".into())
+        .stack_size(64 * 1024)
+        .spawn(move || {
+            // SAFETY: only changes this thread's execution state.
+            let held = unsafe {
+                SetThreadExecutionState(ES_CONTINUOUS | ES_SYSTEM_REQUIRED | ES_DISPLAY_REQUIRED)
+            } != EXECUTION_STATE::default();
+            let _ = ready_tx.send(held);
+            if held {
+                // Returns once the sender is dropped.
+                let _ = rx.recv();
+                // SAFETY: as above.
+                unsafe { SetThreadExecutionState(ES_CONTINUOUS) };
+            }
+        })
+        .ok()?;
+    ready_rx.recv().ok()?.then_some(tx)
+}
+
+/// A systemd-logind block inhibitor on sleep and idle, with `why` as the
+/// reason `systemd-inhibit --list` shows. `None` if logind isn't reachable
+/// (non-systemd system).
+#[cfg(unix)]
+pub(crate) fn hold(why: &str) -> Option<Hold> {
+    let conn = zbus::blocking::Connection::system().ok()?;
+    let reply = conn
+        .call_method(
+            Some("org.freedesktop.login1"),
+            "/org/freedesktop/login1",
+            Some("org.freedesktop.login1.Manager"),
+            "Inhibit",
+            &("sleep:idle", "pc-bridge", why, "block"),
+        )
+        .ok()?;
+    reply.body().deserialize::<zbus::zvariant::OwnedFd>().ok()
+}
@@ -1,10 +1,162 @@
 //! Command execution module
 
+mod auth;
 pub mod custom;
 pub mod dry_run;
+pub(crate) mod explorer;
+mod game_mode;
+mod keep_awake;
+pub(crate) mod mouse;
+pub(crate) mod priority;
+mod rate_limit;
+pub(crate) mod registry;
+mod reply;
+mod selftest;
+pub(crate) mod service;
+mod slots;
+pub(crate) mod switch;
+pub(crate) mod window;
 
+use std::time::Duration;
+
+pub use slots::CommandSlots;
+pub(crate) use slots::SlotUsage;
+
+use crate::AppState;
 use crate::config::FeatureConfig;
 
+/// Announce an intentional power-off before Shutdown runs: a retained
+/// `shutting_down` on sleep_state, so HA can tell it from a crash (the LWT
+/// looks the same either way). With `shutdown_grace_secs` set, the remaining
+/// seconds are counted down once a second on the sleep_state attributes.
+/// Returns once the state is on the wire. If the shutdown then doesn't start,
+/// call [`cancel_shutdown_announcement`].
+pub(crate) async fn announce_shutdown(state: &AppState) {
+    let grace = state.config.read().await.shutdown_grace_secs;
+    state
+        .mqtt
+        .publish_sensor_retained("sleep_state", "shutting_down")
+        .await;
+    for remaining in (0..=grace).rev() {
+        let attrs = serde_json::json!({ "seconds_remaining": remaining });
+        state
+            .mqtt
+            .publish_sensor_attributes("sleep_state", &attrs)
+            .await;
+        if remaining > 0 {
+            tokio::time::sleep(Duration::from_secs(1)).await;
+        }
+    }
+    // The publishes above only queue into rumqttc. Repeat the state over a
+    // one-shot sync connection, which returns once it's on the wire, before
+    // the OS starts tearing the network down (same as the Sleep path).
+    let config = state.config.read().await.clone();
+    let sent = tokio::task::spawn_blocking(move || {
+        let cfg = crate::power::sync_mqtt::SyncMqttConfig::from_config(&config);
+        crate::power::sync_mqtt::sync_mqtt_publish_state(&cfg, b"shutting_down")
+    })
+    .await;
+    match sent {
+        Ok(Ok(())) => log::info!("shutting_down published via sync TCP"),
+        Ok(Err(e)) => log::warn!("Sync MQTT shutting_down publish failed: {}", e),
+        Err(e) => log::warn!("Sync publish task join error: {}", e),
+    }
+}
+
+/// Undo [`announce_shutdown`] when the shutdown was refused, so the retained
+/// `shutting_down` doesn't stick while the machine is still up.
+pub(crate) async fn cancel_shutdown_announcement(state: &AppState) {
+    state
+        .mqtt
+        .publish_sensor_retained("sleep_state", "awake")
+        .await;
+    state
+        .mqtt
+        .publish_sensor_attributes("sleep_state", &serde_json::json!({}))
+        .await;
+}
+
+/// `CheckUpdate`: look up the latest release and publish it as the retained
+/// `latest_version` sensor, with the installed version and an
+/// `update_available` flag as attributes. Never installs anything, and refuses
+/// (without a request) when `update_channel` is `"disabled"`.
+pub(crate) async fn check_update(state: &AppState) -> anyhow::Result<()> {
+    let channel = state.config.read().await.update_channel.clone();
+    let (latest, newer) = crate::updater::check_latest(&channel).await?;
+    log::info!(
+        "CheckUpdate: latest {} (installed {}){}",
+        latest,
+        env!("CARGO_PKG_VERSION"),
+        if newer { " - update available" } else { "" }
+    );
+    state
+        .mqtt
+        .publish_sensor_retained("latest_version", &latest)
+        .await;
+    let attrs = serde_json::json!({
+        "installed": env!("CARGO_PKG_VERSION"),
+        "update_available": newer,
+    });
+    state
+        .mqtt
+        .publish_sensor_attributes("latest_version", &attrs)
+        .await;
+    Ok(())
+}
+
+/// `Echo`: publish the payload, exactly as received, to the `command_result`
+/// topic and return it as the reply `value`. No side effects, so it's a safe
+/// end-to-end check of the command path on a new install. Always available,
+/// like `SelfTest`.
+pub(crate) async fn echo(
+    payload: &str,
+    state: &std::sync::Arc<AppState>,
+) -> anyhow::Result<serde_json::Value> {
+    if state.dry_run {
+        dry_run::report("Echo", payload, state).await;
+        return Ok(serde_json::Value::Null);
+    }
+    log::info!("Echo: {} bytes", payload.len());
+    state.mqtt.publish_command_result(payload).await;
+    Ok(serde_json::Value::from(payload))
+}
+
+/// Trim a button press's payload, and blank it if it's one of
+/// `button_payloads` (HA's button `PRESS` by default).
+pub(crate) fn normalize_payload<'a>(payload: &'a str, button_payloads: &[String]) -> &'a str {
+    let payload = payload.trim();
+    if button_payloads
+        .iter()
+        .any(|p| p.trim().eq_ignore_ascii_case(payload))
+    {
+        ""
+    } else {
+        payload
+    }
+}
+
+/// Validate a process name from a command payload, dropping any `.exe`
+/// suffix: a plain identifier (`[A-Za-z0-9._-]`), so it can't smuggle a path
+/// or shell syntax. Shared by `SetPriority`, `MoveWindow` and `FocusWindow`.
+pub(crate) fn parse_process_name(name: &str) -> anyhow::Result<String> {
+    let process = name.trim();
+    let process = if process.len() > 4
+        && process.as_bytes()[process.len() - 4..].eq_ignore_ascii_case(b".exe")
+    {
+        &process[..process.len() - 4]
+    } else {
+        process
+    };
+    if process.is_empty()
+        || !process
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '.' | '-' | '_'))
+    {
+        anyhow::bail!("invalid process name '{}'", process);
+    }
+    Ok(process.to_string())
+}
+
 /// Whether the feature gating a command is currently enabled.
 ///
 /// Destructive/native commands (Shutdown, Sleep, Lock, ...) are only registered
@@ -20,16 +172,26 @@ pub(crate) fn command_feature_enabled(name: &str, f: &FeatureConfig) -> bool {
         "Sleep" | "Hibernate" => f.cmd_sleep,
         "Lock" => f.cmd_lock,
         "Logoff" => f.cmd_logoff,
-        "MonitorOff" | "MonitorOn" => f.cmd_monitor,
+        "MonitorOff" | "MonitorOn" | "MonitorStandby" => f.cmd_monitor,
+        "SetPriority" => f.cmd_priority,
+        "ServiceControl" => f.cmd_service,
+        "ReadRegistry" => f.cmd_registry,
+        "MoveWindow" | "FocusWindow" => f.cmd_window,
+        "MouseMove" | "MouseClick" => f.cmd_mouse,
         "Launch" => f.launch_game,
         "CloseGame" => f.close_game,
         "RefreshSteamGames" => f.steam_library,
-        "Screensaver" | "Wake" => f.idle_tracking,
+        "Screensaver" | "Wake" | "ResetIdle" => f.idle_tracking,
         "DiscordJoin" | "DiscordLeaveChannel" => f.discord,
         // Audio buttons are all registered under media_controls (register_discovery);
         // volume gates the volume_level sensor, not these commands.
         "MediaPlayPause" | "MediaNext" | "MediaPrevious" | "MediaStop" => f.media_controls,
-        "VolumeMute" => f.media_controls,
+        "VolumeMute" | "Mute" => f.media_controls,
+        // Windows-only, so never subscribed or synced elsewhere.
+        "NightLight" => cfg!(windows) && f.night_light,
+        "KeepAwake" => f.keep_awake,
+        "GameMode" => f.game_mode,
+        "RestartExplorer" => f.cmd_explorer,
         _ => true,
     }
 }
@@ -49,11 +211,23 @@ pub(crate) fn is_native_command(name: &str) -> bool {
             | "Logoff"
             | "MonitorOff"
             | "MonitorOn"
+            | "MonitorStandby"
+            | "SetPriority"
+            | "ServiceControl"
+            | "ReadRegistry"
+            | "MoveWindow"
+            | "FocusWindow"
+            | "MouseMove"
+            | "MouseClick"
             | "Launch"
             | "CloseGame"
             | "RefreshSteamGames"
+            | "CheckUpdate"
+            | "Echo"
+            | "SelfTest"
             | "Screensaver"
             | "Wake"
+            | "ResetIdle"
             | "DiscordJoin"
             | "DiscordLeaveChannel"
             | "MediaPlayPause"
@@ -61,6 +235,11 @@ pub(crate) fn is_native_command(name: &str) -> bool {
             | "MediaPrevious"
             | "MediaStop"
             | "VolumeMute"
+            | "Mute"
+            | "NightLight"
+            | "KeepAwake"
+            | "GameMode"
+            | "RestartExplorer"
     )
 }
 
@@ -141,9 +320,31 @@ pub(crate) fn global_scheme_blocked(config: &crate::config::Config, payload: &st
 
 #[cfg(test)]
 mod tests {
-    use super::{command_feature_enabled, global_scheme_blocked, is_arbitrary_launch};
+    use super::{
+        command_feature_enabled, global_scheme_blocked, is_arbitrary_launch, normalize_payload,
+        parse_process_name,
+    };
     use crate::config::FeatureConfig;
 
+    #[test]
+    fn test_normalize_payload() {
+        let press = ["PRESS".to_string()];
+        assert_eq!(normalize_payload(" press ", &press), "");
+        assert_eq!(normalize_payload("steam:730\n", &press), "steam:730");
+        // With the list emptied, "press" is an ordinary payload.
+        assert_eq!(normalize_payload("press", &[]), "press");
+    }
+
+    #[test]
+    fn test_parse_process_name() {
+        assert_eq!(parse_process_name(" vlc.EXE ").unwrap(), "vlc");
+        assert_eq!(parse_process_name("Spotify").unwrap(), "Spotify");
+        assert!(parse_process_name("").is_err());
+        assert!(parse_process_name(".exe").is_err());
+        assert!(parse_process_name("vlc & calc").is_err());
+        assert!(parse_process_name(r"C:\vlc").is_err());
+    }
+
     #[test]
     fn test_global_scheme_gate_defaults() {
         // Defaults: global launch ON, global close OFF, no configured games.
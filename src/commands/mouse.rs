@@ -0,0 +1,211 @@
+//! `MouseMove` / `MouseClick` commands - put the cursor somewhere and click.
+//!
+//! `MouseMove` takes `{"x":960,"y":540}`; `MouseClick` takes the same plus an
+//! optional `"button"` (`left`, the default, `right` or `middle`), and with no
+//! `x`/`y` clicks wherever the cursor already is. Coordinates are
+//! virtual-screen pixels, as for `MoveWindow`, and must land on the virtual
+//! screen. Windows only.
+
+use anyhow::{anyhow, bail};
+use serde::Deserialize;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub(crate) enum MouseButton {
+    #[default]
+    Left,
+    Right,
+    Middle,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+pub(crate) struct MouseRequest {
+    pub x: Option<i32>,
+    pub y: Option<i32>,
+    #[serde(default)]
+    pub button: MouseButton,
+}
+
+impl MouseRequest {
+    /// Target position, if the payload gave one.
+    pub(crate) fn position(&self) -> Option<(i32, i32)> {
+        self.x.zip(self.y)
+    }
+}
+
+/// Virtual screen rectangle: `left`/`top` inclusive, `right`/`bottom` exclusive.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct ScreenBounds {
+    pub left: i32,
+    pub top: i32,
+    pub right: i32,
+    pub bottom: i32,
+}
+
+impl ScreenBounds {
+    fn contains(&self, x: i32, y: i32) -> bool {
+        (self.left..self.right).contains(&x) && (self.top..self.bottom).contains(&y)
+    }
+}
+
+/// Parse a `MouseMove` (`needs_position`) or `MouseClick` payload. `x` and
+/// `y` come as a pair or not at all; an empty `MouseClick` payload (or HA's
+/// `PRESS`) clicks in place.
+pub(crate) fn parse_payload(payload: &str, needs_position: bool) -> anyhow::Result<MouseRequest> {
+    let payload = payload.trim();
+    let req = if !needs_position && (payload.is_empty() || payload.eq_ignore_ascii_case("press")) {
+        MouseRequest {
+            x: None,
+            y: None,
+            button: MouseButton::Left,
+        }
+    } else {
+        serde_json::from_str(payload).map_err(|e| anyhow!("invalid mouse payload: {}", e))?
+    };
+    if req.x.is_some() != req.y.is_some() {
+        bail!("mouse payload needs both x and y");
+    }
+    if needs_position && req.position().is_none() {
+        bail!("MouseMove needs x and y");
+    }
+    Ok(req)
+}
+
+/// Reject a position outside `bounds`.
+pub(crate) fn check_bounds(x: i32, y: i32, bounds: &ScreenBounds) -> anyhow::Result<()> {
+    if !bounds.contains(x, y) {
+        bail!(
+            "position {},{} is off the virtual screen ({},{} to {},{})",
+            x,
+            y,
+            bounds.left,
+            bounds.top,
+            bounds.right - 1,
+            bounds.bottom - 1
+        );
+    }
+    Ok(())
+}
+
+/// The virtual screen spanning every monitor.
+#[cfg(windows)]
+fn virtual_screen() -> ScreenBounds {
+    use windows::Win32::UI::WindowsAndMessaging::{
+        GetSystemMetrics, SM_CXVIRTUALSCREEN, SM_CYVIRTUALSCREEN, SM_XVIRTUALSCREEN,
+        SM_YVIRTUALSCREEN,
+    };
+
+    // SAFETY: GetSystemMetrics only reads system state.
+    unsafe {
+        let left = GetSystemMetrics(SM_XVIRTUALSCREEN);
+        let top = GetSystemMetrics(SM_YVIRTUALSCREEN);
+        ScreenBounds {
+            left,
+            top,
+            right: left + GetSystemMetrics(SM_CXVIRTUALSCREEN),
+            bottom: top + GetSystemMetrics(SM_CYVIRTUALSCREEN),
+        }
+    }
+}
+
+/// Move the cursor to `x`,`y` after checking it is on screen.
+#[cfg(windows)]
+pub(crate) fn move_cursor(x: i32, y: i32) -> anyhow::Result<()> {
+    use windows::Win32::UI::WindowsAndMessaging::SetCursorPos;
+
+    check_bounds(x, y, &virtual_screen())?;
+    // SAFETY: plain Win32 call, no pointers.
+    unsafe { SetCursorPos(x, y) }.map_err(|e| anyhow!("SetCursorPos failed: {}", e.message()))
+}
+
+/// Click `req.button`, first moving to `req`'s position if it has one.
+#[cfg(windows)]
+pub(crate) fn click(req: &MouseRequest) -> anyhow::Result<()> {
+    use windows::Win32::UI::Input::KeyboardAndMouse::{
+        INPUT, INPUT_0, INPUT_MOUSE, MOUSE_EVENT_FLAGS, MOUSEEVENTF_LEFTDOWN, MOUSEEVENTF_LEFTUP,
+        MOUSEEVENTF_MIDDLEDOWN, MOUSEEVENTF_MIDDLEUP, MOUSEEVENTF_RIGHTDOWN, MOUSEEVENTF_RIGHTUP,
+        MOUSEINPUT, SendInput,
+    };
+
+    if let Some((x, y)) = req.position() {
+        move_cursor(x, y)?;
+    }
+    let (down, up) = match req.button {
+        MouseButton::Left => (MOUSEEVENTF_LEFTDOWN, MOUSEEVENTF_LEFTUP),
+        MouseButton::Right => (MOUSEEVENTF_RIGHTDOWN, MOUSEEVENTF_RIGHTUP),
+        MouseButton::Middle => (MOUSEEVENTF_MIDDLEDOWN, MOUSEEVENTF_MIDDLEUP),
+    };
+    let input = |flags: MOUSE_EVENT_FLAGS| INPUT {
+        r#type: INPUT_MOUSE,
+        Anonymous: INPUT_0 {
+            mi: MOUSEINPUT {
+                dwFlags: flags,
+                ..Default::default()
+            },
+        },
+    };
+    // SAFETY: both INPUTs are fully initialized mouse events; no dx/dy, so the
+    // click lands wherever the cursor is.
+    let sent = unsafe {
+        SendInput(
+            &[input(down), input(up)],
+            std::mem::size_of::<INPUT>() as i32,
+        )
+    };
+    if sent != 2 {
+        // UIPI blocks input into an elevated foreground window.
+        bail!("SendInput injected {} of 2 mouse events", sent);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_payload() {
+        assert_eq!(
+            parse_payload(r#"{"x":-1920,"y":40}"#, true).unwrap(),
+            MouseRequest {
+                x: Some(-1920),
+                y: Some(40),
+                button: MouseButton::Left,
+            }
+        );
+        let click = parse_payload(r#"{"x":10,"y":20,"button":"right"}"#, false).unwrap();
+        assert_eq!(click.position(), Some((10, 20)));
+        assert_eq!(click.button, MouseButton::Right);
+        // Click in place.
+        assert_eq!(parse_payload("PRESS", false).unwrap().position(), None);
+        assert_eq!(
+            parse_payload(r#"{"button":"middle"}"#, false)
+                .unwrap()
+                .button,
+            MouseButton::Middle
+        );
+    }
+
+    #[test]
+    fn test_parse_payload_rejects() {
+        assert!(parse_payload("", true).is_err()); // MouseMove needs a position
+        assert!(parse_payload(r#"{"x":10}"#, false).is_err()); // half a position
+        assert!(parse_payload(r#"{"x":1,"y":1,"button":"back"}"#, false).is_err());
+        assert!(parse_payload("10,20", true).is_err()); // not JSON
+    }
+
+    #[test]
+    fn test_check_bounds() {
+        // Primary 2560x1440 with a 1920-wide monitor to its left.
+        let bounds = ScreenBounds {
+            left: -1920,
+            top: 0,
+            right: 2560,
+            bottom: 1440,
+        };
+        assert!(check_bounds(0, 0, &bounds).is_ok());
+        assert!(check_bounds(-1920, 1439, &bounds).is_ok());
+        assert!(check_bounds(2560, 0, &bounds).is_err());
+        assert!(check_bounds(0, -1, &bounds).is_err());
+    }
+}
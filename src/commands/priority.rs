@@ -0,0 +1,165 @@
+//! `SetPriority` command - change a running process's scheduling priority.
+//!
+//! Payload is `<process>:<class>`, e.g. `cs2:high` or `cs2.exe:normal`. Every
+//! running process with that name is changed. Classes follow the Windows names;
+//! on Linux they map to nice values (raising priority there needs
+//! CAP_SYS_NICE). Realtime is refused outright: a busy realtime process can
+//! starve input and the agent itself.
+
+use anyhow::{anyhow, bail};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum PriorityClass {
+    Idle,
+    BelowNormal,
+    Normal,
+    AboveNormal,
+    High,
+}
+
+impl PriorityClass {
+    fn parse(s: &str) -> anyhow::Result<Self> {
+        let normalized = s.trim().to_ascii_lowercase().replace(['-', ' '], "_");
+        Ok(match normalized.as_str() {
+            "idle" | "low" => Self::Idle,
+            "below_normal" => Self::BelowNormal,
+            "normal" => Self::Normal,
+            "above_normal" => Self::AboveNormal,
+            "high" => Self::High,
+            "realtime" => bail!("realtime priority is not allowed"),
+            _ => bail!(
+                "unknown priority '{}' (idle, below_normal, normal, above_normal, high)",
+                s.trim()
+            ),
+        })
+    }
+
+    /// Nice value used on Linux.
+    #[cfg(unix)]
+    fn nice(self) -> i32 {
+        match self {
+            Self::Idle => 19,
+            Self::BelowNormal => 10,
+            Self::Normal => 0,
+            Self::AboveNormal => -5,
+            Self::High => -10,
+        }
+    }
+}
+
+/// Split a `process:class` payload. The process name goes through
+/// [`parse_process_name`](crate::commands::parse_process_name).
+pub(crate) fn parse_payload(payload: &str) -> anyhow::Result<(String, PriorityClass)> {
+    let (process, class) = payload
+        .rsplit_once(':')
+        .ok_or_else(|| anyhow!("SetPriority payload must be <process>:<priority>"))?;
+    let process = crate::commands::parse_process_name(process)?;
+    Ok((process, PriorityClass::parse(class)?))
+}
+
+/// Apply `class` to every process named `process` (no `.exe`). Returns how
+/// many were changed; errors if none were found or none could be changed.
+#[cfg(windows)]
+pub(crate) fn set_priority(process: &str, class: PriorityClass) -> anyhow::Result<usize> {
+    use windows::Win32::Foundation::CloseHandle;
+    use windows::Win32::System::Threading::{
+        ABOVE_NORMAL_PRIORITY_CLASS, BELOW_NORMAL_PRIORITY_CLASS, HIGH_PRIORITY_CLASS,
+        IDLE_PRIORITY_CLASS, NORMAL_PRIORITY_CLASS, OpenProcess, PROCESS_SET_INFORMATION,
+        SetPriorityClass,
+    };
+
+    let flag = match class {
+        PriorityClass::Idle => IDLE_PRIORITY_CLASS,
+        PriorityClass::BelowNormal => BELOW_NORMAL_PRIORITY_CLASS,
+        PriorityClass::Normal => NORMAL_PRIORITY_CLASS,
+        PriorityClass::AboveNormal => ABOVE_NORMAL_PRIORITY_CLASS,
+        PriorityClass::High => HIGH_PRIORITY_CLASS,
+    };
+    let exe = format!("{process}.exe");
+    let (mut found, mut changed) = (0usize, 0usize);
+
+    for entry in crate::proclist::snapshot()? {
+        if !entry.name.eq_ignore_ascii_case(&exe) && !entry.name.eq_ignore_ascii_case(process) {
+            continue;
+        }
+        found += 1;
+        // SAFETY: the handle is closed right after use.
+        unsafe {
+            if let Ok(handle) = OpenProcess(PROCESS_SET_INFORMATION, false, entry.pid) {
+                if SetPriorityClass(handle, flag).is_ok() {
+                    changed += 1;
+                }
+                let _ = CloseHandle(handle);
+            }
+        }
+    }
+
+    check_outcome(process, found, changed)
+}
+
+#[cfg(unix)]
+pub(crate) fn set_priority(process: &str, class: PriorityClass) -> anyhow::Result<usize> {
+    let (mut found, mut changed) = (0usize, 0usize);
+    for entry in std::fs::read_dir("/proc")?.flatten() {
+        let Some(pid) = entry
+            .file_name()
+            .to_str()
+            .and_then(|s| s.parse::<libc::id_t>().ok())
+        else {
+            continue;
+        };
+        let comm = std::fs::read_to_string(entry.path().join("comm")).unwrap_or_default();
+        let comm = comm.trim();
+        // comm is cut to 15 bytes, so a longer name can only be prefix-matched.
+        let matches = comm == process || (comm.len() == 15 && process.starts_with(comm));
+        if !matches {
+            continue;
+        }
+        found += 1;
+        // SAFETY: setpriority only reads its scalar arguments.
+        if unsafe { libc::setpriority(libc::PRIO_PROCESS, pid, class.nice()) } == 0 {
+            changed += 1;
+        }
+    }
+    check_outcome(process, found, changed)
+}
+
+fn check_outcome(process: &str, found: usize, changed: usize) -> anyhow::Result<usize> {
+    match (found, changed) {
+        (0, _) => bail!("no running process named '{}'", process),
+        (_, 0) => bail!(
+            "could not change priority of '{}' (access denied?)",
+            process
+        ),
+        _ => Ok(changed),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_payload() {
+        assert_eq!(
+            parse_payload("cs2:high").unwrap(),
+            ("cs2".to_string(), PriorityClass::High)
+        );
+        assert_eq!(
+            parse_payload("FortniteClient-Win64-Shipping.exe:Below-Normal").unwrap(),
+            (
+                "FortniteClient-Win64-Shipping".to_string(),
+                PriorityClass::BelowNormal
+            )
+        );
+    }
+
+    #[test]
+    fn test_parse_payload_rejects() {
+        assert!(parse_payload("cs2").is_err()); // no class
+        assert!(parse_payload(":high").is_err()); // no process
+        assert!(parse_payload("cs2:turbo").is_err()); // unknown class
+        assert!(parse_payload("cs2:realtime").is_err()); // refused
+        assert!(parse_payload("a b;rm:high").is_err()); // unsafe name
+    }
+}
@@ -0,0 +1,111 @@
+//! Per-command rate limiting (token buckets).
+//!
+//! The executor's semaphore caps how many commands run at once, but a stuck
+//! automation can still fire the same command over and over inside that limit.
+//! `command_rate_limits` in userConfig.json gives individual commands their own
+//! budget (e.g. at most 1 `Shutdown` per 10s); commands without an entry are
+//! unaffected.
+
+use std::collections::HashMap;
+use std::time::Instant;
+
+use crate::config::CommandRateLimit;
+
+/// Refilling token bucket: holds up to `max` tokens, regains `max` every
+/// `per_secs`, and each command spends one.
+struct TokenBucket {
+    tokens: f64,
+    last: Instant,
+}
+
+/// Bucket state per command name. Owned by the executor's receive loop, so no
+/// locking is needed.
+#[derive(Default)]
+pub(crate) struct CommandRateLimiter {
+    buckets: HashMap<String, TokenBucket>,
+}
+
+impl CommandRateLimiter {
+    /// Spend a token for `name` under `limit`. Returns false when the command
+    /// is over budget and should be dropped. A command's first use starts with a
+    /// full bucket, so a burst of up to `max` is always allowed.
+    pub(crate) fn try_acquire(
+        &mut self,
+        name: &str,
+        limit: CommandRateLimit,
+        now: Instant,
+    ) -> bool {
+        let capacity = f64::from(limit.max.max(1));
+        let per_sec = capacity / limit.per_secs.max(1) as f64;
+
+        let bucket = self.buckets.entry(name.to_string()).or_insert(TokenBucket {
+            tokens: capacity,
+            last: now,
+        });
+
+        let elapsed = now.saturating_duration_since(bucket.last).as_secs_f64();
+        // Clamp to the current capacity too, so lowering `max` on a hot reload
+        // takes effect immediately instead of after the old surplus drains.
+        bucket.tokens = (bucket.tokens + elapsed * per_sec).min(capacity);
+        bucket.last = now;
+
+        if bucket.tokens >= 1.0 {
+            bucket.tokens -= 1.0;
+            true
+        } else {
+            false
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::Duration;
+
+    fn limit(max: u32, per_secs: u64) -> CommandRateLimit {
+        CommandRateLimit { max, per_secs }
+    }
+
+    #[test]
+    fn test_one_per_window() {
+        let mut rl = CommandRateLimiter::default();
+        let t0 = Instant::now();
+        assert!(rl.try_acquire("Shutdown", limit(1, 10), t0));
+        assert!(!rl.try_acquire("Shutdown", limit(1, 10), t0 + Duration::from_secs(5)));
+        assert!(rl.try_acquire("Shutdown", limit(1, 10), t0 + Duration::from_secs(15)));
+    }
+
+    #[test]
+    fn test_burst_up_to_max() {
+        let mut rl = CommandRateLimiter::default();
+        let t0 = Instant::now();
+        for _ in 0..3 {
+            assert!(rl.try_acquire("MediaNext", limit(3, 60), t0));
+        }
+        assert!(!rl.try_acquire("MediaNext", limit(3, 60), t0));
+        // One token back every 20s.
+        assert!(rl.try_acquire("MediaNext", limit(3, 60), t0 + Duration::from_secs(20)));
+        assert!(!rl.try_acquire("MediaNext", limit(3, 60), t0 + Duration::from_secs(20)));
+    }
+
+    #[test]
+    fn test_buckets_are_per_command() {
+        let mut rl = CommandRateLimiter::default();
+        let t0 = Instant::now();
+        assert!(rl.try_acquire("Shutdown", limit(1, 10), t0));
+        // A different command has its own budget.
+        assert!(rl.try_acquire("Restart", limit(1, 10), t0));
+        assert!(!rl.try_acquire("Shutdown", limit(1, 10), t0));
+    }
+
+    #[test]
+    fn test_lowered_limit_applies_immediately() {
+        let mut rl = CommandRateLimiter::default();
+        let t0 = Instant::now();
+        assert!(rl.try_acquire("Lock", limit(5, 10), t0));
+        // Reload drops the budget to 1 - the old 4-token surplus must not carry.
+        assert!(rl.try_acquire("Lock", limit(1, 10), t0));
+        assert!(!rl.try_acquire("Lock", limit(1, 10), t0));
+    }
+}
@@ -0,0 +1,201 @@
+//! `ReadRegistry` command - read one registry value and return it in the
+//! command reply.
+//!
+//! Payload is `{"key":"HKCU\\Software\\VideoLAN\\VLC","value":"Version"}`
+//! (`value` omitted or empty = the key's default value), normally wrapped in
+//! a `reply_to` envelope, since the reply is the only place the value goes.
+//! Only keys listed in `readable_registry_keys`, and their subkeys, can be
+//! read, so a compromised broker can't pull credentials or other secrets out
+//! of the registry. Windows only.
+
+use anyhow::{anyhow, bail};
+use serde::Deserialize;
+use serde_json::Value;
+use std::sync::Arc;
+
+use crate::AppState;
+
+/// Root keys a path may start with, long and short spellings.
+const HIVES: &[(&str, &str)] = &[
+    ("HKEY_CURRENT_USER", "HKCU"),
+    ("HKEY_LOCAL_MACHINE", "HKLM"),
+    ("HKEY_USERS", "HKU"),
+];
+
+/// Longest value name accepted (the registry's own limit is 16,383).
+const MAX_VALUE_NAME: usize = 255;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct RegistryRequest {
+    /// Short hive name, e.g. `HKCU`
+    pub hive: &'static str,
+    /// Path below the hive, without leading or trailing backslashes
+    pub path: String,
+    /// Value name; empty for the default value
+    pub value: String,
+}
+
+#[derive(Deserialize)]
+struct JsonPayload {
+    key: String,
+    #[serde(default)]
+    value: String,
+}
+
+/// Split `HKCU\Software\App` into the short hive name and the path below it.
+/// `None` for an unknown hive, an empty path, or empty path components.
+pub(crate) fn split_key(key: &str) -> Option<(&'static str, String)> {
+    let key = key.trim().trim_end_matches('\\');
+    let (root, path) = key.split_once('\\')?;
+    let hive = HIVES
+        .iter()
+        .find(|(long, short)| root.eq_ignore_ascii_case(long) || root.eq_ignore_ascii_case(short))
+        .map(|&(_, short)| short)?;
+    if path.is_empty() || path.split('\\').any(|part| part.trim().is_empty()) {
+        return None;
+    }
+    Some((hive, path.to_string()))
+}
+
+/// Parse a `ReadRegistry` payload and check its key against the allow-list:
+/// the key itself or anything below a listed key. Registry paths are
+/// case-insensitive, so the comparison is too.
+pub(crate) fn parse_payload(payload: &str, allowed: &[String]) -> anyhow::Result<RegistryRequest> {
+    let p: JsonPayload = serde_json::from_str(payload.trim())
+        .map_err(|e| anyhow!("invalid ReadRegistry payload: {}", e))?;
+    let (hive, path) =
+        split_key(&p.key).ok_or_else(|| anyhow!("invalid registry key '{}'", p.key.trim()))?;
+    if p.value.len() > MAX_VALUE_NAME || p.value.contains('\0') {
+        bail!("invalid registry value name");
+    }
+    let permitted = allowed
+        .iter()
+        .filter_map(|k| split_key(k))
+        .any(|(h, root)| {
+            h == hive
+                && path.len() >= root.len()
+                && path.as_bytes()[..root.len()].eq_ignore_ascii_case(root.as_bytes())
+                && (path.len() == root.len() || path.as_bytes()[root.len()] == b'\\')
+        });
+    if !permitted {
+        bail!(
+            "registry key '{}\\{}' is not in readable_registry_keys",
+            hive,
+            path
+        );
+    }
+    Ok(RegistryRequest {
+        hive,
+        path,
+        value: p.value,
+    })
+}
+
+/// Run a `ReadRegistry` command: the value as JSON (string, number or list
+/// of strings; binary data as hex), for the reply.
+pub(crate) async fn run(payload: &str, state: &Arc<AppState>) -> anyhow::Result<Value> {
+    if state.dry_run {
+        crate::commands::dry_run::report("ReadRegistry", payload.trim(), state).await;
+        return Ok(Value::Null);
+    }
+    let config = state.config.read().await;
+    if !config.features.cmd_registry {
+        bail!("ReadRegistry is disabled (cmd_registry)");
+    }
+    let req = parse_payload(payload, &config.readable_registry_keys)?;
+    drop(config);
+    log::info!("ReadRegistry: {}\\{} [{}]", req.hive, req.path, req.value);
+    #[cfg(windows)]
+    {
+        tokio::task::spawn_blocking(move || read(&req)).await?
+    }
+    #[cfg(not(windows))]
+    {
+        bail!("ReadRegistry is only supported on Windows ({})", req.hive)
+    }
+}
+
+#[cfg(windows)]
+fn read(req: &RegistryRequest) -> anyhow::Result<Value> {
+    use winreg::RegKey;
+    use winreg::enums::{
+        HKEY_CURRENT_USER, HKEY_LOCAL_MACHINE, HKEY_USERS, KEY_READ, REG_BINARY, REG_DWORD,
+        REG_EXPAND_SZ, REG_MULTI_SZ, REG_QWORD, REG_SZ,
+    };
+    use winreg::types::FromRegValue;
+
+    let hive = match req.hive {
+        "HKLM" => HKEY_LOCAL_MACHINE,
+        "HKU" => HKEY_USERS,
+        _ => HKEY_CURRENT_USER,
+    };
+    let key = RegKey::predef(hive)
+        .open_subkey_with_flags(&req.path, KEY_READ)
+        .map_err(|e| anyhow!("{}\\{}: {}", req.hive, req.path, e))?;
+    let raw = key
+        .get_raw_value(&req.value)
+        .map_err(|e| anyhow!("{}\\{} [{}]: {}", req.hive, req.path, req.value, e))?;
+    let value = match raw.vtype {
+        REG_SZ | REG_EXPAND_SZ => Value::from(String::from_reg_value(&raw)?),
+        REG_MULTI_SZ => Value::from(Vec::<String>::from_reg_value(&raw)?),
+        REG_DWORD => Value::from(u32::from_reg_value(&raw)?),
+        REG_QWORD => Value::from(u64::from_reg_value(&raw)?),
+        REG_BINARY => Value::from(
+            raw.bytes
+                .iter()
+                .map(|b| format!("{b:02x}"))
+                .collect::<String>(),
+        ),
+        other => bail!("unsupported registry value type {:?}", other),
+    };
+    Ok(value)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn allowed() -> Vec<String> {
+        vec![r"HKCU\Software\VideoLAN".to_string()]
+    }
+
+    #[test]
+    fn test_split_key() {
+        assert_eq!(
+            split_key(r"HKEY_LOCAL_MACHINE\SOFTWARE\App\"),
+            Some(("HKLM", r"SOFTWARE\App".to_string()))
+        );
+        assert_eq!(
+            split_key(r"hkcu\Software"),
+            Some(("HKCU", "Software".to_string()))
+        );
+        assert_eq!(split_key("HKCU"), None);
+        assert_eq!(split_key(r"HKCR\.txt"), None);
+        assert_eq!(split_key(r"HKCU\Software\\App"), None);
+    }
+
+    #[test]
+    fn test_parse_payload_allowed() {
+        let req = parse_payload(
+            r#"{"key":"hkey_current_user\\software\\videolan\\VLC","value":"Version"}"#,
+            &allowed(),
+        )
+        .unwrap();
+        assert_eq!(req.hive, "HKCU");
+        assert_eq!(req.path, r"software\videolan\VLC");
+        assert_eq!(req.value, "Version");
+        // The listed key itself, default value.
+        assert!(parse_payload(r#"{"key":"HKCU\\Software\\VideoLAN"}"#, &allowed()).is_ok());
+    }
+
+    #[test]
+    fn test_parse_payload_refused() {
+        // Sibling whose name merely starts with the allowed key.
+        assert!(parse_payload(r#"{"key":"HKCU\\Software\\VideoLANX"}"#, &allowed()).is_err());
+        // Same path, other hive.
+        assert!(parse_payload(r#"{"key":"HKLM\\Software\\VideoLAN"}"#, &allowed()).is_err());
+        assert!(parse_payload(r#"{"key":"HKCU\\Software"}"#, &allowed()).is_err());
+        assert!(parse_payload("HKCU\\Software\\VideoLAN", &allowed()).is_err());
+        assert!(parse_payload(r#"{"key":"HKCU\\Software\\VideoLAN"}"#, &[]).is_err());
+    }
+}
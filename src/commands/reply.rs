@@ -0,0 +1,197 @@
+//! Request/response envelopes for commands.
+//!
+//! A command payload may be wrapped as
+//! `{"payload": ..., "reply_to": "<topic>", "correlation_id": ...}`; the
+//! command runs with the inner `payload` and the outcome is published
+//! (not retained) to `reply_to`, echoing `correlation_id`, so scripts can
+//! await a result instead of watching sensors. Commands that produce a
+//! result (`ReadRegistry`, `Echo`, `SelfTest`) add it as `value`. Anything
+//! else - plain strings, JSON without `reply_to` (e.g. notification bodies) -
+//! is passed through.
+
+use log::warn;
+use serde_json::Value;
+
+use crate::config::Config;
+
+/// Where (and under which id) to publish a command's outcome.
+#[derive(Debug, PartialEq)]
+pub(crate) struct ReplyTo {
+    topic: String,
+    correlation_id: Value,
+}
+
+/// Split an incoming payload into the payload the command should see and
+/// the optional reply address.
+pub(crate) fn unwrap_envelope(payload: &str, config: &Config) -> (String, Option<ReplyTo>) {
+    let trimmed = payload.trim_start();
+    if !trimmed.starts_with('{') {
+        return (payload.to_string(), None);
+    }
+    let Ok(Value::Object(mut env)) = serde_json::from_str::<Value>(trimmed) else {
+        return (payload.to_string(), None);
+    };
+    let Some(Value::String(topic)) = env.remove("reply_to") else {
+        return (payload.to_string(), None);
+    };
+    let inner = match env.remove("payload") {
+        None | Some(Value::Null) => String::new(),
+        Some(Value::String(s)) => s,
+        // Structured payloads (e.g. a notification body) are handed on as JSON.
+        Some(other) => other.to_string(),
+    };
+    let correlation_id = env.remove("correlation_id").unwrap_or(Value::Null);
+    if !is_valid_reply_topic(&topic, config) {
+        warn!(
+            "Ignoring reply_to '{}': not a plain topic outside the agent's own",
+            topic
+        );
+        return (inner, None);
+    }
+    (
+        inner,
+        Some(ReplyTo {
+            topic,
+            correlation_id,
+        }),
+    )
+}
+
+/// A reply must go to one concrete topic, never into HA's discovery tree or
+/// the agent's own topics (where a crafted request could overwrite entity
+/// configs or states), and never to one the agent listens on, where it would
+/// come back in as a notification or a custom-subscription command.
+fn is_valid_reply_topic(topic: &str, config: &Config) -> bool {
+    !topic.is_empty()
+        && !topic.contains(['+', '#'])
+        && !crate::config::is_agent_topic(topic)
+        && !crate::mqtt::is_subscribed_input(topic, config)
+}
+
+impl ReplyTo {
+    /// The JSON published to `reply_to` for a finished (or dropped) command.
+    /// A null result (most commands) adds no `value`.
+    pub(crate) fn body(&self, command: &str, outcome: &anyhow::Result<Value>) -> Value {
+        match outcome {
+            Ok(Value::Null) => serde_json::json!({
+                "correlation_id": self.correlation_id,
+                "command": command,
+                "status": "ok",
+            }),
+            Ok(value) => serde_json::json!({
+                "correlation_id": self.correlation_id,
+                "command": command,
+                "status": "ok",
+                "value": value,
+            }),
+            Err(e) => serde_json::json!({
+                "correlation_id": self.correlation_id,
+                "command": command,
+                "status": "error",
+                "error": e.to_string(),
+            }),
+        }
+    }
+
+    pub(crate) async fn send(
+        &self,
+        mqtt: &crate::mqtt::MqttClient,
+        command: &str,
+        outcome: &anyhow::Result<Value>,
+    ) {
+        mqtt.publish_reply(&self.topic, &self.body(command, outcome))
+            .await;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn cfg() -> Config {
+        Config::default()
+    }
+
+    #[test]
+    fn test_plain_payload_passes_through() {
+        assert_eq!(
+            unwrap_envelope("PRESS", &cfg()),
+            ("PRESS".to_string(), None)
+        );
+        // JSON without reply_to is an ordinary payload (e.g. a notification).
+        let body = r#"{"title":"Hi","message":"there"}"#;
+        assert_eq!(unwrap_envelope(body, &cfg()), (body.to_string(), None));
+    }
+
+    #[test]
+    fn test_envelope_unwrapped() {
+        let (payload, reply) = unwrap_envelope(
+            r#"{"payload":"steam:730","reply_to":"tools/replies","correlation_id":42}"#,
+            &cfg(),
+        );
+        assert_eq!(payload, "steam:730");
+        let reply = reply.unwrap();
+        assert_eq!(reply.topic, "tools/replies");
+        assert_eq!(reply.correlation_id, serde_json::json!(42));
+    }
+
+    #[test]
+    fn test_structured_inner_payload_reserialized() {
+        let (payload, reply) = unwrap_envelope(
+            r#"{"payload":{"message":"hi"},"reply_to":"r","correlation_id":"a"}"#,
+            &cfg(),
+        );
+        assert_eq!(payload, r#"{"message":"hi"}"#);
+        assert!(reply.is_some());
+    }
+
+    #[test]
+    fn test_reply_topic_restrictions() {
+        for bad in [
+            "",
+            "tools/+",
+            "tools/#",
+            "homeassistant",
+            "homeassistant/sensor/x/state",
+            "pc-bridge",
+            "pc-bridge/notifications/pc-bridge",
+            "pc-bridge/command_result/pc-bridge",
+        ] {
+            let env = serde_json::json!({ "payload": "", "reply_to": bad }).to_string();
+            let (_, reply) = unwrap_envelope(&env, &cfg());
+            assert!(reply.is_none(), "reply_to {bad:?} should be refused");
+        }
+    }
+
+    #[test]
+    fn test_reply_topic_not_a_subscribed_input() {
+        let mut config = cfg();
+        config.notification_topics = vec!["ha/notify/{device_name}".to_string()];
+        config.custom_subscriptions = vec![crate::config::CustomSubscription {
+            topic: "zigbee2mqtt/+/action".to_string(),
+            command: "Lock".to_string(),
+        }];
+        for bad in ["ha/notify/pc-bridge", "zigbee2mqtt/desk_button/action"] {
+            let env = serde_json::json!({ "payload": "", "reply_to": bad }).to_string();
+            let (_, reply) = unwrap_envelope(&env, &config);
+            assert!(reply.is_none(), "reply_to {bad:?} should be refused");
+        }
+        let env = r#"{"payload":"","reply_to":"zigbee2mqtt/replies"}"#;
+        assert!(unwrap_envelope(env, &config).1.is_some());
+    }
+
+    #[test]
+    fn test_reply_body() {
+        let (_, reply) = unwrap_envelope(r#"{"reply_to":"r","correlation_id":"abc"}"#, &cfg());
+        let reply = reply.unwrap();
+        let ok = reply.body("Lock", &Ok(Value::Null));
+        assert_eq!(ok["status"], "ok");
+        assert_eq!(ok["correlation_id"], "abc");
+        assert!(ok.get("value").is_none());
+        let read = reply.body("ReadRegistry", &Ok(Value::from("3.0.21")));
+        assert_eq!(read["value"], "3.0.21");
+        let err = reply.body("Lock", &Err(anyhow::anyhow!("boom")));
+        assert_eq!(err["status"], "error");
+        assert_eq!(err["error"], "boom");
+    }
+}
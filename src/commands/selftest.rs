@@ -0,0 +1,153 @@
+//! `SelfTest` command - "is everything working on this machine?".
+//!
+//! Runs a read-only check of each subsystem the agent leans on and publishes
+//! one report to the `command_result` topic (and as the reply `value`):
+//!
+//! `{"status": "pass", "checks": {"mqtt": {"ok": true, "detail": "..."}, ...}}`
+//!
+//! - `mqtt`: a probe published to `pc-bridge/selftest/<device>` comes back on
+//!   the agent's own subscription, so publishes really reach the broker (not
+//!   just the connection being up).
+//! - `processes`: a process snapshot can be taken (game detection, priority,
+//!   close game).
+//! - `idle`: the last-input time can be read (idle sensors, `Wake`).
+//! - `display`: the agent can reach the user's display, so the monitor and
+//!   wake commands have something to act on. Nothing is switched on or off.
+//!
+//! `status` is `pass` only when every check passed. Always available, like
+//! `Echo`, which makes it a good first button after install or an OS update.
+
+use log::{info, warn};
+use serde_json::Value;
+use std::sync::Arc;
+use std::time::Duration;
+
+use crate::AppState;
+
+/// How long the MQTT probe gets to come back.
+const MQTT_PROBE_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// Outcome of one check: Ok(detail) or Err(why it failed).
+type CheckResult = Result<String, String>;
+
+pub(crate) async fn run(state: &Arc<AppState>) -> anyhow::Result<Value> {
+    if state.dry_run {
+        crate::commands::dry_run::report("SelfTest", "", state).await;
+        return Ok(Value::Null);
+    }
+    info!("SelfTest: running");
+    let mqtt = state
+        .mqtt
+        .round_trip(MQTT_PROBE_TIMEOUT)
+        .await
+        .map(|rtt| format!("round trip {} ms", rtt.as_millis()));
+    let (processes, idle, display) =
+        tokio::task::spawn_blocking(|| (check_processes(), check_idle(), check_display())).await?;
+    let checks = [
+        ("mqtt", mqtt),
+        ("processes", processes),
+        ("idle", idle),
+        ("display", display),
+    ];
+    for (name, result) in &checks {
+        if let Err(e) = result {
+            warn!("SelfTest: {} failed: {}", name, e);
+        }
+    }
+
+    let report = report(&checks);
+    info!(
+        "SelfTest: {}",
+        report["status"].as_str().unwrap_or_default()
+    );
+    state.mqtt.publish_command_result(&report.to_string()).await;
+    Ok(report)
+}
+
+/// The published report for a list of `(check, result)`.
+fn report(checks: &[(&str, CheckResult)]) -> Value {
+    let passed = checks.iter().all(|(_, r)| r.is_ok());
+    let checks: serde_json::Map<String, Value> = checks
+        .iter()
+        .map(|(name, result)| {
+            let entry = match result {
+                Ok(detail) => serde_json::json!({ "ok": true, "detail": detail }),
+                Err(e) => serde_json::json!({ "ok": false, "detail": e }),
+            };
+            (name.to_string(), entry)
+        })
+        .collect();
+    serde_json::json!({
+        "status": if passed { "pass" } else { "fail" },
+        "checks": checks,
+    })
+}
+
+#[cfg(windows)]
+fn check_processes() -> CheckResult {
+    let processes = crate::proclist::snapshot().map_err(|e| e.to_string())?;
+    Ok(format!("{} processes", processes.len()))
+}
+
+#[cfg(unix)]
+fn check_processes() -> CheckResult {
+    let entries = std::fs::read_dir("/proc").map_err(|e| e.to_string())?;
+    let count = entries
+        .flatten()
+        .filter(|e| e.file_name().to_string_lossy().parse::<u32>().is_ok())
+        .count();
+    Ok(format!("{count} processes"))
+}
+
+#[cfg(windows)]
+fn check_idle() -> CheckResult {
+    let ms = crate::sensors::IdleSensor::get_idle_ms()
+        .ok_or("GetLastInputInfo failed (no access to the input desktop)")?;
+    Ok(format!("idle {}s", ms / 1000))
+}
+
+#[cfg(unix)]
+fn check_idle() -> CheckResult {
+    let secs = crate::sensors::IdleSensor::get_idle_seconds_blocking()
+        .ok_or("no idle time source (X11, D-Bus or ext-idle-notify)")?;
+    Ok(format!("idle {secs}s"))
+}
+
+#[cfg(windows)]
+fn check_display() -> CheckResult {
+    if crate::proclist::in_session_0() {
+        return Err("running in session 0 (service): no desktop to reach".to_string());
+    }
+    Ok("desktop session".to_string())
+}
+
+#[cfg(unix)]
+fn check_display() -> CheckResult {
+    if crate::linux_wayland::is_wayland_session() {
+        return Ok("Wayland session".to_string());
+    }
+    if crate::linux_x11::dpms_on().is_some() {
+        return Ok("X11 display".to_string());
+    }
+    Err("no X11 display or Wayland session".to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_report_fails_if_any_check_fails() {
+        let ok = report(&[("mqtt", Ok("round trip 4 ms".to_string()))]);
+        assert_eq!(ok["status"], "pass");
+        assert_eq!(ok["checks"]["mqtt"]["ok"], true);
+
+        let failed = report(&[
+            ("mqtt", Ok("round trip 4 ms".to_string())),
+            ("display", Err("no display".to_string())),
+        ]);
+        assert_eq!(failed["status"], "fail");
+        assert_eq!(failed["checks"]["display"]["detail"], "no display");
+        assert_eq!(failed["checks"]["mqtt"]["ok"], true);
+    }
+}
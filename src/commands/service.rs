@@ -0,0 +1,248 @@
+//! `ServiceControl` command - start, stop or restart an OS service.
+//!
+//! Payload is `{"service":"Spooler","action":"restart"}` or the shorthand
+//! `Spooler:restart` (what the HA select sends). Only services listed in
+//! `controllable_services` can be touched, so a compromised broker can't stop
+//! arbitrary system services. Windows goes through the Service Control
+//! Manager (the agent needs rights on the service, normally admin); Linux
+//! runs `systemctl` directly, without a shell.
+
+use anyhow::{anyhow, bail};
+use serde::Deserialize;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum ServiceAction {
+    Start,
+    Stop,
+    Restart,
+}
+
+impl ServiceAction {
+    const ALL: [Self; 3] = [Self::Start, Self::Stop, Self::Restart];
+
+    fn parse(s: &str) -> anyhow::Result<Self> {
+        match s.trim().to_ascii_lowercase().as_str() {
+            "start" => Ok(Self::Start),
+            "stop" => Ok(Self::Stop),
+            "restart" => Ok(Self::Restart),
+            _ => bail!(
+                "unknown service action '{}' (start, stop, restart)",
+                s.trim()
+            ),
+        }
+    }
+
+    pub(crate) fn as_str(self) -> &'static str {
+        match self {
+            Self::Start => "start",
+            Self::Stop => "stop",
+            Self::Restart => "restart",
+        }
+    }
+}
+
+#[derive(Deserialize)]
+struct JsonPayload {
+    service: String,
+    action: String,
+}
+
+/// A service name safe to hand to the SCM / systemctl: letters, digits and
+/// `.`, `_`, `-`, `@` (systemd template units), at most 256 characters.
+pub(crate) fn is_valid_service_name(name: &str) -> bool {
+    !name.is_empty()
+        && name.len() <= 256
+        && !name.starts_with('-')
+        && name
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '.' | '_' | '-' | '@'))
+}
+
+/// Parse a JSON or `service:action` payload and check the service against
+/// the allow-list. Returns the service name as configured.
+pub(crate) fn parse_payload(
+    payload: &str,
+    allowed: &[String],
+) -> anyhow::Result<(String, ServiceAction)> {
+    let payload = payload.trim();
+    let (service, action) = if payload.starts_with('{') {
+        let p: JsonPayload = serde_json::from_str(payload)
+            .map_err(|e| anyhow!("invalid ServiceControl payload: {}", e))?;
+        (p.service, ServiceAction::parse(&p.action)?)
+    } else {
+        let (service, action) = payload
+            .rsplit_once(':')
+            .ok_or_else(|| anyhow!("ServiceControl payload must be <service>:<action> or JSON"))?;
+        (service.to_string(), ServiceAction::parse(action)?)
+    };
+    let service = service.trim();
+    if !is_valid_service_name(service) {
+        bail!("invalid service name '{}'", service);
+    }
+    // Service names are case-insensitive on Windows; systemd units aren't,
+    // but the configured spelling is what gets used either way.
+    let configured = allowed
+        .iter()
+        .find(|s| s.eq_ignore_ascii_case(service))
+        .ok_or_else(|| anyhow!("service '{}' is not in controllable_services", service))?;
+    Ok((configured.clone(), action))
+}
+
+/// Options for the HA select: every action for every allowed service.
+pub(crate) fn select_options(allowed: &[String]) -> Vec<String> {
+    allowed
+        .iter()
+        .flat_map(|s| {
+            ServiceAction::ALL
+                .iter()
+                .map(move |a| format!("{}:{}", s, a.as_str()))
+        })
+        .collect()
+}
+
+/// Apply `action` to `service`. Blocking (a stop waits for the service to
+/// actually stop): call via `spawn_blocking`.
+#[cfg(windows)]
+pub(crate) fn control(service: &str, action: ServiceAction) -> anyhow::Result<()> {
+    use windows::Win32::Foundation::{
+        ERROR_ACCESS_DENIED, ERROR_SERVICE_ALREADY_RUNNING, ERROR_SERVICE_NOT_ACTIVE,
+    };
+    use windows::Win32::System::Services::{
+        CloseServiceHandle, ControlService, OpenSCManagerW, OpenServiceW, QueryServiceStatus,
+        SC_MANAGER_CONNECT, SERVICE_CONTROL_STOP, SERVICE_QUERY_STATUS, SERVICE_START,
+        SERVICE_STATUS, SERVICE_STOP, SERVICE_STOPPED, StartServiceW,
+    };
+    use windows::core::{HSTRING, PCWSTR};
+
+    // How long a stop may take before a restart gives up on starting again.
+    const STOP_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(30);
+
+    let denied = |e: windows::core::Error| {
+        if e.code() == ERROR_ACCESS_DENIED.to_hresult() {
+            anyhow!(
+                "access denied controlling '{}' (the agent needs admin rights)",
+                service
+            )
+        } else {
+            anyhow!("'{}': {}", service, e.message())
+        }
+    };
+
+    // SAFETY: both handles are closed on every path; SERVICE_STATUS is a plain
+    // out-struct on the stack.
+    unsafe {
+        let scm =
+            OpenSCManagerW(PCWSTR::null(), PCWSTR::null(), SC_MANAGER_CONNECT).map_err(denied)?;
+        let result = (|| {
+            let svc = OpenServiceW(
+                scm,
+                &HSTRING::from(service),
+                SERVICE_START | SERVICE_STOP | SERVICE_QUERY_STATUS,
+            )
+            .map_err(denied)?;
+            let result = (|| {
+                if matches!(action, ServiceAction::Stop | ServiceAction::Restart) {
+                    let mut status = SERVICE_STATUS::default();
+                    match ControlService(svc, SERVICE_CONTROL_STOP, &raw mut status) {
+                        Ok(()) => {}
+                        // Already stopped: nothing to wait for.
+                        Err(e) if e.code() == ERROR_SERVICE_NOT_ACTIVE.to_hresult() => {}
+                        Err(e) => return Err(denied(e)),
+                    }
+                    let deadline = std::time::Instant::now() + STOP_TIMEOUT;
+                    loop {
+                        QueryServiceStatus(svc, &raw mut status).map_err(denied)?;
+                        if status.dwCurrentState == SERVICE_STOPPED {
+                            break;
+                        }
+                        if std::time::Instant::now() >= deadline {
+                            bail!("'{}' did not stop within {:?}", service, STOP_TIMEOUT);
+                        }
+                        std::thread::sleep(std::time::Duration::from_millis(250));
+                    }
+                }
+                if matches!(action, ServiceAction::Start | ServiceAction::Restart) {
+                    match StartServiceW(svc, None) {
+                        Ok(()) => {}
+                        Err(e) if e.code() == ERROR_SERVICE_ALREADY_RUNNING.to_hresult() => {}
+                        Err(e) => return Err(denied(e)),
+                    }
+                }
+                Ok(())
+            })();
+            let _ = CloseServiceHandle(svc);
+            result
+        })();
+        let _ = CloseServiceHandle(scm);
+        result
+    }
+}
+
+#[cfg(unix)]
+pub(crate) fn control(service: &str, action: ServiceAction) -> anyhow::Result<()> {
+    // `--` so a name can never be read as an option (validation also rejects
+    // a leading '-').
+    let output = std::process::Command::new("systemctl")
+        .args([action.as_str(), "--", service])
+        .output()
+        .map_err(|e| anyhow!("failed to run systemctl: {}", e))?;
+    if !output.status.success() {
+        bail!(
+            "systemctl {} {} failed: {}",
+            action.as_str(),
+            service,
+            String::from_utf8_lossy(&output.stderr).trim()
+        );
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn allowed() -> Vec<String> {
+        vec!["Spooler".to_string(), "plexmediaserver".to_string()]
+    }
+
+    #[test]
+    fn test_parse_payload() {
+        assert_eq!(
+            parse_payload(r#"{"service":"Spooler","action":"restart"}"#, &allowed()).unwrap(),
+            ("Spooler".to_string(), ServiceAction::Restart)
+        );
+        // Shorthand, matched case-insensitively against the configured name.
+        assert_eq!(
+            parse_payload("spooler:Stop", &allowed()).unwrap(),
+            ("Spooler".to_string(), ServiceAction::Stop)
+        );
+    }
+
+    #[test]
+    fn test_parse_payload_rejects() {
+        let allowed = allowed();
+        assert!(parse_payload("Spooler", &allowed).is_err()); // no action
+        assert!(parse_payload("Spooler:pause", &allowed).is_err()); // unknown action
+        assert!(parse_payload("WinDefend:stop", &allowed).is_err()); // not allowed
+        assert!(parse_payload("a b;rm:stop", &allowed).is_err()); // unsafe name
+        assert!(parse_payload(r#"{"service":"Spooler"}"#, &allowed).is_err());
+        assert!(parse_payload("Spooler:stop", &[]).is_err()); // empty allow-list
+    }
+
+    #[test]
+    fn test_is_valid_service_name() {
+        assert!(is_valid_service_name("Spooler"));
+        assert!(is_valid_service_name("getty@tty1.service"));
+        assert!(!is_valid_service_name(""));
+        assert!(!is_valid_service_name("--now"));
+        assert!(!is_valid_service_name("Print Spooler"));
+    }
+
+    #[test]
+    fn test_select_options() {
+        assert_eq!(
+            select_options(&["Spooler".to_string()]),
+            ["Spooler:start", "Spooler:stop", "Spooler:restart"]
+        );
+    }
+}
@@ -0,0 +1,98 @@
+//! Command concurrency slots.
+//!
+//! The executor runs at most `MAX_CONCURRENT_COMMANDS` commands at once; a
+//! command that arrives with every slot taken is dropped. The slots live in
+//! `AppState` rather than the executor so the `command_slots_used` sensor can
+//! report how many are taken, and how many commands were dropped for want of
+//! one or by `command_rate_limits`, which otherwise only shows up in the log.
+
+use std::sync::Arc;
+use std::sync::atomic::{AtomicU64, Ordering};
+use tokio::sync::{OwnedSemaphorePermit, Semaphore};
+
+pub(crate) const MAX_CONCURRENT_COMMANDS: usize = 5;
+
+pub struct CommandSlots {
+    semaphore: Arc<Semaphore>,
+    dropped_busy: AtomicU64,
+    dropped_rate_limited: AtomicU64,
+}
+
+impl Default for CommandSlots {
+    fn default() -> Self {
+        Self {
+            semaphore: Arc::new(Semaphore::new(MAX_CONCURRENT_COMMANDS)),
+            dropped_busy: AtomicU64::new(0),
+            dropped_rate_limited: AtomicU64::new(0),
+        }
+    }
+}
+
+impl CommandSlots {
+    /// Take a slot for one command, held until the permit is dropped. None
+    /// (counted as a drop) when every slot is in use.
+    pub(crate) fn try_acquire(&self) -> Option<OwnedSemaphorePermit> {
+        let permit = self.semaphore.clone().try_acquire_owned().ok();
+        if permit.is_none() {
+            self.dropped_busy.fetch_add(1, Ordering::Relaxed);
+        }
+        permit
+    }
+
+    /// Count a command dropped by its `command_rate_limits` budget.
+    pub(crate) fn note_rate_limited(&self) {
+        self.dropped_rate_limited.fetch_add(1, Ordering::Relaxed);
+    }
+
+    pub(crate) fn snapshot(&self) -> SlotUsage {
+        SlotUsage {
+            used: MAX_CONCURRENT_COMMANDS - self.semaphore.available_permits(),
+            dropped_busy: self.dropped_busy.load(Ordering::Relaxed),
+            dropped_rate_limited: self.dropped_rate_limited.load(Ordering::Relaxed),
+        }
+    }
+}
+
+/// Slot usage at one moment, as published by the `command_slots_used` sensor.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct SlotUsage {
+    pub used: usize,
+    /// Commands dropped since startup because every slot was taken.
+    pub dropped_busy: u64,
+    /// Commands dropped since startup by `command_rate_limits`.
+    pub dropped_rate_limited: u64,
+}
+
+impl SlotUsage {
+    pub(crate) fn attributes(&self) -> serde_json::Value {
+        serde_json::json!({
+            "max": MAX_CONCURRENT_COMMANDS,
+            "dropped_busy": self.dropped_busy,
+            "dropped_rate_limited": self.dropped_rate_limited,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_slots_count_usage_and_drops() {
+        let slots = CommandSlots::default();
+        let permits: Vec<_> = (0..MAX_CONCURRENT_COMMANDS)
+            .map(|_| slots.try_acquire().unwrap())
+            .collect();
+        assert!(slots.try_acquire().is_none());
+        slots.note_rate_limited();
+        let usage = slots.snapshot();
+        assert_eq!(usage.used, MAX_CONCURRENT_COMMANDS);
+        assert_eq!(usage.dropped_busy, 1);
+        assert_eq!(usage.dropped_rate_limited, 1);
+        assert_eq!(usage.attributes()["max"], MAX_CONCURRENT_COMMANDS);
+
+        drop(permits);
+        assert_eq!(slots.snapshot().used, 0);
+        assert!(slots.try_acquire().is_some());
+    }
+}
@@ -0,0 +1,213 @@
+//! Switch commands: stateful on/off entities.
+//!
+//! A switch is registered as an HA `switch` whose command topic is the usual
+//! `<name>/action` topic (so subscription and routing are shared with
+//! buttons) plus a retained `ON`/`OFF` state topic. The executor hands switch
+//! commands to [`run`], which applies the request, reads the real state back
+//! and publishes it; [`SwitchStateSync`] republishes on reconnect and picks up
+//! changes made outside HA (e.g. the keyboard mute key).
+
+use log::{debug, info, warn};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+use crate::config::FeatureConfig;
+
+/// Every native switch command.
+pub(crate) const SWITCHES: &[&str] = &["Mute", "NightLight", "GameMode", "KeepAwake"];
+
+/// How often switch states are re-read to catch changes made outside HA.
+const POLL_INTERVAL: Duration = Duration::from_secs(2);
+
+pub(crate) fn is_switch(name: &str) -> bool {
+    SWITCHES.contains(&name)
+}
+
+/// What a switch payload asks for.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum SwitchAction {
+    On,
+    Off,
+    /// Empty payload (or `PRESS`/`TOGGLE`): flip the current state, so the
+    /// command still works from a plain button or script.
+    Toggle,
+}
+
+impl SwitchAction {
+    pub(crate) fn parse(payload: &str) -> Option<Self> {
+        let p = payload.trim();
+        if p.is_empty() || p.eq_ignore_ascii_case("press") || p.eq_ignore_ascii_case("toggle") {
+            Some(Self::Toggle)
+        } else if p.eq_ignore_ascii_case("on") || p.eq_ignore_ascii_case("true") || p == "1" {
+            Some(Self::On)
+        } else if p.eq_ignore_ascii_case("off") || p.eq_ignore_ascii_case("false") || p == "0" {
+            Some(Self::Off)
+        } else {
+            None
+        }
+    }
+}
+
+/// Current state of a switch, or None if it can't be read right now.
+/// Blocking: call via `spawn_blocking`.
+pub(crate) fn current(name: &str) -> Option<bool> {
+    match name {
+        "Mute" => crate::audio::get_mute(),
+        #[cfg(windows)]
+        "NightLight" => crate::night_light::get(),
+        "GameMode" => Some(super::game_mode::is_active()),
+        "KeepAwake" => Some(super::keep_awake::is_active()),
+        _ => None,
+    }
+}
+
+/// Apply `action` and return the state read back afterwards.
+/// Blocking: call via `spawn_blocking`.
+fn apply(name: &str, action: SwitchAction) -> anyhow::Result<bool> {
+    let ok = match (name, action) {
+        ("Mute", SwitchAction::Toggle) => crate::audio::toggle_mute(),
+        ("Mute", SwitchAction::On) => crate::audio::set_mute(true),
+        ("Mute", SwitchAction::Off) => crate::audio::set_mute(false),
+        #[cfg(windows)]
+        ("NightLight", SwitchAction::Toggle) => crate::night_light::toggle(),
+        #[cfg(windows)]
+        ("NightLight", SwitchAction::On) => crate::night_light::set(true),
+        #[cfg(windows)]
+        ("NightLight", SwitchAction::Off) => crate::night_light::set(false),
+        #[cfg(not(windows))]
+        ("NightLight", _) => anyhow::bail!("NightLight is only supported on Windows"),
+        ("KeepAwake", SwitchAction::Toggle) => {
+            super::keep_awake::set(!super::keep_awake::is_active())
+        }
+        ("KeepAwake", SwitchAction::On) => super::keep_awake::set(true),
+        ("KeepAwake", SwitchAction::Off) => super::keep_awake::set(false),
+        _ => anyhow::bail!("'{}' is not a switch", name),
+    };
+    if !ok {
+        anyhow::bail!("failed to set '{}'", name);
+    }
+    current(name).ok_or_else(|| anyhow::anyhow!("cannot read '{}' state back", name))
+}
+
+/// Execute a switch command and publish the resulting state.
+pub(crate) async fn run(name: &str, payload: &str, state: &AppState) -> anyhow::Result<()> {
+    let action = SwitchAction::parse(payload)
+        .ok_or_else(|| anyhow::anyhow!("{} expects ON, OFF or TOGGLE, got '{}'", name, payload))?;
+    let on = if name == "GameMode" {
+        // Dispatches other commands instead of touching the OS.
+        super::game_mode::apply(action, state).await?
+    } else {
+        let switch = name.to_string();
+        tokio::task::spawn_blocking(move || apply(&switch, action)).await??
+    };
+    state.mqtt.publish_switch_state(name, on).await;
+    Ok(())
+}
+
+/// Switches currently enabled by their feature flag.
+pub(crate) fn enabled_switches(f: &FeatureConfig) -> Vec<&'static str> {
+    SWITCHES
+        .iter()
+        .copied()
+        .filter(|name| super::command_feature_enabled(name, f))
+        .collect()
+}
+
+/// Keeps the switch state topics in step with the machine.
+pub struct SwitchStateSync {
+    state: Arc<AppState>,
+}
+
+impl SwitchStateSync {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut tick = interval(POLL_INTERVAL);
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev: Vec<(&'static str, bool)> = Vec::new();
+
+        info!("Switch state sync started");
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Switch state sync shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev.clear();
+                }
+                _ = tick.tick() => {
+                    let names = enabled_switches(&self.state.config.read().await.features);
+                    let Ok(now) = tokio::task::spawn_blocking(move || {
+                        names
+                            .into_iter()
+                            .filter_map(|n| current(n).map(|on| (n, on)))
+                            .collect::<Vec<_>>()
+                    })
+                    .await
+                    else {
+                        warn!("Switch state read panicked");
+                        continue;
+                    };
+                    for &(name, on) in &now {
+                        if !prev.contains(&(name, on)) {
+                            self.state.mqtt.publish_switch_state(name, on).await;
+                        }
+                    }
+                    prev = now;
+                }
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_switch_action() {
+        assert_eq!(SwitchAction::parse("ON"), Some(SwitchAction::On));
+        assert_eq!(SwitchAction::parse("off"), Some(SwitchAction::Off));
+        assert_eq!(SwitchAction::parse("true"), Some(SwitchAction::On));
+        assert_eq!(SwitchAction::parse("0"), Some(SwitchAction::Off));
+        assert_eq!(SwitchAction::parse(""), Some(SwitchAction::Toggle));
+        assert_eq!(SwitchAction::parse("PRESS"), Some(SwitchAction::Toggle));
+        assert_eq!(SwitchAction::parse(" toggle "), Some(SwitchAction::Toggle));
+        assert_eq!(SwitchAction::parse("maybe"), None);
+    }
+
+    #[test]
+    fn test_enabled_switches_follow_feature() {
+        let off = FeatureConfig {
+            media_controls: false,
+            ..FeatureConfig::default()
+        };
+        assert!(enabled_switches(&off).is_empty());
+        let on = FeatureConfig {
+            media_controls: true,
+            ..FeatureConfig::default()
+        };
+        assert_eq!(enabled_switches(&on), ["Mute"]);
+        let night = FeatureConfig {
+            media_controls: false,
+            night_light: true,
+            ..FeatureConfig::default()
+        };
+        // Night Light is Windows-only.
+        assert_eq!(enabled_switches(&night).len(), usize::from(cfg!(windows)));
+        let awake = FeatureConfig {
+            media_controls: false,
+            keep_awake: true,
+            ..FeatureConfig::default()
+        };
+        assert_eq!(enabled_switches(&awake), ["KeepAwake"]);
+    }
+}
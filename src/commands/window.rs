@@ -0,0 +1,167 @@
+//! Window commands for a running process's topmost visible window.
+//!
+//! `MoveWindow` moves and resizes it. Payload is
+//! `{"process":"msedge","x":1920,"y":0,"w":1920,"h":1080}`, in virtual-screen
+//! pixels (a monitor left of the primary has negative x); a maximized window
+//! is restored first, since Windows ignores a new size on a maximized window.
+//!
+//! `FocusWindow` brings it to the foreground. Payload is the bare process
+//! name, e.g. `vlc` (checked with `commands::parse_process_name`); a minimized
+//! window is restored first.
+//!
+//! Windows only.
+
+use anyhow::{anyhow, bail};
+use serde::Deserialize;
+
+/// Largest width/height accepted. Bigger than any real desktop; it only stops
+/// a typo from asking for a window millions of pixels wide.
+const MAX_EXTENT: i32 = 32_768;
+
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+pub(crate) struct MoveRequest {
+    /// Process name, `.exe` optional
+    pub process: String,
+    pub x: i32,
+    pub y: i32,
+    pub w: i32,
+    pub h: i32,
+}
+
+/// Parse and validate a `MoveWindow` payload.
+pub(crate) fn parse_payload(payload: &str) -> anyhow::Result<MoveRequest> {
+    let mut req: MoveRequest = serde_json::from_str(payload.trim())
+        .map_err(|e| anyhow!("invalid MoveWindow payload: {}", e))?;
+    req.process = crate::commands::parse_process_name(&req.process)?;
+    if !(1..=MAX_EXTENT).contains(&req.w) || !(1..=MAX_EXTENT).contains(&req.h) {
+        bail!(
+            "window size {}x{} out of range (1-{})",
+            req.w,
+            req.h,
+            MAX_EXTENT
+        );
+    }
+    let extent = -MAX_EXTENT..=MAX_EXTENT;
+    if !extent.contains(&req.x) || !extent.contains(&req.y) {
+        bail!("window position {},{} out of range", req.x, req.y);
+    }
+    Ok(req)
+}
+
+/// Topmost visible window of `process`. Errors if the process isn't running
+/// or has no visible window.
+#[cfg(windows)]
+fn find_window(process: &str) -> anyhow::Result<windows::Win32::Foundation::HWND> {
+    let exe = format!("{}.exe", process);
+    let pids: Vec<u32> = crate::proclist::snapshot()?
+        .into_iter()
+        .filter(|p| p.name.eq_ignore_ascii_case(&exe) || p.name.eq_ignore_ascii_case(process))
+        .map(|p| p.pid)
+        .collect();
+    if pids.is_empty() {
+        bail!("no running process named '{}'", process);
+    }
+    crate::proclist::visible_windows()
+        .into_iter()
+        .find(|(_, pid)| pids.contains(pid))
+        .map(|(hwnd, _)| hwnd)
+        .ok_or_else(|| anyhow!("'{}' has no visible window", process))
+}
+
+/// Move the topmost visible window of `req.process`.
+#[cfg(windows)]
+pub(crate) fn move_window(req: &MoveRequest) -> anyhow::Result<()> {
+    use windows::Win32::UI::WindowsAndMessaging::{
+        IsZoomed, SW_RESTORE, SWP_NOACTIVATE, SWP_NOZORDER, SetWindowPos, ShowWindow,
+    };
+
+    let hwnd = find_window(&req.process)?;
+    // SAFETY: hwnd came from EnumWindows just now; if the window has closed
+    // since, the calls fail harmlessly.
+    unsafe {
+        if IsZoomed(hwnd).as_bool() {
+            let _ = ShowWindow(hwnd, SW_RESTORE);
+        }
+        SetWindowPos(
+            hwnd,
+            None,
+            req.x,
+            req.y,
+            req.w,
+            req.h,
+            SWP_NOZORDER | SWP_NOACTIVATE,
+        )
+        .map_err(|e| anyhow!("SetWindowPos failed for '{}': {}", req.process, e.message()))?;
+    }
+    Ok(())
+}
+
+/// Bring the topmost visible window of `process` to the foreground.
+///
+/// Windows only lets the foreground process hand out focus, and a background
+/// service isn't it, so a bare SetForegroundWindow just flashes the taskbar
+/// button. Attaching to the foreground window's input queue for the call
+/// makes Windows treat it as coming from the app that has focus.
+#[cfg(windows)]
+pub(crate) fn focus_window(process: &str) -> anyhow::Result<()> {
+    use windows::Win32::System::Threading::{AttachThreadInput, GetCurrentThreadId};
+    use windows::Win32::UI::WindowsAndMessaging::{
+        ASFW_ANY, AllowSetForegroundWindow, BringWindowToTop, GetForegroundWindow,
+        GetWindowThreadProcessId, IsIconic, SW_RESTORE, SetForegroundWindow, ShowWindow,
+    };
+
+    let hwnd = find_window(process)?;
+
+    // SAFETY: hwnd came from EnumWindows just now; if the window has closed
+    // since, the calls fail harmlessly. The input queues are detached again
+    // before returning.
+    let focused = unsafe {
+        if IsIconic(hwnd).as_bool() {
+            let _ = ShowWindow(hwnd, SW_RESTORE);
+        }
+        let _ = AllowSetForegroundWindow(ASFW_ANY);
+        let current = GetCurrentThreadId();
+        let foreground = GetWindowThreadProcessId(GetForegroundWindow(), None);
+        let attached = foreground != 0
+            && foreground != current
+            && AttachThreadInput(current, foreground, true).as_bool();
+        let focused = SetForegroundWindow(hwnd).as_bool();
+        let _ = BringWindowToTop(hwnd);
+        if attached {
+            let _ = AttachThreadInput(current, foreground, false);
+        }
+        focused
+    };
+    if !focused {
+        bail!("Windows refused to bring '{}' to the front", process);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_payload() {
+        assert_eq!(
+            parse_payload(r#"{"process":"msedge.exe","x":-1920,"y":0,"w":1920,"h":1080}"#).unwrap(),
+            MoveRequest {
+                process: "msedge".to_string(),
+                x: -1920,
+                y: 0,
+                w: 1920,
+                h: 1080,
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_payload_rejects() {
+        assert!(parse_payload("notepad").is_err()); // not JSON
+        assert!(parse_payload(r#"{"process":"notepad","x":0,"y":0}"#).is_err()); // no size
+        assert!(parse_payload(r#"{"process":"a b;rm","x":0,"y":0,"w":8,"h":8}"#).is_err());
+        assert!(parse_payload(r#"{"process":"notepad","x":0,"y":0,"w":0,"h":600}"#).is_err());
+        assert!(parse_payload(r#"{"process":"notepad","x":0,"y":0,"w":800,"h":99999}"#).is_err());
+    }
+}
@@ -5,11 +5,20 @@ use log::{error, info, warn};
 use notify::{Event, EventKind, RecursiveMode, Watcher};
 use serde::{Deserialize, Serialize};
 use std::collections::HashMap;
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
 use std::sync::Arc;
 
 use crate::AppState;
 
+/// Upper bound for `shutdown_grace_secs` (10 minutes).
+const MAX_SHUTDOWN_GRACE_SECS: u64 = 600;
+
+/// Upper bound for a custom command's `timeout_secs` (1 hour).
+const MAX_CUSTOM_COMMAND_TIMEOUT_SECS: u64 = 3600;
+
+/// Notification topic used when `notification_topics` is empty.
+const DEFAULT_NOTIFICATION_TOPIC: &str = "pc-bridge/notifications/{device_name}";
+
 /// User configuration structure (matches userConfig.json)
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct Config {
@@ -23,6 +32,23 @@ pub struct Config {
     /// Can be simple string (game_id) or object with app_id
     #[serde(default)]
     pub games: HashMap<String, GameConfig>,
+    /// Process-name substrings that are never treated as a game, even when they
+    /// match a `games` pattern (e.g. `launcher`, `crashhandler`, `setup`).
+    /// Case-insensitive; checked before pattern matching.
+    #[serde(default)]
+    pub game_exclusions: Vec<String>,
+
+    /// game_ids in the order they should win when one process matches
+    /// patterns of several games (e.g. a launcher and its game). Unlisted
+    /// games come after, longest pattern first; see [`prioritized_games`].
+    #[serde(default)]
+    pub game_priority: Vec<String>,
+
+    /// Commands run when a game (by game_id) is detected starting or
+    /// stopping, e.g. raise its priority on start and revert on exit. Fired
+    /// once detection has been stable for a few seconds.
+    #[serde(default)]
+    pub game_hooks: HashMap<String, GameHooks>,
 
     /// Allow custom sensor polling via PowerShell/WMI/registry
     #[serde(default)]
@@ -69,10 +95,129 @@ pub struct Config {
     #[serde(default)]
     pub disk_sensor_paths: Vec<String>,
 
+    /// Services (systemd units on Linux) the `ServiceControl` command may
+    /// start, stop or restart. Anything not listed is refused.
+    #[serde(default)]
+    pub controllable_services: Vec<String>,
+
+    /// Processes (e.g. `cs2.exe`) whose windows get a `fullscreen_<name>`
+    /// sensor reporting whether they cover a whole monitor, and which one.
+    /// Windows only; needs the `window_fullscreen` feature.
+    #[serde(default)]
+    pub fullscreen_windows: Vec<String>,
+
+    /// Log output settings. Read once at startup (logging starts before the
+    /// config is loaded), so changes need a restart.
+    #[serde(default)]
+    pub logging: LoggingConfig,
+
     #[serde(default)]
     pub custom_sensors: Vec<CustomSensor>,
     #[serde(default)]
     pub custom_commands: Vec<CustomCommand>,
+
+    /// Optional per-command rate limits: command name (native or custom) →
+    /// token bucket. Commands without an entry are only bound by the global
+    /// concurrency cap.
+    #[serde(default)]
+    pub command_rate_limits: HashMap<String, CommandRateLimit>,
+
+    /// Extra MQTT topic filters (wildcards allowed) routed to a command, for
+    /// driving the agent from non-HA dashboards with their own topic scheme.
+    /// Subscribed at startup; changes need a restart.
+    #[serde(default)]
+    pub custom_subscriptions: Vec<CustomSubscription>,
+
+    /// Seconds between announcing `shutting_down` and actually powering off,
+    /// counted down on the sleep_state attributes. 0 = shut down right away.
+    #[serde(default)]
+    pub shutdown_grace_secs: u64,
+
+    /// Whether the `Wake` command runs the full display-wake sequence (monitor
+    /// power on + benign keypress) or only dismisses the screensaver. Default
+    /// on, so a DPMS-blanked monitor comes back too.
+    #[serde(default = "default_true")]
+    pub wake_turns_on_display: bool,
+
+    /// Publish every sensor value in one retained JSON object on
+    /// `homeassistant/sensor/<device>/state` instead of one topic per sensor;
+    /// discovery points each entity into it with a `value_template`. Fewer
+    /// messages on constrained brokers. Read at startup; changes need a restart.
+    #[serde(default)]
+    pub bundle_state: bool,
+
+    /// Count game controller input (XInput) as activity for `idle_seconds` /
+    /// `lastactive`, which otherwise only see keyboard and mouse. Windows only.
+    #[serde(default)]
+    pub idle_include_gamepad: bool,
+
+    /// Skip the resume wake sequence's keypress and sleep hold when there was
+    /// keyboard/mouse input in the last few seconds: the user woke the PC
+    /// themselves and the display is already on. Windows only.
+    #[serde(default = "default_true")]
+    pub wake_skip_when_active: bool,
+
+    /// On resume, drop and redial the broker connection straight away rather
+    /// than waiting for keepalive to notice the socket died during sleep.
+    #[serde(default)]
+    pub reconnect_on_wake: bool,
+
+    /// Discovery overrides keyed by entity id as it appears in the topic
+    /// (`runninggames`, `Shutdown`, `custom_<name>`), e.g.
+    /// `{"runninggames": {"icon": "mdi:controller"}}`.
+    #[serde(default)]
+    pub entities: HashMap<String, EntityOverride>,
+
+    /// When a reload finds no games at all (e.g. an empty `{}` saved by
+    /// mistake) but some were configured before, keep the previous games
+    /// instead of silently detecting nothing.
+    #[serde(default = "default_true")]
+    pub keep_games_on_empty_reload: bool,
+
+    /// Device details shown on the HA device page. Read at startup.
+    #[serde(default)]
+    pub device: DeviceConfig,
+
+    /// Second broker that gets a copy of every sensor state/attribute
+    /// publish. Publish-only; commands come from `mqtt` alone. Read at startup.
+    #[serde(default)]
+    pub mirror: Option<MqttConfig>,
+
+    /// Topics (wildcards allowed) that deliver notifications, with
+    /// `{device_name}` filled in. The first is the notify entity's command
+    /// topic. Empty = `pc-bridge/notifications/{device_name}`. Read at startup.
+    #[serde(default)]
+    pub notification_topics: Vec<String>,
+
+    /// Toasts shown per minute before further notifications are dropped, so
+    /// a runaway automation can't flood the desktop. A `notification` entry
+    /// in `command_rate_limits` takes precedence. 0 = unlimited.
+    #[serde(default = "default_max_notifications_per_minute")]
+    pub max_notifications_per_minute: u32,
+
+    /// Registry keys (e.g. `HKCU\Software\VideoLAN`) the `ReadRegistry`
+    /// command may read values from, subkeys included. Anything else is
+    /// refused.
+    #[serde(default)]
+    pub readable_registry_keys: Vec<String>,
+
+    /// Payloads that mean "no payload" on an HA button's command topic: HA
+    /// buttons send `PRESS`, which the command reads as empty. Matched
+    /// case-insensitively. Payloads from custom subscriptions, envelopes and
+    /// local dispatches are never blanked, so a literal "press" gets through.
+    #[serde(default = "default_button_payloads")]
+    pub button_payloads: Vec<String>,
+
+    /// What the `GameMode` switch does: commands run when it's turned on,
+    /// and others when it's turned off (requires `game_mode`).
+    #[serde(default)]
+    pub game_mode: GameModeConfig,
+
+    /// Require commands from MQTT to be signed with a shared key, so anyone
+    /// else who can publish to the broker can't run them. Off unless
+    /// `hmac_key` is set.
+    #[serde(default)]
+    pub command_auth: CommandAuthConfig,
 }
 
 impl Default for Config {
@@ -84,6 +229,7 @@ impl Default for Config {
                 user: String::new(),
                 pass: String::new(),
                 client_id: None,
+                client_cert: None,
             },
             intervals: IntervalConfig::default(),
             features: FeatureConfig::default(),
@@ -100,8 +246,144 @@ impl Default for Config {
             disk_sensor_paths: Vec::new(),
             custom_sensors: Vec::new(),
             custom_commands: Vec::new(),
+            game_exclusions: Vec::new(),
+            command_rate_limits: HashMap::new(),
+            custom_subscriptions: Vec::new(),
+            shutdown_grace_secs: 0,
+            wake_turns_on_display: true,
+            controllable_services: Vec::new(),
+            logging: LoggingConfig::default(),
+            game_priority: Vec::new(),
+            fullscreen_windows: Vec::new(),
+            bundle_state: false,
+            game_hooks: HashMap::new(),
+            idle_include_gamepad: false,
+            wake_skip_when_active: true,
+            reconnect_on_wake: false,
+            entities: HashMap::new(),
+            keep_games_on_empty_reload: true,
+            device: DeviceConfig::default(),
+            mirror: None,
+            notification_topics: Vec::new(),
+            max_notifications_per_minute: 10,
+            readable_registry_keys: Vec::new(),
+            button_payloads: default_button_payloads(),
+            game_mode: GameModeConfig::default(),
+            command_auth: CommandAuthConfig::default(),
+        }
+    }
+}
+
+/// True when `process_name` contains any of the (already lowercased)
+/// `exclusions` as a case-insensitive substring.
+pub fn is_excluded_process(process_name: &str, exclusions: &[String]) -> bool {
+    if exclusions.is_empty() {
+        return false;
+    }
+    let lowered = process_name.to_lowercase();
+    exclusions.iter().any(|e| lowered.contains(e.as_str()))
+}
+
+/// The pattern of a `glob:` games key (prefix case-insensitive), or None for
+/// a plain prefix key.
+pub fn game_glob(key: &str) -> Option<&str> {
+    let prefix = key.get(..5)?;
+    prefix.eq_ignore_ascii_case("glob:").then(|| &key[5..])
+}
+
+/// Case-insensitive (ASCII) glob match of the whole `name`: `*` matches any
+/// run of characters, `?` exactly one, anything else itself.
+pub fn glob_match(pattern: &str, name: &str) -> bool {
+    let (p, n) = (pattern.as_bytes(), name.as_bytes());
+    let (mut pi, mut ni) = (0, 0);
+    // Where the last `*` was, and the name position it currently covers up to.
+    let mut star: Option<(usize, usize)> = None;
+    while ni < n.len() {
+        match p.get(pi) {
+            Some(b'*') => {
+                star = Some((pi, ni));
+                pi += 1;
+            }
+            Some(&c) if c == b'?' || c.eq_ignore_ascii_case(&n[ni]) => {
+                pi += 1;
+                ni += 1;
+            }
+            _ => match star {
+                // Let the last `*` swallow one more character and retry.
+                Some((sp, sn)) => {
+                    star = Some((sp, sn + 1));
+                    pi = sp + 1;
+                    ni = sn + 1;
+                }
+                None => return false,
+            },
+        }
+    }
+    p[pi..].iter().all(|&c| c == b'*')
+}
+
+/// The directory passed as `--config-dir <dir>` or `--config-dir=<dir>`, if
+/// any. The last occurrence wins.
+pub fn config_dir_arg(args: impl IntoIterator<Item = String>) -> Option<String> {
+    let mut args = args.into_iter();
+    let mut dir = None;
+    while let Some(arg) = args.next() {
+        if arg == "--config-dir" {
+            dir = args.next();
+        } else if let Some(value) = arg.strip_prefix("--config-dir=") {
+            dir = Some(value.to_string());
         }
     }
+    dir.filter(|d| !d.is_empty())
+}
+
+/// Sensor id for a `fullscreen_windows` entry: `fullscreen_` plus the process
+/// name without `.exe`, lowercased, with anything but `[a-z0-9]` replaced by
+/// `_`. None if nothing usable is left.
+pub fn fullscreen_sensor_id(process: &str) -> Option<String> {
+    let lower = process.trim().to_ascii_lowercase();
+    let stem = lower.strip_suffix(".exe").unwrap_or(&lower);
+    if stem.is_empty() {
+        return None;
+    }
+    let slug: String = stem
+        .chars()
+        .map(|c| if c.is_ascii_alphanumeric() { c } else { '_' })
+        .collect();
+    Some(format!("fullscreen_{}", slug))
+}
+
+/// The `games` entries in detection order, so matching never depends on
+/// `HashMap` iteration order: games listed in `priority` (game_ids,
+/// case-insensitive) first in that order, then longer - more specific -
+/// patterns before shorter ones, then alphabetically.
+pub fn prioritized_games<'a>(
+    games: &'a HashMap<String, GameConfig>,
+    priority: &[String],
+) -> Vec<(&'a String, &'a GameConfig)> {
+    let rank = |gc: &GameConfig| {
+        priority
+            .iter()
+            .position(|id| id.eq_ignore_ascii_case(gc.game_id()))
+            .unwrap_or(usize::MAX)
+    };
+    let mut ordered: Vec<_> = games.iter().collect();
+    ordered.sort_by(|(pa, ga), (pb, gb)| {
+        rank(ga)
+            .cmp(&rank(gb))
+            .then(pb.len().cmp(&pa.len()))
+            .then_with(|| pa.to_lowercase().cmp(&pb.to_lowercase()))
+            .then_with(|| pa.cmp(pb))
+    });
+    ordered
+}
+
+fn default_max_notifications_per_minute() -> u32 {
+    10
+}
+
+fn default_button_payloads() -> Vec<String> {
+    vec!["PRESS".to_string()]
 }
 
 fn default_true() -> bool {
@@ -270,6 +552,8 @@ pub struct FeatureConfig {
     #[serde(default = "default_true")]
     pub cmd_monitor: bool,
     #[serde(default)]
+    pub cmd_priority: bool,
+    #[serde(default)]
     pub notifications: bool,
     #[serde(default)]
     pub cpu_sensor: bool,
@@ -305,6 +589,57 @@ pub struct FeatureConfig {
     pub uptime_sensor: bool,
     #[serde(default)]
     pub hwinfo_sensor: bool,
+    #[serde(default)]
+    pub focus_assist: bool,
+    #[serde(default)]
+    pub process_count: bool,
+    #[serde(default)]
+    pub vram_sensor: bool,
+    #[serde(default)]
+    pub cmd_service: bool,
+    #[serde(default)]
+    pub audio_peak: bool,
+    #[serde(default)]
+    pub window_fullscreen: bool,
+    #[serde(default)]
+    pub cmd_window: bool,
+    #[serde(default)]
+    pub windows_version: bool,
+    #[serde(default)]
+    pub cmd_mouse: bool,
+    #[serde(default)]
+    pub metered_connection: bool,
+    #[serde(default)]
+    pub remote_session: bool,
+    /// HA device triggers for power events (woke, going to sleep, lid);
+    /// fired by the sleep_wake listener.
+    #[serde(default)]
+    pub device_triggers: bool,
+    #[serde(default)]
+    pub cmd_registry: bool,
+    /// Publish a `heartbeat` counter every `intervals.heartbeat` seconds, so
+    /// HA can tell a stalled agent from a disconnected one.
+    #[serde(default)]
+    pub heartbeat: bool,
+    /// `NightLight` switch for Windows Night Light (blue-light reduction).
+    #[serde(default)]
+    pub night_light: bool,
+    /// `GameMode` switch, running the `game_mode` steps.
+    #[serde(default)]
+    pub game_mode: bool,
+    /// `command_slots_used` sensor: busy command slots and dropped commands.
+    #[serde(default)]
+    pub command_slots: bool,
+    /// `RestartExplorer` button: restart a hung desktop shell (Windows).
+    #[serde(default)]
+    pub cmd_explorer: bool,
+    /// `tcp_connections` sensor: established non-loopback TCP connections.
+    #[serde(default)]
+    pub tcp_connections: bool,
+    /// `KeepAwake` switch: hold off sleep, the screensaver and the display
+    /// timeout while it's on.
+    #[serde(default)]
+    pub keep_awake: bool,
 }
 
 impl Default for FeatureConfig {
@@ -342,6 +677,27 @@ impl Default for FeatureConfig {
             disk_sensor: false,
             uptime_sensor: false,
             hwinfo_sensor: false,
+            focus_assist: false,
+            process_count: false,
+            cmd_priority: false,
+            vram_sensor: false,
+            cmd_service: false,
+            audio_peak: false,
+            window_fullscreen: false,
+            cmd_window: false,
+            windows_version: false,
+            cmd_mouse: false,
+            metered_connection: false,
+            remote_session: false,
+            device_triggers: false,
+            cmd_registry: false,
+            heartbeat: false,
+            night_light: false,
+            game_mode: false,
+            command_slots: false,
+            cmd_explorer: false,
+            tcp_connections: false,
+            keep_awake: false,
         }
     }
 }
@@ -404,6 +760,180 @@ pub struct CustomCommand {
     pub args: Option<Vec<String>>,
     #[serde(default)]
     pub command: Option<String>,
+    /// Wait for the command to exit before the run counts as done, so a
+    /// `reply_to` reply reports its real outcome (non-zero exit = error).
+    #[serde(default)]
+    pub wait: bool,
+    /// How long a `wait` command may run before it's killed (default 60s,
+    /// at most an hour).
+    #[serde(default)]
+    pub timeout_secs: Option<u64>,
+}
+
+/// Allow at most `max` runs of a command per `per_secs` seconds.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+pub struct CommandRateLimit {
+    pub max: u32,
+    pub per_secs: u64,
+}
+
+/// `game_hooks` entry: commands run when the game starts and when it exits.
+#[derive(Debug, Clone, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct GameHooks {
+    #[serde(default)]
+    pub on_start: Vec<HookCommand>,
+    #[serde(default)]
+    pub on_exit: Vec<HookCommand>,
+}
+
+/// A command a game hook runs: a native or custom command name plus its
+/// payload, handled exactly as if Home Assistant had sent it (same feature
+/// gates and rate limits).
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct HookCommand {
+    pub command: String,
+    #[serde(default)]
+    pub payload: String,
+}
+
+/// `entities` entry: replaces the built-in icon and/or device_class in an
+/// entity's discovery config. Unset fields keep the default.
+#[derive(Debug, Clone, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct EntityOverride {
+    #[serde(default)]
+    pub icon: Option<String>,
+    #[serde(default)]
+    pub device_class: Option<String>,
+}
+
+/// Route messages on an arbitrary MQTT topic filter to `command` (a native or
+/// custom command name). The message payload becomes the command payload.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct CustomSubscription {
+    pub topic: String,
+    pub command: String,
+}
+
+/// `game_mode` section: commands the `GameMode` switch runs, like a game
+/// hook that HA turns on and off.
+#[derive(Debug, Clone, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct GameModeConfig {
+    /// Dispatched in order when game mode is turned on.
+    #[serde(default)]
+    pub on: Vec<HookCommand>,
+    /// Dispatched in order when game mode is turned off; usually undoes `on`.
+    #[serde(default)]
+    pub off: Vec<HookCommand>,
+    /// Hold off sleep, the screensaver and display timeout while game mode is on.
+    #[serde(default)]
+    pub keep_awake: bool,
+}
+
+/// `command_auth` section. With `hmac_key` set, a command arriving over MQTT
+/// only runs if its payload is `{"payload": ..., "ts": <unix secs>, "sig":
+/// <hex HMAC-SHA256>}` signed with the key (see `commands::auth`).
+#[derive(Clone, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct CommandAuthConfig {
+    /// Shared secret, at least 16 characters. Empty = no signing required.
+    /// Moved out of userConfig.json into the encrypted `command_auth_key`
+    /// credential file on load, like `mqtt.pass`.
+    #[serde(default)]
+    pub hmac_key: String,
+    /// Commands that must be signed, e.g. `["Shutdown", "Restart"]`: exact
+    /// built-in or custom command names (`notification` for notifications).
+    /// Empty = every command, HA's own button presses included.
+    #[serde(default)]
+    pub commands: Vec<String>,
+    /// How far a signature's `ts` may be from this PC's clock; 0 = 60s.
+    #[serde(default)]
+    pub max_skew_secs: u64,
+}
+
+/// Signatures older (or newer) than this are refused by default.
+const DEFAULT_AUTH_MAX_SKEW_SECS: u64 = 60;
+
+impl CommandAuthConfig {
+    /// Whether `name` has to be signed.
+    pub fn requires(&self, name: &str) -> bool {
+        !self.hmac_key.is_empty()
+            && (self.commands.is_empty() || self.commands.iter().any(|c| c == name))
+    }
+
+    pub fn max_skew_secs(&self) -> u64 {
+        match self.max_skew_secs {
+            0 => DEFAULT_AUTH_MAX_SKEW_SECS,
+            n => n,
+        }
+    }
+}
+
+impl std::fmt::Debug for CommandAuthConfig {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.debug_struct("CommandAuthConfig")
+            .field("hmac_key", &"[REDACTED]")
+            .field("commands", &self.commands)
+            .field("max_skew_secs", &self.max_skew_secs)
+            .finish()
+    }
+}
+
+/// `device` section: overrides for the HA device registry entry. Unset (or
+/// blank) fields keep the defaults: model "PC Bridge v<version>", manufacturer
+/// "dank0i", sw_version the bridge version.
+#[derive(Debug, Clone, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct DeviceConfig {
+    #[serde(default)]
+    pub model: Option<String>,
+    #[serde(default)]
+    pub manufacturer: Option<String>,
+    #[serde(default)]
+    pub sw_version: Option<String>,
+}
+
+/// `logging` section.
+#[derive(Debug, Clone, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct LoggingConfig {
+    #[serde(default)]
+    pub format: LogFormat,
+    #[serde(default)]
+    pub level: LogLevel,
+}
+
+/// Log line format: human-readable `text`, or one JSON object per line
+/// (`level`, `time`, `msg`, `module` plus any structured fields) for
+/// Loki/ELK-style ingestion.
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum LogFormat {
+    #[default]
+    Text,
+    Json,
+}
+
+/// Lowest level written to the log. Routine per-poll and per-command detail
+/// is at `debug`; `info` keeps startup, state changes and errors; `warn`
+/// drops down to problems only.
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum LogLevel {
+    Error,
+    Warn,
+    #[default]
+    Info,
+    Debug,
+    Trace,
+}
+
+impl LogLevel {
+    pub fn filter(self) -> log::LevelFilter {
+        match self {
+            Self::Error => log::LevelFilter::Error,
+            Self::Warn => log::LevelFilter::Warn,
+            Self::Info => log::LevelFilter::Info,
+            Self::Debug => log::LevelFilter::Debug,
+            Self::Trace => log::LevelFilter::Trace,
+        }
+    }
 }
 
 /// Custom command types
@@ -424,6 +954,24 @@ pub struct MqttConfig {
     pub pass: String,
     #[serde(default)]
     pub client_id: Option<String>,
+    /// Client certificate for ssl:// brokers, taken from the Windows
+    /// CurrentUser\MY store by SHA-1 thumbprint or subject substring.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub client_cert: Option<String>,
+}
+
+impl MqttConfig {
+    /// The broker to connect to: `broker` as configured, or, when it's left
+    /// blank, one found via mDNS (`_mqtt._tcp.local`) with a
+    /// `homeassistant.local` fallback. The lookup blocks (up to 1.5s) until a
+    /// broker has been found.
+    pub fn broker_url(&self) -> String {
+        if self.broker.trim().is_empty() {
+            crate::mqtt::mdns::discovered_broker()
+        } else {
+            self.broker.clone()
+        }
+    }
 }
 
 impl std::fmt::Debug for MqttConfig {
@@ -433,6 +981,7 @@ impl std::fmt::Debug for MqttConfig {
             .field("user", &self.user)
             .field("pass", &"[REDACTED]")
             .field("client_id", &self.client_id)
+            .field("client_cert", &self.client_cert)
             .finish()
     }
 }
@@ -461,6 +1010,12 @@ pub struct IntervalConfig {
     pub network: u64,
     #[serde(default = "default_disk_sensor")]
     pub disk: u64,
+    /// Audio peak meter sample rate. Short by default: the meter is cheap to
+    /// read and a slow rate misses short sounds.
+    #[serde(default = "default_audio_peak")]
+    pub audio_peak: u64,
+    #[serde(default = "default_heartbeat")]
+    pub heartbeat: u64,
 }
 
 impl Default for IntervalConfig {
@@ -475,6 +1030,8 @@ impl Default for IntervalConfig {
             gpu: default_system_sensors(),
             network: default_system_sensors(),
             disk: default_disk_sensor(),
+            audio_peak: default_audio_peak(),
+            heartbeat: default_heartbeat(),
         }
     }
 }
@@ -494,6 +1051,12 @@ fn default_system_sensors() -> u64 {
 fn default_disk_sensor() -> u64 {
     60
 }
+fn default_audio_peak() -> u64 {
+    2
+}
+fn default_heartbeat() -> u64 {
+    60
+}
 
 impl Config {
     /// Given a live list of running process names, return those that match a
@@ -503,6 +1066,7 @@ impl Config {
     /// running-game *sensor*, which also does a loose prefix match: CloseGame
     /// kills processes, so `cs` must not select `csrss.exe`. Real configs (and
     /// Steam auto-discovery) use full base names, which match exactly here.
+    /// `glob:` keys match as in the sensor; the user spelled out the wildcards.
     pub fn matching_game_processes<'a>(
         &self,
         process_names: impl IntoIterator<Item = &'a str>,
@@ -522,16 +1086,58 @@ impl Config {
         if patterns.is_empty() {
             return Vec::new();
         }
+        let exclusions = self.lowered_game_exclusions();
         let mut matched = Vec::new();
         for name in process_names {
+            if is_excluded_process(name, &exclusions) {
+                continue;
+            }
             let base = strip_exe(name);
-            if patterns.iter().any(|p| base.eq_ignore_ascii_case(p)) {
+            if patterns.iter().any(|p| match game_glob(p) {
+                Some(glob) => glob_match(glob, name) || glob_match(glob, base),
+                None => base.eq_ignore_ascii_case(p),
+            }) {
                 matched.push(name.to_string());
             }
         }
         matched
     }
 
+    /// `game_exclusions` lowercased, with blank entries dropped (an empty
+    /// substring would otherwise exclude every process).
+    pub fn lowered_game_exclusions(&self) -> Vec<String> {
+        self.game_exclusions
+            .iter()
+            .map(|e| e.trim().to_lowercase())
+            .filter(|e| !e.is_empty())
+            .collect()
+    }
+
+    /// The configured log format, read straight from userConfig.json before
+    /// the config proper is loaded (logging has to start first). Text if the
+    /// file is missing or unreadable; the full load reports those errors.
+    pub fn peek_log_format() -> LogFormat {
+        Self::peek_logging("format")
+    }
+
+    /// The configured log level, read early like [`Self::peek_log_format`].
+    /// Info if unset or unreadable.
+    pub fn peek_log_level() -> LogLevel {
+        Self::peek_logging("level")
+    }
+
+    /// One `logging` field from userConfig.json, or its default. Each field
+    /// is read on its own so a bad value in one doesn't reset the other.
+    fn peek_logging<T: serde::de::DeserializeOwned + Default>(field: &str) -> T {
+        Self::config_path()
+            .ok()
+            .and_then(|p| std::fs::read_to_string(p).ok())
+            .and_then(|content| serde_json::from_str::<serde_json::Value>(&content).ok())
+            .and_then(|json| json.get("logging")?.get(field).cloned())
+            .and_then(|value| serde_json::from_value(value).ok())
+            .unwrap_or_default()
+    }
+
     /// Check if this is a first run (no config file exists)
     pub fn is_first_run() -> Result<bool> {
         Self::migrate_config_location()?;
@@ -544,26 +1150,12 @@ impl Config {
         Self::migrate_config_location()?;
 
         let config_path = Self::config_path()?;
-
-        if !config_path.exists() {
-            bail!(
-                "Configuration file not found at {:?}\n\
-                 Run the setup wizard first.",
-                config_path
-            );
-        }
-
-        let content = std::fs::read_to_string(&config_path)
-            .with_context(|| format!("Failed to read {:?}", config_path))?;
-
-        // Migrate config if needed (adds missing fields)
-        let content = Self::migrate_config(&config_path, &content)?;
-
-        let mut config: Config =
-            serde_json::from_str(&content).with_context(|| "Failed to parse userConfig.json")?;
+        let mut config = Self::from_file(&config_path)?;
 
         // Load MQTT password from credential file (or migrate from inline JSON)
         Self::load_credential(&mut config, &config_path)?;
+        Self::load_mirror_credential(&mut config, &config_path);
+        Self::load_command_auth_key(&mut config, &config_path)?;
 
         config.validate()?;
 
@@ -576,7 +1168,23 @@ impl Config {
         Self::migrate_config_location()?;
 
         let config_path = Self::config_path()?;
+        let mut config = Self::from_file(&config_path)?;
+
+        // Clear any inline password remnant without decrypting
+        config.mqtt.pass = String::new();
+        // The other secrets are separate and still load, so a later save
+        // doesn't drop them.
+        Self::load_mirror_credential(&mut config, &config_path);
+        Self::load_command_auth_key(&mut config, &config_path)?;
+
+        config.validate()?;
+        Ok(config)
+    }
 
+    /// Read, migrate and parse the config at `config_path`. Does not touch the
+    /// credential file or validate, so the loaders above stay thin and the
+    /// file handling can be exercised against a temp path.
+    fn from_file(config_path: &Path) -> Result<Self> {
         if !config_path.exists() {
             bail!(
                 "Configuration file not found at {:?}\n\
@@ -585,21 +1193,34 @@ impl Config {
             );
         }
 
-        let content = std::fs::read_to_string(&config_path)
+        let content = std::fs::read_to_string(config_path)
             .with_context(|| format!("Failed to read {:?}", config_path))?;
 
-        let content = Self::migrate_config(&config_path, &content)?;
+        // Migrate config if needed (adds missing fields)
+        let content = Self::migrate_config(config_path, &content)?;
 
-        let mut config: Config =
+        let mut config: Self =
             serde_json::from_str(&content).with_context(|| "Failed to parse userConfig.json")?;
-
-        // Clear any inline password remnant without decrypting
-        config.mqtt.pass = String::new();
-
-        config.validate()?;
+        config.drop_blank_game_patterns();
         Ok(config)
     }
 
+    /// Remove `games` entries with a blank process pattern. They're always a
+    /// typo or a botched edit, but configs with one loaded fine before, so
+    /// they're skipped with a warning rather than failing the load.
+    fn drop_blank_game_patterns(&mut self) {
+        self.games.retain(|pattern, gc| {
+            let blank = pattern.trim().is_empty();
+            if blank {
+                warn!(
+                    "games: ignoring empty process pattern for game '{}'",
+                    gc.game_id()
+                );
+            }
+            !blank
+        });
+    }
+
     /// Load the MQTT credential from the separate file, or migrate from inline JSON.
     fn load_credential(config: &mut Config, config_path: &PathBuf) -> Result<()> {
         let inline_pass = std::mem::take(&mut config.mqtt.pass);
@@ -613,7 +1234,7 @@ impl Config {
 
             // Clean up stale inline password from JSON if present
             if !inline_pass.is_empty()
-                && let Err(e) = Self::clear_inline_password(config_path)
+                && let Err(e) = Self::clear_inline_password(config_path, "mqtt", "pass")
             {
                 warn!("Failed to strip inline password from config (will retry on next save): {e}");
             }
@@ -624,7 +1245,7 @@ impl Config {
             })?;
             config.mqtt.pass = plaintext;
             crate::credential::save_to_file(&config.mqtt.pass)?;
-            if let Err(e) = Self::clear_inline_password(config_path) {
+            if let Err(e) = Self::clear_inline_password(config_path, "mqtt", "pass") {
                 warn!("Failed to strip inline password from config (will retry on next save): {e}");
             }
             info!("Migrated MQTT password to credential file");
@@ -634,12 +1255,67 @@ impl Config {
         Ok(())
     }
 
-    /// Blank out the `mqtt.pass` field in the JSON config file.
-    fn clear_inline_password(config_path: &PathBuf) -> Result<()> {
+    /// Load the `mirror` broker's password. Unlike the primary credential, one
+    /// that can't be decrypted isn't fatal: the mirror just connects without it.
+    fn load_mirror_credential(config: &mut Config, config_path: &PathBuf) {
+        let Some(mirror) = config.mirror.as_mut() else {
+            return;
+        };
+        let file = crate::credential::MIRROR_CREDENTIAL;
+        if let Err(e) = Self::load_secret(&mut mirror.pass, file, config_path, ("mirror", "pass")) {
+            warn!("mirror: credential unavailable, connecting without a password: {e:#}");
+        }
+    }
+
+    /// Load the command signing key. Fatal if it can't be read: carrying on
+    /// without it would accept unsigned commands.
+    fn load_command_auth_key(config: &mut Config, config_path: &PathBuf) -> Result<()> {
+        let file = crate::credential::COMMAND_AUTH_KEY;
+        let field = ("command_auth", "hmac_key");
+        Self::load_secret(&mut config.command_auth.hmac_key, file, config_path, field).with_context(
+            || {
+                format!(
+                    "command_auth.hmac_key can't be loaded; delete the '{file}' file next to \
+                 userConfig.json and set the key again"
+                )
+            },
+        )
+    }
+
+    /// Load a secret kept in credential file `file` into `slot`, or move an
+    /// inline value there (older configs kept it in userConfig.json as
+    /// plaintext). The file wins if both exist; an inline copy is stripped from
+    /// `(section, field)`.
+    fn load_secret(
+        slot: &mut String,
+        file: &str,
+        config_path: &PathBuf,
+        (section, field): (&str, &str),
+    ) -> Result<()> {
+        let inline = std::mem::take(slot);
+
+        if crate::credential::secret_path(file)?.exists() {
+            *slot = crate::credential::load_secret(file).map_err(|e| anyhow::anyhow!(e.message))?;
+        } else if !inline.is_empty() {
+            crate::credential::save_secret(file, &inline)?;
+            *slot = inline.clone();
+            info!("Migrated {} to its credential file", file);
+        }
+
+        if !inline.is_empty()
+            && let Err(e) = Self::clear_inline_password(config_path, section, field)
+        {
+            warn!("Failed to strip inline secret from config (will retry on next save): {e}");
+        }
+        Ok(())
+    }
+
+    /// Blank out `section.field` (e.g. `mqtt.pass`) in the JSON config file.
+    fn clear_inline_password(config_path: &PathBuf, section: &str, field: &str) -> Result<()> {
         let content = std::fs::read_to_string(config_path)?;
         let mut json: serde_json::Value = serde_json::from_str(&content)?;
-        if let Some(mqtt) = json.get_mut("mqtt").and_then(|v| v.as_object_mut()) {
-            mqtt.insert("pass".to_string(), serde_json::Value::String(String::new()));
+        if let Some(obj) = json.get_mut(section).and_then(|v| v.as_object_mut()) {
+            obj.insert(field.to_string(), serde_json::Value::String(String::new()));
         }
         let content = serde_json::to_string_pretty(&json)?;
         // Atomic write like every other userConfig.json writer: a bare write()
@@ -650,7 +1326,7 @@ impl Config {
     }
 
     /// Migrate config by adding missing fields with defaults
-    fn migrate_config(config_path: &PathBuf, content: &str) -> Result<String> {
+    fn migrate_config(config_path: &Path, content: &str) -> Result<String> {
         let mut json: serde_json::Value =
             serde_json::from_str(content).with_context(|| "Failed to parse config as JSON")?;
 
@@ -811,8 +1487,11 @@ impl Config {
 
     /// Get the platform-specific config directory
     fn config_dir() -> Result<PathBuf> {
-        // Explicit override, used by the integration test kit to point the real
-        // binary at a throwaway config; also handy for portable installs.
+        // Explicit override (`--config-dir` sets it), used by the integration
+        // test kit to point the real binary at a throwaway config; also for
+        // portable installs and services whose profile directory isn't the
+        // user's. Never the exe directory: under Program Files that is
+        // read-only, so the first-run save and the reload watcher would fail.
         if let Ok(dir) = std::env::var("PC_BRIDGE_CONFIG_DIR")
             && !dir.is_empty()
         {
@@ -879,6 +1558,78 @@ impl Config {
         Ok(())
     }
 
+    /// Take the hot-reloadable fields from a freshly loaded config. Anything
+    /// not copied here keeps its startup value until restart.
+    fn apply_reload(&mut self, new: Config) {
+        let old_count = self.games.len();
+        if new.games.is_empty() && old_count > 0 {
+            if new.keep_games_on_empty_reload {
+                warn!(
+                    "Reloaded config has no games; keeping the previous {} (set keep_games_on_empty_reload to false to clear them)",
+                    old_count
+                );
+            } else {
+                warn!("Reloaded config has no games; game detection will report none");
+                self.games = new.games;
+            }
+        } else {
+            self.games = new.games;
+        }
+        self.game_exclusions = new.game_exclusions;
+
+        // Reload intervals (sensors pick up changes via config_generation)
+        self.intervals = new.intervals;
+
+        // Security-relevant flags
+        self.allow_raw_commands = new.allow_raw_commands;
+        self.allow_global_launch = new.allow_global_launch;
+        self.allow_global_close = new.allow_global_close;
+        // Tray manager reconciles on config_generation and reads this live.
+        self.show_tray_icon = new.show_tray_icon;
+
+        // Discord keybind
+        self.discord_keybind = new.discord_keybind;
+
+        // Built-in feature enable flags. Previously these were NOT hot-reloaded,
+        // so disabling a feature in the UI didn't stick (a reconnect re-registered
+        // it from the stale in-memory flags). Applying them here + the discovery
+        // re-register/teardown in reload_hot_config makes a disable actually
+        // remove the entity from HA. NOTE: the sensor TASKS are startup-spawned
+        // and grouped, so a newly-ENABLED feature still needs a restart to start
+        // publishing (its entity will show until then); full runtime task
+        // start/stop is the separate foundation refactor.
+        self.features = new.features;
+
+        // Custom sensors/commands (re-registered by the caller).
+        self.custom_sensors_enabled = new.custom_sensors_enabled;
+        self.custom_commands_enabled = new.custom_commands_enabled;
+        self.custom_command_privileges_allowed = new.custom_command_privileges_allowed;
+        self.custom_sensors = new.custom_sensors;
+        self.custom_commands = new.custom_commands;
+        self.command_rate_limits = new.command_rate_limits;
+        self.shutdown_grace_secs = new.shutdown_grace_secs;
+        self.wake_turns_on_display = new.wake_turns_on_display;
+        self.wake_skip_when_active = new.wake_skip_when_active;
+        self.reconnect_on_wake = new.reconnect_on_wake;
+        self.entities = new.entities;
+        self.keep_games_on_empty_reload = new.keep_games_on_empty_reload;
+        self.max_notifications_per_minute = new.max_notifications_per_minute;
+        self.readable_registry_keys = new.readable_registry_keys;
+        self.button_payloads = new.button_payloads;
+        self.game_mode = new.game_mode;
+        self.command_auth = new.command_auth;
+        // The game sensor rebuilds its patterns on config_generation.
+        self.game_priority = new.game_priority;
+        // Read by the hook runner on every start/exit.
+        self.game_hooks = new.game_hooks;
+        // Read per command; the select's options follow on re-registration.
+        self.controllable_services = new.controllable_services;
+        // The fullscreen sensor re-reads its watch list every poll.
+        self.fullscreen_windows = new.fullscreen_windows;
+        // The idle sensor starts/stops gamepad polling on config_generation.
+        self.idle_include_gamepad = new.idle_include_gamepad;
+    }
+
     /// Merge Steam-discovered games into the config and save
     ///
     /// Adds newly installed games and removes auto-discovered games that are
@@ -964,7 +1715,7 @@ impl Config {
 
     /// Save current config to userConfig.json.
     ///
-    /// The MQTT password is stored in a separate credential file (encrypted
+    /// The MQTT passwords are stored in separate credential files (encrypted
     /// via DPAPI on Windows).  The JSON config always has `pass: ""`.
     pub fn save(&self) -> Result<()> {
         let config_path = Self::config_path()?;
@@ -978,10 +1729,22 @@ impl Config {
         // Save encrypted password to separate credential file
         crate::credential::save_to_file(&self.mqtt.pass)
             .with_context(|| "Failed to save MQTT credential")?;
-
-        // Write config JSON without the password
+        let mirror_pass = self.mirror.as_ref().map_or("", |m| m.pass.as_str());
+        crate::credential::save_secret(crate::credential::MIRROR_CREDENTIAL, mirror_pass)
+            .with_context(|| "Failed to save mirror credential")?;
+        crate::credential::save_secret(
+            crate::credential::COMMAND_AUTH_KEY,
+            &self.command_auth.hmac_key,
+        )
+        .with_context(|| "Failed to save command_auth key")?;
+
+        // Write config JSON without the passwords
         let mut to_save = self.clone();
         to_save.mqtt.pass = String::new();
+        if let Some(mirror) = to_save.mirror.as_mut() {
+            mirror.pass = String::new();
+        }
+        to_save.command_auth.hmac_key = String::new();
 
         let content = serde_json::to_string_pretty(&to_save)?;
         crate::fsutil::write_atomic(&config_path, content.as_bytes(), None)
@@ -1001,7 +1764,15 @@ impl Config {
             bail!("device_name cannot contain whitespace");
         }
         // device_name flows into MQTT topics; reject characters that would break
-        // or wildcard a subscription (# + /) or otherwise malform a topic.
+        // or wildcard a subscription (# + /) or otherwise malform a topic. The
+        // topic characters get their own message since they're the likely culprit
+        // when every subscription silently stops matching.
+        if self.device_name.contains(['/', '+', '#']) {
+            bail!(
+                "device_name '{}' cannot contain MQTT topic characters '/', '+', or '#'",
+                self.device_name
+            );
+        }
         if !self
             .device_name
             .chars()
@@ -1009,27 +1780,182 @@ impl Config {
         {
             bail!("device_name may only contain letters, digits, '.', '_', and '-'");
         }
-        if self.mqtt.broker.is_empty() {
-            bail!("mqtt.broker is required");
-        }
+        // A blank broker is auto-discovered (see MqttConfig::broker_url).
+        let broker = self.mqtt.broker.trim();
         // ws:// / wss:// parse but were never given a WebSocket transport (they
         // silently connected as raw TCP/TLS, which the broker rejects). Reject
         // them explicitly until real WebSocket support is wired and tested.
-        if self.mqtt.broker.starts_with("ws://") || self.mqtt.broker.starts_with("wss://") {
+        if broker.starts_with("ws://") || broker.starts_with("wss://") {
             bail!(
                 "mqtt.broker: ws:// and wss:// are not supported yet; use tcp:// or ssl:// (MQTT over TLS)"
             );
         }
-        if !self.mqtt.broker.starts_with("tcp://") && !self.mqtt.broker.starts_with("ssl://") {
+        if !broker.is_empty() && !broker.starts_with("tcp://") && !broker.starts_with("ssl://") {
             bail!("mqtt.broker must start with tcp:// or ssl://");
         }
-
-        // Validate custom sensors
-        for sensor in &self.custom_sensors {
-            Self::validate_custom_sensor(sensor)?;
+        if let Some(cert) = &self.mqtt.client_cert {
+            if cert.trim().is_empty() {
+                bail!("mqtt.client_cert is empty; set a thumbprint or subject, or remove it");
+            }
+            if !broker.starts_with("ssl://") {
+                bail!("mqtt.client_cert requires an ssl:// broker");
+            }
+            if !cfg!(windows) {
+                bail!("mqtt.client_cert is only supported on Windows (certificate store)");
+            }
+        }
+        if let Some(mirror) = &self.mirror {
+            // No mDNS fallback here: that would find the primary broker again.
+            let mirror_broker = mirror.broker.trim();
+            if !mirror_broker.starts_with("tcp://") && !mirror_broker.starts_with("ssl://") {
+                bail!("mirror.broker must be set and start with tcp:// or ssl://");
+            }
+            if mirror.client_cert.is_some() && !mirror_broker.starts_with("ssl://") {
+                bail!("mirror.client_cert requires an ssl:// broker");
+            }
         }
 
-        // Validate custom commands
+        for (name, limit) in &self.command_rate_limits {
+            if limit.max == 0 || limit.per_secs == 0 {
+                bail!(
+                    "command_rate_limits.{}: max and per_secs must both be at least 1",
+                    name
+                );
+            }
+        }
+
+        for subscription in &self.custom_subscriptions {
+            Self::validate_custom_subscription(subscription)?;
+        }
+
+        for (i, topic) in self.notification_topics.iter().enumerate() {
+            if topic.trim().is_empty() {
+                bail!("notification_topics cannot contain an empty topic");
+            }
+            if let Err(reason) = check_topic_filter(topic) {
+                bail!("notification_topics '{}': {}", topic, reason);
+            }
+            // HA publishes the notify entity's messages here, so it has to be
+            // a real topic.
+            if i == 0 && topic.contains(['+', '#']) {
+                bail!(
+                    "notification_topics '{}': the first topic is the notify entity's command topic and cannot contain wildcards",
+                    topic
+                );
+            }
+            // Anything else under the agent's roots would feed its own retained
+            // configs and states back in as toasts.
+            let default_topic =
+                DEFAULT_NOTIFICATION_TOPIC.replace("{device_name}", &self.device_name);
+            let is_default =
+                [DEFAULT_NOTIFICATION_TOPIC, default_topic.as_str()].contains(&topic.trim());
+            if !is_default
+                && let Some(root) = AGENT_TOPIC_ROOTS
+                    .iter()
+                    .find(|root| filter_reaches_root(topic, root))
+            {
+                bail!(
+                    "notification_topics '{}' overlaps PC Bridge's own '{}/...' topics",
+                    topic,
+                    root
+                );
+            }
+        }
+
+        for (game, hooks) in &self.game_hooks {
+            if hooks
+                .on_start
+                .iter()
+                .chain(&hooks.on_exit)
+                .any(|h| h.command.trim().is_empty())
+            {
+                bail!("game_hooks.{}: every hook needs a command", game);
+            }
+        }
+
+        for step in self.game_mode.on.iter().chain(&self.game_mode.off) {
+            match step.command.trim() {
+                "" => bail!("game_mode: every step needs a command"),
+                // It would flip itself straight back.
+                "GameMode" => bail!("game_mode steps cannot run GameMode"),
+                _ => {}
+            }
+        }
+
+        let auth = &self.command_auth;
+        if !auth.hmac_key.is_empty() && auth.hmac_key.chars().count() < 16 {
+            bail!("command_auth.hmac_key must be at least 16 characters");
+        }
+        // Names are matched exactly, so a misspelt one ("shutdown") would
+        // silently leave the real command unsigned; refuse anything that
+        // isn't a command we can receive.
+        for name in &auth.commands {
+            let known = crate::commands::is_native_command(name)
+                || name == "notification"
+                || self.custom_commands.iter().any(|c| &c.name == name);
+            if !known {
+                bail!(
+                    "command_auth.commands: '{}' is not a built-in or custom command (names are case-sensitive)",
+                    name
+                );
+            }
+        }
+
+        for (id, entity) in &self.entities {
+            if [&entity.icon, &entity.device_class]
+                .into_iter()
+                .flatten()
+                .any(|v| v.trim().is_empty())
+            {
+                bail!("entities.{}: icon and device_class can't be empty", id);
+            }
+        }
+
+        if let Some(bad) = self
+            .controllable_services
+            .iter()
+            .find(|s| !crate::commands::service::is_valid_service_name(s))
+        {
+            bail!("controllable_services: invalid service name '{}'", bad);
+        }
+        if let Some(bad) = self
+            .readable_registry_keys
+            .iter()
+            .find(|k| crate::commands::registry::split_key(k).is_none())
+        {
+            bail!(
+                "readable_registry_keys: '{}' must be HKCU\\, HKLM\\ or HKU\\ followed by a path",
+                bad
+            );
+        }
+
+        // Each watched process needs its own sensor id.
+        let mut fullscreen_ids = std::collections::HashSet::new();
+        for process in &self.fullscreen_windows {
+            let Some(id) = fullscreen_sensor_id(process) else {
+                bail!("fullscreen_windows: empty process name");
+            };
+            if !fullscreen_ids.insert(id) {
+                bail!("fullscreen_windows: '{}' is listed twice", process.trim());
+            }
+        }
+
+        // The countdown holds a command slot for its whole length, so cap it at
+        // something a person would actually wait through.
+        if self.shutdown_grace_secs > MAX_SHUTDOWN_GRACE_SECS {
+            bail!(
+                "shutdown_grace_secs must be at most {} (got {})",
+                MAX_SHUTDOWN_GRACE_SECS,
+                self.shutdown_grace_secs
+            );
+        }
+
+        // Validate custom sensors
+        for sensor in &self.custom_sensors {
+            Self::validate_custom_sensor(sensor)?;
+        }
+
+        // Validate custom commands
         for cmd in &self.custom_commands {
             Self::validate_custom_command(cmd, self.custom_command_privileges_allowed)?;
         }
@@ -1037,6 +1963,32 @@ impl Config {
         Ok(())
     }
 
+    /// Validate a custom subscription's topic filter per the MQTT rules: `+`
+    /// must fill a whole level and `#` must be the whole last level.
+    fn validate_custom_subscription(subscription: &CustomSubscription) -> Result<()> {
+        let topic = &subscription.topic;
+        if topic.is_empty() {
+            bail!("Custom subscription topic cannot be empty");
+        }
+        if subscription.command.trim().is_empty() {
+            bail!("Custom subscription '{}' needs a command", topic);
+        }
+        if let Err(reason) = check_topic_filter(topic) {
+            bail!("Custom subscription '{}': {}", topic, reason);
+        }
+        if let Some(root) = AGENT_TOPIC_ROOTS
+            .iter()
+            .find(|root| filter_reaches_root(topic, root))
+        {
+            bail!(
+                "Custom subscription '{}' overlaps PC Bridge's own '{}/...' topics",
+                topic,
+                root
+            );
+        }
+        Ok(())
+    }
+
     /// Validate a custom sensor definition
     fn validate_custom_sensor(sensor: &CustomSensor) -> Result<()> {
         if sensor.name.is_empty() {
@@ -1150,6 +2102,25 @@ impl Config {
             );
         }
 
+        if cmd.timeout_secs == Some(0) {
+            bail!(
+                "Custom command '{}' timeout_secs must be at least 1",
+                cmd.name
+            );
+        }
+        // A waiting command holds a command slot and a blocking thread until
+        // it exits or times out.
+        if let Some(secs) = cmd.timeout_secs
+            && secs > MAX_CUSTOM_COMMAND_TIMEOUT_SECS
+        {
+            bail!(
+                "Custom command '{}' timeout_secs must be at most {} (got {})",
+                cmd.name,
+                MAX_CUSTOM_COMMAND_TIMEOUT_SECS,
+                secs
+            );
+        }
+
         if cmd.admin && !privileges_allowed {
             bail!(
                 "Custom command '{}' has admin=true but custom_command_privileges_allowed=false. \
@@ -1203,6 +2174,66 @@ impl Config {
             .clone()
             .unwrap_or_else(|| format!("pc-agent-{}", self.device_name))
     }
+
+    /// Rate limit for command `name`: its `command_rate_limits` entry, else
+    /// for notifications `max_notifications_per_minute`.
+    pub fn rate_limit_for(&self, name: &str) -> Option<CommandRateLimit> {
+        if let Some(limit) = self.command_rate_limits.get(name) {
+            return Some(*limit);
+        }
+        (name == "notification" && self.max_notifications_per_minute > 0).then_some(
+            CommandRateLimit {
+                max: self.max_notifications_per_minute,
+                per_secs: 60,
+            },
+        )
+    }
+
+    /// Notification topic filters with `{device_name}` filled in; the default
+    /// topic when none are configured. Never empty.
+    pub fn notification_topics(&self) -> Vec<String> {
+        let expand = |t: &str| t.trim().replace("{device_name}", &self.device_name);
+        if self.notification_topics.is_empty() {
+            return vec![expand(DEFAULT_NOTIFICATION_TOPIC)];
+        }
+        self.notification_topics.iter().map(|t| expand(t)).collect()
+    }
+}
+
+/// Check an MQTT topic filter: `+` must fill a whole level and `#` must be
+/// the whole last level.
+fn check_topic_filter(topic: &str) -> std::result::Result<(), &'static str> {
+    let levels: Vec<&str> = topic.split('/').collect();
+    for (i, level) in levels.iter().enumerate() {
+        if level.contains('#') && (*level != "#" || i != levels.len() - 1) {
+            return Err("'#' must be the entire last topic level");
+        }
+        if level.contains('+') && *level != "+" {
+            return Err("'+' must be an entire topic level");
+        }
+    }
+    Ok(())
+}
+
+/// First topic levels everything the agent publishes or subscribes to lives
+/// under (discovery, state, commands, notifications, results).
+const AGENT_TOPIC_ROOTS: [&str; 2] = [crate::mqtt::DISCOVERY_PREFIX, "pc-bridge"];
+
+/// Whether a (valid) topic filter can match a topic under `root/`: a leading
+/// `#`, or `root` or `+` followed by at least one more level.
+fn filter_reaches_root(topic: &str, root: &str) -> bool {
+    match topic.split_once('/') {
+        Some((first, _)) => first == root || first == "+",
+        None => topic == "#",
+    }
+}
+
+/// Whether a concrete topic is one of the agent's own: a root in
+/// [`AGENT_TOPIC_ROOTS`] or anything under it.
+pub(crate) fn is_agent_topic(topic: &str) -> bool {
+    AGENT_TOPIC_ROOTS
+        .iter()
+        .any(|root| topic == *root || filter_reaches_root(topic, root))
 }
 
 /// Watch userConfig.json for changes and reload games on modification
@@ -1261,7 +2292,8 @@ pub async fn watch_config(state: Arc<AppState>) {
     let mut shutdown_rx = state.shutdown_tx.subscribe();
 
     // Debounce: editors emit multiple events per save (write temp, rename, update).
-    // Wait 500ms after the last event before reloading to avoid redundant work.
+    // Wait until the file has been quiet for RELOAD_DEBOUNCE before reloading, so
+    // one save is one reload (and one log line).
     let mut debounce_deadline: Option<tokio::time::Instant> = None;
 
     loop {
@@ -1292,14 +2324,8 @@ pub async fn watch_config(state: Arc<AppState>) {
                 });
 
                 if is_our_file {
-                    match event.kind {
-                        EventKind::Modify(_) | EventKind::Create(_) => {
-                            debounce_deadline = Some(
-                                tokio::time::Instant::now()
-                                    + std::time::Duration::from_millis(500),
-                            );
-                        }
-                        _ => {}
+                    if is_reload_event(&event.kind) {
+                        debounce_deadline = Some(tokio::time::Instant::now() + RELOAD_DEBOUNCE);
                     }
                 }
             }
@@ -1307,6 +2333,21 @@ pub async fn watch_config(state: Arc<AppState>) {
     }
 }
 
+/// Quiet period after the last change event before the config is reloaded.
+const RELOAD_DEBOUNCE: std::time::Duration = std::time::Duration::from_millis(500);
+
+/// Whether a watcher event can change the file's contents. Metadata-only
+/// events (the chmod/attribute touch some editors do after a save) don't, so
+/// they neither trigger nor extend a reload.
+fn is_reload_event(kind: &EventKind) -> bool {
+    use notify::event::ModifyKind;
+    match kind {
+        EventKind::Modify(m) => !matches!(m, ModifyKind::Metadata(_)),
+        EventKind::Create(_) => true,
+        _ => false,
+    }
+}
+
 /// Reload hot-reloadable config fields (games, intervals, commands, sensors, security flags)
 async fn reload_hot_config(state: &AppState) {
     // Config::load() does synchronous file I/O - run on the blocking pool to
@@ -1326,33 +2367,8 @@ async fn reload_hot_config(state: &AppState) {
     {
         let mut config = state.config.write().await;
         let old_count = config.games.len();
-        config.games = new_config.games;
-
-        // Reload intervals (sensors pick up changes via config_generation)
-        config.intervals = new_config.intervals;
-
-        // Security-relevant flags
-        config.allow_raw_commands = new_config.allow_raw_commands;
-        config.allow_global_launch = new_config.allow_global_launch;
-        config.allow_global_close = new_config.allow_global_close;
-        // Tray manager reconciles on config_generation and reads this live.
-        config.show_tray_icon = new_config.show_tray_icon;
-
-        // Discord keybind
-        config.discord_keybind = new_config.discord_keybind;
-
-        // Built-in feature enable flags. Previously these were NOT hot-reloaded,
-        // so disabling a feature in the UI didn't stick (a reconnect re-registered
-        // it from the stale in-memory flags). Applying them here + the discovery
-        // re-register/teardown below makes a disable actually remove the entity
-        // from HA. NOTE: the sensor TASKS are startup-spawned and grouped, so a
-        // newly-ENABLED feature still needs a restart to start publishing (its
-        // entity will show until then); full runtime task start/stop is the
-        // separate foundation refactor.
-        config.features = new_config.features;
-
-        // Also reload custom sensors/commands config. Capture the old entity
-        // names first so we can tear down any that were removed.
+        // Capture the old custom entity names first so we can tear down any
+        // that were removed.
         let old_sensors_enabled = config.custom_sensors_enabled;
         let old_commands_enabled = config.custom_commands_enabled;
         let old_sensor_names: Vec<String> = config
@@ -1366,11 +2382,7 @@ async fn reload_hot_config(state: &AppState) {
             .map(|c| c.name.clone())
             .collect();
 
-        config.custom_sensors_enabled = new_config.custom_sensors_enabled;
-        config.custom_commands_enabled = new_config.custom_commands_enabled;
-        config.custom_command_privileges_allowed = new_config.custom_command_privileges_allowed;
-        config.custom_sensors = new_config.custom_sensors;
-        config.custom_commands = new_config.custom_commands;
+        config.apply_reload(new_config);
 
         let new_game_count = config.games.len();
 
@@ -1430,6 +2442,8 @@ async fn reload_hot_config(state: &AppState) {
             let config = state.config.read().await;
             state.mqtt.register_discovery(&config).await;
             state.mqtt.clear_disabled_entities(&config).await;
+            // Subscribe new command topics and drop removed ones.
+            state.mqtt.sync_command_subscriptions(&config).await;
         }
 
         // Log security-relevant changes (using captured locals - no lock needed)
@@ -1498,6 +2512,76 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_matching_game_processes_respects_exclusions() {
+        let mut config = Config::default();
+        config.games.insert(
+            "fortniteclient-win64-shipping".to_string(),
+            GameConfig::Simple("fortnite".into()),
+        );
+        config.games.insert(
+            "fortnitelauncher".to_string(),
+            GameConfig::Simple("fortnite".into()),
+        );
+        config.game_exclusions = vec!["Launcher".to_string(), "  ".to_string()];
+
+        let matched = config.matching_game_processes(
+            ["FortniteClient-Win64-Shipping.exe", "FortniteLauncher.exe"]
+                .iter()
+                .copied(),
+        );
+        assert_eq!(
+            matched,
+            vec!["FortniteClient-Win64-Shipping.exe".to_string()]
+        );
+    }
+
+    #[test]
+    fn test_glob_match() {
+        assert!(glob_match("*apex*", "r5apex.exe"));
+        assert!(glob_match("R5APEX_*.exe", "r5apex_dx12.exe"));
+        assert!(glob_match("game?.exe", "game2.exe"));
+        assert!(!glob_match("game?.exe", "game.exe"));
+        // The whole name must match, not just a prefix.
+        assert!(!glob_match("r5apex", "r5apex.exe"));
+        assert!(glob_match("*", ""));
+        assert!(!glob_match("", "r5apex.exe"));
+        assert_eq!(game_glob("GLOB:*apex*"), Some("*apex*"));
+        assert_eq!(game_glob("apex"), None);
+    }
+
+    #[test]
+    fn test_matching_game_processes_glob() {
+        let mut config = Config::default();
+        config.games.insert(
+            "glob:r5apex*".to_string(),
+            GameConfig::Simple("apex_legends".into()),
+        );
+        let matched =
+            config.matching_game_processes(["r5apex_dx12.exe", "explorer.exe"].iter().copied());
+        assert_eq!(matched, vec!["r5apex_dx12.exe".to_string()]);
+    }
+
+    #[test]
+    fn test_is_excluded_process() {
+        let exclusions = vec!["crashhandler".to_string(), "setup".to_string()];
+        assert!(is_excluded_process("UnityCrashHandler64.exe", &exclusions));
+        assert!(is_excluded_process("Setup.exe", &exclusions));
+        assert!(!is_excluded_process("bf2042.exe", &exclusions));
+        assert!(!is_excluded_process("bf2042.exe", &[]));
+    }
+
+    #[test]
+    fn test_lowered_game_exclusions_drops_blank_entries() {
+        let mut config = Config::default();
+        config.game_exclusions = vec![" Launcher ".into(), String::new(), "  ".into()];
+        // A blank entry would be a substring of every process name.
+        assert_eq!(
+            config.lowered_game_exclusions(),
+            vec!["launcher".to_string()]
+        );
+    }
+
     fn minimal_config() -> Config {
         Config {
             device_name: "test-pc".to_string(),
@@ -1506,6 +2590,7 @@ mod tests {
                 user: String::new(),
                 pass: String::new(),
                 client_id: None,
+                client_cert: None,
             },
             intervals: IntervalConfig::default(),
             features: FeatureConfig::default(),
@@ -1522,6 +2607,30 @@ mod tests {
             custom_commands: vec![],
             update_channel: default_update_channel(),
             disk_sensor_paths: Vec::new(),
+            game_exclusions: Vec::new(),
+            command_rate_limits: HashMap::new(),
+            custom_subscriptions: Vec::new(),
+            shutdown_grace_secs: 0,
+            wake_turns_on_display: true,
+            controllable_services: Vec::new(),
+            logging: LoggingConfig::default(),
+            game_priority: Vec::new(),
+            fullscreen_windows: Vec::new(),
+            bundle_state: false,
+            game_hooks: HashMap::new(),
+            idle_include_gamepad: false,
+            wake_skip_when_active: true,
+            reconnect_on_wake: false,
+            entities: HashMap::new(),
+            keep_games_on_empty_reload: true,
+            device: DeviceConfig::default(),
+            mirror: None,
+            notification_topics: Vec::new(),
+            max_notifications_per_minute: 10,
+            readable_registry_keys: Vec::new(),
+            button_payloads: vec!["PRESS".to_string()],
+            game_mode: GameModeConfig::default(),
+            command_auth: CommandAuthConfig::default(),
         }
     }
 
@@ -1552,6 +2661,26 @@ mod tests {
         assert!(!features.disk_sensor);
         assert!(!features.uptime_sensor);
         assert!(!features.hwinfo_sensor);
+        assert!(!features.focus_assist);
+        assert!(!features.process_count);
+        assert!(!features.vram_sensor);
+        assert!(!features.cmd_service);
+        assert!(!features.audio_peak);
+        assert!(!features.window_fullscreen);
+        assert!(!features.cmd_window);
+        assert!(!features.windows_version);
+        assert!(!features.cmd_mouse);
+        assert!(!features.metered_connection);
+        assert!(!features.remote_session);
+        assert!(!features.device_triggers);
+        assert!(!features.cmd_registry);
+        assert!(!features.heartbeat);
+        assert!(!features.night_light);
+        assert!(!features.game_mode);
+        assert!(!features.command_slots);
+        assert!(!features.cmd_explorer);
+        assert!(!features.tcp_connections);
+        assert!(!features.keep_awake);
     }
 
     #[test]
@@ -1751,10 +2880,211 @@ mod tests {
         assert!(config.validate().is_err());
     }
 
+    #[test]
+    fn test_validate_mqtt_topic_chars_in_device_name() {
+        // Each of these would split or wildcard every topic built from the name.
+        for name in ["office/pc", "pc+1", "pc#", "/pc"] {
+            let mut config = minimal_config();
+            config.device_name = name.to_string();
+            let err = config.validate().unwrap_err().to_string();
+            assert!(err.contains("MQTT topic characters"), "{name}: {err}");
+        }
+    }
+
+    #[test]
+    fn test_validate_device_name_allowed_chars() {
+        let mut config = minimal_config();
+        config.device_name = "Gaming-PC_2.lan".to_string();
+        assert!(config.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_command_rate_limits() {
+        let mut config = minimal_config();
+        config.command_rate_limits.insert(
+            "Shutdown".to_string(),
+            CommandRateLimit {
+                max: 1,
+                per_secs: 10,
+            },
+        );
+        assert!(config.validate().is_ok());
+
+        // A zero budget or window can never refill - reject rather than guess.
+        for (max, per_secs) in [(0, 10), (1, 0)] {
+            config
+                .command_rate_limits
+                .insert("Shutdown".to_string(), CommandRateLimit { max, per_secs });
+            assert!(config.validate().is_err(), "max={max} per_secs={per_secs}");
+        }
+    }
+
+    #[test]
+    fn test_command_rate_limits_deserialize() {
+        let json = r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"},
+                       "command_rate_limits": {"Shutdown": {"max": 1, "per_secs": 10}}}"#;
+        let config: Config = serde_json::from_str(json).unwrap();
+        assert_eq!(
+            config.command_rate_limits["Shutdown"],
+            CommandRateLimit {
+                max: 1,
+                per_secs: 10
+            }
+        );
+    }
+
+    #[test]
+    fn test_validate_custom_subscription_filters() {
+        let valid = ["dash/pc/sleep", "dash/+/sleep", "dash/#", "+", "pc-bridge"];
+        let invalid = [
+            "",
+            "dash/pc#",
+            "dash/#/sleep",
+            "dash/p+/sleep",
+            // Would feed the agent its own discovery, state and result topics.
+            "#",
+            "+/#",
+            "+/pc/sleep",
+            "homeassistant/button/pc/Sleep/action",
+            "pc-bridge/command_result/pc",
+        ];
+        for topic in valid {
+            let mut config = minimal_config();
+            config.custom_subscriptions = vec![CustomSubscription {
+                topic: topic.to_string(),
+                command: "Lock".to_string(),
+            }];
+            assert!(config.validate().is_ok(), "{topic} should be valid");
+        }
+        for topic in invalid {
+            let mut config = minimal_config();
+            config.custom_subscriptions = vec![CustomSubscription {
+                topic: topic.to_string(),
+                command: "Lock".to_string(),
+            }];
+            assert!(config.validate().is_err(), "{topic} should be rejected");
+        }
+
+        let mut config = minimal_config();
+        config.custom_subscriptions = vec![CustomSubscription {
+            topic: "dash/pc/sleep".to_string(),
+            command: " ".to_string(),
+        }];
+        assert!(config.validate().is_err());
+    }
+
+    #[test]
+    fn test_game_hooks_parse_and_validate() {
+        let json = r#"{
+            "device_name": "test-pc",
+            "mqtt": {"broker": "tcp://localhost:1883"},
+            "game_hooks": {
+                "cs2": {
+                    "on_start": [{"command": "SetPriority", "payload": "cs2:high"}],
+                    "on_exit": [{"command": "SetPriority", "payload": "cs2:normal"}]
+                },
+                "fortnite": {"on_start": [{"command": "MonitorOn"}]}
+            }
+        }"#;
+        let mut config: Config = serde_json::from_str(json).unwrap();
+        assert!(config.validate().is_ok());
+        assert_eq!(config.game_hooks["cs2"].on_exit[0].payload, "cs2:normal");
+        assert!(config.game_hooks["fortnite"].on_exit.is_empty());
+        assert_eq!(config.game_hooks["fortnite"].on_start[0].payload, "");
+
+        config
+            .game_hooks
+            .get_mut("fortnite")
+            .unwrap()
+            .on_exit
+            .push(HookCommand {
+                command: " ".to_string(),
+                payload: String::new(),
+            });
+        assert!(config.validate().is_err());
+    }
+
+    #[test]
+    fn test_command_auth_validate() {
+        let config = load_temp_config(
+            r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                "command_auth": {"hmac_key": "0123456789abcdef", "commands": ["Shutdown"]}}"#,
+        )
+        .unwrap();
+        assert!(config.command_auth.requires("Shutdown"));
+        assert!(!config.command_auth.requires("Lock"));
+        assert_eq!(config.command_auth.max_skew_secs(), 60);
+        assert!(!format!("{:?}", config.command_auth).contains("0123456789abcdef"));
+        assert!(
+            load_temp_config(
+                r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                    "command_auth": {"hmac_key": "short"}}"#,
+            )
+            .is_err()
+        );
+        // A misspelt name would leave the real command unsigned.
+        assert!(
+            load_temp_config(
+                r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                    "command_auth": {"hmac_key": "0123456789abcdef", "commands": ["shutdown"]}}"#,
+            )
+            .is_err()
+        );
+        // No key: nothing needs signing.
+        assert!(!Config::default().command_auth.requires("Shutdown"));
+    }
+
+    #[test]
+    fn test_game_mode_parse_and_validate() {
+        let json = r#"{
+            "device_name": "test-pc",
+            "mqtt": {"broker": "tcp://localhost:1883"},
+            "game_mode": {
+                "on": [{"command": "Mute", "payload": "ON"}, {"command": "power_plan_high"}],
+                "keep_awake": true
+            }
+        }"#;
+        let mut config: Config = serde_json::from_str(json).unwrap();
+        assert!(config.validate().is_ok());
+        assert_eq!(config.game_mode.on.len(), 2);
+        assert!(config.game_mode.off.is_empty());
+        assert!(config.game_mode.keep_awake);
+
+        config.game_mode.off.push(HookCommand {
+            command: "GameMode".to_string(),
+            payload: "OFF".to_string(),
+        });
+        assert!(config.validate().is_err());
+        config.game_mode.off[0].command = String::new();
+        assert!(config.validate().is_err());
+    }
+
+    #[test]
+    fn test_entities_parse_and_validate() {
+        let json = r#"{
+            "device_name": "test-pc",
+            "mqtt": {"broker": "tcp://localhost:1883"},
+            "entities": {
+                "runninggames": {"icon": "mdi:controller"},
+                "idle_seconds": {"device_class": "duration"}
+            }
+        }"#;
+        let mut config: Config = serde_json::from_str(json).unwrap();
+        assert!(config.validate().is_ok());
+        assert_eq!(config.entities["runninggames"].device_class, None);
+
+        config.entities.get_mut("runninggames").unwrap().icon = Some(String::new());
+        assert!(config.validate().is_err());
+    }
+
     #[test]
     fn test_validate_empty_broker() {
+        // Blank means "discover via mDNS", not an error.
         let mut config = minimal_config();
         config.mqtt.broker = String::new();
+        assert!(config.validate().is_ok());
+        // ...but a client cert still needs an explicit ssl:// broker.
+        config.mqtt.client_cert = Some("gaming-pc".to_string());
         assert!(config.validate().is_err());
     }
 
@@ -1788,6 +3118,203 @@ mod tests {
         assert!(config.validate().is_err());
     }
 
+    #[test]
+    fn test_validate_shutdown_grace_secs() {
+        let mut config = minimal_config();
+        config.shutdown_grace_secs = 30;
+        assert!(config.validate().is_ok());
+        config.shutdown_grace_secs = MAX_SHUTDOWN_GRACE_SECS + 1;
+        assert!(config.validate().is_err());
+        // Absent from older configs -> immediate shutdown.
+        let parsed: Config =
+            serde_json::from_str(r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"}}"#)
+                .unwrap();
+        assert_eq!(parsed.shutdown_grace_secs, 0);
+    }
+
+    #[test]
+    fn test_is_reload_event() {
+        use notify::event::{CreateKind, DataChange, MetadataKind, ModifyKind, RenameMode};
+        assert!(is_reload_event(&EventKind::Modify(ModifyKind::Data(
+            DataChange::Content
+        ))));
+        assert!(is_reload_event(&EventKind::Modify(ModifyKind::Name(
+            RenameMode::To
+        ))));
+        assert!(is_reload_event(&EventKind::Create(CreateKind::File)));
+        assert!(!is_reload_event(&EventKind::Modify(ModifyKind::Metadata(
+            MetadataKind::Permissions
+        ))));
+        assert!(!is_reload_event(&EventKind::Access(
+            notify::event::AccessKind::Any
+        )));
+    }
+
+    #[test]
+    fn test_wake_turns_on_display_defaults_on() {
+        let parsed: Config =
+            serde_json::from_str(r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"}}"#)
+                .unwrap();
+        assert!(parsed.wake_turns_on_display);
+        let parsed: Config = serde_json::from_str(
+            r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"}, "wake_turns_on_display": false}"#,
+        )
+        .unwrap();
+        assert!(!parsed.wake_turns_on_display);
+        assert!(parsed.wake_skip_when_active);
+    }
+
+    #[test]
+    fn test_keep_games_on_empty_reload_defaults_on() {
+        let parsed: Config =
+            serde_json::from_str(r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"}}"#)
+                .unwrap();
+        assert!(parsed.keep_games_on_empty_reload);
+        assert!(Config::default().keep_games_on_empty_reload);
+    }
+
+    #[test]
+    fn test_reload_applies_hot_fields() {
+        let mut config = Config::default();
+        config
+            .games
+            .insert("cs2".to_string(), GameConfig::Simple("cs".into()));
+        let mut new = Config::default();
+        new.game_priority = vec!["rocket_league".to_string()];
+        new.game_hooks
+            .insert("cs".to_string(), GameHooks::default());
+        new.controllable_services = vec!["Spooler".to_string()];
+        new.fullscreen_windows = vec!["cs2.exe".to_string()];
+        new.idle_include_gamepad = true;
+        config.apply_reload(new);
+        assert_eq!(config.game_priority, ["rocket_league"]);
+        assert!(config.game_hooks.contains_key("cs"));
+        assert_eq!(config.controllable_services, ["Spooler"]);
+        assert_eq!(config.fullscreen_windows, ["cs2.exe"]);
+        assert!(config.idle_include_gamepad);
+        // An empty games map keeps the previous games by default.
+        assert!(config.games.contains_key("cs2"));
+    }
+
+    #[test]
+    fn test_button_payloads_default() {
+        let parsed: Config =
+            serde_json::from_str(r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"}}"#)
+                .unwrap();
+        assert_eq!(parsed.button_payloads, ["PRESS"]);
+        let parsed: Config = serde_json::from_str(
+            r#"{"device_name": "pc", "mqtt": {"broker": "tcp://h:1883"}, "button_payloads": []}"#,
+        )
+        .unwrap();
+        assert!(parsed.button_payloads.is_empty());
+    }
+
+    #[test]
+    fn test_validate_client_cert_requires_ssl() {
+        // A client cert on a plain tcp:// broker would be silently unused.
+        let mut config = minimal_config();
+        config.mqtt.client_cert = Some("gaming-pc".to_string());
+        let err = config.validate().unwrap_err().to_string();
+        assert!(err.contains("ssl://"), "{err}");
+
+        config.mqtt.broker = "ssl://mqtt.example.com:8883".to_string();
+        config.mqtt.client_cert = Some("  ".to_string());
+        assert!(config.validate().is_err());
+
+        config.mqtt.client_cert = Some("gaming-pc".to_string());
+        assert_eq!(config.validate().is_ok(), cfg!(windows));
+    }
+
+    #[test]
+    fn test_notification_rate_limit() {
+        let mut config = minimal_config();
+        assert_eq!(
+            config.rate_limit_for("notification"),
+            Some(CommandRateLimit {
+                max: 10,
+                per_secs: 60
+            })
+        );
+        assert_eq!(config.rate_limit_for("Shutdown"), None);
+
+        config.max_notifications_per_minute = 0;
+        assert_eq!(config.rate_limit_for("notification"), None);
+
+        let explicit = CommandRateLimit {
+            max: 2,
+            per_secs: 5,
+        };
+        config
+            .command_rate_limits
+            .insert("notification".to_string(), explicit);
+        assert_eq!(config.rate_limit_for("notification"), Some(explicit));
+    }
+
+    #[test]
+    fn test_notification_topics() {
+        let mut config = minimal_config();
+        assert_eq!(
+            config.notification_topics(),
+            vec![format!("pc-bridge/notifications/{}", config.device_name)]
+        );
+        assert!(config.validate().is_ok());
+
+        config.notification_topics = vec![
+            "hass.agent/notifications/{device_name}".to_string(),
+            "ha/notify/+".to_string(),
+        ];
+        assert_eq!(
+            config.notification_topics(),
+            vec![
+                format!("hass.agent/notifications/{}", config.device_name),
+                "ha/notify/+".to_string(),
+            ]
+        );
+        assert!(config.validate().is_ok());
+
+        // The first topic is advertised to HA, so no wildcards there.
+        config.notification_topics.reverse();
+        assert!(config.validate().is_err());
+        config.notification_topics = vec!["ha/notify/a+b".to_string()];
+        assert!(config.validate().is_err());
+    }
+
+    #[test]
+    fn test_notification_topics_reject_agent_topics() {
+        let mut config = minimal_config();
+        for bad in [
+            "#",
+            "pc-bridge/#",
+            "homeassistant/#",
+            "+/notify",
+            "pc-bridge/x",
+        ] {
+            config.notification_topics = vec!["ha/notify/pc".to_string(), bad.to_string()];
+            assert!(config.validate().is_err(), "{bad:?} should be rejected");
+        }
+        // The default topic is the one exception, spelled either way.
+        for ok in [
+            "pc-bridge/notifications/{device_name}".to_string(),
+            format!("pc-bridge/notifications/{}", config.device_name),
+        ] {
+            config.notification_topics = vec![ok.clone(), "ha/notify/+".to_string()];
+            assert!(config.validate().is_ok(), "{ok:?} should be allowed");
+        }
+    }
+
+    #[test]
+    fn test_validate_mirror_needs_broker() {
+        let mut config = minimal_config();
+        let mut mirror: MqttConfig =
+            serde_json::from_str(r#"{"broker": "", "user": "logger"}"#).unwrap();
+        config.mirror = Some(mirror.clone());
+        assert!(config.validate().is_err());
+
+        mirror.broker = "tcp://analytics.lan:1883".to_string();
+        config.mirror = Some(mirror);
+        assert!(config.validate().is_ok());
+    }
+
     // ===== Custom sensor validation =====
 
     #[test]
@@ -1888,6 +3415,8 @@ mod tests {
             path: None,
             args: None,
             command: None,
+            wait: false,
+            timeout_secs: None,
         };
         // privileges_allowed = false
         assert!(Config::validate_custom_command(&cmd, false).is_err());
@@ -1904,6 +3433,8 @@ mod tests {
             path: None,
             args: None,
             command: None,
+            wait: false,
+            timeout_secs: None,
         };
         // privileges_allowed = true
         assert!(Config::validate_custom_command(&cmd, true).is_ok());
@@ -1920,8 +3451,31 @@ mod tests {
             path: None, // Missing!
             args: None,
             command: None,
+            wait: false,
+            timeout_secs: None,
+        };
+        assert!(Config::validate_custom_command(&cmd, false).is_err());
+    }
+
+    #[test]
+    fn test_validate_custom_command_timeout_bounds() {
+        let mut cmd = CustomCommand {
+            name: "backup".to_string(),
+            command_type: CustomCommandType::Shell,
+            icon: None,
+            admin: false,
+            script: None,
+            path: None,
+            args: None,
+            command: Some("backup.bat".to_string()),
+            wait: true,
+            timeout_secs: Some(0),
         };
         assert!(Config::validate_custom_command(&cmd, false).is_err());
+        cmd.timeout_secs = Some(300);
+        assert!(Config::validate_custom_command(&cmd, false).is_ok());
+        cmd.timeout_secs = Some(MAX_CUSTOM_COMMAND_TIMEOUT_SECS + 1);
+        assert!(Config::validate_custom_command(&cmd, false).is_err());
     }
 
     // ===== Config helper methods =====
@@ -1956,6 +3510,8 @@ mod tests {
         assert_eq!(intervals.game_sensor, 5);
         assert_eq!(intervals.last_active, 10);
         assert_eq!(intervals.steam_check, 30);
+        assert_eq!(intervals.audio_peak, 2);
+        assert_eq!(intervals.heartbeat, 60);
     }
 
     // ===== Full config JSON parsing =====
@@ -2191,6 +3747,221 @@ mod tests {
         assert_eq!(config["device_name"], "temp-test-pc");
     }
 
+    // ===== Loading from a file =====
+
+    fn write_temp_config(json: &str) -> tempfile::NamedTempFile {
+        use std::io::Write;
+        let mut temp_file = tempfile::NamedTempFile::new().expect("Failed to create temp file");
+        temp_file
+            .write_all(json.as_bytes())
+            .expect("Failed to write");
+        temp_file
+    }
+
+    /// Parse + validate like `load()`, minus the credential file.
+    fn load_temp_config(json: &str) -> Result<Config> {
+        let temp_file = write_temp_config(json);
+        let config = Config::from_file(&temp_file.path().to_path_buf())?;
+        config.validate()?;
+        Ok(config)
+    }
+
+    #[test]
+    fn test_from_file_missing_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let err = Config::from_file(&dir.path().join("userConfig.json")).unwrap_err();
+        assert!(err.to_string().contains("setup wizard"), "{err}");
+    }
+
+    #[test]
+    fn test_from_file_applies_defaults() {
+        let config = load_temp_config(
+            r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"}}"#,
+        )
+        .unwrap();
+        assert_eq!(config.device_name, "file-pc");
+        assert_eq!(config.intervals.game_sensor, 5);
+        assert_eq!(config.update_channel, "stable");
+        assert!(config.allow_global_launch);
+        assert!(config.games.is_empty());
+    }
+
+    #[test]
+    fn test_from_file_missing_required_fields() {
+        // No mqtt section at all.
+        assert!(load_temp_config(r#"{"device_name": "file-pc"}"#).is_err());
+        // No device_name.
+        assert!(load_temp_config(r#"{"mqtt": {"broker": "tcp://host:1883"}}"#).is_err());
+    }
+
+    #[test]
+    fn test_from_file_rejects_default_device_name() {
+        let err =
+            load_temp_config(r#"{"device_name": "my-pc", "mqtt": {"broker": "tcp://host:1883"}}"#)
+                .unwrap_err();
+        assert!(err.to_string().contains("my-pc"), "{err}");
+    }
+
+    #[test]
+    fn test_from_file_rejects_bad_broker_scheme() {
+        for broker in ["mqtt://host:1883", "host:1883", "ws://host:9001"] {
+            let json = format!(r#"{{"device_name": "file-pc", "mqtt": {{"broker": "{broker}"}}}}"#);
+            assert!(
+                load_temp_config(&json).is_err(),
+                "{broker} should be rejected"
+            );
+        }
+    }
+
+    #[test]
+    fn test_from_file_rejects_negative_interval() {
+        let json = r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                       "intervals": {"game_sensor": -5}}"#;
+        assert!(load_temp_config(json).is_err());
+    }
+
+    #[test]
+    fn test_logging_format() {
+        let config = load_temp_config(
+            r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                "logging": {"format": "json"}}"#,
+        )
+        .unwrap();
+        assert_eq!(config.logging.format, LogFormat::Json);
+        let config = load_temp_config(
+            r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"}}"#,
+        )
+        .unwrap();
+        assert_eq!(config.logging.format, LogFormat::Text);
+    }
+
+    #[test]
+    fn test_logging_level() {
+        let config = load_temp_config(
+            r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                "logging": {"level": "warn"}}"#,
+        )
+        .unwrap();
+        assert_eq!(config.logging.level, LogLevel::Warn);
+        assert_eq!(config.logging.level.filter(), log::LevelFilter::Warn);
+        let config = load_temp_config(
+            r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"}}"#,
+        )
+        .unwrap();
+        assert_eq!(config.logging.level, LogLevel::Info);
+        assert!(
+            load_temp_config(
+                r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                    "logging": {"level": "loud"}}"#,
+            )
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_from_file_migrates_zero_interval() {
+        let json = r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                       "intervals": {"game_sensor": 0}}"#;
+        let temp_file = write_temp_config(json);
+        let config = Config::from_file(&temp_file.path().to_path_buf()).unwrap();
+        assert_eq!(config.intervals.game_sensor, 5);
+    }
+
+    #[test]
+    fn test_from_file_skips_empty_game_pattern() {
+        let json = r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                       "games": {" ": "blank_game", "bf2042": "battlefield"}}"#;
+        let config = load_temp_config(json).unwrap();
+        assert_eq!(config.games.len(), 1);
+        assert!(config.games.contains_key("bf2042"));
+    }
+
+    #[test]
+    fn test_clear_inline_password_blanks_only_that_field() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("userConfig.json");
+        std::fs::write(
+            &path,
+            r#"{"mqtt": {"pass": "p"}, "command_auth": {"hmac_key": "0123456789abcdef"}}"#,
+        )
+        .unwrap();
+        Config::clear_inline_password(&path, "command_auth", "hmac_key").unwrap();
+        let json: serde_json::Value =
+            serde_json::from_str(&std::fs::read_to_string(&path).unwrap()).unwrap();
+        assert_eq!(json["command_auth"]["hmac_key"], "");
+        assert_eq!(json["mqtt"]["pass"], "p");
+    }
+
+    #[test]
+    fn test_fullscreen_sensor_id() {
+        assert_eq!(
+            fullscreen_sensor_id("cs2.exe").as_deref(),
+            Some("fullscreen_cs2")
+        );
+        assert_eq!(
+            fullscreen_sensor_id(" RocketLeague.EXE ").as_deref(),
+            Some("fullscreen_rocketleague")
+        );
+        assert_eq!(
+            fullscreen_sensor_id("Cyberpunk 2077").as_deref(),
+            Some("fullscreen_cyberpunk_2077")
+        );
+        assert_eq!(fullscreen_sensor_id("  "), None);
+    }
+
+    #[test]
+    fn test_from_file_rejects_duplicate_fullscreen_window() {
+        let json = r#"{"device_name": "file-pc", "mqtt": {"broker": "tcp://host:1883"},
+                       "fullscreen_windows": ["cs2.exe", "CS2"]}"#;
+        let err = load_temp_config(json).unwrap_err();
+        assert!(err.to_string().contains("listed twice"), "{err}");
+    }
+
+    #[test]
+    fn test_config_dir_arg() {
+        let args = |a: &[&str]| a.iter().map(ToString::to_string).collect::<Vec<_>>();
+        assert_eq!(
+            config_dir_arg(args(&["pc-bridge", "--config-dir", r"D:\pcb"])).as_deref(),
+            Some(r"D:\pcb")
+        );
+        assert_eq!(
+            config_dir_arg(args(&["pc-bridge", "--config-dir=/srv/pcb", "--replace"])).as_deref(),
+            Some("/srv/pcb")
+        );
+        assert_eq!(config_dir_arg(args(&["pc-bridge", "--replace"])), None);
+        // Missing or empty value: fall back to the default location.
+        assert_eq!(config_dir_arg(args(&["pc-bridge", "--config-dir"])), None);
+        assert_eq!(config_dir_arg(args(&["pc-bridge", "--config-dir="])), None);
+    }
+
+    #[test]
+    fn test_prioritized_games() {
+        let games: HashMap<String, GameConfig> = [
+            ("steam", "steam_client"),
+            ("cs2", "counter_strike"),
+            ("RocketLeague", "rocket_league"),
+            ("rocket", "rocket_launcher"),
+            ("bf", "battlefield"),
+        ]
+        .into_iter()
+        .map(|(p, id)| (p.to_string(), GameConfig::Simple(id.to_string())))
+        .collect();
+        let order = |priority: &[&str]| {
+            let priority: Vec<String> = priority.iter().map(ToString::to_string).collect();
+            prioritized_games(&games, &priority)
+                .into_iter()
+                .map(|(p, _)| p.as_str())
+                .collect::<Vec<_>>()
+        };
+        // Most specific first; equal lengths alphabetically.
+        assert_eq!(order(&[]), ["RocketLeague", "rocket", "steam", "cs2", "bf"]);
+        // Listed game_ids jump ahead, in list order.
+        assert_eq!(
+            order(&["BATTLEFIELD", "rocket_launcher"]),
+            ["bf", "rocket", "RocketLeague", "steam", "cs2"]
+        );
+    }
+
     #[test]
     fn test_invalid_json_fails() {
         let bad_json = r#"{ "device_name": "test, "mqtt": {} }"#;
@@ -3,6 +3,9 @@
 //! On Windows, MQTT passwords are encrypted with `CryptProtectData` (tied to
 //! the current Windows user) and stored in a separate `mqtt_credential` file
 //! alongside `userConfig.json`.  The JSON config never contains the password.
+//! Other secrets get a file of their own the same way: the `mirror` broker's
+//! password ([`MIRROR_CREDENTIAL`]) and the command signing key
+//! ([`COMMAND_AUTH_KEY`]).
 //!
 //! On other platforms, passwords are stored as plaintext in the credential
 //! file with restrictive permissions (0600).
@@ -89,20 +92,43 @@ impl std::error::Error for CredentialDecryptFailed {}
 
 /// Path to the credential file alongside `userConfig.json`.
 pub fn credential_path() -> anyhow::Result<std::path::PathBuf> {
+    path_beside_config("mqtt_credential")
+}
+
+/// Credential file for `mirror.pass`.
+pub const MIRROR_CREDENTIAL: &str = "mirror_credential";
+/// Credential file for `command_auth.hmac_key`.
+pub const COMMAND_AUTH_KEY: &str = "command_auth_key";
+
+/// Path to the credential file `name` (e.g. [`MIRROR_CREDENTIAL`]), next to
+/// `mqtt_credential`.
+pub fn secret_path(name: &str) -> anyhow::Result<std::path::PathBuf> {
+    path_beside_config(name)
+}
+
+fn path_beside_config(name: &str) -> anyhow::Result<std::path::PathBuf> {
     let config_path = crate::config::Config::config_path()?;
     let dir = config_path
         .parent()
         .expect("config path always has a parent");
-    Ok(dir.join("mqtt_credential"))
+    Ok(dir.join(name))
 }
 
 /// Encrypt a plaintext password and write it to the credential file.
 pub fn save_to_file(plaintext: &str) -> anyhow::Result<()> {
-    let path = credential_path()?;
+    save_at(&credential_path()?, plaintext)
+}
+
+/// [`save_to_file`] for the secret kept in credential file `name`.
+pub fn save_secret(name: &str, plaintext: &str) -> anyhow::Result<()> {
+    save_at(&secret_path(name)?, plaintext)
+}
+
+fn save_at(path: &std::path::Path, plaintext: &str) -> anyhow::Result<()> {
     if plaintext.is_empty() {
         // Remove credential file when password is cleared
         if path.exists() {
-            std::fs::remove_file(&path)?;
+            std::fs::remove_file(path)?;
         }
         return Ok(());
     }
@@ -113,7 +139,7 @@ pub fn save_to_file(plaintext: &str) -> anyhow::Result<()> {
     let encrypted = encrypt(plaintext)?;
     // Atomic write with owner-only perms set before any bytes hit disk (the file
     // may hold plaintext on non-Windows).
-    crate::fsutil::write_atomic(&path, encrypted.as_bytes(), Some(0o600))?;
+    crate::fsutil::write_atomic(path, encrypted.as_bytes(), Some(0o600))?;
     Ok(())
 }
 
@@ -122,10 +148,22 @@ pub fn load_from_file() -> Result<String, DecryptError> {
     let path = credential_path().map_err(|e| DecryptError {
         message: e.to_string(),
     })?;
+    load_at(&path)
+}
+
+/// [`load_from_file`] for the secret kept in credential file `name`.
+pub fn load_secret(name: &str) -> Result<String, DecryptError> {
+    let path = secret_path(name).map_err(|e| DecryptError {
+        message: e.to_string(),
+    })?;
+    load_at(&path)
+}
+
+fn load_at(path: &std::path::Path) -> Result<String, DecryptError> {
     if !path.exists() {
         return Ok(String::new());
     }
-    let stored = std::fs::read_to_string(&path).map_err(|e| DecryptError {
+    let stored = std::fs::read_to_string(path).map_err(|e| DecryptError {
         message: format!("Failed to read credential file: {e}"),
     })?;
     // Windows stores "DPAPI:<base64>" - whitespace-insensitive, so a full trim is
@@ -277,6 +315,20 @@ mod tests {
         assert_eq!(decrypt("hello").unwrap(), "hello");
     }
 
+    #[test]
+    fn test_file_roundtrip_and_clear() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("mirror_credential");
+        save_at(&path, "s3cret").unwrap();
+        assert_ne!(std::fs::read_to_string(&path).unwrap(), "");
+        assert_eq!(load_at(&path).unwrap(), "s3cret");
+
+        // An empty password removes the file rather than storing "".
+        save_at(&path, "").unwrap();
+        assert!(!path.exists());
+        assert_eq!(load_at(&path).unwrap(), "");
+    }
+
     #[cfg(windows)]
     #[test]
     fn test_dpapi_roundtrip() {
@@ -96,16 +96,24 @@ pub fn dpms_on() -> Option<bool> {
 
 /// Force the monitor DPMS power on or off. Returns whether the request was sent.
 pub fn set_dpms(on: bool) -> bool {
+    force_dpms(if on {
+        dpms::DPMSMode::ON
+    } else {
+        dpms::DPMSMode::OFF
+    })
+}
+
+/// Force the monitor into DPMS standby. Returns whether the request was sent.
+pub fn dpms_standby() -> bool {
+    force_dpms(dpms::DPMSMode::STANDBY)
+}
+
+fn force_dpms(level: dpms::DPMSMode) -> bool {
     let Ok((conn, _)) = x11rb::connect(None) else {
         return false;
     };
     // ForceLevel requires DPMS enabled.
     let _ = conn.dpms_enable();
-    let level = if on {
-        dpms::DPMSMode::ON
-    } else {
-        dpms::DPMSMode::OFF
-    };
     let ok = conn.dpms_force_level(level).is_ok();
     let _ = conn.flush();
     ok
@@ -119,12 +127,27 @@ pub fn wake() -> bool {
     };
     let _ = conn.dpms_enable();
     let _ = conn.dpms_force_level(dpms::DPMSMode::ON);
-    // Fake Shift press+release (keycode 50 = Shift_L on standard layouts); a
-    // no-op for the user but enough to reset the idle/screensaver timer.
+    fake_shift(&conn, screen_num);
+    let _ = conn.flush();
+    true
+}
+
+/// Reset the idle timer with a fake key press (XTEST), leaving DPMS alone.
+/// Returns whether an X11 display was reached.
+pub fn reset_idle() -> bool {
+    let Ok((conn, screen_num)) = x11rb::connect(None) else {
+        return false;
+    };
+    fake_shift(&conn, screen_num);
+    let _ = conn.flush();
+    true
+}
+
+/// Fake Shift press+release (keycode 50 = Shift_L on standard layouts); a
+/// no-op for the user but enough to reset the idle/screensaver timer.
+fn fake_shift(conn: &impl Connection, screen_num: usize) {
     if let Some(root) = conn.setup().roots.get(screen_num).map(|s| s.root) {
         let _ = conn.xtest_fake_input(2, 50, 0, root, 0, 0, 0); // KeyPress
         let _ = conn.xtest_fake_input(3, 50, 0, root, 0, 0, 0); // KeyRelease
     }
-    let _ = conn.flush();
-    true
 }
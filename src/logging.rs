@@ -10,6 +10,16 @@
 //! `env_logger`'s `writer::buffer`), so the writer below needs no internal
 //! synchronization.
 //!
+//! With `logging.format: "json"` (or `PC_BRIDGE_LOG_FORMAT=json`) each record
+//! is written as one JSON object per line instead, for Loki/ELK ingestion:
+//! `time`, `level`, `module`, `msg`, plus any structured key-values the call
+//! site attached (`info!(command = name; "...")`).
+//!
+//! `logging.level` (or `PC_BRIDGE_LOG_LEVEL`) sets the lowest level written,
+//! `info` by default. Per-poll and per-command detail is logged at `debug`,
+//! so `info` holds startup, state changes and errors, and `warn` only
+//! problems.
+//!
 //! Nothing sensitive is logged: existing call sites log only error messages,
 //! fixed strings, and `host:port` - never credentials. As defense-in-depth the
 //! log files are created owner-only (`0600` on Unix; `%LOCALAPPDATA%` is
@@ -19,6 +29,8 @@ use std::fs::{self, File, OpenOptions};
 use std::io::{self, Write};
 use std::path::{Path, PathBuf};
 
+use crate::config::{Config, LogFormat, LogLevel};
+
 /// Maximum size of the active log file before it is rotated.
 const MAX_LOG_BYTES: u64 = 5 * 1024 * 1024;
 /// Number of rotated files to retain (`pc-bridge.log.1` ..= `pc-bridge.log.N`).
@@ -107,10 +119,18 @@ impl Write for RotatingWriter {
 /// read-only or permission-denied log directory never prevents startup.
 pub fn init() {
     let mut builder = env_logger::Builder::from_default_env();
-    builder
-        .filter_level(log::LevelFilter::Info)
-        .format_target(false)
-        .format_timestamp_secs();
+    builder.filter_level(log_level().filter());
+    match log_format() {
+        LogFormat::Text => {
+            builder.format_target(false).format_timestamp_secs();
+        }
+        LogFormat::Json => {
+            builder.format(|buf, record| {
+                let time = buf.timestamp_millis().to_string();
+                writeln!(buf, "{}", json_line(&time, record))
+            });
+        }
+    }
 
     match log_file_path().and_then(RotatingWriter::open) {
         Ok(writer) => {
@@ -126,6 +146,55 @@ pub fn init() {
     }
 }
 
+/// `PC_BRIDGE_LOG_FORMAT` wins over the config file, so a one-off run can
+/// switch formats without editing it.
+fn log_format() -> LogFormat {
+    match std::env::var("PC_BRIDGE_LOG_FORMAT").as_deref() {
+        Ok("json") => LogFormat::Json,
+        Ok("text") => LogFormat::Text,
+        _ => Config::peek_log_format(),
+    }
+}
+
+/// `PC_BRIDGE_LOG_LEVEL` wins over the config file, like the format.
+fn log_level() -> LogLevel {
+    std::env::var("PC_BRIDGE_LOG_LEVEL")
+        .ok()
+        .and_then(|v| serde_json::from_value(v.trim().to_ascii_lowercase().into()).ok())
+        .unwrap_or_else(Config::peek_log_level)
+}
+
+/// One JSON log line (without the newline). Structured key-values become
+/// top-level fields; they can't shadow the fixed ones.
+fn json_line(time: &str, record: &log::Record) -> String {
+    struct Fields(serde_json::Map<String, serde_json::Value>);
+
+    impl<'kvs> log::kv::VisitSource<'kvs> for Fields {
+        fn visit_pair(
+            &mut self,
+            key: log::kv::Key<'kvs>,
+            value: log::kv::Value<'kvs>,
+        ) -> Result<(), log::kv::Error> {
+            self.0
+                .entry(key.as_str())
+                .or_insert_with(|| value.to_string().into());
+            Ok(())
+        }
+    }
+
+    let mut fields = Fields(serde_json::Map::new());
+    fields.0.insert("time".into(), time.into());
+    fields
+        .0
+        .insert("level".into(), record.level().as_str().into());
+    fields.0.insert("module".into(), record.target().into());
+    fields
+        .0
+        .insert("msg".into(), record.args().to_string().into());
+    let _ = record.key_values().visit(&mut fields);
+    serde_json::Value::Object(fields.0).to_string()
+}
+
 /// Resolve the log file path, creating the parent directory if needed.
 fn log_file_path() -> io::Result<PathBuf> {
     let dir = log_dir();
@@ -191,6 +260,24 @@ mod tests {
         assert_eq!(backup_path(p, 3), PathBuf::from("/var/log/pc-bridge.log.3"));
     }
 
+    #[test]
+    fn json_line_has_fixed_and_structured_fields() {
+        let kvs = [("command", "Sleep"), ("level", "shadowed")];
+        let record = log::Record::builder()
+            .level(log::Level::Warn)
+            .target("pc_bridge::commands")
+            .args(format_args!("Executing \"{}\"", "Sleep"))
+            .key_values(&kvs)
+            .build();
+        let line: serde_json::Value =
+            serde_json::from_str(&json_line("2026-01-02T03:04:05.678Z", &record)).unwrap();
+        assert_eq!(line["time"], "2026-01-02T03:04:05.678Z");
+        assert_eq!(line["level"], "WARN");
+        assert_eq!(line["module"], "pc_bridge::commands");
+        assert_eq!(line["msg"], "Executing \"Sleep\"");
+        assert_eq!(line["command"], "Sleep");
+    }
+
     #[test]
     fn rotates_when_exceeding_limit() {
         let dir = tempfile::tempdir().unwrap();
@@ -25,8 +25,10 @@ mod linux_wayland;
 mod linux_x11;
 mod logging;
 mod mqtt;
+mod night_light;
 mod notification;
 mod power;
+mod proclist;
 mod sensors;
 mod setup;
 mod steam;
@@ -36,12 +38,16 @@ mod tray;
 mod ui;
 mod updater;
 
-use log::{error, info};
+use log::{error, info, warn};
 use std::sync::Arc;
 #[cfg(windows)]
 use std::time::Duration;
 use tokio::sync::{RwLock, broadcast};
 
+/// How long exit waits for still-running blocking tasks (a wake sequence, a
+/// stuck WMI query) before abandoning them.
+const SHUTDOWN_BLOCKING_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(2);
+
 /// Saved console mode for restoration on exit (Windows only).
 /// Stores the raw handle as `isize` (avoiding `*mut c_void` Send/Sync issues)
 /// and the original `CONSOLE_MODE` flags.
@@ -51,7 +57,7 @@ static ORIGINAL_CONSOLE_MODE: std::sync::OnceLock<(
     windows::Win32::System::Console::CONSOLE_MODE,
 )> = std::sync::OnceLock::new();
 
-use crate::commands::CommandExecutor;
+use crate::commands::{CommandExecutor, CommandSlots};
 use crate::config::Config;
 use crate::mqtt::MqttClient;
 #[cfg(windows)]
@@ -74,6 +80,9 @@ pub struct AppState {
     /// their OS side effects are NOT performed. Enabled via `--dry-run` or
     /// `PC_BRIDGE_DRY_RUN=1` for the integration test kit; off in normal use.
     pub dry_run: bool,
+    /// The executor's concurrent command slots, shared so the
+    /// `command_slots_used` sensor can report them.
+    pub command_slots: CommandSlots,
 }
 
 /// Handle for optional tasks
@@ -90,11 +99,30 @@ fn restore_console_mode() {
 }
 
 fn main() -> anyhow::Result<()> {
+    // --config-dir relocates userConfig.json (games included). Exported so the
+    // settings window and the updater's relaunch inherit it.
+    if let Some(dir) = config::config_dir_arg(std::env::args()) {
+        // SAFETY: nothing else is running yet, so no thread can read the
+        // environment concurrently.
+        unsafe { std::env::set_var("PC_BRIDGE_CONFIG_DIR", dir) };
+    }
+
     // The settings window runs in its own mode; the headless agent never loads egui.
     if std::env::args().any(|a| a == "--ui") {
         return ui::run();
     }
 
+    // --check / --validate: config + broker smoke test for setup scripts. It
+    // leaves a running agent alone, so it comes before the single-instance
+    // handling.
+    if std::env::args().any(|a| matches!(a.as_str(), "--check" | "-check" | "--validate")) {
+        let ok = tokio::runtime::Builder::new_current_thread()
+            .enable_all()
+            .build()?
+            .block_on(run_check());
+        std::process::exit(if ok { 0 } else { 1 });
+    }
+
     // Single-instance: if the headless agent is already running and this is a plain
     // launch (the user opened the app again), don't kill + restart it - open the
     // settings window instead. The updater relaunches with `--replace`, which skips
@@ -107,10 +135,14 @@ fn main() -> anyhow::Result<()> {
         return Ok(());
     }
 
-    tokio::runtime::Builder::new_current_thread()
+    let runtime = tokio::runtime::Builder::new_current_thread()
         .enable_all()
-        .build()?
-        .block_on(run_agent())
+        .build()?;
+    let result = runtime.block_on(run_agent());
+    // Dropping the runtime waits for every spawn_blocking task with no limit, so
+    // one wedged Win32/D-Bus call would keep the process alive after "stopped".
+    runtime.shutdown_timeout(SHUTDOWN_BLOCKING_TIMEOUT);
+    result
 }
 
 /// Spawn the settings window as a separate `--ui` process (it runs independently of
@@ -151,24 +183,49 @@ pub(crate) fn instance_already_running() -> bool {
 
 /// Mark this process as the running agent by creating the named singleton mutex and
 /// holding it for the process lifetime (the kernel releases it on exit, so the next
-/// launch's probe sees it gone). No-op off Windows.
+/// launch's probe sees it gone). Returns false if the mutex already existed, i.e.
+/// another agent holds it. Creation and the existence check are one atomic kernel
+/// call, so two launches racing past `instance_already_running` can't both win.
+/// With `wait`, a mutex that already exists is retried for up to ~2s first: an
+/// agent that was just quit still holds it while it exits, and a quick
+/// quit-then-relaunch shouldn't lose to it. Always true off Windows.
 #[cfg(windows)]
-fn hold_singleton() {
+fn hold_singleton(wait: bool) -> bool {
+    use windows::Win32::Foundation::{CloseHandle, ERROR_ALREADY_EXISTS, GetLastError};
     use windows::Win32::System::Threading::CreateMutexW;
     use windows::core::w;
-    unsafe {
-        // Keep the handle alive for the whole process; leaking it is intentional (it
-        // is closed by the OS on exit). If another handle to the name exists (an old
-        // instance mid-exit), we still get a valid handle and become the sole owner
-        // once it closes.
-        if let Ok(h) = CreateMutexW(None, false, w!("Local\\pc-bridge-agent-singleton")) {
-            std::mem::forget(h);
+
+    let mut retries = if wait { 10 } else { 0 };
+    loop {
+        // SAFETY: plain Win32 calls; the handle is either kept or closed once.
+        unsafe {
+            let h = match CreateMutexW(None, false, w!("Local\\pc-bridge-agent-singleton")) {
+                Ok(h) => h,
+                // Couldn't create it at all - don't block startup over the guard.
+                Err(_) => return true,
+            };
+            let first = GetLastError() != ERROR_ALREADY_EXISTS;
+            if first || retries == 0 {
+                // Keep the handle alive for the whole process; leaking it is
+                // intentional (it is closed by the OS on exit). When the name is
+                // still held (a --replace takeover), this handle keeps it existing
+                // after the other agent exits, so we end up the sole owner.
+                std::mem::forget(h);
+                return first;
+            }
+            // Let go of ours so the name disappears once the exiting agent's
+            // handle closes.
+            let _ = CloseHandle(h);
         }
+        retries -= 1;
+        std::thread::sleep(Duration::from_millis(200));
     }
 }
 
 #[cfg(not(windows))]
-fn hold_singleton() {}
+fn hold_singleton(_wait: bool) -> bool {
+    true
+}
 
 async fn run_agent() -> anyhow::Result<()> {
     // On Windows, attach to parent console if launched from terminal
@@ -206,6 +263,17 @@ async fn run_agent() -> anyhow::Result<()> {
 
     info!("PC Bridge starting...");
 
+    // Installed as a service, everything visible goes to the invisible
+    // session 0 desktop; most "notifications don't show" reports are this.
+    #[cfg(windows)]
+    if proclist::in_session_0() {
+        warn!(
+            "Running in session 0 (as a Windows service): notifications, launched apps, the \
+             tray icon and other GUI actions will NOT appear on the user's desktop. Start \
+             pc-bridge at logon in the user's session instead to use them"
+        );
+    }
+
     // Parse CLI arguments
     let args: Vec<String> = std::env::args().collect();
     let force_setup = args.iter().any(|a| a == "--setup");
@@ -216,11 +284,18 @@ async fn run_agent() -> anyhow::Result<()> {
             Ok("1" | "true")
         );
 
-    // Kill any existing instances (an updater --replace takeover, or a stale one),
-    // then claim the singleton so a later plain launch opens settings instead of
-    // killing us.
+    // Claim the singleton first so a later plain launch opens settings instead of
+    // killing us. A plain launch that still finds it held after a short wait (an
+    // agent that was just quit releases it as it exits) lost a startup race with
+    // another agent (both passed main()'s probe) and exits rather than killing
+    // the winner; an updater --replace takeover proceeds at once. Then kill any
+    // existing instances (the --replace target, or a stale one).
+    let is_replace = args.iter().any(|a| a == "--replace");
+    if !hold_singleton(!is_replace) && !is_replace {
+        warn!("Another pc-bridge agent is already running; exiting");
+        return Ok(());
+    }
     kill_existing_instances();
-    hold_singleton();
 
     // Clean up leftover .old files from a previous update
     updater::cleanup_old_files();
@@ -317,6 +392,7 @@ async fn run_agent() -> anyhow::Result<()> {
         process_watcher,
         start_time: std::time::Instant::now(),
         dry_run,
+        command_slots: CommandSlots::default(),
     });
     if dry_run {
         info!(
@@ -327,9 +403,13 @@ async fn run_agent() -> anyhow::Result<()> {
     // Collect task handles for cleanup
     let mut handles: Vec<TaskHandle> = Vec::new();
 
-    // Start event-driven process watcher if game detection or idle tracking is enabled
+    // Start event-driven process watcher if game detection, process_count or
+    // idle tracking is enabled
     #[cfg(windows)]
-    if config.features.running_game || config.features.idle_tracking {
+    if config.features.running_game
+        || config.features.process_count
+        || config.features.idle_tracking
+    {
         let poll_interval = Duration::from_secs(config.intervals.game_sensor.max(5));
         state
             .process_watcher
@@ -364,7 +444,7 @@ async fn run_agent() -> anyhow::Result<()> {
                         // entities.
                         Ok(())
                         | Err(tokio::sync::broadcast::error::RecvError::Lagged(_)) => {
-                            let config = state.config.read().await;
+                            let config = state.config.read().await.clone();
                             // Re-register only. We do NOT re-run clear_disabled_entities
                             // here: re-registration alone restores any config a broker
                             // restart dropped, and the disabled entities were already
@@ -372,6 +452,13 @@ async fn run_agent() -> anyhow::Result<()> {
                             // repeating the ~3x-per-entity teardown on every reconnect is
                             // pure churn on a flapping broker.
                             state.mqtt.register_discovery(&config).await;
+                            // Then check it stuck (a broker ACL drops it silently),
+                            // without holding up shutdown.
+                            tokio::select! {
+                                biased;
+                                _ = shutdown_rx.recv() => break,
+                                () = state.mqtt.verify_discovery(&config) => {}
+                            }
                         }
                         Err(tokio::sync::broadcast::error::RecvError::Closed) => break,
                     },
@@ -408,6 +495,28 @@ async fn run_agent() -> anyhow::Result<()> {
         );
     }
 
+    // Seed initial sensor states, each gated by its own flag, BEFORE the sensors
+    // start. With the network not up yet (right after a reboot) rumqttc keeps
+    // these queued and sends them in order once it connects, so a lock or a
+    // display-off the sensors report meanwhile still lands after them.
+    if config.features.sleep_wake {
+        state
+            .mqtt
+            .publish_sensor_retained("sleep_state", "awake")
+            .await;
+        #[cfg(windows)]
+        state.mqtt.publish_sensor_retained("away_mode", "off").await;
+    }
+    if config.features.display_state {
+        state.mqtt.publish_sensor_retained("display", "on").await;
+    }
+    if config.features.session_state {
+        state
+            .mqtt
+            .publish_sensor_retained("session", "unlocked")
+            .await;
+    }
+
     // Runtime supervisor: starts/stops every sensor task live as feature flags
     // change (no restart). Only HWiNFO stays startup-gated above.
     handles.push(tokio::spawn(
@@ -448,54 +557,53 @@ async fn run_agent() -> anyhow::Result<()> {
         state.mqtt.publish_hwinfo_availability(false).await;
     }
 
-    // Seed initial sensor states, each gated by its own flag.
-    if config.features.sleep_wake {
-        state
-            .mqtt
-            .publish_sensor_retained("sleep_state", "awake")
-            .await;
-    }
-    if config.features.display_state {
-        state.mqtt.publish_sensor_retained("display", "on").await;
-    }
-    if config.features.session_state {
-        state
-            .mqtt
-            .publish_sensor_retained("session", "unlocked")
-            .await;
-    }
-
     // Wait for shutdown signal (Ctrl+C or broadcast)
     info!("PC Bridge running. Press Ctrl+C to stop.");
 
     #[cfg(windows)]
     {
+        let mut shutdown_rx = shutdown_tx.subscribe();
         if console_attached {
-            // Terminal mode: wait for Ctrl+C via tokio's signal handler
-            tokio::signal::ctrl_c().await.ok();
+            // Terminal mode: wait for Ctrl+C via tokio's console ctrl handler.
+            // If that handler can't be installed (some terminal hosts refuse
+            // SetConsoleCtrlHandler), ctrl_c() errors immediately - treating
+            // that as a signal would shut down right after startup, so fall
+            // back to the broadcast path (tray Quit / --replace) instead.
+            if let Err(e) = tokio::signal::ctrl_c().await {
+                warn!(
+                    "Could not install Ctrl+C handler ({e}); use the tray Quit or --replace to stop"
+                );
+                let _ = shutdown_rx.recv().await;
+            }
         } else {
             // Background mode (no console): wait for broadcast shutdown
-            let mut shutdown_rx = shutdown_tx.subscribe();
             let _ = shutdown_rx.recv().await;
         }
     }
 
     #[cfg(not(windows))]
-    tokio::signal::ctrl_c().await?;
+    wait_for_unix_shutdown(shutdown_tx.subscribe()).await;
 
     info!("Shutting down...");
 
-    // Second Ctrl+C force-exits (in case shutdown hangs)
+    // Second Ctrl+C force-exits (in case shutdown hangs). Only when the handler
+    // actually installed - an Err here must not be mistaken for a keypress.
     tokio::spawn(async {
-        tokio::signal::ctrl_c().await.ok();
-        eprintln!("Forced shutdown");
-        #[cfg(windows)]
-        restore_console_mode();
-        std::process::exit(1);
+        if tokio::signal::ctrl_c().await.is_ok() {
+            eprintln!("Forced shutdown");
+            #[cfg(windows)]
+            restore_console_mode();
+            std::process::exit(1);
+        }
     });
 
     let _ = shutdown_tx.send(());
 
+    // A wake sequence may still be holding the PC awake; let go of it rather
+    // than rely on the process exiting.
+    #[cfg(windows)]
+    let _ = tokio::task::spawn_blocking(crate::power::release_sleep_prevention).await;
+
     // Wait for tasks to finish (with timeout)
     let _ = tokio::time::timeout(std::time::Duration::from_secs(5), async {
         for handle in handles {
@@ -523,6 +631,42 @@ async fn run_agent() -> anyhow::Result<()> {
     Ok(())
 }
 
+/// Wait for SIGINT (Ctrl+C) or SIGTERM (systemd stop, `kill`). Each handler is
+/// registered independently so one failing doesn't lose the other; if neither
+/// can be installed we log it and fall back to the internal shutdown broadcast.
+#[cfg(not(windows))]
+async fn wait_for_unix_shutdown(mut shutdown_rx: tokio::sync::broadcast::Receiver<()>) {
+    use tokio::signal::unix::{SignalKind, signal};
+
+    let mut sigterm = match signal(SignalKind::terminate()) {
+        Ok(s) => Some(s),
+        Err(e) => {
+            warn!("Could not install SIGTERM handler: {e}");
+            None
+        }
+    };
+    let sigterm_recv = async {
+        match sigterm.as_mut() {
+            Some(s) => {
+                s.recv().await;
+            }
+            None => std::future::pending().await,
+        }
+    };
+    let ctrl_c = async {
+        if let Err(e) = tokio::signal::ctrl_c().await {
+            warn!("Could not install Ctrl+C handler: {e}");
+            std::future::pending::<()>().await;
+        }
+    };
+
+    tokio::select! {
+        () = ctrl_c => {}
+        () = sigterm_recv => info!("Received SIGTERM"),
+        _ = shutdown_rx.recv() => {}
+    }
+}
+
 /// Log which features are enabled
 fn log_enabled_features(config: &Config) {
     let f = &config.features;
@@ -541,6 +685,7 @@ fn log_enabled_features(config: &Config) {
         f.cmd_lock,
         f.cmd_logoff,
         f.cmd_monitor,
+        f.cmd_priority,
         f.notifications,
         f.cpu_sensor,
         f.memory_sensor,
@@ -559,6 +704,26 @@ fn log_enabled_features(config: &Config) {
         f.disk_sensor,
         f.uptime_sensor,
         f.hwinfo_sensor,
+        f.focus_assist,
+        f.process_count,
+        f.vram_sensor,
+        f.cmd_service,
+        f.audio_peak,
+        f.window_fullscreen,
+        f.cmd_window,
+        f.windows_version,
+        f.cmd_mouse,
+        f.metered_connection,
+        f.remote_session,
+        f.device_triggers,
+        f.cmd_registry,
+        f.heartbeat,
+        f.night_light,
+        f.game_mode,
+        f.command_slots,
+        f.cmd_explorer,
+        f.tcp_connections,
+        f.keep_awake,
         config.custom_sensors_enabled,
         config.custom_commands_enabled,
     ]
@@ -645,6 +810,47 @@ fn reset_mqtt_password() -> anyhow::Result<()> {
     Ok(())
 }
 
+/// `--check` / `--validate`: load and validate userConfig.json, connect to the
+/// broker with a short timeout and publish a test message. Nothing else starts
+/// (no sensors, watchers or power listener). Prints each step; returns false
+/// if any failed, which `main` turns into a nonzero exit code.
+async fn run_check() -> bool {
+    const CONNECT_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(10);
+
+    // GUI-subsystem exe: attach to the calling shell so the output shows.
+    #[cfg(windows)]
+    unsafe {
+        let _ = windows::Win32::System::Console::AttachConsole(u32::MAX);
+    }
+
+    match Config::config_path() {
+        Ok(path) => println!("Config: {}", path.display()),
+        Err(e) => {
+            println!("FAIL  config location: {e:#}");
+            return false;
+        }
+    }
+    let config = match Config::load() {
+        Ok(config) => config,
+        Err(e) => {
+            println!("FAIL  config: {e:#}");
+            return false;
+        }
+    };
+    println!("OK    config valid (device '{}')", config.device_name);
+
+    match MqttClient::check_connection(&config, CONNECT_TIMEOUT).await {
+        Ok(broker) => {
+            println!("OK    MQTT connected to {broker} and test message acknowledged");
+            true
+        }
+        Err(e) => {
+            println!("FAIL  MQTT: {e:#}");
+            false
+        }
+    }
+}
+
 /// Pop up a console and prompt for the MQTT password when decryption fails.
 fn handle_credential_failure() -> anyhow::Result<Config> {
     use std::io::{self, Write};
@@ -711,60 +917,21 @@ fn handle_credential_failure() -> anyhow::Result<Config> {
 /// Kill any other running instances (platform-specific)
 #[cfg(windows)]
 fn kill_existing_instances() {
-    use windows::Win32::Foundation::CloseHandle;
-    use windows::Win32::System::Diagnostics::ToolHelp::{
-        CreateToolhelp32Snapshot, PROCESSENTRY32W, Process32FirstW, Process32NextW,
-        TH32CS_SNAPPROCESS,
-    };
-    use windows::Win32::System::Threading::{OpenProcess, PROCESS_TERMINATE, TerminateProcess};
-
-    let my_pid = std::process::id();
-
-    // Match any of these exe names (covers renames)
-    let exe_names = ["pc-bridge.exe", "pc bridge.exe", "pc-agent.exe"];
-
-    unsafe {
-        let snapshot = match CreateToolhelp32Snapshot(TH32CS_SNAPPROCESS, 0) {
-            Ok(s) => s,
-            Err(e) => {
-                info!("Failed to create process snapshot: {:?}", e);
-                return;
-            }
-        };
-
-        let mut entry = PROCESSENTRY32W {
-            dwSize: std::mem::size_of::<PROCESSENTRY32W>() as u32,
-            ..Default::default()
-        };
-
-        if Process32FirstW(snapshot, &raw mut entry).is_ok() {
-            loop {
-                let proc_name = String::from_utf16_lossy(&entry.szExeFile)
-                    .trim_end_matches('\0')
-                    .to_lowercase();
-
-                // Check if this process matches any of our exe names
-                let is_match = exe_names.iter().any(|&name| proc_name == name);
-
-                if is_match
-                    && entry.th32ProcessID != my_pid
-                    && let Ok(handle) = OpenProcess(PROCESS_TERMINATE, false, entry.th32ProcessID)
-                {
-                    info!(
-                        "Killing existing instance: {} (PID {})",
-                        proc_name, entry.th32ProcessID
-                    );
-                    let _ = TerminateProcess(handle, 0);
-                    let _ = CloseHandle(handle);
-                }
-
-                if Process32NextW(snapshot, &raw mut entry).is_err() {
-                    break;
-                }
-            }
+    let processes = match proclist::snapshot() {
+        Ok(p) => p,
+        Err(e) => {
+            info!("Failed to create process snapshot: {:?}", e);
+            return;
         }
+    };
 
-        let _ = CloseHandle(snapshot);
+    let own_exe = proclist::own_exe_name();
+    for proc in proclist::other_instances(&processes, std::process::id(), &own_exe) {
+        info!(
+            "Killing existing instance: {} (PID {})",
+            proc.name, proc.pid
+        );
+        proclist::terminate(proc.pid);
     }
 
     // Give processes time to exit
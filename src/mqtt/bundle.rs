@@ -0,0 +1,156 @@
+//! Bundled sensor state (`bundle_state`).
+//!
+//! Instead of one retained topic per sensor, values are collected here and
+//! published together as a single retained JSON object on
+//! `homeassistant/sensor/<device>/state`, at most once per `FLUSH_DELAY`. A
+//! burst of updates (every sensor republishing after a reconnect, or several
+//! polls landing together) becomes one message. Discovery points each entity
+//! into the object with a `value_template`.
+//!
+//! `sleep_state` and `bridge_info` keep their own topics: the sleep publisher
+//! writes `sleep_state` over a separate connection moments before suspend, and
+//! the birth message is sent by the event loop itself. Attributes are always
+//! per-sensor.
+
+use log::{debug, warn};
+use rumqttc::{AsyncClient, QoS};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tokio::sync::{Notify, broadcast};
+
+use super::{DISCOVERY_PREFIX, MqttClient};
+
+/// Sensors that never go into the bundle (see module docs).
+const UNBUNDLED: &[&str] = &["sleep_state", "bridge_info"];
+
+/// How long after the first change the bundle waits before publishing, so the
+/// rest of a burst lands in the same message.
+const FLUSH_DELAY: Duration = Duration::from_secs(1);
+
+/// Latest value of every bundled sensor, plus a wake-up for the flusher.
+pub(super) struct StateBundle {
+    values: Mutex<serde_json::Map<String, serde_json::Value>>,
+    dirty: Notify,
+}
+
+impl StateBundle {
+    pub(super) fn new() -> Self {
+        Self {
+            values: Mutex::new(serde_json::Map::new()),
+            dirty: Notify::new(),
+        }
+    }
+
+    /// Record `name`'s value; `run_flusher` publishes it shortly. Always
+    /// schedules a flush, even when the value is unchanged, so a sensor
+    /// republishing after a reconnect still refreshes the retained object.
+    pub(super) fn set(&self, name: &str, value: &str) {
+        self.values
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .insert(name.to_string(), value.into());
+        self.dirty.notify_one();
+    }
+
+    fn snapshot(&self) -> Vec<u8> {
+        let values = self.values.lock().unwrap_or_else(|e| e.into_inner());
+        serde_json::to_vec(&*values).unwrap_or_default()
+    }
+}
+
+/// Topic the bundle is published on.
+pub(super) fn bundle_topic(device_name: &str) -> String {
+    format!("{}/sensor/{}/state", DISCOVERY_PREFIX, device_name)
+}
+
+/// `value_template` picking `name` out of the bundle. A key nothing has been
+/// published for yet renders empty, which HA skips instead of logging a
+/// template error. The name is JSON-quoted so a custom sensor name can't
+/// break out of the Jinja string.
+pub(super) fn value_template(name: &str) -> String {
+    let key = serde_json::to_string(name).unwrap_or_default();
+    format!("{{{{ value_json[{}] | default('') }}}}", key)
+}
+
+/// Publish the bundle whenever it changes, until shutdown.
+pub(super) async fn run_flusher(
+    bundle: Arc<StateBundle>,
+    client: AsyncClient,
+    topic: String,
+    mut shutdown_rx: broadcast::Receiver<()>,
+) {
+    loop {
+        tokio::select! {
+            biased;
+            _ = shutdown_rx.recv() => {
+                debug!("State bundle flusher shutting down");
+                break;
+            }
+            () = bundle.dirty.notified() => {}
+        }
+        tokio::time::sleep(FLUSH_DELAY).await;
+        let payload = bundle.snapshot();
+        if let Err(e) = client
+            .publish(&topic, QoS::AtLeastOnce, true, payload)
+            .await
+        {
+            warn!(topic = topic.as_str(); "MQTT publish failed for {}: {:?}", topic, e);
+        }
+    }
+}
+
+impl MqttClient {
+    /// The bundle `name` is published through, if bundling is on and the
+    /// sensor isn't one of the `UNBUNDLED` ones.
+    pub(super) fn bundle_for(&self, name: &str) -> Option<&StateBundle> {
+        self.bundle
+            .as_deref()
+            .filter(|_| !UNBUNDLED.contains(&name))
+    }
+
+    /// State topic for sensor `name`'s discovery config: the bundle topic
+    /// when it's bundled, else its own.
+    pub(super) fn sensor_state_topic(&self, name: &str) -> String {
+        if self.bundle_for(name).is_some() {
+            bundle_topic(&self.device_name)
+        } else {
+            self.sensor_topic(name)
+        }
+    }
+
+    /// `value_template` to go with `sensor_state_topic`.
+    pub(super) fn sensor_value_template(&self, name: &str) -> Option<String> {
+        self.bundle_for(name).map(|_| value_template(name))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_value_template() {
+        assert_eq!(
+            value_template("cpu_usage"),
+            r#"{{ value_json["cpu_usage"] | default('') }}"#
+        );
+        // Quotes in a custom sensor name stay inside the string literal.
+        assert_eq!(
+            value_template(r#"a"b"#),
+            r#"{{ value_json["a\"b"] | default('') }}"#
+        );
+    }
+
+    #[test]
+    fn test_snapshot_keeps_latest_values() {
+        let bundle = StateBundle::new();
+        bundle.set("cpu_usage", "12");
+        bundle.set("runninggames", "none");
+        bundle.set("cpu_usage", "40");
+        let json: serde_json::Value = serde_json::from_slice(&bundle.snapshot()).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!({"cpu_usage": "40", "runninggames": "none"})
+        );
+    }
+}
@@ -0,0 +1,148 @@
+//! MQTT client certificates from the Windows certificate store.
+//!
+//! `mqtt.client_cert` selects a certificate in the current user's Personal
+//! ("MY") store, either by SHA-1 thumbprint (as shown by certmgr / `certutil`,
+//! spaces and colons allowed) or by a substring of the subject. The private key
+//! never leaves the store: TLS signatures go through the certificate's own CNG
+//! key handle, so non-exportable and smartcard/TPM-backed keys work too.
+//!
+//! native-tls only takes a client identity as an exported PKCS#12 blob, so
+//! connections with a client certificate use rustls with a CNG signer instead.
+//! The server is still checked against the Windows trusted roots.
+
+/// TLS client config presenting the selected store certificate.
+#[cfg(windows)]
+pub(crate) type ClientTlsConfig = std::sync::Arc<rustls::ClientConfig>;
+
+/// Never built off Windows: `mqtt.client_cert` needs the Windows store.
+#[cfg(not(windows))]
+pub(crate) type ClientTlsConfig = std::convert::Infallible;
+
+/// How `mqtt.client_cert` picks a certificate.
+#[derive(Debug, PartialEq, Eq)]
+pub(crate) enum CertSelector {
+    /// SHA-1 thumbprint bytes (20)
+    Thumbprint(Vec<u8>),
+    /// Case-insensitive substring of a subject name value (e.g. "gaming-pc")
+    Subject(String),
+}
+
+impl CertSelector {
+    /// A value that is exactly 40 hex digits once spaces/colons are dropped is
+    /// a thumbprint; anything else is matched against the subject.
+    pub(crate) fn parse(value: &str) -> Option<Self> {
+        let value = value.trim();
+        if value.is_empty() {
+            return None;
+        }
+        let hex: String = value.chars().filter(|c| !matches!(c, ' ' | ':')).collect();
+        if hex.len() == 40 && hex.chars().all(|c| c.is_ascii_hexdigit()) {
+            let bytes = (0..40)
+                .step_by(2)
+                .map(|i| u8::from_str_radix(&hex[i..i + 2], 16).unwrap_or(0))
+                .collect();
+            return Some(Self::Thumbprint(bytes));
+        }
+        Some(Self::Subject(value.to_string()))
+    }
+}
+
+/// Build a rustls config presenting the selected store certificate, signing
+/// with its key handle in place.
+#[cfg(windows)]
+pub(crate) fn client_tls_config(selector: &CertSelector) -> anyhow::Result<ClientTlsConfig> {
+    use rustls_cng::signer::CngSigningKey;
+    use rustls_cng::store::{CertStore, CertStoreType};
+    use std::sync::Arc;
+
+    let store = CertStore::open(CertStoreType::CurrentUser, "My")
+        .map_err(|e| anyhow::anyhow!("cannot open the Personal certificate store: {e}"))?;
+    let found = match selector {
+        CertSelector::Thumbprint(hash) => store.find_by_sha1(hash),
+        CertSelector::Subject(subject) => store.find_by_subject_str(subject),
+    }
+    .map_err(|e| anyhow::anyhow!("certificate store search failed: {e}"))?;
+    let Some(ctx) = found.into_iter().next() else {
+        anyhow::bail!("no certificate matching {selector:?} in CurrentUser\\MY");
+    };
+
+    let key = ctx
+        .acquire_key()
+        .and_then(CngSigningKey::new)
+        .map_err(|e| anyhow::anyhow!("the client certificate's private key is unusable: {e}"))?;
+    let chain = ctx
+        .as_chain_der()
+        .map_err(|e| anyhow::anyhow!("cannot build the client certificate chain: {e}"))?;
+    let certified =
+        rustls::sign::CertifiedKey::new(chain.into_iter().map(Into::into).collect(), Arc::new(key));
+
+    let mut roots = rustls::RootCertStore::empty();
+    let (added, _) =
+        roots.add_parsable_certificates(rustls_native_certs::load_native_certs().certs);
+    if added == 0 {
+        anyhow::bail!("no trusted root certificates found in the Windows store");
+    }
+
+    let provider = Arc::new(rustls::crypto::ring::default_provider());
+    let config = rustls::ClientConfig::builder_with_provider(provider)
+        .with_safe_default_protocol_versions()
+        .map_err(|e| anyhow::anyhow!("TLS init failed: {e}"))?
+        .with_root_certificates(roots)
+        .with_client_cert_resolver(Arc::new(StoreCert(Arc::new(certified))));
+    Ok(Arc::new(config))
+}
+
+/// Always presents the one store certificate, whatever the server asks for.
+#[cfg(windows)]
+#[derive(Debug)]
+struct StoreCert(std::sync::Arc<rustls::sign::CertifiedKey>);
+
+#[cfg(windows)]
+impl rustls::client::ResolvesClientCert for StoreCert {
+    fn resolve(
+        &self,
+        _root_hint_subjects: &[&[u8]],
+        _sigschemes: &[rustls::SignatureScheme],
+    ) -> Option<std::sync::Arc<rustls::sign::CertifiedKey>> {
+        Some(self.0.clone())
+    }
+
+    fn has_certs(&self) -> bool {
+        true
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::CertSelector;
+
+    #[test]
+    fn test_parse_thumbprint() {
+        let sel =
+            CertSelector::parse("3b:a1 C0 ff 00 11 22 33 44 55 66 77 88 99 aa bb cc dd ee ff");
+        let Some(CertSelector::Thumbprint(bytes)) = sel else {
+            panic!("expected thumbprint, got {sel:?}");
+        };
+        assert_eq!(bytes.len(), 20);
+        assert_eq!(&bytes[..3], &[0x3b, 0xa1, 0xc0]);
+    }
+
+    #[test]
+    fn test_parse_subject() {
+        assert_eq!(
+            CertSelector::parse(" gaming-pc "),
+            Some(CertSelector::Subject("gaming-pc".to_string()))
+        );
+        // 40 chars but not hex - a subject, not a thumbprint.
+        let s = "CN=zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz";
+        assert!(matches!(
+            CertSelector::parse(s),
+            Some(CertSelector::Subject(_))
+        ));
+    }
+
+    #[test]
+    fn test_parse_empty() {
+        assert_eq!(CertSelector::parse("  "), None);
+    }
+}
@@ -6,8 +6,9 @@
 //! helpers below build single payloads.
 
 use std::sync::Arc;
+use std::time::Duration;
 
-use log::{debug, error, info};
+use log::{debug, error, info, warn};
 use rumqttc::QoS;
 
 use super::payload::{HADevice, HADiscoveryPayload, derive_state_class};
@@ -15,13 +16,66 @@ use super::payload::{HADevice, HADiscoveryPayload, derive_state_class};
 #[cfg(windows)]
 use super::payload::AvailabilityEntry;
 use super::{DISCOVERY_PREFIX, MqttClient};
-use crate::config::{Config, CustomCommand, CustomSensor};
+use crate::config::{Config, CustomCommand, CustomSensor, EntityOverride};
+
+/// How long the broker gets to hand our retained discovery config back.
+const DISCOVERY_ECHO_TIMEOUT: Duration = Duration::from_secs(5);
+/// Registrations tried per connection before giving up until the next one.
+const DISCOVERY_ATTEMPTS: u32 = 3;
 
 impl MqttClient {
+    /// Confirm the discovery configs actually landed on the broker, retrying
+    /// registration if not. A broker ACL that denies `homeassistant/#` still
+    /// PUBACKs (MQTT 3.1.1 has no way to say no) and just drops the message,
+    /// so a successful publish proves nothing. Instead we subscribe to the
+    /// always-registered `bridge_info` config and wait for the retained copy
+    /// to come back.
+    pub(crate) async fn verify_discovery(&self, config: &Config) {
+        let probe = self.config_topic("sensor", "bridge_info");
+        for attempt in 1..=DISCOVERY_ATTEMPTS {
+            self.discovery_echo.send_replace(false);
+            let mut echo = self.discovery_echo.subscribe();
+            if let Err(e) = self.client.subscribe(&probe, QoS::AtLeastOnce).await {
+                error!("Failed to subscribe to {probe} to verify discovery: {e:?}");
+                return;
+            }
+            let seen = tokio::time::timeout(DISCOVERY_ECHO_TIMEOUT, echo.wait_for(|&seen| seen))
+                .await
+                .is_ok_and(|r| r.is_ok());
+            let _ = self.client.unsubscribe(&probe).await;
+            if seen {
+                debug!("Discovery config confirmed on the broker ({probe})");
+                return;
+            }
+            if attempt < DISCOVERY_ATTEMPTS {
+                warn!(
+                    "Discovery config {probe} not retained by the broker (attempt {attempt}/{DISCOVERY_ATTEMPTS}) - publishing again"
+                );
+                self.register_discovery(config).await;
+            }
+        }
+        error!(
+            "Discovery config {probe} never reached the broker after {DISCOVERY_ATTEMPTS} attempts - \
+             the device will not appear in Home Assistant. Check that the broker ACL lets this \
+             client publish and subscribe to {DISCOVERY_PREFIX}/#"
+        );
+    }
+
     /// Publish a retained discovery config, logging on failure. A broker
     /// rejection (16 KB packet cap, ACL) mid-registration would otherwise
-    /// silently orphan the entity with no diagnostics.
+    /// silently orphan the entity with no diagnostics. Any `entities`
+    /// override for the entity is merged in first.
     async fn publish_discovery(&self, topic: &str, payload: impl Into<Vec<u8>>) {
+        let mut payload = payload.into();
+        if let Some(id) = entity_id(topic) {
+            let overrides = self
+                .entity_overrides
+                .lock()
+                .unwrap_or_else(|e| e.into_inner());
+            if let Some(entity) = overrides.get(id) {
+                payload = apply_override(payload, entity);
+            }
+        }
         if let Err(e) = self
             .client
             .publish(topic, QoS::AtLeastOnce, true, payload)
@@ -32,6 +86,11 @@ impl MqttClient {
     }
 
     pub(crate) async fn register_discovery(&self, config: &Config) {
+        self.entity_overrides
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .clone_from(&config.entities);
+
         // Fix #5: Use shared device reference instead of creating new one
         let device = &self.device;
 
@@ -97,6 +156,7 @@ impl MqttClient {
                 name: "Sleep State".to_string(),
                 unique_id: format!("{}_sleep_state", self.device_id),
                 state_topic: Some(self.sensor_topic("sleep_state")),
+                value_template: None,
                 command_topic: None,
                 availability_topic: None,
                 availability: None,
@@ -106,7 +166,8 @@ impl MqttClient {
                 device_class: None,
                 unit_of_measurement: None,
                 state_class: None,
-                json_attributes_topic: None,
+                // Carries the Shutdown countdown (seconds_remaining).
+                json_attributes_topic: Some(self.sensor_attributes_topic("sleep_state")),
             };
             let topic = self.config_topic("sensor", "sleep_state");
             let Ok(json) = serde_json::to_string(&payload) else {
@@ -114,6 +175,18 @@ impl MqttClient {
                 return;
             };
             self.publish_discovery(&topic, json).await;
+
+            // Away mode / modern standby comes from Windows power settings.
+            #[cfg(windows)]
+            self.register_sensor(
+                device,
+                "away_mode",
+                "Away Mode",
+                "mdi:power-sleep",
+                None,
+                None,
+            )
+            .await;
         }
 
         // Display power state sensor
@@ -167,7 +240,7 @@ impl MqttClient {
 
         // Now playing (media session) sensor (GSMTC on Windows, playerctl on Linux).
         if config.features.now_playing {
-            self.register_sensor(
+            self.register_sensor_with_attributes(
                 device,
                 "now_playing",
                 "Now Playing",
@@ -193,6 +266,15 @@ impl MqttClient {
                 Some("%"),
             )
             .await;
+            self.register_sensor_with_attributes(
+                device,
+                "cpu_mhz",
+                "CPU Clock",
+                "mdi:speedometer",
+                Some("frequency"),
+                Some("MHz"),
+            )
+            .await;
         }
         if config.features.memory_sensor {
             self.register_sensor(
@@ -253,7 +335,8 @@ impl MqttClient {
             let payload = HADiscoveryPayload {
                 name: "Steam Updating".to_string(),
                 unique_id: format!("{}_steam_updating", self.device_id),
-                state_topic: Some(self.sensor_topic("steam_updating")),
+                state_topic: Some(self.sensor_state_topic("steam_updating")),
+                value_template: self.sensor_value_template("steam_updating"),
                 command_topic: None,
                 availability_topic: None,
                 availability: None,
@@ -286,6 +369,28 @@ impl MqttClient {
             .await;
         }
 
+        // VRAM used/total (MiB)
+        if config.features.vram_sensor {
+            self.register_sensor(
+                device,
+                "vram_used_mb",
+                "VRAM Used",
+                "mdi:memory",
+                Some("data_size"),
+                Some("MiB"),
+            )
+            .await;
+            self.register_sensor(
+                device,
+                "vram_total_mb",
+                "VRAM Total",
+                "mdi:memory",
+                Some("data_size"),
+                Some("MiB"),
+            )
+            .await;
+        }
+
         // Network throughput sensor
         if config.features.network_sensor {
             self.register_sensor_with_attributes(
@@ -299,6 +404,19 @@ impl MqttClient {
             .await;
         }
 
+        // Established TCP connections, listeners as an attribute
+        if config.features.tcp_connections {
+            self.register_sensor_with_attributes(
+                device,
+                "tcp_connections",
+                "TCP Connections",
+                "mdi:lan-connect",
+                None,
+                Some("connections"),
+            )
+            .await;
+        }
+
         // Disk usage sensor
         if config.features.disk_sensor {
             self.register_sensor_with_attributes(
@@ -325,6 +443,136 @@ impl MqttClient {
             .await;
         }
 
+        // Heartbeat counter, for spotting an agent that is connected but stalled
+        if config.features.heartbeat {
+            self.register_sensor(
+                device,
+                "heartbeat",
+                "Heartbeat",
+                "mdi:heart-pulse",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // Executor load: busy command slots, dropped commands as attributes
+        if config.features.command_slots {
+            self.register_sensor_with_attributes(
+                device,
+                "command_slots_used",
+                "Command Slots Used",
+                "mdi:tray-full",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // Process/thread counts, published by the game sensor off its process walk
+        if config.features.process_count {
+            self.register_sensor_with_attributes(
+                device,
+                "process_count",
+                "Process Count",
+                "mdi:format-list-numbered",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // Focus Assist is Windows-only (WNF quiet-hours state); gated like HWiNFO
+        // so a stray flag on Linux doesn't leave a perma-unavailable entity.
+        #[cfg(windows)]
+        if config.features.focus_assist {
+            self.register_sensor(
+                device,
+                "focus_assist",
+                "Focus Assist",
+                "mdi:bell-sleep",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // Reads the Windows CurrentVersion registry key; nothing to report elsewhere.
+        #[cfg(windows)]
+        if config.features.windows_version {
+            self.register_sensor_with_attributes(
+                device,
+                "windows_version",
+                "Windows Version",
+                "mdi:microsoft-windows",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // WinRT connection cost; no Linux producer.
+        #[cfg(windows)]
+        if config.features.metered_connection {
+            self.register_sensor_with_attributes(
+                device,
+                "metered_connection",
+                "Metered Connection",
+                "mdi:cash-clock",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // SM_REMOTESESSION; no Linux producer.
+        #[cfg(windows)]
+        if config.features.remote_session {
+            self.register_sensor_with_attributes(
+                device,
+                "remote_session",
+                "Remote Session",
+                "mdi:remote-desktop",
+                None,
+                None,
+            )
+            .await;
+        }
+
+        // The peak meter is WASAPI-only, gated the same way.
+        #[cfg(windows)]
+        if config.features.audio_peak {
+            self.register_sensor(
+                device,
+                "audio_peak",
+                "Audio Peak",
+                "mdi:waveform",
+                None,
+                Some("%"),
+            )
+            .await;
+        }
+
+        // One sensor per watched process; the producer is Windows-only.
+        #[cfg(windows)]
+        if config.features.window_fullscreen {
+            for process in &config.fullscreen_windows {
+                let Some(id) = crate::config::fullscreen_sensor_id(process) else {
+                    continue;
+                };
+                let display_name = format!("Fullscreen: {}", process.trim());
+                self.register_sensor_with_attributes(
+                    device,
+                    &id,
+                    &display_name,
+                    "mdi:fullscreen",
+                    None,
+                    None,
+                )
+                .await;
+            }
+        }
+
         // HWiNFO sensors are Windows-only - the producer task is
         // `#[cfg(windows)]` and shared-memory is a Win32-only API. We also
         // gate discovery here so a stray `hwinfo_sensor: true` on Linux/macOS
@@ -553,6 +801,23 @@ impl MqttClient {
         )
         .await;
 
+        self.register_button(device, "SelfTest", "mdi:stethoscope")
+            .await;
+        // Report-only update check; it contacts GitHub, so not with updates off.
+        if crate::updater::updates_enabled(&config.update_channel) {
+            self.register_button(device, "CheckUpdate", "mdi:update")
+                .await;
+            self.register_sensor_with_attributes(
+                device,
+                "latest_version",
+                "Latest Version",
+                "mdi:package-up",
+                None,
+                None,
+            )
+            .await;
+        }
+
         // Command buttons - gated by their respective features
         // Game launch button + Steam refresh
         if config.features.launch_game {
@@ -568,12 +833,14 @@ impl MqttClient {
                 .await;
         }
 
-        // Idle tracking buttons (screensaver/wake)
+        // Idle tracking buttons (screensaver/wake/reset idle)
         if config.features.idle_tracking {
             self.register_button(device, "Screensaver", "mdi:monitor")
                 .await;
             self.register_button(device, "Wake", "mdi:monitor-eye")
                 .await;
+            self.register_button(device, "ResetIdle", "mdi:timer-refresh")
+                .await;
         }
 
         // Power control buttons - each gated by its own feature flag.
@@ -601,6 +868,43 @@ impl MqttClient {
                 .await;
             self.register_button(device, "MonitorOn", "mdi:monitor")
                 .await;
+            self.register_button(device, "MonitorStandby", "mdi:monitor-shimmer")
+                .await;
+        }
+        // Takes "<process>:<priority>", so it's a text box rather than a button.
+        if config.features.cmd_priority {
+            self.register_text(device, "SetPriority", "mdi:speedometer")
+                .await;
+        }
+        // One option per allowed service and action ("Spooler:restart"); with
+        // nothing allowed there is nothing to offer.
+        if config.features.cmd_service && !config.controllable_services.is_empty() {
+            let options = crate::commands::service::select_options(&config.controllable_services);
+            self.register_select(device, "ServiceControl", "mdi:cog-sync", &options)
+                .await;
+        }
+        // MoveWindow takes JSON ({"process":..,"x":..,"y":..,"w":..,"h":..}),
+        // FocusWindow a bare process name; the window calls are Windows-only.
+        #[cfg(windows)]
+        if config.features.cmd_window {
+            self.register_text(device, "MoveWindow", "mdi:arrow-expand-all")
+                .await;
+            self.register_text(device, "FocusWindow", "mdi:dock-window")
+                .await;
+        }
+        // MouseMove takes {"x":..,"y":..}; pressing MouseClick left-clicks in
+        // place, and automations can send it a position and button as JSON.
+        #[cfg(windows)]
+        if config.features.cmd_mouse {
+            self.register_text(device, "MouseMove", "mdi:cursor-move")
+                .await;
+            self.register_button(device, "MouseClick", "mdi:cursor-default-click")
+                .await;
+        }
+        #[cfg(windows)]
+        if config.features.cmd_explorer {
+            self.register_button(device, "RestartExplorer", "mdi:restart")
+                .await;
         }
 
         // Discord buttons
@@ -625,6 +929,21 @@ impl MqttClient {
             ] {
                 self.register_button(device, name, icon).await;
             }
+            self.register_switch(device, "Mute", "mdi:volume-off").await;
+        }
+        // Night Light lives in a Windows CloudStore blob (see night_light.rs).
+        #[cfg(windows)]
+        if config.features.night_light {
+            self.register_switch(device, "NightLight", "mdi:weather-night")
+                .await;
+        }
+        if config.features.game_mode {
+            self.register_switch(device, "GameMode", "mdi:controller")
+                .await;
+        }
+        if config.features.keep_awake {
+            self.register_switch(device, "KeepAwake", "mdi:coffee")
+                .await;
         }
         if config.features.volume {
             // Register volume sensor
@@ -639,9 +958,19 @@ impl MqttClient {
             .await;
         }
 
+        // Device triggers for the automation editor ("Device" trigger); the
+        // power listener fires them, so they need sleep_wake as well.
+        if config.features.device_triggers && config.features.sleep_wake {
+            for &(name, kind, subtype) in DEVICE_TRIGGERS {
+                self.register_device_trigger(device, name, kind, subtype)
+                    .await;
+            }
+        }
+
         // Register notify service only if notifications enabled
         if config.features.notifications {
-            self.register_notify_service(device).await;
+            let topics = config.notification_topics();
+            self.register_notify_service(device, &topics[0]).await;
         }
 
         info!("Registered HA discovery");
@@ -723,10 +1052,66 @@ impl MqttClient {
 
     /// Helper to register a button command
     async fn register_button(&self, device: &Arc<HADevice>, name: &str, icon: &str) {
+        self.register_command_entity(device, "button", name, icon, None)
+            .await;
+    }
+
+    /// Helper to register a command that takes free-form input (HA `text`
+    /// entity). It publishes to the same action topic as a button, so the
+    /// executor sees the typed value as the payload.
+    async fn register_text(&self, device: &Arc<HADevice>, name: &str, icon: &str) {
+        self.register_command_entity(device, "text", name, icon, None)
+            .await;
+    }
+
+    /// Helper to register a command with a fixed set of payloads (HA `select`
+    /// entity). Optimistic: there is no state topic, the chosen option is
+    /// just sent to the action topic like a text value.
+    async fn register_select(
+        &self,
+        device: &Arc<HADevice>,
+        name: &str,
+        icon: &str,
+        options: &[String],
+    ) {
+        let payload = serde_json::json!({
+            "name": name,
+            "unique_id": format!("{}_{}", self.device_id, name),
+            "command_topic": self.command_topic(name),
+            "availability_topic": self.availability_topic(),
+            "options": options,
+            "device": &**device,
+            "icon": icon,
+        });
+        let topic = self.config_topic("select", name);
+        let Ok(json) = serde_json::to_string(&payload) else {
+            error!("Failed to serialize HA discovery payload");
+            return;
+        };
+        self.publish_discovery(&topic, json).await;
+    }
+
+    /// Helper to register a switch command (see `commands::switch`): ON/OFF
+    /// on the shared action topic, with the agent publishing the real state.
+    async fn register_switch(&self, device: &Arc<HADevice>, name: &str, icon: &str) {
+        let state_topic = self.switch_state_topic(name);
+        self.register_command_entity(device, "switch", name, icon, Some(state_topic))
+            .await;
+    }
+
+    async fn register_command_entity(
+        &self,
+        device: &Arc<HADevice>,
+        component: &str,
+        name: &str,
+        icon: &str,
+        state_topic: Option<String>,
+    ) {
         let payload = HADiscoveryPayload {
             name: name.to_string(),
             unique_id: format!("{}_{}", self.device_id, name),
-            state_topic: None,
+            state_topic,
+            value_template: None,
             command_topic: Some(self.command_topic(name)),
             availability_topic: Some(self.availability_topic()),
             availability: None,
@@ -739,7 +1124,7 @@ impl MqttClient {
             json_attributes_topic: None,
         };
 
-        let topic = self.config_topic("button", name);
+        let topic = self.config_topic(component, name);
         let Ok(json) = serde_json::to_string(&payload) else {
             error!("Failed to serialize HA discovery payload");
             return;
@@ -793,7 +1178,8 @@ impl MqttClient {
         let payload = HADiscoveryPayload {
             name: display_name.to_string(),
             unique_id: format!("{}_{}", self.device_id, name),
-            state_topic: Some(self.sensor_topic(name)),
+            state_topic: Some(self.sensor_state_topic(name)),
+            value_template: self.sensor_value_template(name),
             command_topic: None,
             availability_topic: None,
             availability: Some(availability_entries),
@@ -829,7 +1215,8 @@ impl MqttClient {
         let payload = HADiscoveryPayload {
             name: display_name.to_string(),
             unique_id: format!("{}_{}", self.device_id, name),
-            state_topic: Some(self.sensor_topic(name)),
+            state_topic: Some(self.sensor_state_topic(name)),
+            value_template: self.sensor_value_template(name),
             command_topic: None,
             availability_topic: Some(self.availability_topic()),
             availability: None,
@@ -854,10 +1241,36 @@ impl MqttClient {
         self.publish_discovery(&topic, json).await;
     }
 
+    /// Register a device trigger (`device_automation`). HA has no entity for
+    /// it: the trigger shows up under the device in the automation editor,
+    /// and fires on each publish to its topic.
+    async fn register_device_trigger(
+        &self,
+        device: &Arc<HADevice>,
+        name: &str,
+        kind: &str,
+        subtype: &str,
+    ) {
+        let payload = serde_json::json!({
+            "automation_type": "trigger",
+            "topic": self.trigger_topic(name),
+            "type": kind,
+            "subtype": subtype,
+            "payload": name,
+            "device": &**device,
+        });
+        let topic = self.config_topic("device_automation", name);
+        let Ok(json) = serde_json::to_string(&payload) else {
+            error!("Failed to serialize HA discovery payload");
+            return;
+        };
+        self.publish_discovery(&topic, json).await;
+    }
+
     /// Register notify service for MQTT discovery
-    async fn register_notify_service(&self, device: &Arc<HADevice>) {
-        // The notify platform expects command_topic to receive messages
-        let notify_topic = format!("pc-bridge/notifications/{}", self.device_name);
+    async fn register_notify_service(&self, device: &Arc<HADevice>, notify_topic: &str) {
+        // The notify platform expects command_topic to receive messages; the
+        // first of `notification_topics`, which validation keeps wildcard-free.
 
         let payload = serde_json::json!({
             "name": "Notification",
@@ -900,7 +1313,8 @@ impl MqttClient {
             let payload = HADiscoveryPayload {
                 name: display_name,
                 unique_id: format!("{}_{}", self.device_id, topic_name),
-                state_topic: Some(self.sensor_topic(&topic_name)),
+                state_topic: Some(self.sensor_state_topic(&topic_name)),
+                value_template: self.sensor_value_template(&topic_name),
                 command_topic: None,
                 availability_topic: Some(self.availability_topic()),
                 availability: None,
@@ -931,7 +1345,9 @@ impl MqttClient {
         }
     }
 
-    /// Register custom commands for MQTT discovery and subscribe to their topics
+    /// Register custom commands for MQTT discovery. Their action topics are
+    /// subscribed with the other command topics (`subscribe_commands`, and
+    /// `sync_command_subscriptions` on hot-reload).
     pub async fn register_custom_commands(&self, commands: &[CustomCommand]) {
         for cmd in commands {
             let icon = cmd
@@ -944,6 +1360,7 @@ impl MqttClient {
                 name: display_name,
                 unique_id: format!("{}_custom_{}", self.device_id, cmd.name),
                 state_topic: None,
+                value_template: None,
                 command_topic: Some(self.command_topic(&cmd.name)),
                 availability_topic: Some(self.availability_topic()),
                 availability: None,
@@ -963,15 +1380,6 @@ impl MqttClient {
             };
             self.publish_discovery(&topic, json).await;
 
-            // Subscribe to command topic
-            let cmd_topic = self.command_topic(&cmd.name);
-            if let Err(e) = self.client.subscribe(&cmd_topic, QoS::AtLeastOnce).await {
-                error!(
-                    "Failed to subscribe to custom command {}: {:?}",
-                    cmd.name, e
-                );
-            }
-
             debug!("Registered custom command: {}", cmd.name);
         }
 
@@ -1034,6 +1442,18 @@ impl MqttClient {
     }
 }
 
+/// Device triggers: object id (also the event payload), HA `type`, HA
+/// `subtype`. Lid events come from GUID_LIDSWITCH_STATE_CHANGE, so Windows
+/// only.
+const DEVICE_TRIGGERS: &[(&str, &str, &str)] = &[
+    ("woke", "power", "woke_up"),
+    ("went_to_sleep", "power", "going_to_sleep"),
+    #[cfg(windows)]
+    ("lid_closed", "lid", "closed"),
+    #[cfg(windows)]
+    ("lid_opened", "lid", "opened"),
+];
+
 /// Windows-only HWiNFO sensor object ids (mirrors the `#[cfg(windows)]` HWiNFO
 /// block in `register_discovery`). Listed here so teardown can clear them when
 /// the HWiNFO feature is turned off.
@@ -1062,18 +1482,44 @@ const HWINFO_ENTITY_IDS: &[&str] = &[
     "hwinfo_diagnostic",
 ];
 
+/// Entity id in a `homeassistant/<component>/<device>/<id>/config` topic.
+fn entity_id(topic: &str) -> Option<&str> {
+    topic
+        .strip_suffix("/config")?
+        .rsplit_once('/')
+        .map(|(_, id)| id)
+}
+
+/// Overwrite `icon`/`device_class` in a serialized discovery config. Empty
+/// payloads (teardown) and anything that isn't a JSON object pass through.
+fn apply_override(payload: Vec<u8>, entity: &EntityOverride) -> Vec<u8> {
+    let Ok(serde_json::Value::Object(mut config)) = serde_json::from_slice(&payload) else {
+        return payload;
+    };
+    if let Some(icon) = &entity.icon {
+        config.insert("icon".to_string(), icon.clone().into());
+    }
+    if let Some(device_class) = &entity.device_class {
+        config.insert("device_class".to_string(), device_class.clone().into());
+    }
+    serde_json::to_vec(&config).unwrap_or(payload)
+}
+
 /// Every built-in HA entity the agent can register, paired with whether the
 /// current config enables it. The teardown pass clears the disabled ones.
 ///
 /// Keep in sync with `register_discovery`. A missing entry only means a stale
 /// entity is not auto-removed when its feature is disabled; it never causes a
-/// wrong publish. `bridge_info` is always registered, so it is intentionally
-/// absent (never cleared).
+/// wrong publish. `bridge_info` and `SelfTest` are always registered, so they
+/// are intentionally absent (never cleared). `CheckUpdate` and `latest_version`
+/// follow `update_channel` rather than a feature flag. The per-process
+/// `fullscreen_*` sensors are named by config, so they aren't listed either.
 fn feature_entities(config: &Config) -> Vec<(&'static str, &'static str, bool)> {
     let f = &config.features;
     // CPU, memory, and active-window share the system task that also drives the
     // battery and bridge-health sensors, so those ride along with any of them.
     let system_any = f.cpu_sensor || f.memory_sensor || f.active_window;
+    let updates = crate::updater::updates_enabled(&config.update_channel);
     #[allow(unused_mut)]
     let mut entities = vec![
         // Sensors
@@ -1085,6 +1531,7 @@ fn feature_entities(config: &Config) -> Vec<(&'static str, &'static str, bool)>
         ("sensor", "sleep_state", f.sleep_wake),
         ("sensor", "display", f.display_state),
         ("sensor", "cpu_usage", f.cpu_sensor),
+        ("sensor", "cpu_mhz", f.cpu_sensor),
         ("sensor", "memory_usage", f.memory_sensor),
         ("sensor", "active_window", f.active_window),
         ("sensor", "battery_level", system_any),
@@ -1092,9 +1539,15 @@ fn feature_entities(config: &Config) -> Vec<(&'static str, &'static str, bool)>
         ("sensor", "bridge_health", system_any),
         ("sensor", "steam_updating", f.steam_updates),
         ("sensor", "gpu_usage", f.gpu_sensor),
+        ("sensor", "vram_used_mb", f.vram_sensor),
+        ("sensor", "vram_total_mb", f.vram_sensor),
         ("sensor", "network_throughput", f.network_sensor),
+        ("sensor", "tcp_connections", f.tcp_connections),
         ("sensor", "disk_usage", f.disk_sensor),
         ("sensor", "system_uptime", f.uptime_sensor),
+        ("sensor", "heartbeat", f.heartbeat),
+        ("sensor", "command_slots_used", f.command_slots),
+        ("sensor", "process_count", f.process_count),
         ("sensor", "volume_level", f.volume),
         // Cross-platform sensors with per-OS producers.
         ("sensor", "session", f.session_state),
@@ -1102,12 +1555,15 @@ fn feature_entities(config: &Config) -> Vec<(&'static str, &'static str, bool)>
         ("sensor", "mic", f.mic),
         ("sensor", "webcam", f.webcam),
         ("sensor", "now_playing", f.now_playing),
+        ("sensor", "latest_version", updates),
         // Buttons
+        ("button", "CheckUpdate", updates),
         ("button", "Launch", f.launch_game),
         ("button", "CloseGame", f.close_game),
         ("button", "RefreshSteamGames", f.steam_library),
         ("button", "Screensaver", f.idle_tracking),
         ("button", "Wake", f.idle_tracking),
+        ("button", "ResetIdle", f.idle_tracking),
         ("button", "Shutdown", f.cmd_shutdown),
         ("button", "Restart", f.cmd_restart),
         ("button", "Sleep", f.cmd_sleep),
@@ -1116,6 +1572,14 @@ fn feature_entities(config: &Config) -> Vec<(&'static str, &'static str, bool)>
         ("button", "Logoff", f.cmd_logoff),
         ("button", "MonitorOff", f.cmd_monitor),
         ("button", "MonitorOn", f.cmd_monitor),
+        ("button", "MonitorStandby", f.cmd_monitor),
+        ("text", "SetPriority", f.cmd_priority),
+        // Only registered with something to control; an emptied list clears it.
+        (
+            "select",
+            "ServiceControl",
+            f.cmd_service && !config.controllable_services.is_empty(),
+        ),
         ("button", "DiscordJoin", f.discord),
         ("button", "DiscordLeaveChannel", f.discord),
         ("button", "MediaPlayPause", f.media_controls),
@@ -1123,19 +1587,50 @@ fn feature_entities(config: &Config) -> Vec<(&'static str, &'static str, bool)>
         ("button", "MediaPrevious", f.media_controls),
         ("button", "MediaStop", f.media_controls),
         ("button", "VolumeMute", f.media_controls),
+        ("switch", "Mute", f.media_controls),
+        ("switch", "GameMode", f.game_mode),
+        ("switch", "KeepAwake", f.keep_awake),
     ];
-    // HWiNFO sensors have a Windows-only producer, so they only exist here.
+    // HWiNFO sensors, Focus Assist, the audio peak meter, Night Light and the
+    // window and mouse commands are Windows-only, so they only exist here.
+    #[cfg(windows)]
+    entities.push(("sensor", "focus_assist", f.focus_assist));
+    #[cfg(windows)]
+    entities.push(("sensor", "audio_peak", f.audio_peak));
+    #[cfg(windows)]
+    entities.push(("sensor", "windows_version", f.windows_version));
+    #[cfg(windows)]
+    entities.push(("sensor", "metered_connection", f.metered_connection));
+    #[cfg(windows)]
+    entities.push(("sensor", "remote_session", f.remote_session));
+    #[cfg(windows)]
+    entities.push(("sensor", "away_mode", f.sleep_wake));
+    #[cfg(windows)]
+    entities.push(("switch", "NightLight", f.night_light));
+    #[cfg(windows)]
+    entities.push(("text", "MoveWindow", f.cmd_window));
+    #[cfg(windows)]
+    entities.push(("text", "FocusWindow", f.cmd_window));
+    #[cfg(windows)]
+    entities.push(("text", "MouseMove", f.cmd_mouse));
+    #[cfg(windows)]
+    entities.push(("button", "MouseClick", f.cmd_mouse));
+    #[cfg(windows)]
+    entities.push(("button", "RestartExplorer", f.cmd_explorer));
     #[cfg(windows)]
     for oid in HWINFO_ENTITY_IDS {
         entities.push(("sensor", oid, f.hwinfo_sensor));
     }
+    for &(name, _, _) in DEVICE_TRIGGERS {
+        entities.push(("device_automation", name, f.device_triggers && f.sleep_wake));
+    }
     entities
 }
 
 #[cfg(test)]
 mod tests {
-    use super::feature_entities;
-    use crate::config::Config;
+    use super::{apply_override, entity_id, feature_entities};
+    use crate::config::{Config, EntityOverride};
 
     fn enabled_of(config: &Config, component: &str, oid: &str) -> Option<bool> {
         feature_entities(config)
@@ -1204,11 +1699,12 @@ mod tests {
     }
 
     #[test]
-    fn cmd_monitor_gates_both_monitor_buttons() {
+    fn cmd_monitor_gates_all_monitor_buttons() {
         let mut config = Config::default();
         config.features.cmd_monitor = false;
         assert_eq!(enabled_of(&config, "button", "MonitorOff"), Some(false));
         assert_eq!(enabled_of(&config, "button", "MonitorOn"), Some(false));
+        assert_eq!(enabled_of(&config, "button", "MonitorStandby"), Some(false));
     }
 
     #[test]
@@ -1218,4 +1714,26 @@ mod tests {
         assert_eq!(enabled_of(&config, "sensor", "battery_level"), Some(true));
         assert_eq!(enabled_of(&config, "sensor", "bridge_health"), Some(true));
     }
+
+    #[test]
+    fn entity_override_replaces_icon_only_where_set() {
+        assert_eq!(
+            entity_id("homeassistant/sensor/pc/runninggames/config"),
+            Some("runninggames")
+        );
+        assert_eq!(entity_id("homeassistant/sensor/pc/state"), None);
+
+        let entity = EntityOverride {
+            icon: Some("mdi:controller".to_string()),
+            device_class: None,
+        };
+        let payload =
+            br#"{"name":"Running Game","icon":"mdi:gamepad-variant","device_class":"enum"}"#;
+        let merged: serde_json::Value =
+            serde_json::from_slice(&apply_override(payload.to_vec(), &entity)).unwrap();
+        assert_eq!(merged["icon"], "mdi:controller");
+        assert_eq!(merged["device_class"], "enum");
+        // Teardown (empty payload) is left alone.
+        assert!(apply_override(Vec::new(), &entity).is_empty());
+    }
 }
@@ -0,0 +1,184 @@
+//! Host details for the `bridge_info` attributes: hostname, IP addresses,
+//! boot time and (Windows) OS release, so the HA device page says which
+//! machine this is, and whether the agent runs in session 0 as a service.
+//! Gathered again on every connect, so DHCP and network changes show up.
+
+use std::net::{IpAddr, Ipv4Addr, Ipv6Addr};
+use time::OffsetDateTime;
+use time::format_description::well_known::Rfc3339;
+
+/// `hostname`, `ip_addresses`, `boot_time` and, on Windows,
+/// `windows_version` and `session_0`. A field that can't be read is left out.
+pub(super) fn collect() -> serde_json::Map<String, serde_json::Value> {
+    let mut info = serde_json::Map::new();
+    if let Some(hostname) = hostname() {
+        info.insert("hostname".to_string(), hostname.into());
+    }
+    let ips: Vec<String> = interface_addresses()
+        .into_iter()
+        .filter(is_reachable)
+        .map(|ip| ip.to_string())
+        .collect();
+    info.insert("ip_addresses".to_string(), ips.into());
+    if let Some(boot) = crate::sensors::get_system_uptime()
+        .and_then(|secs| i64::try_from(secs).ok())
+        .map(|secs| OffsetDateTime::now_utc() - time::Duration::seconds(secs))
+        .and_then(|boot| boot.format(&Rfc3339).ok())
+    {
+        info.insert("boot_time".to_string(), boot.into());
+    }
+    #[cfg(windows)]
+    if let Some(version) = crate::sensors::windows_version_label() {
+        info.insert("windows_version".to_string(), version.into());
+    }
+    #[cfg(windows)]
+    info.insert(
+        "session_0".to_string(),
+        crate::proclist::in_session_0().into(),
+    );
+    info
+}
+
+/// Addresses another machine could reach us on: no loopback, and no
+/// link-local (`169.254.x.x` without DHCP, `fe80::` on every IPv6 NIC).
+fn is_reachable(ip: &IpAddr) -> bool {
+    match ip {
+        IpAddr::V4(v4) => !v4.is_loopback() && !v4.is_link_local() && !v4.is_unspecified(),
+        IpAddr::V6(v6) => {
+            !v6.is_loopback() && !v6.is_unspecified() && (v6.segments()[0] & 0xffc0) != 0xfe80
+        }
+    }
+}
+
+#[cfg(windows)]
+fn hostname() -> Option<String> {
+    std::env::var("COMPUTERNAME").ok().filter(|h| !h.is_empty())
+}
+
+#[cfg(unix)]
+fn hostname() -> Option<String> {
+    std::fs::read_to_string("/proc/sys/kernel/hostname")
+        .ok()
+        .map(|h| h.trim().to_string())
+        .or_else(|| std::env::var("HOSTNAME").ok())
+        .filter(|h| !h.is_empty())
+}
+
+/// Unicast addresses of every adapter that is up.
+#[cfg(windows)]
+fn interface_addresses() -> Vec<IpAddr> {
+    use windows::Win32::Foundation::ERROR_BUFFER_OVERFLOW;
+    use windows::Win32::NetworkManagement::IpHelper::{
+        GAA_FLAG_SKIP_ANYCAST, GAA_FLAG_SKIP_DNS_SERVER, GAA_FLAG_SKIP_MULTICAST,
+        GetAdaptersAddresses, IP_ADAPTER_ADDRESSES_LH,
+    };
+    use windows::Win32::NetworkManagement::Ndis::IfOperStatusUp;
+    use windows::Win32::Networking::WinSock::{
+        AF_INET, AF_INET6, AF_UNSPEC, SOCKADDR_IN, SOCKADDR_IN6,
+    };
+
+    let flags = GAA_FLAG_SKIP_ANYCAST | GAA_FLAG_SKIP_MULTICAST | GAA_FLAG_SKIP_DNS_SERVER;
+    let mut size: u32 = 16 * 1024;
+    // u64 elements keep the buffer aligned for IP_ADAPTER_ADDRESSES_LH.
+    let mut buf: Vec<u64>;
+    // SAFETY: the buffer is `size` bytes; the adapter list and every pointer
+    // in it live inside that buffer, which outlives the walk below.
+    unsafe {
+        loop {
+            buf = vec![0; (size as usize).div_ceil(8)];
+            let ret = GetAdaptersAddresses(
+                u32::from(AF_UNSPEC.0),
+                flags,
+                None,
+                Some(buf.as_mut_ptr().cast::<IP_ADAPTER_ADDRESSES_LH>()),
+                &raw mut size,
+            );
+            match ret {
+                0 => break,
+                r if r == ERROR_BUFFER_OVERFLOW.0 => {}
+                _ => return Vec::new(),
+            }
+        }
+
+        let mut ips = Vec::new();
+        let mut adapter = buf.as_ptr().cast::<IP_ADAPTER_ADDRESSES_LH>();
+        while let Some(a) = adapter.as_ref() {
+            adapter = a.Next;
+            if a.OperStatus != IfOperStatusUp {
+                continue;
+            }
+            let mut unicast = a.FirstUnicastAddress;
+            while let Some(u) = unicast.as_ref() {
+                unicast = u.Next;
+                let Some(sa) = u.Address.lpSockaddr.as_ref() else {
+                    continue;
+                };
+                if sa.sa_family == AF_INET {
+                    let sin = &*u.Address.lpSockaddr.cast::<SOCKADDR_IN>();
+                    // S_addr is in network byte order in memory.
+                    ips.push(IpAddr::V4(Ipv4Addr::from(
+                        sin.sin_addr.S_un.S_addr.to_ne_bytes(),
+                    )));
+                } else if sa.sa_family == AF_INET6 {
+                    let sin6 = &*u.Address.lpSockaddr.cast::<SOCKADDR_IN6>();
+                    ips.push(IpAddr::V6(Ipv6Addr::from(sin6.sin6_addr.u.Byte)));
+                }
+            }
+        }
+        ips
+    }
+}
+
+/// Addresses of every interface that is up.
+#[cfg(unix)]
+fn interface_addresses() -> Vec<IpAddr> {
+    let mut ips = Vec::new();
+    let mut ifap: *mut libc::ifaddrs = std::ptr::null_mut();
+    // SAFETY: getifaddrs hands back a list we walk read-only and free once.
+    unsafe {
+        if libc::getifaddrs(&raw mut ifap) != 0 {
+            return ips;
+        }
+        let mut cur = ifap;
+        while let Some(ifa) = cur.as_ref() {
+            cur = ifa.ifa_next;
+            if ifa.ifa_flags & libc::IFF_UP as u32 == 0 {
+                continue;
+            }
+            let Some(sa) = ifa.ifa_addr.as_ref() else {
+                continue;
+            };
+            match i32::from(sa.sa_family) {
+                libc::AF_INET => {
+                    let sin = &*ifa.ifa_addr.cast::<libc::sockaddr_in>();
+                    ips.push(IpAddr::V4(Ipv4Addr::from(u32::from_be(
+                        sin.sin_addr.s_addr,
+                    ))));
+                }
+                libc::AF_INET6 => {
+                    let sin6 = &*ifa.ifa_addr.cast::<libc::sockaddr_in6>();
+                    ips.push(IpAddr::V6(Ipv6Addr::from(sin6.sin6_addr.s6_addr)));
+                }
+                _ => {}
+            }
+        }
+        libc::freeifaddrs(ifap);
+    }
+    ips
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_is_reachable() {
+        let ip = |s: &str| s.parse::<IpAddr>().unwrap();
+        assert!(is_reachable(&ip("192.168.1.20")));
+        assert!(is_reachable(&ip("2001:db8::20")));
+        assert!(!is_reachable(&ip("127.0.0.1")));
+        assert!(!is_reachable(&ip("169.254.10.4")));
+        assert!(!is_reachable(&ip("::1")));
+        assert!(!is_reachable(&ip("fe80::1c2a:3bff:fe4d:5e6f")));
+    }
+}
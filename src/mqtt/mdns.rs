@@ -0,0 +1,315 @@
+//! Broker auto-discovery over mDNS / DNS-SD.
+//!
+//! When `mqtt.broker` is left blank we browse for `_mqtt._tcp.local` and use
+//! the first broker that answers, falling back to
+//! `tcp://homeassistant.local:1883` (the HA Mosquitto add-on on a stock
+//! install). A found broker is cached until a connect to it fails; the
+//! fallback never is, so the next lookup browses again. Queries go out from
+//! an ephemeral port, which makes them "legacy unicast" queries (RFC 6762
+//! §6.7): responders answer straight back to us, so there is no need to bind
+//! 5353 or join the multicast group.
+
+use log::{debug, info};
+use std::net::{Ipv4Addr, SocketAddr, UdpSocket};
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+/// Used when nothing answers the browse.
+pub(crate) const DEFAULT_BROKER: &str = "tcp://homeassistant.local:1883";
+
+const SERVICE: &str = "_mqtt._tcp.local";
+const MDNS_ADDR: SocketAddr =
+    SocketAddr::new(std::net::IpAddr::V4(Ipv4Addr::new(224, 0, 0, 251)), 5353);
+const DISCOVERY_TIMEOUT: Duration = Duration::from_millis(1500);
+
+const TYPE_A: u16 = 1;
+const TYPE_PTR: u16 = 12;
+const TYPE_SRV: u16 = 33;
+
+/// The last broker found by a browse, until [`forget_discovered_broker`].
+static DISCOVERED: Mutex<Option<String>> = Mutex::new(None);
+
+/// Broker URL for a blank `mqtt.broker`. Browses (blocking for up to 1.5s)
+/// unless an earlier browse found one, so reconnects and the sleep-time sync
+/// publish reuse a found broker without touching the network. Concurrent
+/// callers wait for one browse rather than starting their own.
+pub(crate) fn discovered_broker() -> String {
+    let mut cached = DISCOVERED.lock().unwrap_or_else(|e| e.into_inner());
+    if let Some(broker) = cached.as_ref() {
+        return broker.clone();
+    }
+    match discover(DISCOVERY_TIMEOUT) {
+        Some((host, port)) => {
+            info!("Discovered MQTT broker via mDNS: {}:{}", host, port);
+            let broker = format_broker(&host, port);
+            *cached = Some(broker.clone());
+            broker
+        }
+        None => {
+            info!(
+                "No MQTT broker answered on {}, using {}",
+                SERVICE, DEFAULT_BROKER
+            );
+            DEFAULT_BROKER.to_string()
+        }
+    }
+}
+
+/// Drop the cached broker after a failed connect, so the next lookup browses
+/// again (the broker may have moved to a new address or port).
+pub(crate) fn forget_discovered_broker() {
+    *DISCOVERED.lock().unwrap_or_else(|e| e.into_inner()) = None;
+}
+
+fn format_broker(host: &str, port: u16) -> String {
+    if host.contains(':') {
+        format!("tcp://[{host}]:{port}")
+    } else {
+        format!("tcp://{host}:{port}")
+    }
+}
+
+fn discover(timeout: Duration) -> Option<(String, u16)> {
+    let socket = UdpSocket::bind((Ipv4Addr::UNSPECIFIED, 0)).ok()?;
+    let deadline = Instant::now() + timeout;
+    let mut records = Records::default();
+
+    exchange(
+        &socket,
+        &build_query(SERVICE, TYPE_PTR),
+        &mut records,
+        deadline,
+    );
+    // Most responders put the SRV/A records in the additional section; ask for
+    // the instance's SRV explicitly if this one didn't.
+    if records.srv.is_empty()
+        && let Some(instance) = records.ptr.first().cloned()
+    {
+        exchange(
+            &socket,
+            &build_query(&instance, TYPE_SRV),
+            &mut records,
+            deadline,
+        );
+    }
+    records.broker()
+}
+
+/// Send `query` and fold every response received until an SRV record shows up
+/// or `deadline` passes.
+fn exchange(socket: &UdpSocket, query: &[u8], records: &mut Records, deadline: Instant) {
+    if let Err(e) = socket.send_to(query, MDNS_ADDR) {
+        debug!("mDNS query failed: {}", e);
+        return;
+    }
+    let mut buf = [0u8; 9000];
+    while records.srv.is_empty() {
+        let Some(left) = deadline
+            .checked_duration_since(Instant::now())
+            .filter(|d| !d.is_zero())
+        else {
+            return;
+        };
+        if socket.set_read_timeout(Some(left)).is_err() {
+            return;
+        }
+        match socket.recv_from(&mut buf) {
+            Ok((n, _)) => records.absorb(&buf[..n]),
+            Err(_) => return,
+        }
+    }
+}
+
+/// A one-question DNS query with the QU (unicast response) bit set.
+fn build_query(name: &str, qtype: u16) -> Vec<u8> {
+    // id 0, flags 0, one question, no records
+    let mut msg = vec![0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0];
+    for label in name.split('.').filter(|l| !l.is_empty()) {
+        let label = &label.as_bytes()[..label.len().min(63)];
+        msg.push(label.len() as u8);
+        msg.extend_from_slice(label);
+    }
+    msg.push(0);
+    msg.extend_from_slice(&qtype.to_be_bytes());
+    msg.extend_from_slice(&0x8001u16.to_be_bytes()); // QU | IN
+    msg
+}
+
+/// Records collected from one or more responses.
+#[derive(Default, Debug)]
+struct Records {
+    /// Service instance names from PTR answers
+    ptr: Vec<String>,
+    /// (target host, port) from SRV records
+    srv: Vec<(String, u16)>,
+    /// Host name -> IPv4 address from A records
+    a: Vec<(String, Ipv4Addr)>,
+}
+
+impl Records {
+    /// Parse a DNS message and keep its PTR/SRV/A records. Malformed messages
+    /// are ignored from the first bad record on.
+    fn absorb(&mut self, msg: &[u8]) {
+        let Some(header) = msg.get(..12) else {
+            return;
+        };
+        let count = |i: usize| usize::from(u16::from_be_bytes([header[i], header[i + 1]]));
+        let (questions, records) = (count(4), count(6) + count(8) + count(10));
+
+        let mut pos = 12;
+        for _ in 0..questions {
+            let Some((_, next)) = read_name(msg, pos) else {
+                return;
+            };
+            pos = next + 4; // qtype + qclass
+        }
+        for _ in 0..records {
+            let Some((name, next)) = read_name(msg, pos) else {
+                return;
+            };
+            let Some(fixed) = msg.get(next..next + 10) else {
+                return;
+            };
+            let rtype = u16::from_be_bytes([fixed[0], fixed[1]]);
+            let rdlen = usize::from(u16::from_be_bytes([fixed[8], fixed[9]]));
+            let rdata = next + 10;
+            let Some(data) = msg.get(rdata..rdata + rdlen) else {
+                return;
+            };
+            match rtype {
+                TYPE_PTR if name.eq_ignore_ascii_case(SERVICE) => {
+                    if let Some((instance, _)) = read_name(msg, rdata) {
+                        self.ptr.push(instance);
+                    }
+                }
+                TYPE_SRV if data.len() > 6 => {
+                    let port = u16::from_be_bytes([data[4], data[5]]);
+                    if let Some((target, _)) = read_name(msg, rdata + 6) {
+                        self.srv.push((target, port));
+                    }
+                }
+                TYPE_A if data.len() == 4 => {
+                    self.a
+                        .push((name, Ipv4Addr::new(data[0], data[1], data[2], data[3])));
+                }
+                _ => {}
+            }
+            pos = rdata + rdlen;
+        }
+    }
+
+    /// The first SRV target, as an address when an A record for it came along
+    /// (so we don't depend on the OS resolving `.local` names).
+    fn broker(&self) -> Option<(String, u16)> {
+        let (target, port) = self.srv.first()?;
+        let host = self
+            .a
+            .iter()
+            .find(|(name, _)| name.eq_ignore_ascii_case(target))
+            .map_or_else(|| target.clone(), |(_, ip)| ip.to_string());
+        Some((host, *port))
+    }
+}
+
+/// Read a (possibly compressed) domain name at `pos`. Returns the dotted name
+/// and the position just past it in the original message.
+fn read_name(msg: &[u8], mut pos: usize) -> Option<(String, usize)> {
+    let mut labels: Vec<String> = Vec::new();
+    let mut end = None;
+    // Bounds pointer loops in a crafted packet.
+    for _ in 0..128 {
+        let len = *msg.get(pos)?;
+        match len {
+            0 => {
+                return Some((labels.join("."), end.unwrap_or(pos + 1)));
+            }
+            l if l & 0xC0 == 0xC0 => {
+                let ptr = usize::from(u16::from_be_bytes([l & 0x3F, *msg.get(pos + 1)?]));
+                end.get_or_insert(pos + 2);
+                pos = ptr;
+            }
+            l => {
+                let label = msg.get(pos + 1..pos + 1 + usize::from(l))?;
+                labels.push(String::from_utf8_lossy(label).into_owned());
+                pos += 1 + usize::from(l);
+            }
+        }
+    }
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A typical Avahi answer: PTR in the answers, SRV + A as additionals,
+    /// using compression pointers back into the question.
+    fn avahi_response() -> Vec<u8> {
+        let mut msg = vec![0, 0, 0x84, 0, 0, 1, 0, 1, 0, 0, 0, 2];
+        // question: _mqtt._tcp.local PTR (offset 12)
+        msg.extend_from_slice(b"\x05_mqtt\x04_tcp\x05local\x00");
+        msg.extend_from_slice(&[0, 12, 0, 1]);
+        // answer: ptr -> "Mosquitto._mqtt._tcp.local" (instance at rdata)
+        msg.extend_from_slice(&[0xC0, 12, 0, 12, 0, 1, 0, 0, 0x11, 0x94, 0, 12]);
+        let instance = msg.len();
+        msg.extend_from_slice(b"\x09Mosquitto\xC0\x0C");
+        // additional: SRV for the instance -> ha.local:1883
+        msg.extend_from_slice(&[0xC0, instance as u8, 0, 33, 0x80, 1, 0, 0, 0, 120, 0, 11]);
+        msg.extend_from_slice(&[0, 0, 0, 0, 0x07, 0x5B]);
+        let target = msg.len();
+        msg.extend_from_slice(b"\x02ha\xC0\x17");
+        // additional: A ha.local -> 192.168.1.20
+        msg.extend_from_slice(&[0xC0, target as u8, 0, 1, 0x80, 1, 0, 0, 0, 120, 0, 4]);
+        msg.extend_from_slice(&[192, 168, 1, 20]);
+        msg
+    }
+
+    #[test]
+    fn test_build_query() {
+        let q = build_query(SERVICE, TYPE_PTR);
+        assert_eq!(&q[4..6], &[0, 1]);
+        assert_eq!(&q[12..30], b"\x05_mqtt\x04_tcp\x05local\x00");
+        assert_eq!(&q[30..], &[0, 12, 0x80, 1]);
+    }
+
+    #[test]
+    fn test_parse_avahi_response() {
+        let mut records = Records::default();
+        records.absorb(&avahi_response());
+        assert_eq!(records.ptr, ["Mosquitto._mqtt._tcp.local"]);
+        assert_eq!(records.srv, [("ha.local".to_string(), 1883)]);
+        assert_eq!(records.broker(), Some(("192.168.1.20".to_string(), 1883)));
+    }
+
+    #[test]
+    fn test_srv_without_address_uses_hostname() {
+        let mut records = Records::default();
+        records.srv.push(("ha.local".to_string(), 8883));
+        assert_eq!(records.broker(), Some(("ha.local".to_string(), 8883)));
+    }
+
+    #[test]
+    fn test_truncated_response_is_ignored() {
+        let msg = avahi_response();
+        for cut in [0, 11, 20, 40, 50] {
+            let mut records = Records::default();
+            records.absorb(&msg[..cut]);
+            assert!(records.broker().is_none(), "cut at {cut}");
+        }
+    }
+
+    #[test]
+    fn test_pointer_loop_rejected() {
+        // A name that points at itself.
+        assert!(read_name(&[0xC0, 0], 0).is_none());
+    }
+
+    #[test]
+    fn test_format_broker() {
+        assert_eq!(
+            format_broker("192.168.1.20", 1883),
+            "tcp://192.168.1.20:1883"
+        );
+        assert_eq!(format_broker("fe80::1", 1883), "tcp://[fe80::1]:1883");
+    }
+}
@@ -0,0 +1,123 @@
+//! Optional second broker (`mirror` config) that gets a copy of every sensor
+//! state and attribute publish, on the same topics, for feeding a logging or
+//! analytics broker alongside HA. Publish-only: nothing is subscribed there,
+//! so commands still come from the primary broker alone, and no discovery
+//! configs are sent.
+//!
+//! Copies are queued with `try_publish`: a mirror that is down or slow drops
+//! them instead of holding up the primary publish path.
+
+use log::{debug, info, warn};
+use rumqttc::{AsyncClient, Event, EventLoop, MqttOptions, Packet, QoS};
+use std::time::Duration;
+use tokio::sync::broadcast;
+
+use super::MqttClient;
+use crate::config::{Config, MqttConfig};
+
+/// Publishes queued for the mirror before further copies are dropped.
+const MIRROR_QUEUE: usize = 256;
+
+pub(super) struct Mirror {
+    client: AsyncClient,
+}
+
+impl Mirror {
+    /// Connect to the `mirror` broker in the background. Fails only on a bad
+    /// config (TLS setup); connection errors are retried.
+    pub(super) fn start(
+        config: &Config,
+        mirror: &MqttConfig,
+        shutdown_rx: broadcast::Receiver<()>,
+    ) -> anyhow::Result<Self> {
+        let (host, port, use_tls) = MqttClient::parse_broker_url(&mirror.broker)?;
+        let client_id = mirror
+            .client_id
+            .clone()
+            .unwrap_or_else(|| format!("{}-mirror", config.client_id()));
+        let mut opts = MqttOptions::new(client_id, host.clone(), port);
+        if !mirror.user.is_empty() {
+            opts.set_credentials(&mirror.user, &mirror.pass);
+        }
+        if use_tls {
+            let tls_config = MqttClient::tls_configuration(mirror)?;
+            opts.set_transport(rumqttc::Transport::tls_with_config(tls_config));
+        }
+        opts.set_keep_alive(Duration::from_secs(30));
+        opts.set_clean_session(true);
+        let availability = MqttClient::availability_topic_static(&config.device_name);
+        opts.set_last_will(rumqttc::LastWill::new(
+            &availability,
+            "offline".as_bytes().to_vec(),
+            QoS::AtLeastOnce,
+            true,
+        ));
+
+        let (client, eventloop) = AsyncClient::new(opts, MIRROR_QUEUE);
+        tokio::spawn(run(eventloop, client.clone(), availability, shutdown_rx));
+        info!("Mirroring sensor publishes to {}:{}", host, port);
+        Ok(Self { client })
+    }
+
+    /// Queue a copy of a sensor publish; dropped if the mirror is backed up.
+    pub(super) fn publish(&self, topic: &str, retained: bool, payload: impl Into<Vec<u8>>) {
+        if let Err(e) = self
+            .client
+            .try_publish(topic, QoS::AtLeastOnce, retained, payload)
+        {
+            debug!("Mirror publish dropped for {}: {:?}", topic, e);
+        }
+    }
+}
+
+async fn run(
+    mut eventloop: EventLoop,
+    client: AsyncClient,
+    availability: String,
+    mut shutdown_rx: broadcast::Receiver<()>,
+) {
+    let mut backoff_secs: u64 = 1;
+    let mut connected = false;
+    loop {
+        tokio::select! {
+            biased;
+            _ = shutdown_rx.recv() => {
+                debug!("Mirror event loop shutting down");
+                if connected {
+                    let _ = client.try_publish(&availability, QoS::AtLeastOnce, true, "offline");
+                    let _ = client.try_disconnect();
+                    // Let the offline publish and Disconnect go out.
+                    let _ = tokio::time::timeout(Duration::from_secs(1), async {
+                        while eventloop.poll().await.is_ok() {}
+                    })
+                    .await;
+                }
+                break;
+            }
+            poll_result = eventloop.poll() => match poll_result {
+                Ok(Event::Incoming(Packet::ConnAck(_))) => {
+                    info!("Mirror broker connected");
+                    connected = true;
+                    backoff_secs = 1;
+                    let _ = client.try_publish(&availability, QoS::AtLeastOnce, true, "online");
+                }
+                Ok(_) => {}
+                Err(e) => {
+                    // Loud once per outage, quiet while it stays down.
+                    if connected || backoff_secs == 1 {
+                        warn!("Mirror broker error (retrying): {:?}", e);
+                    } else {
+                        debug!("Mirror broker still unreachable: {:?}", e);
+                    }
+                    connected = false;
+                    tokio::select! {
+                        biased;
+                        _ = shutdown_rx.recv() => break,
+                        () = tokio::time::sleep(Duration::from_secs(backoff_secs)) => {}
+                    }
+                    backoff_secs = (backoff_secs * 2).min(30);
+                }
+            }
+        }
+    }
+}
@@ -4,12 +4,11 @@ use log::{debug, error, info, warn};
 use rumqttc::{AsyncClient, Event, MqttOptions, Packet, QoS};
 use std::sync::Arc;
 use std::time::Duration;
-use tokio::sync::{broadcast, mpsc};
+use tokio::sync::{Notify, broadcast, mpsc, watch};
 
-use crate::config::Config;
+use crate::config::{Config, CustomSubscription, DeviceConfig, EntityOverride, MqttConfig};
 #[cfg(test)]
 use crate::config::{CustomCommand, CustomSensor};
-#[cfg(test)]
 use std::collections::HashMap;
 
 pub(super) const DISCOVERY_PREFIX: &str = "homeassistant";
@@ -20,6 +19,13 @@ const VERSION: &str = env!("CARGO_PKG_VERSION");
 pub struct Command {
     pub name: String,
     pub payload: String,
+    /// Dispatched by the agent itself (`dispatch_local`) rather than received
+    /// over MQTT; its payload comes from our own config, so `command_auth`
+    /// doesn't apply.
+    pub local: bool,
+    /// Arrived on an HA button's command topic, the only place the default
+    /// press payload (`button_payloads`) is blanked.
+    pub from_button: bool,
 }
 
 /// MQTT client wrapper
@@ -34,9 +40,43 @@ pub struct MqttClient {
     /// Broadcast channel notifying subscribers when MQTT reconnects (ConnAck).
     /// Sensors listen on this to republish retained state after broker/network recovery.
     reconnect_tx: broadcast::Sender<()>,
+    /// Set by the event loop when the broker hands back our retained
+    /// `bridge_info` discovery config; see `verify_discovery`.
+    discovery_echo: Arc<watch::Sender<bool>>,
+    /// Last payload the event loop saw on the `SelfTest` probe topic; see
+    /// `round_trip`.
+    probe_echo: Arc<watch::Sender<String>>,
+    /// Whether the broker connection is currently up: set on ConnAck, cleared
+    /// on a connection error. See `is_connected`.
+    connected: Arc<watch::Sender<bool>>,
+    /// Sender side of the command channel, for commands the agent raises
+    /// itself (game hooks); see `dispatch_local`.
+    local_commands: mpsc::Sender<Command>,
+    /// Collects sensor values for the single JSON state topic when
+    /// `bundle_state` is on; see mqtt/bundle.rs.
+    bundle: Option<Arc<bundle::StateBundle>>,
+    /// Wakes the event loop to drop its connection and dial again at once;
+    /// see `reconnect_now`.
+    force_reconnect: Arc<Notify>,
+    /// The `entities` icon/device_class overrides, refreshed by every
+    /// `register_discovery` so a hot-reload applies them.
+    entity_overrides: std::sync::Mutex<HashMap<String, EntityOverride>>,
+    /// Secondary broker that sensor publishes are copied to (`mirror`
+    /// config); see mqtt/mirror.rs.
+    mirror: Option<mirror::Mirror>,
+    /// Command topics currently subscribed. The ConnAck handler resubscribes
+    /// these, and `sync_command_subscriptions` diffs a reloaded config against
+    /// them.
+    command_topics: Arc<std::sync::Mutex<Vec<String>>>,
 }
 
+mod bundle;
+mod cert_store;
+pub(crate) use cert_store::ClientTlsConfig;
 mod discovery;
+mod host_info;
+pub(crate) mod mdns;
+mod mirror;
 mod payload;
 mod topics;
 
@@ -50,34 +90,175 @@ pub struct CommandReceiver {
     rx: mpsc::Receiver<Command>,
 }
 
-/// Match an inbound MQTT topic against the cached button and notify prefixes
-/// and return the command name (or "notification") if it routes.  Single
-/// source of truth shared by the event loop and unit tests.
+/// The HA device every entity is attached to, with the `device` config's
+/// model/manufacturer/sw_version in place of the defaults where set.
+fn ha_device(device_id: &str, device_name: &str, info: &DeviceConfig) -> HADevice {
+    let pick = |value: &Option<String>, default: String| {
+        value
+            .as_deref()
+            .map(str::trim)
+            .filter(|v| !v.is_empty())
+            .map_or(default, str::to_string)
+    };
+    HADevice {
+        identifiers: vec![device_id.to_string()],
+        name: device_name.to_string(),
+        model: pick(&info.model, format!("PC Bridge v{}", VERSION)),
+        manufacturer: pick(&info.manufacturer, "dank0i".to_string()),
+        sw_version: pick(&info.sw_version, VERSION.to_string()),
+    }
+}
+
+/// Topics in `wanted` but not `current` (to subscribe), and in `current` but
+/// not `wanted` (to unsubscribe).
+fn diff_topics(current: &[String], wanted: &[String]) -> (Vec<String>, Vec<String>) {
+    let added = wanted
+        .iter()
+        .filter(|t| !current.contains(t))
+        .cloned()
+        .collect();
+    let removed = current
+        .iter()
+        .filter(|t| !wanted.contains(t))
+        .cloned()
+        .collect();
+    (added, removed)
+}
+
+/// Whether a message published to `topic` would come back in as a command or
+/// a notification (same routing as the event loop).
+pub(crate) fn is_subscribed_input(topic: &str, config: &Config) -> bool {
+    let button_prefix = format!("{}/button/{}/", DISCOVERY_PREFIX, config.device_name);
+    parse_incoming_topic(
+        topic,
+        &button_prefix,
+        &config.notification_topics(),
+        &config.custom_subscriptions,
+    )
+    .is_some()
+}
+
+/// Match an inbound MQTT topic against the cached button prefix and notify topics,
+/// then the user's `custom_subscriptions` filters (first match wins), and
+/// return the command name (or "notification") if it routes.  Single source of
+/// truth shared by the event loop and unit tests.
 fn parse_incoming_topic<'a>(
     topic: &'a str,
     button_prefix: &str,
-    notify_topic: &str,
+    notify_topics: &[String],
+    custom_subscriptions: &'a [CustomSubscription],
 ) -> Option<&'a str> {
     if let Some(rest) = topic.strip_prefix(button_prefix)
         && let Some(cmd) = rest.strip_suffix("/action")
     {
         return Some(cmd);
     }
-    if topic == notify_topic {
+    if notify_topics
+        .iter()
+        .any(|filter| topics::topic_matches_filter(filter, topic))
+    {
         return Some("notification");
     }
-    None
+    custom_subscriptions
+        .iter()
+        .find(|s| topics::topic_matches_filter(&s.topic, topic))
+        .map(|s| s.command.as_str())
 }
 
 impl MqttClient {
-    pub async fn new(
-        config: &Config,
-        mut shutdown_rx: broadcast::Receiver<()>,
-    ) -> anyhow::Result<(Self, CommandReceiver)> {
-        // Parse broker URL
-        let broker = &config.mqtt.broker;
-        let (host, port, use_tls) = Self::parse_broker_url(broker)?;
+    /// OS trust store for the server; plus a client certificate from the
+    /// Windows store when `mqtt.client_cert` is set.
+    fn tls_configuration(mqtt: &MqttConfig) -> anyhow::Result<rumqttc::TlsConfiguration> {
+        match Self::client_tls(mqtt)? {
+            None => Ok(rumqttc::TlsConfiguration::Native),
+            #[cfg(windows)]
+            Some(config) => {
+                info!("MQTT TLS client certificate loaded from the certificate store");
+                Ok(rumqttc::TlsConfiguration::Rustls(config))
+            }
+            #[cfg(not(windows))]
+            Some(never) => match never {},
+        }
+    }
+
+    /// The TLS config presenting `mqtt.client_cert`, or None when it's unset.
+    /// Shared with connections made outside rumqttc (the sync sleep publish).
+    pub(crate) fn client_tls(mqtt: &MqttConfig) -> anyhow::Result<Option<ClientTlsConfig>> {
+        let Some(selector) = mqtt
+            .client_cert
+            .as_deref()
+            .and_then(cert_store::CertSelector::parse)
+        else {
+            return Ok(None);
+        };
+        #[cfg(windows)]
+        {
+            cert_store::client_tls_config(&selector).map(Some)
+        }
+        #[cfg(not(windows))]
+        {
+            anyhow::bail!("mqtt.client_cert ({selector:?}) requires the Windows certificate store")
+        }
+    }
 
+    /// One-shot connectivity check for `--check`: connect with the configured
+    /// broker, credentials and TLS, publish a test message and wait for the
+    /// broker to acknowledge it. Uses its own client id (and no will), so an
+    /// agent already running with this config isn't kicked off the broker.
+    /// Returns the broker URL that was used.
+    pub async fn check_connection(config: &Config, timeout: Duration) -> anyhow::Result<String> {
+        let mqtt_config = config.mqtt.clone();
+        let broker = tokio::task::spawn_blocking(move || mqtt_config.broker_url()).await?;
+        let (host, port, use_tls) = Self::parse_broker_url(&broker)?;
+
+        let mut opts = MqttOptions::new(format!("{}-check", config.client_id()), host, port);
+        if !config.mqtt.user.is_empty() {
+            opts.set_credentials(&config.mqtt.user, &config.mqtt.pass);
+        }
+        if use_tls {
+            let tls_config = Self::tls_configuration(&config.mqtt)?;
+            opts.set_transport(rumqttc::Transport::tls_with_config(tls_config));
+        }
+        opts.set_clean_session(true);
+        let (client, mut eventloop) = AsyncClient::new(opts, 4);
+
+        // Queued now, sent right after the ConnAck.
+        let topic = format!("pc-bridge/check/{}", config.device_name);
+        client
+            .publish(&topic, QoS::AtLeastOnce, false, "ok".as_bytes().to_vec())
+            .await?;
+
+        let outcome = tokio::time::timeout(timeout, async {
+            loop {
+                match eventloop.poll().await {
+                    Ok(Event::Incoming(Packet::ConnAck(_))) => debug!("Check: connected"),
+                    Ok(Event::Incoming(Packet::PubAck(_))) => return Ok(()),
+                    Ok(_) => {}
+                    // Refused logins, TLS and DNS failures all land here.
+                    Err(e) => return Err(anyhow::anyhow!("{}: {}", broker, e)),
+                }
+            }
+        })
+        .await
+        .unwrap_or_else(|_| {
+            Err(anyhow::anyhow!(
+                "{}: no answer within {}s",
+                broker,
+                timeout.as_secs()
+            ))
+        });
+
+        // Best-effort clean disconnect; the result is already decided.
+        if client.disconnect().await.is_ok() {
+            let _ = tokio::time::timeout(Duration::from_secs(1), eventloop.poll()).await;
+        }
+        outcome.map(|()| broker)
+    }
+
+    /// Options for the main connection to `broker`: credentials, TLS, session
+    /// settings and the availability last will.
+    fn connection_options(config: &Config, broker: &str) -> anyhow::Result<MqttOptions> {
+        let (host, port, use_tls) = Self::parse_broker_url(broker)?;
         let mut opts = MqttOptions::new(config.client_id(), host.clone(), port);
 
         // Authentication
@@ -87,7 +268,7 @@ impl MqttClient {
 
         // TLS transport (ssl:// or wss:// scheme)
         if use_tls {
-            let tls_config = rumqttc::TlsConfiguration::Native;
+            let tls_config = Self::tls_configuration(&config.mqtt)?;
             opts.set_transport(rumqttc::Transport::tls_with_config(tls_config));
             info!("MQTT TLS enabled for {}:{}", host, port);
         }
@@ -108,13 +289,25 @@ impl MqttClient {
         // Reconnection is handled by rumqttc automatically - just keep polling
 
         // Last Will and Testament (LWT)
-        let availability_topic = Self::availability_topic_static(&config.device_name);
         opts.set_last_will(rumqttc::LastWill::new(
-            &availability_topic,
+            Self::availability_topic_static(&config.device_name),
             "offline".as_bytes().to_vec(),
             QoS::AtLeastOnce,
             true,
         ));
+        Ok(opts)
+    }
+
+    pub async fn new(
+        config: &Config,
+        mut shutdown_rx: broadcast::Receiver<()>,
+    ) -> anyhow::Result<(Self, CommandReceiver)> {
+        // A blank broker is browsed for over mDNS (blocking, until one is
+        // found), so resolve it on the blocking pool.
+        let mqtt_config = config.mqtt.clone();
+        let broker = tokio::task::spawn_blocking(move || mqtt_config.broker_url()).await?;
+        let opts = Self::connection_options(config, &broker)?;
+        let availability_topic = Self::availability_topic_static(&config.device_name);
 
         // Buffer must hold ALL messages queued before the event loop starts draining.
         // MQTT spec forbids sending packets before CONNACK, so nothing drains until
@@ -132,13 +325,44 @@ impl MqttClient {
         let device_name = config.device_name.clone();
         let device_id = config.device_id();
         let (command_tx, command_rx) = mpsc::channel(16);
+        let local_commands = command_tx.clone();
+
+        let bundle = config
+            .bundle_state
+            .then(|| Arc::new(bundle::StateBundle::new()));
+        if let Some(bundle) = &bundle {
+            tokio::spawn(bundle::run_flusher(
+                Arc::clone(bundle),
+                client.clone(),
+                bundle::bundle_topic(&device_name),
+                shutdown_rx.resubscribe(),
+            ));
+            info!("Bundled state enabled - sensors publish to one JSON topic");
+        }
 
         // Reconnect notification channel - sensors subscribe to republish state
         let (reconnect_tx, _) = broadcast::channel(4);
         let reconnect_tx_for_eventloop = reconnect_tx.clone();
+        let discovery_echo = Arc::new(watch::Sender::new(false));
+        let discovery_echo_for_eventloop = Arc::clone(&discovery_echo);
+        let probe_echo = Arc::new(watch::Sender::new(String::new()));
+        let probe_echo_for_eventloop = Arc::clone(&probe_echo);
+        let probe_topic = Self::probe_topic(&config.device_name);
+        let connected = Arc::new(watch::Sender::new(false));
+        let connected_for_eventloop = Arc::clone(&connected);
+        let force_reconnect = Arc::new(Notify::new());
+        let force_reconnect_for_eventloop = Arc::clone(&force_reconnect);
+        let discovery_probe_topic = format!(
+            "{}/sensor/{}/bridge_info/config",
+            DISCOVERY_PREFIX, &config.device_name
+        );
 
-        // Build list of topics to subscribe to (for reconnection)
-        let subscribe_topics = Self::build_subscribe_topics(&config.device_name, config);
+        // Topics to subscribe to, kept current by hot-reload (for reconnection)
+        let command_topics = Arc::new(std::sync::Mutex::new(Self::build_subscribe_topics(
+            &config.device_name,
+            config,
+        )));
+        let command_topics_for_eventloop = Arc::clone(&command_topics);
 
         // Clone client for event loop to publish availability on reconnect
         let client_for_eventloop = client.clone();
@@ -146,7 +370,8 @@ impl MqttClient {
 
         // Pre-compute prefixes for hot path (avoid format!() per message)
         let button_prefix = format!("{}/button/{}/", DISCOVERY_PREFIX, &device_name);
-        let notify_topic_match = format!("pc-bridge/notifications/{}", &device_name);
+        let notify_topics = config.notification_topics();
+        let custom_subscriptions = config.custom_subscriptions.clone();
 
         // Pre-compute birth message for ConnAck (Feature H).
         //
@@ -162,7 +387,7 @@ impl MqttClient {
             DISCOVERY_PREFIX, &device_name
         );
         let birth_payload = VERSION.to_string();
-        let birth_attrs_payload = serde_json::json!({
+        let birth_attrs = serde_json::json!({
             "version": VERSION,
             "os": std::env::consts::OS,
             "arch": std::env::consts::ARCH,
@@ -181,6 +406,7 @@ impl MqttClient {
                 "cmd_lock": config.features.cmd_lock,
                 "cmd_logoff": config.features.cmd_logoff,
                 "cmd_monitor": config.features.cmd_monitor,
+                "cmd_priority": config.features.cmd_priority,
                 "notifications": config.features.notifications,
                 "cpu_sensor": config.features.cpu_sensor,
                 "memory_sensor": config.features.memory_sensor,
@@ -199,9 +425,32 @@ impl MqttClient {
                 "disk_sensor": config.features.disk_sensor,
                 "uptime_sensor": config.features.uptime_sensor,
                 "hwinfo_sensor": config.features.hwinfo_sensor,
+                "focus_assist": config.features.focus_assist,
+                "process_count": config.features.process_count,
+                "vram_sensor": config.features.vram_sensor,
+                "cmd_service": config.features.cmd_service,
+                "audio_peak": config.features.audio_peak,
+                "window_fullscreen": config.features.window_fullscreen,
+                "cmd_window": config.features.cmd_window,
+                "windows_version": config.features.windows_version,
+                "cmd_mouse": config.features.cmd_mouse,
+                "metered_connection": config.features.metered_connection,
+                "remote_session": config.features.remote_session,
+                "device_triggers": config.features.device_triggers,
+                "cmd_registry": config.features.cmd_registry,
+                "heartbeat": config.features.heartbeat,
+                "night_light": config.features.night_light,
+                "game_mode": config.features.game_mode,
+                "command_slots": config.features.command_slots,
+                "cmd_explorer": config.features.cmd_explorer,
+                "tcp_connections": config.features.tcp_connections,
+                "keep_awake": config.features.keep_awake,
             }
-        })
-        .to_string();
+        });
+
+        // An mDNS-discovered broker is looked up again after a failed connect.
+        let rediscover = config.mqtt.broker.trim().is_empty().then(|| config.clone());
+        let mut current_broker = broker;
 
         // Spawn event loop handler
         tokio::spawn(async move {
@@ -213,6 +462,15 @@ impl MqttClient {
                         debug!("MQTT event loop shutting down");
                         break;
                     }
+                    () = force_reconnect_for_eventloop.notified() => {
+                        // Drop the socket without waiting for keepalive to notice
+                        // it died; the next poll() dials fresh and in-flight
+                        // publishes are kept and resent.
+                        info!("MQTT forcing reconnect");
+                        connected_for_eventloop.send_replace(false);
+                        eventloop.clean();
+                        backoff_secs = 1;
+                    }
                     poll_result = eventloop.poll() => {
                         match poll_result {
                     Ok(Event::Incoming(Packet::Publish(publish))) => {
@@ -222,12 +480,21 @@ impl MqttClient {
                             String::from_utf8_lossy(&publish.payload)
                         );
 
+                        if publish.topic == discovery_probe_topic {
+                            discovery_echo_for_eventloop.send_replace(!publish.payload.is_empty());
+                        }
+                        if publish.topic == probe_topic {
+                            probe_echo_for_eventloop
+                                .send_replace(String::from_utf8_lossy(&publish.payload).into_owned());
+                        }
+
                         // Extract command name using the shared parser so a
                         // change here can't drift from the test-only path.
                         let cmd_name = parse_incoming_topic(
                             &publish.topic,
                             &button_prefix,
-                            &notify_topic_match,
+                            &notify_topics,
+                            &custom_subscriptions,
                         )
                         .map(str::to_owned);
 
@@ -240,10 +507,13 @@ impl MqttClient {
                             // try_send (not .await): blocking here would stop the
                             // poll loop from sending keepalives and the broker
                             // would drop us. Dropping a button press is safer.
+                            let from_button = publish.topic.starts_with(button_prefix.as_str());
                             if command_tx
                                 .try_send(Command {
                                     name: cmd_name,
                                     payload,
+                                    local: false,
+                                    from_button,
                                 })
                                 .is_err()
                             {
@@ -255,6 +525,7 @@ impl MqttClient {
                         info!("MQTT connected - resubscribing then announcing online");
                         // Reset backoff on successful connection.
                         backoff_secs = 1;
+                        connected_for_eventloop.send_replace(true);
 
                         // Run the resubscribe + birth publishes in a SEPARATE task
                         // so the event loop below keeps calling poll() and draining
@@ -266,12 +537,15 @@ impl MqttClient {
                         // the task stay sequential, so subscribes still hit the wire
                         // before the availability publish (TCP order), which HA needs.
                         let client = client_for_eventloop.clone();
-                        let topics = subscribe_topics.clone();
+                        let topics = command_topics_for_eventloop
+                            .lock()
+                            .unwrap_or_else(|e| e.into_inner())
+                            .clone();
                         let avail = availability_topic_for_eventloop.clone();
                         let state_topic = birth_topic.clone();
                         let state_body = birth_payload.clone();
                         let attr_topic = birth_attrs_topic.clone();
-                        let attr_body = birth_attrs_payload.clone();
+                        let mut attrs = birth_attrs.clone();
                         let rtx = reconnect_tx_for_eventloop.clone();
                         tokio::spawn(async move {
                             // Subscribe BEFORE publishing "online": HA may fire
@@ -304,6 +578,14 @@ impl MqttClient {
                             {
                                 warn!("Failed to publish bridge_info birth message: {:?}", e);
                             }
+                            // Host details are read per connect, so an address
+                            // that came up (or changed) since startup shows.
+                            if let Ok(host) = tokio::task::spawn_blocking(host_info::collect).await
+                                && let Some(attrs) = attrs.as_object_mut()
+                            {
+                                attrs.extend(host);
+                            }
+                            let attr_body = attrs.to_string();
                             if let Err(e) = client
                                 .publish(&attr_topic, QoS::AtLeastOnce, true, attr_body.as_bytes())
                                 .await
@@ -319,7 +601,27 @@ impl MqttClient {
                     }
                     Ok(_) => {}
                     Err(e) => {
+                        connected_for_eventloop.send_replace(false);
                         warn!("MQTT error (retrying in {}s): {:?}", backoff_secs, e);
+                        if let Some(config) = &rediscover {
+                            // The broker may have moved (new address or port):
+                            // browse again and point the next dial at the answer.
+                            mdns::forget_discovered_broker();
+                            let mqtt_config = config.mqtt.clone();
+                            if let Ok(broker) =
+                                tokio::task::spawn_blocking(move || mqtt_config.broker_url()).await
+                                && broker != current_broker
+                            {
+                                match Self::connection_options(config, &broker) {
+                                    Ok(opts) => {
+                                        info!("MQTT broker is now {}", broker);
+                                        eventloop.mqtt_options = opts;
+                                        current_broker = broker;
+                                    }
+                                    Err(e) => warn!("Ignoring re-discovered broker {}: {}", broker, e),
+                                }
+                            }
+                        }
                         // Race the backoff against shutdown so Ctrl+C isn't stuck
                         // for up to 30s waiting on a reconnect delay.
                         tokio::select! {
@@ -338,17 +640,18 @@ impl MqttClient {
             }
         });
 
+        // A broken mirror config mustn't take the primary connection down.
+        let mirror = config.mirror.as_ref().and_then(|m| {
+            mirror::Mirror::start(config, m, shutdown_rx.resubscribe())
+                .inspect_err(|e| warn!("Mirror broker disabled: {}", e))
+                .ok()
+        });
+
         // Fix #3: Pre-cache topic strings
         let cached_topics = CachedTopics::new(&device_name);
 
         // Fix #5: Create shared device info once
-        let device = Arc::new(HADevice {
-            identifiers: vec![device_id.clone()],
-            name: device_name.clone(),
-            model: format!("PC Bridge v{}", VERSION),
-            manufacturer: "dank0i".to_string(),
-            sw_version: VERSION.to_string(),
-        });
+        let device = Arc::new(ha_device(&device_id, &device_name, &config.device));
 
         let mqtt = Self {
             client,
@@ -357,6 +660,15 @@ impl MqttClient {
             cached_topics,
             device,
             reconnect_tx,
+            discovery_echo,
+            probe_echo,
+            connected,
+            local_commands,
+            bundle,
+            force_reconnect,
+            entity_overrides: std::sync::Mutex::new(config.entities.clone()),
+            mirror,
+            command_topics,
         };
 
         let cmd_rx = CommandReceiver { rx: command_rx };
@@ -366,7 +678,7 @@ impl MqttClient {
         // Remove any HA entities whose feature is now disabled (e.g. the user
         // turned a sensor off) so nothing stale lingers on the HA side.
         mqtt.clear_disabled_entities(config).await;
-        mqtt.subscribe_commands(config).await;
+        mqtt.subscribe_commands().await;
 
         Ok((mqtt, cmd_rx))
     }
@@ -383,8 +695,8 @@ impl MqttClient {
     #[cfg(test)]
     fn extract_command_name(topic: &str, device_name: &str) -> Option<String> {
         let button_prefix = format!("{}/button/{}/", DISCOVERY_PREFIX, device_name);
-        let notify_topic = format!("pc-bridge/notifications/{}", device_name);
-        parse_incoming_topic(topic, &button_prefix, &notify_topic).map(|s| s.to_string())
+        let notify_topics = vec![format!("pc-bridge/notifications/{}", device_name)];
+        parse_incoming_topic(topic, &button_prefix, &notify_topics, &[]).map(|s| s.to_string())
     }
 
     // Discovery registration (`register_*` methods) lives in mqtt/discovery.rs
@@ -400,6 +712,7 @@ impl MqttClient {
         "RefreshSteamGames",
         "Screensaver",
         "Wake",
+        "ResetIdle",
         "DiscordJoin",
         "DiscordLeaveChannel",
         "Shutdown",
@@ -410,11 +723,27 @@ impl MqttClient {
         "Logoff",
         "MonitorOff",
         "MonitorOn",
+        "MonitorStandby",
+        "SetPriority",
+        "ServiceControl",
+        "MoveWindow",
+        "FocusWindow",
+        "ReadRegistry",
+        "MouseMove",
+        "MouseClick",
+        "CheckUpdate",
+        "Echo",
+        "SelfTest",
         "MediaPlayPause",
         "MediaNext",
         "MediaPrevious",
         "MediaStop",
         "VolumeMute",
+        "Mute",
+        "NightLight",
+        "KeepAwake",
+        "GameMode",
+        "RestartExplorer",
     ];
 
     fn build_subscribe_topics(device_name: &str, config: &Config) -> Vec<String> {
@@ -429,9 +758,13 @@ impl MqttClient {
             }
         }
 
-        // Notification topic if enabled
+        // Notification topics if enabled
         if config.features.notifications {
-            topics.push(format!("pc-bridge/notifications/{}", device_name));
+            for topic in config.notification_topics() {
+                if !topics.contains(&topic) {
+                    topics.push(topic);
+                }
+            }
         }
 
         // Custom commands
@@ -442,21 +775,66 @@ impl MqttClient {
             ));
         }
 
+        // User-defined topic filters (non-HA dashboards)
+        for subscription in &config.custom_subscriptions {
+            if !topics.contains(&subscription.topic) {
+                topics.push(subscription.topic.clone());
+            }
+        }
+
         topics
     }
 
-    async fn subscribe_commands(&self, config: &Config) {
-        let topics = Self::build_subscribe_topics(&self.device_name, config);
+    async fn subscribe_commands(&self) {
+        let topics = self
+            .command_topics
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .clone();
 
         for topic in &topics {
             if let Err(e) = self.client.subscribe(topic, QoS::AtLeastOnce).await {
-                error!("Failed to subscribe to {}: {:?}", topic, e);
+                error!(topic = topic.as_str(); "Failed to subscribe to {}: {:?}", topic, e);
             }
         }
 
         info!("Subscribed to {} command topics", topics.len());
     }
 
+    /// Bring the command subscriptions in line with a reloaded config:
+    /// unsubscribe topics it no longer has (removed custom commands, disabled
+    /// features), subscribe new ones. No reconnect needed.
+    pub(crate) async fn sync_command_subscriptions(&self, config: &Config) {
+        let wanted = Self::build_subscribe_topics(&self.device_name, config);
+        let (added, removed) = {
+            let mut current = self
+                .command_topics
+                .lock()
+                .unwrap_or_else(|e| e.into_inner());
+            let diff = diff_topics(&current, &wanted);
+            *current = wanted;
+            diff
+        };
+
+        for topic in &removed {
+            if let Err(e) = self.client.unsubscribe(topic).await {
+                warn!("Failed to unsubscribe from {}: {:?}", topic, e);
+            }
+        }
+        for topic in &added {
+            if let Err(e) = self.client.subscribe(topic, QoS::AtLeastOnce).await {
+                error!(topic = topic.as_str(); "Failed to subscribe to {}: {:?}", topic, e);
+            }
+        }
+        if !added.is_empty() || !removed.is_empty() {
+            info!(
+                "Command topics updated: {} subscribed, {} unsubscribed",
+                added.len(),
+                removed.len()
+            );
+        }
+    }
+
     /// Subscribe to MQTT reconnect notifications.
     /// Fires after every ConnAck (initial connect + reconnects).
     /// Sensors use this to republish retained state that may have been lost.
@@ -464,18 +842,70 @@ impl MqttClient {
         self.reconnect_tx.subscribe()
     }
 
-    /// Publish a sensor value (non-retained)
+    /// Whether the broker connection is up right now.
+    pub fn is_connected(&self) -> bool {
+        *self.connected.borrow()
+    }
+
+    /// Drop the broker connection and reconnect immediately, instead of
+    /// waiting for keepalive to find out a socket died (e.g. across sleep).
+    /// Publishes queued meanwhile go out on the new connection.
+    pub fn reconnect_now(&self) {
+        self.force_reconnect.notify_one();
+    }
+
+    /// Hand a command to the executor as though it had arrived over MQTT, so
+    /// the same feature gates and rate limits apply. Like an inbound command,
+    /// it is dropped (with a warning) if the executor is backed up.
+    pub fn dispatch_local(&self, name: &str, payload: &str) {
+        if self
+            .local_commands
+            .try_send(Command {
+                name: name.to_string(),
+                payload: payload.to_string(),
+                local: true,
+                from_button: false,
+            })
+            .is_err()
+        {
+            warn!(
+                "Command channel full or closed - dropping local command {}",
+                name
+            );
+        }
+    }
+
+    /// Publish a sensor value (non-retained). With `bundle_state` on, the
+    /// value goes into the bundled state object instead (which is retained).
     pub async fn publish_sensor(&self, name: &str, value: &str) {
+        self.mirror(name, false, value);
+        if let Some(bundle) = self.bundle_for(name) {
+            bundle.set(name, value);
+            return;
+        }
         self.publish_inner(self.sensor_topic(name), false, value.to_owned())
             .await;
     }
 
-    /// Publish a sensor value (retained)
+    /// Publish a sensor value (retained), or into the bundle like
+    /// `publish_sensor`.
     pub async fn publish_sensor_retained(&self, name: &str, value: &str) {
+        self.mirror(name, true, value);
+        if let Some(bundle) = self.bundle_for(name) {
+            bundle.set(name, value);
+            return;
+        }
         self.publish_inner(self.sensor_topic(name), true, value.to_owned())
             .await;
     }
 
+    /// Publish a switch's state (retained, HA's default ON/OFF payloads).
+    pub async fn publish_switch_state(&self, name: &str, on: bool) {
+        let value = if on { "ON" } else { "OFF" };
+        self.publish_inner(self.switch_state_topic(name), true, value.to_owned())
+            .await;
+    }
+
     /// Publish a dry-run command record to the test topic consumed by the
     /// integration test kit. Not retained. Topic: `pc-bridge/test/executed/<device>`.
     pub async fn publish_test_action(&self, name: &str, payload: &str, action: &str) {
@@ -487,6 +917,70 @@ impl MqttClient {
         self.publish_inner(topic, false, value).await;
     }
 
+    /// Publish an `Echo` payload verbatim, or a `SelfTest` report (not
+    /// retained). Topic: `pc-bridge/command_result/<device>`.
+    pub async fn publish_command_result(&self, payload: &str) {
+        let topic = format!("pc-bridge/command_result/{}", self.device_name);
+        self.publish_inner(topic, false, payload.to_owned()).await;
+    }
+
+    /// `SelfTest`'s probe topic: `pc-bridge/selftest/<device>`.
+    fn probe_topic(device_name: &str) -> String {
+        format!("pc-bridge/selftest/{device_name}")
+    }
+
+    /// Publish a probe and wait for the broker to hand it back on our own
+    /// subscription, proving publishes actually get through (a PUBACK alone
+    /// doesn't: a broker ACL drops the message and still acks). Returns the
+    /// round-trip time, or why it failed.
+    pub(crate) async fn round_trip(&self, timeout: Duration) -> Result<Duration, String> {
+        if !self.is_connected() {
+            return Err("not connected to the broker".to_string());
+        }
+        let topic = Self::probe_topic(&self.device_name);
+        let nonce = std::time::SystemTime::now()
+            .duration_since(std::time::UNIX_EPOCH)
+            .unwrap_or_default()
+            .as_nanos()
+            .to_string();
+        let mut echo = self.probe_echo.subscribe();
+        self.client
+            .subscribe(&topic, QoS::AtLeastOnce)
+            .await
+            .map_err(|e| format!("subscribe failed: {e}"))?;
+        let started = std::time::Instant::now();
+        let published = self
+            .client
+            .publish(&topic, QoS::AtLeastOnce, false, nonce.as_bytes().to_vec())
+            .await;
+        let seen = match published {
+            Ok(()) => tokio::time::timeout(timeout, echo.wait_for(|p| *p == nonce))
+                .await
+                .is_ok_and(|r| r.is_ok()),
+            Err(_) => false,
+        };
+        let _ = self.client.unsubscribe(&topic).await;
+        if let Err(e) = published {
+            return Err(format!("publish failed: {e}"));
+        }
+        if !seen {
+            return Err(format!(
+                "probe on {topic} didn't come back within {}s",
+                timeout.as_secs()
+            ));
+        }
+        Ok(started.elapsed())
+    }
+
+    /// Publish a command reply (not retained) to a caller-supplied `reply_to`
+    /// topic; see `commands::reply`.
+    pub async fn publish_reply(&self, topic: &str, body: &serde_json::Value) {
+        let Ok(payload) = serde_json::to_vec(body) else {
+            return;
+        };
+        self.publish_inner(topic.to_string(), false, payload).await;
+    }
+
     /// Publish availability status
     pub async fn publish_availability(&self, online: bool) {
         // Zero-copy static payloads - Bytes::from_static avoids the &[u8] → Vec<u8>
@@ -518,9 +1012,27 @@ impl MqttClient {
         let Ok(payload) = serde_json::to_vec(attributes) else {
             return;
         };
+        if let Some(mirror) = &self.mirror {
+            mirror.publish(&topic, true, payload.clone());
+        }
         self.publish_inner(topic, true, payload).await;
     }
 
+    /// Fire a device trigger (see `discovery::DEVICE_TRIGGERS`). Not retained,
+    /// so HA doesn't replay the event when it reconnects.
+    pub async fn fire_trigger(&self, name: &str) {
+        self.publish_inner(self.trigger_topic(name), false, name)
+            .await;
+    }
+
+    /// Copy a sensor value to the `mirror` broker, if one is configured. The
+    /// mirror always gets the per-sensor topic, even with `bundle_state` on.
+    fn mirror(&self, name: &str, retained: bool, value: &str) {
+        if let Some(mirror) = &self.mirror {
+            mirror.publish(&self.sensor_topic(name), retained, value);
+        }
+    }
+
     /// Internal publish helper. Logs failures instead of silently dropping them
     /// - broker disconnects in the middle of a publish should be visible.
     async fn publish_inner(&self, topic: String, retained: bool, payload: impl Into<Vec<u8>>) {
@@ -529,7 +1041,7 @@ impl MqttClient {
             .publish(&topic, QoS::AtLeastOnce, retained, payload)
             .await
         {
-            warn!("MQTT publish failed for {}: {:?}", topic, e);
+            warn!(topic = topic.as_str(); "MQTT publish failed for {}: {:?}", topic, e);
         }
     }
 
@@ -540,7 +1052,7 @@ impl MqttClient {
             .publish_bytes(&topic, QoS::AtLeastOnce, retained, payload)
             .await
         {
-            warn!("MQTT publish_bytes failed for {}: {:?}", topic, e);
+            warn!(topic = topic.as_str(); "MQTT publish_bytes failed for {}: {:?}", topic, e);
         }
     }
 
@@ -557,7 +1069,9 @@ impl CommandReceiver {
 #[cfg(test)]
 mod tests {
     use super::*;
-    use crate::config::{FeatureConfig, IntervalConfig, MqttConfig};
+    use crate::config::{
+        CommandAuthConfig, FeatureConfig, GameModeConfig, IntervalConfig, LoggingConfig, MqttConfig,
+    };
 
     /// Create a minimal MqttClient for testing topics and payload generation.
     /// The event loop is never polled - no real broker connection is made.
@@ -571,14 +1085,17 @@ mod tests {
             device_name: device_name.to_string(),
             device_id: device_id.clone(),
             cached_topics: CachedTopics::new(device_name),
-            device: Arc::new(HADevice {
-                identifiers: vec![device_id],
-                name: device_name.to_string(),
-                model: format!("PC Bridge v{}", VERSION),
-                manufacturer: "dank0i".to_string(),
-                sw_version: VERSION.to_string(),
-            }),
+            device: Arc::new(ha_device(&device_id, device_name, &DeviceConfig::default())),
             reconnect_tx,
+            discovery_echo: Arc::new(watch::Sender::new(false)),
+            probe_echo: Arc::new(watch::Sender::new(String::new())),
+            connected: Arc::new(watch::Sender::new(false)),
+            local_commands: mpsc::channel(1).0,
+            bundle: None,
+            force_reconnect: Arc::new(Notify::new()),
+            entity_overrides: std::sync::Mutex::new(HashMap::new()),
+            mirror: None,
+            command_topics: Arc::new(std::sync::Mutex::new(Vec::new())),
         }
     }
 
@@ -591,6 +1108,7 @@ mod tests {
                 user: String::new(),
                 pass: String::new(),
                 client_id: None,
+                client_cert: None,
             },
             intervals: IntervalConfig::default(),
             features,
@@ -607,6 +1125,30 @@ mod tests {
             custom_commands: Vec::new(),
             update_channel: crate::config::default_update_channel(),
             disk_sensor_paths: Vec::new(),
+            game_exclusions: Vec::new(),
+            command_rate_limits: HashMap::new(),
+            custom_subscriptions: Vec::new(),
+            shutdown_grace_secs: 0,
+            wake_turns_on_display: true,
+            controllable_services: Vec::new(),
+            logging: LoggingConfig::default(),
+            game_priority: Vec::new(),
+            fullscreen_windows: Vec::new(),
+            bundle_state: false,
+            game_hooks: HashMap::new(),
+            idle_include_gamepad: false,
+            wake_skip_when_active: true,
+            reconnect_on_wake: false,
+            entities: HashMap::new(),
+            keep_games_on_empty_reload: true,
+            device: DeviceConfig::default(),
+            mirror: None,
+            notification_topics: Vec::new(),
+            max_notifications_per_minute: 10,
+            readable_registry_keys: Vec::new(),
+            button_payloads: vec!["PRESS".to_string()],
+            game_mode: GameModeConfig::default(),
+            command_auth: CommandAuthConfig::default(),
         }
     }
 
@@ -631,6 +1173,29 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_bundled_sensor_state_topic() {
+        let mut mqtt = test_client("dank0i-pc");
+        assert_eq!(
+            mqtt.sensor_state_topic("cpu_usage"),
+            "homeassistant/sensor/dank0i-pc/cpu_usage/state"
+        );
+        assert_eq!(mqtt.sensor_value_template("cpu_usage"), None);
+
+        mqtt.bundle = Some(Arc::new(bundle::StateBundle::new()));
+        assert_eq!(
+            mqtt.sensor_state_topic("cpu_usage"),
+            "homeassistant/sensor/dank0i-pc/state"
+        );
+        assert!(mqtt.sensor_value_template("cpu_usage").is_some());
+        // Published over its own paths, so never bundled.
+        assert_eq!(
+            mqtt.sensor_state_topic("sleep_state"),
+            "homeassistant/sensor/dank0i-pc/sleep_state/state"
+        );
+        assert_eq!(mqtt.sensor_value_template("bridge_info"), None);
+    }
+
     #[test]
     fn test_sensor_attributes_topic() {
         let mqtt = test_client("dank0i-pc");
@@ -723,6 +1288,7 @@ mod tests {
             name: "CPU Usage".to_string(),
             unique_id: format!("{}_cpu_usage", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("cpu_usage")),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -762,6 +1328,7 @@ mod tests {
             name: "Sleep".to_string(),
             unique_id: format!("{}_Sleep", mqtt.device_id),
             state_topic: None,
+            value_template: None,
             command_topic: Some(mqtt.command_topic("Sleep")),
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -802,6 +1369,7 @@ mod tests {
             name: "Running Game".to_string(),
             unique_id: format!("{}_runninggames", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("runninggames")),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -833,6 +1401,7 @@ mod tests {
             name: "Test".to_string(),
             unique_id: format!("{}_test", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("test")),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -858,6 +1427,21 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_ha_device_overrides() {
+        let info = DeviceConfig {
+            model: Some("ThinkStation P360".to_string()),
+            manufacturer: Some("Lenovo".to_string()),
+            sw_version: Some("  ".to_string()),
+        };
+        let device = ha_device("office_pc", "office-pc", &info);
+        assert_eq!(device.model, "ThinkStation P360");
+        assert_eq!(device.manufacturer, "Lenovo");
+        // Blank falls back to the bridge version.
+        assert_eq!(device.sw_version, VERSION);
+        assert_eq!(device.identifiers, vec!["office_pc".to_string()]);
+    }
+
     #[test]
     fn test_sleep_state_has_no_availability() {
         let mqtt = test_client("dank0i-pc");
@@ -866,6 +1450,7 @@ mod tests {
             name: "Sleep State".to_string(),
             unique_id: format!("{}_sleep_state", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("sleep_state")),
+            value_template: None,
             command_topic: None,
             availability_topic: None,
             availability: None,
@@ -897,6 +1482,7 @@ mod tests {
             name: "Test".to_string(),
             unique_id: "test_id".to_string(),
             state_topic: None,
+            value_template: None,
             command_topic: None,
             availability_topic: None,
             availability: None,
@@ -936,6 +1522,7 @@ mod tests {
             name: "Last Active".to_string(),
             unique_id: format!("{}_lastactive", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("lastactive")),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -975,6 +1562,7 @@ mod tests {
             name: format!("Custom: {}", sensor.name),
             unique_id: format!("{}_{}", mqtt.device_id, topic_name),
             state_topic: Some(mqtt.sensor_topic(&topic_name)),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -1011,12 +1599,15 @@ mod tests {
             path: None,
             args: None,
             command: Some("reboot-router.sh".to_string()),
+            wait: false,
+            timeout_secs: None,
         };
 
         let payload = HADiscoveryPayload {
             name: format!("Custom: {}", cmd.name),
             unique_id: format!("{}_custom_{}", mqtt.device_id, cmd.name),
             state_topic: None,
+            value_template: None,
             command_topic: Some(mqtt.command_topic(&cmd.name)),
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -1135,6 +1726,25 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_diff_topics() {
+        let topic = |name: &str| format!("homeassistant/button/pc/{name}/action");
+        let current = [topic("Lock"), topic("backup_db")];
+        let wanted = [topic("Lock"), topic("reboot_router")];
+        let (added, removed) = diff_topics(&current, &wanted);
+        assert_eq!(added, [topic("reboot_router")]);
+        assert_eq!(removed, [topic("backup_db")]);
+        assert_eq!(diff_topics(&wanted, &wanted), (vec![], vec![]));
+    }
+
+    #[test]
+    fn test_echo_subscribed_without_features() {
+        let config = test_config("test-pc", FeatureConfig::default());
+        let topics = MqttClient::build_subscribe_topics("test-pc", &config);
+        assert!(topics.contains(&"homeassistant/button/test-pc/Echo/action".to_string()));
+        assert!(topics.contains(&"homeassistant/button/test-pc/SelfTest/action".to_string()));
+    }
+
     #[test]
     fn test_subscribe_topics_with_audio() {
         let features = FeatureConfig {
@@ -1179,6 +1789,8 @@ mod tests {
                 path: None,
                 args: None,
                 command: Some("echo test".to_string()),
+                wait: false,
+                timeout_secs: None,
             },
             CustomCommand {
                 name: "backup_db".to_string(),
@@ -1189,6 +1801,8 @@ mod tests {
                 path: None,
                 args: None,
                 command: Some("echo backup".to_string()),
+                wait: false,
+                timeout_secs: None,
             },
         ];
 
@@ -1233,6 +1847,27 @@ mod tests {
             disk_sensor: true,
             uptime_sensor: true,
             hwinfo_sensor: true,
+            focus_assist: true,
+            process_count: true,
+            cmd_priority: true,
+            vram_sensor: true,
+            cmd_service: true,
+            audio_peak: true,
+            window_fullscreen: true,
+            cmd_window: true,
+            windows_version: true,
+            cmd_mouse: true,
+            metered_connection: true,
+            remote_session: true,
+            device_triggers: true,
+            cmd_registry: true,
+            heartbeat: true,
+            night_light: true,
+            game_mode: true,
+            command_slots: true,
+            cmd_explorer: true,
+            tcp_connections: true,
+            keep_awake: true,
         };
         let config = test_config("test-pc", features);
         let topics = MqttClient::build_subscribe_topics("test-pc", &config);
@@ -1281,6 +1916,7 @@ mod tests {
             name: "Battery Level".to_string(),
             unique_id: format!("{}_battery_level", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("battery_level")),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -1650,6 +2286,92 @@ mod tests {
         assert_eq!(cmd, None);
     }
 
+    // ===== custom_subscriptions routing =====
+
+    fn custom_sub(topic: &str, command: &str) -> CustomSubscription {
+        CustomSubscription {
+            topic: topic.to_string(),
+            command: command.to_string(),
+        }
+    }
+
+    #[test]
+    fn test_topic_matches_filter() {
+        use super::topics::topic_matches_filter;
+        assert!(topic_matches_filter("home/pc/sleep", "home/pc/sleep"));
+        assert!(!topic_matches_filter("home/pc/sleep", "home/pc/sleep/now"));
+        assert!(topic_matches_filter("home/+/sleep", "home/pc/sleep"));
+        assert!(!topic_matches_filter("home/+/sleep", "home/pc/x/sleep"));
+        // '#' also matches the parent level itself.
+        assert!(topic_matches_filter("home/pc/#", "home/pc"));
+        assert!(topic_matches_filter("home/pc/#", "home/pc/a/b"));
+        assert!(topic_matches_filter("#", "anything/at/all"));
+        // Wildcards at the first level don't reach broker-internal topics.
+        assert!(!topic_matches_filter("#", "$SYS/broker/uptime"));
+        assert!(!topic_matches_filter(
+            "+/broker/uptime",
+            "$SYS/broker/uptime"
+        ));
+    }
+
+    #[test]
+    fn test_parse_incoming_topic_custom_subscriptions() {
+        let subs = vec![
+            custom_sub("dash/pc/power/off", "Shutdown"),
+            custom_sub("dash/pc/media/+", "MediaPlayPause"),
+            custom_sub("dash/#", "Lock"),
+        ];
+        let button = "homeassistant/button/pc/";
+        let notify = ["pc-bridge/notifications/pc".to_string()];
+
+        let route = |topic: &'static str| parse_incoming_topic(topic, button, &notify, &subs);
+        assert_eq!(route("dash/pc/power/off"), Some("Shutdown"));
+        assert_eq!(route("dash/pc/media/toggle"), Some("MediaPlayPause"));
+        // First match wins; the catch-all only sees what the others didn't.
+        assert_eq!(route("dash/pc/other"), Some("Lock"));
+        assert_eq!(route("elsewhere/pc"), None);
+        // Built-in topics keep priority over user filters.
+        assert_eq!(route("homeassistant/button/pc/Sleep/action"), Some("Sleep"));
+    }
+
+    #[test]
+    fn test_notification_topics_routing() {
+        let notify = [
+            "hass.agent/notifications/pc".to_string(),
+            "ha/notify/+".to_string(),
+        ];
+        let route = |topic| parse_incoming_topic(topic, "homeassistant/button/pc/", &notify, &[]);
+        assert_eq!(route("hass.agent/notifications/pc"), Some("notification"));
+        assert_eq!(route("ha/notify/all"), Some("notification"));
+        assert_eq!(route("pc-bridge/notifications/pc"), None);
+
+        let features = FeatureConfig {
+            notifications: true,
+            ..FeatureConfig::default()
+        };
+        let mut config = test_config("pc", features);
+        config.notification_topics = vec![
+            "hass.agent/notifications/{device_name}".to_string(),
+            "ha/notify/+".to_string(),
+        ];
+        let topics = MqttClient::build_subscribe_topics("pc", &config);
+        assert!(topics.contains(&"hass.agent/notifications/pc".to_string()));
+        assert!(topics.contains(&"ha/notify/+".to_string()));
+        assert!(!topics.contains(&"pc-bridge/notifications/pc".to_string()));
+    }
+
+    #[test]
+    fn test_subscribe_topics_with_custom_subscriptions() {
+        let mut config = test_config("test-pc", FeatureConfig::default());
+        config.custom_subscriptions = vec![
+            custom_sub("dash/pc/#", "Lock"),
+            custom_sub("dash/pc/#", "Sleep"),
+        ];
+        let topics = MqttClient::build_subscribe_topics("test-pc", &config);
+        // Subscribed once even when two routes share a filter.
+        assert_eq!(topics.iter().filter(|t| *t == "dash/pc/#").count(), 1);
+    }
+
     // ===== Topic generation tests =====
 
     #[test]
@@ -1665,6 +2387,8 @@ mod tests {
         let cmd = Command {
             name: "Sleep".to_string(),
             payload: "".to_string(),
+            local: false,
+            from_button: true,
         };
         assert_eq!(cmd.name, "Sleep");
         assert!(cmd.payload.is_empty());
@@ -1675,6 +2399,8 @@ mod tests {
         let cmd = Command {
             name: "notification".to_string(),
             payload: r#"{"title":"Test","message":"Hello"}"#.to_string(),
+            local: false,
+            from_button: false,
         };
         assert_eq!(cmd.name, "notification");
         assert!(cmd.payload.contains("Test"));
@@ -1903,6 +2629,7 @@ mod tests {
                     user: String::new(),
                     pass: String::new(),
                     client_id: None,
+                    client_cert: None,
                 },
                 intervals: IntervalConfig::default(),
                 features,
@@ -1919,6 +2646,30 @@ mod tests {
                 custom_commands: Vec::new(),
                 update_channel: crate::config::default_update_channel(),
                 disk_sensor_paths: Vec::new(),
+                game_exclusions: Vec::new(),
+                command_rate_limits: HashMap::new(),
+                custom_subscriptions: Vec::new(),
+                shutdown_grace_secs: 0,
+                wake_turns_on_display: true,
+                controllable_services: Vec::new(),
+                logging: LoggingConfig::default(),
+                game_priority: Vec::new(),
+                fullscreen_windows: Vec::new(),
+                bundle_state: false,
+                game_hooks: HashMap::new(),
+                idle_include_gamepad: false,
+                wake_skip_when_active: true,
+                reconnect_on_wake: false,
+                entities: HashMap::new(),
+                keep_games_on_empty_reload: true,
+                device: DeviceConfig::default(),
+                mirror: None,
+                notification_topics: Vec::new(),
+                max_notifications_per_minute: 10,
+                readable_registry_keys: Vec::new(),
+                button_payloads: vec!["PRESS".to_string()],
+                game_mode: GameModeConfig::default(),
+                command_auth: CommandAuthConfig::default(),
             }
         }
 
@@ -1956,6 +2707,27 @@ mod tests {
                 disk_sensor: true,
                 uptime_sensor: true,
                 hwinfo_sensor: true,
+                focus_assist: true,
+                process_count: true,
+                cmd_priority: true,
+                vram_sensor: true,
+                cmd_service: true,
+                audio_peak: true,
+                window_fullscreen: true,
+                cmd_window: true,
+                windows_version: true,
+                cmd_mouse: true,
+                metered_connection: true,
+                remote_session: true,
+                device_triggers: true,
+                cmd_registry: true,
+                heartbeat: true,
+                night_light: true,
+                game_mode: true,
+                command_slots: true,
+                cmd_explorer: true,
+                tcp_connections: true,
+                keep_awake: true,
             }
         }
 
@@ -2084,6 +2856,8 @@ mod tests {
                     path: None,
                     args: None,
                     command: Some("echo test".to_string()),
+                    wait: false,
+                    timeout_secs: None,
                 });
             }
 
@@ -2130,6 +2904,7 @@ mod tests {
                 "Launch",
                 "Screensaver",
                 "Wake",
+                "ResetIdle",
                 "Shutdown",
                 "Sleep",
                 "Lock",
@@ -2374,6 +3149,7 @@ mod tests {
             name: "GPU Power".to_string(),
             unique_id: format!("{}_gpu_power", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("gpu_power")),
+            value_template: None,
             command_topic: None,
             availability_topic: Some(mqtt.availability_topic()),
             availability: None,
@@ -2396,6 +3172,7 @@ mod tests {
             name: "Sleep State".to_string(),
             unique_id: format!("{}_sleep_state", mqtt.device_id),
             state_topic: Some(mqtt.sensor_topic("sleep_state")),
+            value_template: None,
             command_topic: None,
             availability_topic: None,
             availability: None,
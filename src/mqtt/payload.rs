@@ -14,6 +14,9 @@ pub(super) struct HADiscoveryPayload {
     pub(super) unique_id: String,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub(super) state_topic: Option<String>,
+    /// Extracts this entity's value from a shared state topic (`bundle_state`).
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(super) value_template: Option<String>,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub(super) command_topic: Option<String>,
     #[serde(skip_serializing_if = "Option::is_none")]
@@ -77,6 +77,26 @@ impl CachedTopics {
     }
 }
 
+/// MQTT topic-filter match: `+` matches exactly one level, a trailing `#`
+/// matches the parent level and everything below it. Per the spec, wildcards in
+/// the first level never match `$`-prefixed (broker-internal) topics.
+pub(super) fn topic_matches_filter(filter: &str, topic: &str) -> bool {
+    if topic.starts_with('$') && (filter.starts_with('+') || filter.starts_with('#')) {
+        return false;
+    }
+    let mut filter_levels = filter.split('/');
+    let mut topic_levels = topic.split('/');
+    loop {
+        match (filter_levels.next(), topic_levels.next()) {
+            (Some("#"), _) => return true,
+            (Some("+"), Some(_)) => {}
+            (Some(f), Some(t)) if f == t => {}
+            (None, None) => return true,
+            _ => return false,
+        }
+    }
+}
+
 // Topic helpers - split-impl block lives here so callers in mod.rs can
 // continue to use `self.sensor_topic(...)` etc. but the format strings are
 // no longer scattered.  All these return owned String because rumqttc's
@@ -129,6 +149,22 @@ impl MqttClient {
         )
     }
 
+    /// Retained ON/OFF state of a switch command.
+    pub(super) fn switch_state_topic(&self, name: &str) -> String {
+        format!(
+            "{}/switch/{}/{}/state",
+            DISCOVERY_PREFIX, self.device_name, name
+        )
+    }
+
+    /// Event topic of a device trigger; the payload is the trigger name.
+    pub(super) fn trigger_topic(&self, name: &str) -> String {
+        format!(
+            "{}/device_automation/{}/{}/trigger",
+            DISCOVERY_PREFIX, self.device_name, name
+        )
+    }
+
     /// Discovery config topic.  Used at registration time for every entity.
     ///
     /// `component` is the HA MQTT discovery component (`sensor`, `button`,
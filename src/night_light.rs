@@ -0,0 +1,180 @@
+//! Night Light (blue-light reduction) state - Windows only.
+//!
+//! Windows keeps the on/off state in an undocumented CloudStore blob,
+//! `$windows.data.bluelightreduction.bluelightreductionstate`, under HKCU.
+//! Byte 18 is the length of the inner record: 0x15 while Night Light is on,
+//! 0x13 while it's off, the difference being a `10 00` pair at offset 23.
+//! Bytes 10..15 are a 5-byte LEB128 timestamp; a write only takes effect if
+//! it moves forward, so flipping the state also bumps it. Windows watches the
+//! value, so a write applies without signing out.
+#![cfg_attr(not(windows), allow(dead_code))]
+
+/// Below HKCU.
+#[cfg(windows)]
+const STATE_KEY: &str = r"Software\Microsoft\Windows\CurrentVersion\CloudStore\Store\DefaultAccount\Current\default$windows.data.bluelightreduction.bluelightreductionstate\windows.data.bluelightreduction.bluelightreductionstate";
+
+const LENGTH_OFFSET: usize = 18;
+const LENGTH_ON: u8 = 0x15;
+const LENGTH_OFF: u8 = 0x13;
+const ON_MARKER_OFFSET: usize = 23;
+const ON_MARKER: [u8; 2] = [0x10, 0x00];
+const TIMESTAMP: std::ops::Range<usize> = 10..15;
+
+/// Whether the state blob says Night Light is on; None for a layout we don't
+/// recognise.
+pub(crate) fn blob_is_on(data: &[u8]) -> Option<bool> {
+    if data.len() < ON_MARKER_OFFSET + ON_MARKER.len() {
+        return None;
+    }
+    match data[LENGTH_OFFSET] {
+        LENGTH_ON => Some(true),
+        LENGTH_OFF => Some(false),
+        _ => None,
+    }
+}
+
+/// `data` rewritten to the requested state, with the timestamp bumped so
+/// Windows picks the change up. None if the layout isn't recognised.
+pub(crate) fn blob_with_state(data: &[u8], on: bool) -> Option<Vec<u8>> {
+    let current = blob_is_on(data)?;
+    if current == on {
+        return Some(data.to_vec());
+    }
+    let mut out = data.to_vec();
+    bump_timestamp(&mut out[TIMESTAMP])?;
+    let marker = ON_MARKER_OFFSET..ON_MARKER_OFFSET + ON_MARKER.len();
+    if on {
+        out[LENGTH_OFFSET] = LENGTH_ON;
+        out.splice(ON_MARKER_OFFSET..ON_MARKER_OFFSET, ON_MARKER);
+    } else {
+        if out[marker.clone()] != ON_MARKER {
+            return None;
+        }
+        out[LENGTH_OFFSET] = LENGTH_OFF;
+        out.drain(marker);
+    }
+    Some(out)
+}
+
+/// Add one to a fixed-width LEB128 value in place, keeping its width. None if
+/// the bytes aren't a value of exactly that width, or it would overflow.
+fn bump_timestamp(bytes: &mut [u8]) -> Option<()> {
+    let (last, rest) = bytes.split_last()?;
+    if last & 0x80 != 0 || rest.iter().any(|b| b & 0x80 == 0) {
+        return None;
+    }
+    let value = bytes
+        .iter()
+        .enumerate()
+        .fold(0u64, |acc, (i, b)| acc | (u64::from(b & 0x7f) << (7 * i)));
+    let next = value + 1;
+    if next >> (7 * bytes.len()) != 0 {
+        return None;
+    }
+    let width = bytes.len();
+    for (i, b) in bytes.iter_mut().enumerate() {
+        let group = ((next >> (7 * i)) & 0x7f) as u8;
+        *b = if i + 1 < width { group | 0x80 } else { group };
+    }
+    Some(())
+}
+
+#[cfg(windows)]
+fn read_blob() -> Option<Vec<u8>> {
+    use winreg::RegKey;
+    use winreg::enums::{HKEY_CURRENT_USER, KEY_READ};
+
+    let key = RegKey::predef(HKEY_CURRENT_USER)
+        .open_subkey_with_flags(STATE_KEY, KEY_READ)
+        .ok()?;
+    key.get_raw_value("Data").ok().map(|raw| raw.bytes)
+}
+
+/// Current Night Light state, or None if it can't be read (never configured,
+/// or an unknown blob layout).
+#[cfg(windows)]
+pub fn get() -> Option<bool> {
+    blob_is_on(&read_blob()?)
+}
+
+/// Turn Night Light on or off.
+#[cfg(windows)]
+pub fn set(on: bool) -> bool {
+    use winreg::enums::{HKEY_CURRENT_USER, KEY_SET_VALUE, REG_BINARY};
+    use winreg::{RegKey, RegValue};
+
+    let Some(bytes) = read_blob().and_then(|data| blob_with_state(&data, on)) else {
+        return false;
+    };
+    RegKey::predef(HKEY_CURRENT_USER)
+        .open_subkey_with_flags(STATE_KEY, KEY_SET_VALUE)
+        .and_then(|key| {
+            key.set_raw_value(
+                "Data",
+                &RegValue {
+                    bytes,
+                    vtype: REG_BINARY,
+                },
+            )
+        })
+        .is_ok()
+}
+
+/// Toggle Night Light.
+#[cfg(windows)]
+pub fn toggle() -> bool {
+    get().is_some_and(|on| set(!on))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// State blob captured with Night Light off.
+    const OFF: [u8; 41] = [
+        0x43, 0x42, 0x01, 0x00, 0x0a, 0x02, 0x01, 0x00, 0x2a, 0x06, 0xe4, 0xa1, 0xd5, 0xb5, 0x06,
+        0x2a, 0x2b, 0x0e, 0x13, 0x43, 0x42, 0x01, 0x00, 0xd0, 0x0a, 0x02, 0xc6, 0x14, 0x8a, 0x8d,
+        0xee, 0xd7, 0xee, 0xf8, 0xe6, 0xda, 0x01, 0x00, 0x00, 0x00, 0x00,
+    ];
+
+    #[test]
+    fn test_blob_is_on() {
+        assert_eq!(blob_is_on(&OFF), Some(false));
+        let on = blob_with_state(&OFF, true).unwrap();
+        assert_eq!(blob_is_on(&on), Some(true));
+        assert_eq!(&on[23..25], &ON_MARKER);
+        assert_eq!(on.len(), OFF.len() + 2);
+        assert_eq!(blob_is_on(&OFF[..20]), None);
+        let mut odd = OFF;
+        odd[LENGTH_OFFSET] = 0x20;
+        assert_eq!(blob_is_on(&odd), None);
+    }
+
+    #[test]
+    fn test_blob_round_trip() {
+        let on = blob_with_state(&OFF, true).unwrap();
+        let off = blob_with_state(&on, false).unwrap();
+        assert_eq!(off.len(), OFF.len());
+        // Everything but the timestamp is back where it started.
+        assert_eq!(off[..10], OFF[..10]);
+        assert_eq!(off[15..], OFF[15..]);
+        assert_ne!(off[10..15], OFF[10..15]);
+        // Already in the requested state: unchanged.
+        assert_eq!(blob_with_state(&OFF, false).unwrap(), OFF);
+    }
+
+    #[test]
+    fn test_bump_timestamp() {
+        let mut ts = [0x81, 0x80, 0x00];
+        bump_timestamp(&mut ts).unwrap();
+        assert_eq!(ts, [0x82, 0x80, 0x00]);
+        // Carry into the next group.
+        let mut ts = [0xff, 0x80, 0x00];
+        bump_timestamp(&mut ts).unwrap();
+        assert_eq!(ts, [0x80, 0x81, 0x00]);
+        // Full: growing the value would change the blob's width.
+        assert!(bump_timestamp(&mut [0xff, 0xff, 0x7f]).is_none());
+        // Not a 3-byte LEB128 value.
+        assert!(bump_timestamp(&mut [0x01, 0x80, 0x00]).is_none());
+    }
+}
@@ -4,6 +4,13 @@
 //! - ~10ms instead of 200-500ms latency
 //! - No PowerShell process spawn overhead
 //! - Proper app identity support
+//! - No console code page in the way: text goes to WinRT as UTF-16, so emoji
+//!   and accented characters show as sent
+//!
+//! A payload with `progress` (percent) shows a toast with a progress bar,
+//! `message` as the status line under it. Giving it a `tag` lets later
+//! payloads with the same tag update that toast in place, so HA can push
+//! "Backup 40%... 80%... done" as one toast instead of a stack of popups.
 #![allow(dead_code)] // Used on Windows only
 
 #[cfg(windows)]
@@ -11,7 +18,9 @@ use log::debug;
 #[cfg(windows)]
 use windows::{
     Data::Xml::Dom::XmlDocument,
-    UI::Notifications::{ToastNotification, ToastNotificationManager},
+    UI::Notifications::{
+        NotificationData, NotificationUpdateResult, ToastNotification, ToastNotificationManager,
+    },
     Win32::System::Com::{COINIT_APARTMENTTHREADED, CoInitializeEx},
     core::HSTRING,
 };
@@ -23,16 +32,67 @@ pub struct NotificationPayload {
     pub title: String,
     #[serde(default)]
     pub message: String,
+    /// Replaces (or, for a progress toast, updates) the earlier notification
+    /// with the same tag
+    #[serde(default)]
+    pub tag: Option<String>,
+    /// Progress bar value, 0-100
+    #[serde(default)]
+    pub progress: Option<f64>,
 }
 
+/// Windows rejects toast tags longer than this.
+const MAX_TAG_LEN: usize = 64;
+
+/// Status line under the progress bar when the payload has no message.
+const DEFAULT_PROGRESS_STATUS: &str = "In progress";
+
 impl NotificationPayload {
     /// Parse notification payload from JSON or plain text
     pub fn from_payload(payload: &str) -> Self {
         serde_json::from_str(payload).unwrap_or_else(|_| Self {
             title: String::new(),
             message: payload.to_string(),
+            ..Default::default()
         })
     }
+
+    /// Tag cut to what Windows accepts; `None` if absent or blank.
+    fn tag(&self) -> Option<String> {
+        self.tag
+            .as_deref()
+            .map(str::trim)
+            .filter(|t| !t.is_empty())
+            .map(|t| t.chars().take(MAX_TAG_LEN).collect())
+    }
+
+    /// Status line for a progress toast.
+    fn progress_status(&self) -> &str {
+        if self.message.is_empty() {
+            DEFAULT_PROGRESS_STATUS
+        } else {
+            &self.message
+        }
+    }
+}
+
+/// `progress` percent clamped to 0-100 (NaN counts as 0).
+fn clamp_percent(percent: f64) -> f64 {
+    if percent.is_nan() {
+        0.0
+    } else {
+        percent.clamp(0.0, 100.0)
+    }
+}
+
+/// The toast `<progress>` value: a 0.0-1.0 fraction.
+fn progress_value(percent: f64) -> String {
+    format!("{:.2}", clamp_percent(percent) / 100.0)
+}
+
+/// Text shown at the right of the bar, e.g. "40%".
+fn progress_label(percent: f64) -> String {
+    format!("{:.0}%", clamp_percent(percent))
 }
 
 /// Show a native Windows toast notification
@@ -55,9 +115,23 @@ pub fn show_toast(payload: &str) -> anyhow::Result<()> {
     let title = escape_xml(title);
     let message = escape_xml(message);
 
-    // Build toast XML template
-    let toast_xml = format!(
-        r#"<toast>
+    // Build toast XML template. The progress bar's fields are data-bound so a
+    // later payload with the same tag can update them in place.
+    let toast_xml = if notif.progress.is_some() {
+        format!(
+            r#"<toast>
+            <visual>
+                <binding template="ToastGeneric">
+                    <text>{}</text>
+                    <progress value="{{progressValue}}" valueStringOverride="{{progressLabel}}" status="{{progressStatus}}"/>
+                </binding>
+            </visual>
+        </toast>"#,
+            title
+        )
+    } else {
+        format!(
+            r#"<toast>
             <visual>
                 <binding template="ToastText02">
                     <text id="1">{}</text>
@@ -65,8 +139,9 @@ pub fn show_toast(payload: &str) -> anyhow::Result<()> {
                 </binding>
             </visual>
         </toast>"#,
-        title, message
-    );
+            title, message
+        )
+    };
 
     // Initialize COM on this thread (STA) - the WinRT calls below (XmlDocument,
     // ToastNotificationManager) require an initialized apartment. This runs on a
@@ -78,18 +153,43 @@ pub fn show_toast(payload: &str) -> anyhow::Result<()> {
         let _ = CoInitializeEx(None, COINIT_APARTMENTTHREADED);
     }
 
+    // Use PowerShell's AUMID as app identity (works without app registration)
+    let app_id = HSTRING::from(
+        "{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\\WindowsPowerShell\\v1.0\\powershell.exe",
+    );
+    let notifier = ToastNotificationManager::CreateToastNotifierWithId(&app_id)?;
+
+    let tag = notif.tag().map(|t| HSTRING::from(t.as_str()));
+    let data = match notif.progress {
+        Some(percent) => Some(progress_data(percent, notif.progress_status())?),
+        None => None,
+    };
+
+    // A progress toast with this tag still on screen (or in Action Center):
+    // update its bar silently rather than popping a new toast. NotFound (it
+    // was dismissed, or never shown) falls through to showing a fresh one.
+    if let (Some(tag), Some(data)) = (&tag, &data)
+        && matches!(
+            notifier.UpdateWithTag(data, tag),
+            Ok(NotificationUpdateResult::Succeeded)
+        )
+    {
+        debug!("Toast notification updated: {} ({})", tag, message);
+        return Ok(());
+    }
+
     // Create XML document
     let xml_doc = XmlDocument::new()?;
     xml_doc.LoadXml(&HSTRING::from(&toast_xml))?;
 
     // Create toast notification
     let toast = ToastNotification::CreateToastNotification(&xml_doc)?;
-
-    // Use PowerShell's AUMID as app identity (works without app registration)
-    let app_id = HSTRING::from(
-        "{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\\WindowsPowerShell\\v1.0\\powershell.exe",
-    );
-    let notifier = ToastNotificationManager::CreateToastNotifierWithId(&app_id)?;
+    if let Some(tag) = &tag {
+        toast.SetTag(tag)?;
+    }
+    if let Some(data) = &data {
+        toast.SetData(data)?;
+    }
 
     notifier.Show(&toast)?;
 
@@ -97,6 +197,24 @@ pub fn show_toast(payload: &str) -> anyhow::Result<()> {
     Ok(())
 }
 
+/// Bound values for the progress toast's `{progressValue}` etc. Raw text:
+/// data binding doesn't go through the XML parser, so no escaping.
+#[cfg(windows)]
+fn progress_data(percent: f64, status: &str) -> windows::core::Result<NotificationData> {
+    let data = NotificationData::new()?;
+    let values = data.Values()?;
+    values.Insert(
+        &HSTRING::from("progressValue"),
+        &HSTRING::from(progress_value(percent)),
+    )?;
+    values.Insert(
+        &HSTRING::from("progressLabel"),
+        &HSTRING::from(progress_label(percent)),
+    )?;
+    values.Insert(&HSTRING::from("progressStatus"), &HSTRING::from(status))?;
+    Ok(data)
+}
+
 /// Show notification on Linux using notify-send
 #[cfg(not(windows))]
 pub fn show_toast(payload: &str) -> anyhow::Result<()> {
@@ -108,21 +226,33 @@ pub fn show_toast(payload: &str) -> anyhow::Result<()> {
     } else {
         &notif.title
     };
-    let message = if notif.message.is_empty() {
+    let message = if notif.progress.is_some() {
+        notif.progress_status()
+    } else if notif.message.is_empty() {
         payload
     } else {
         &notif.message
     };
 
+    // Progress and tag go in as hints: `value` draws a bar, and the stack
+    // tags make dunst / GNOME-style servers replace the earlier notification.
+    let mut hints = Vec::new();
+    if let Some(percent) = notif.progress {
+        hints.push(format!("--hint=int:value:{:.0}", clamp_percent(percent)));
+    }
+    if let Some(tag) = notif.tag() {
+        hints.push(format!("--hint=string:x-dunst-stack-tag:{tag}"));
+        hints.push(format!(
+            "--hint=string:x-canonical-private-synchronous:{tag}"
+        ));
+    }
+
     // Try notify-send (available on most Linux desktops).  .status() waits
     // and reaps the child; .spawn() alone would leak zombies on Linux.
     let result = Command::new("notify-send")
-        .args([
-            "--app-name=PC Bridge",
-            "--icon=dialog-information",
-            title,
-            message,
-        ])
+        .args(["--app-name=PC Bridge", "--icon=dialog-information"])
+        .args(&hints)
+        .args([title, message])
         .status();
 
     // A non-zero exit is a failure too, not just a missing binary, so fall
@@ -205,9 +335,41 @@ mod tests {
         assert_eq!(payload.message, "Just a plain message");
     }
 
+    #[test]
+    fn test_payload_parsing_progress() {
+        let json = r#"{"title": "Backup", "message": "Copying", "tag": "backup", "progress": 40}"#;
+        let payload = NotificationPayload::from_payload(json);
+        assert_eq!(payload.tag().as_deref(), Some("backup"));
+        assert_eq!(payload.progress, Some(40.0));
+        assert_eq!(payload.progress_status(), "Copying");
+
+        let bare = NotificationPayload::from_payload(r#"{"title": "Backup", "progress": 5}"#);
+        assert_eq!(bare.progress_status(), DEFAULT_PROGRESS_STATUS);
+        assert_eq!(bare.tag(), None);
+        let long = format!(r#"{{"tag": "{}"}}"#, "x".repeat(100));
+        assert_eq!(
+            NotificationPayload::from_payload(&long)
+                .tag()
+                .unwrap()
+                .len(),
+            MAX_TAG_LEN
+        );
+    }
+
+    #[test]
+    fn test_progress_value() {
+        assert_eq!(progress_value(40.0), "0.40");
+        assert_eq!(progress_value(150.0), "1.00");
+        assert_eq!(progress_value(-3.0), "0.00");
+        assert_eq!(progress_value(f64::NAN), "0.00");
+        assert_eq!(progress_label(79.6), "80%");
+    }
+
     #[test]
     fn test_xml_escaping() {
         assert_eq!(escape_xml("Hello & World"), "Hello &amp; World");
         assert_eq!(escape_xml("<script>"), "&lt;script&gt;");
+        // Non-ASCII passes through untouched, emoji included.
+        assert_eq!(escape_xml("Café 🎉 ready"), "Café 🎉 ready");
     }
 }
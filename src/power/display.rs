@@ -1,8 +1,9 @@
 //! Display wake functions - handles waking display after WoL
 
-use log::{error, info};
+use log::{debug, error, info};
 use std::sync::atomic::{AtomicBool, Ordering};
-use std::time::Duration;
+use std::sync::{Condvar, Mutex};
+use std::time::{Duration, Instant};
 use windows::Win32::Foundation::{LPARAM, WPARAM};
 use windows::Win32::UI::Input::KeyboardAndMouse::{
     INPUT, INPUT_0, INPUT_KEYBOARD, KEYBD_EVENT_FLAGS, KEYBDINPUT, KEYEVENTF_KEYUP, SendInput,
@@ -11,14 +12,26 @@ use windows::Win32::UI::WindowsAndMessaging::{
     HWND_BROADCAST, SMTO_ABORTIFHUNG, SMTO_BLOCK, SendMessageTimeoutW,
 };
 
+use super::resume::WakeToken;
+
 const WM_SYSCOMMAND: u32 = 0x0112;
 const SC_MONITORPOWER: usize = 0xF170;
 const MONITOR_ON: isize = -1;
+const MONITOR_STANDBY: isize = 1;
 const MONITOR_OFF: isize = 2;
 const VK_F15: u16 = 0x7E;
+/// Input this recent at resume means the user woke the PC themselves.
+const USER_ACTIVE_IDLE_MS: u32 = 5_000;
 
 static SLEEP_PREVENTION_ACTIVE: AtomicBool = AtomicBool::new(false);
 
+/// Set once the agent is stopping; wakes the sleep-prevention thread early so
+/// it resets the execution state itself (only the thread that set it can).
+static SLEEP_PREVENTION_RELEASED: (Mutex<bool>, Condvar) = (Mutex::new(false), Condvar::new());
+
+/// How long shutdown waits for the sleep-prevention thread to let go.
+const SLEEP_PREVENTION_RELEASE_WAIT: Duration = Duration::from_millis(500);
+
 /// Wake display using multiple methods (matches Go WakeDisplay behavior)
 pub fn wake_display() {
     info!("WakeDisplay: Initiating display wake sequence");
@@ -39,59 +52,46 @@ pub fn wake_display() {
 }
 
 /// Dismiss screensaver by terminating .scr processes natively via Win32 API
-fn dismiss_screensaver() {
-    use windows::Win32::Foundation::CloseHandle;
-    use windows::Win32::System::Diagnostics::ToolHelp::{
-        CreateToolhelp32Snapshot, PROCESSENTRY32W, Process32FirstW, Process32NextW,
-        TH32CS_SNAPPROCESS,
-    };
-    use windows::Win32::System::Threading::{OpenProcess, PROCESS_TERMINATE, TerminateProcess};
-
-    info!("Attempting to dismiss screensaver");
-
-    unsafe {
-        let snapshot = match CreateToolhelp32Snapshot(TH32CS_SNAPPROCESS, 0) {
-            Ok(s) => s,
-            Err(_) => return,
-        };
+pub fn dismiss_screensaver() {
+    debug!("Attempting to dismiss screensaver");
 
-        let mut entry = PROCESSENTRY32W {
-            dwSize: std::mem::size_of::<PROCESSENTRY32W>() as u32,
-            ..Default::default()
-        };
-
-        if Process32FirstW(snapshot, &raw mut entry).is_ok() {
-            loop {
-                let name = String::from_utf16_lossy(&entry.szExeFile);
-                let name = name.trim_end_matches('\0');
-
-                // Check for .scr extension (case-insensitive)
-                if name.len() >= 4
-                    && name.as_bytes()[name.len() - 4..].eq_ignore_ascii_case(b".scr")
-                    && let Ok(handle) = OpenProcess(PROCESS_TERMINATE, false, entry.th32ProcessID)
-                {
-                    info!(
-                        "Terminating screensaver: {} (PID {})",
-                        name, entry.th32ProcessID
-                    );
-                    let _ = TerminateProcess(handle, 0);
-                    let _ = CloseHandle(handle);
-                }
-
-                if Process32NextW(snapshot, &raw mut entry).is_err() {
-                    break;
-                }
-            }
-        }
+    let Ok(processes) = crate::proclist::snapshot() else {
+        return;
+    };
 
-        let _ = CloseHandle(snapshot);
+    for proc in processes.iter().filter(|p| {
+        // Check for .scr extension (case-insensitive)
+        p.name.len() >= 4 && p.name.as_bytes()[p.name.len() - 4..].eq_ignore_ascii_case(b".scr")
+    }) {
+        info!("Terminating screensaver: {} (PID {})", proc.name, proc.pid);
+        crate::proclist::terminate(proc.pid);
     }
 
-    info!("Screensaver dismiss completed");
+    debug!("Screensaver dismiss completed");
 }
 
-/// Wake display with retries (useful immediately after WoL)
-pub fn wake_display_with_retry(max_attempts: usize, delay_between: Duration) {
+/// Wake display with retries (useful immediately after WoL).
+///
+/// With `skip_when_active`, a resume the user caused (keyboard/mouse input in
+/// the last `USER_ACTIVE_IDLE_MS`) only dismisses the screensaver and powers
+/// the monitor on: the F15 keypress could land in whatever they are already
+/// doing, and the sleep hold is pointless with someone at the desk.
+///
+/// Stops between attempts once `token` is stale: a later wake runs its own
+/// sequence, and after a sleep the keypresses and sleep hold must not run.
+pub(super) fn wake_display_with_retry(
+    max_attempts: usize,
+    delay_between: Duration,
+    skip_when_active: bool,
+    token: &WakeToken,
+) {
+    if skip_when_active && user_active() {
+        info!("WakeDisplay: recent user input, skipping keypress and sleep prevention");
+        dismiss_screensaver();
+        turn_on_monitor();
+        return;
+    }
+
     let attempts = max_attempts.max(1);
     info!(
         "WakeDisplay: Starting wake sequence with {} attempts",
@@ -99,6 +99,10 @@ pub fn wake_display_with_retry(max_attempts: usize, delay_between: Duration) {
     );
 
     for attempt in 1..=attempts {
+        if !token.is_current() {
+            info!("WakeDisplay: superseded by a later power event, stopping");
+            return;
+        }
         dismiss_screensaver();
         std::thread::sleep(Duration::from_millis(50));
         turn_on_monitor();
@@ -110,23 +114,45 @@ pub fn wake_display_with_retry(max_attempts: usize, delay_between: Duration) {
         }
     }
 
+    if !token.is_current() {
+        info!("WakeDisplay: superseded by a later power event, stopping");
+        return;
+    }
     prevent_sleep_temporary(Duration::from_secs(30));
     info!("WakeDisplay: Wake sequence completed");
 }
 
 /// Send SC_MONITORPOWER to turn on all monitors.
+fn turn_on_monitor() {
+    set_monitor_power(MONITOR_ON);
+}
+
+/// Turn all monitors off via SC_MONITORPOWER (lParam 2 = power off).
+pub fn monitor_off() {
+    info!("MonitorOff: turning displays off");
+    set_monitor_power(MONITOR_OFF);
+}
+
+/// Put all monitors in low-power standby via SC_MONITORPOWER (lParam 1).
+/// Monitors without a standby state treat it as off.
+pub fn monitor_standby() {
+    info!("MonitorStandby: putting displays in standby");
+    set_monitor_power(MONITOR_STANDBY);
+}
+
+/// Broadcast SC_MONITORPOWER with `level` as lParam.
 ///
 /// Uses SendMessageTimeoutW, not SendMessageW: a broadcast blocks until EVERY
 /// top-level window handles it, so one hung window (a frozen game) would park the
 /// caller forever. SMTO_ABORTIFHUNG skips hung windows; the 2s cap bounds the rest
 /// so we never permanently leak a blocking-pool thread.
-fn turn_on_monitor() {
+fn set_monitor_power(level: isize) {
     unsafe {
         SendMessageTimeoutW(
             HWND_BROADCAST,
             WM_SYSCOMMAND,
             WPARAM(SC_MONITORPOWER),
-            LPARAM(MONITOR_ON),
+            LPARAM(level),
             SMTO_ABORTIFHUNG | SMTO_BLOCK,
             2000,
             None,
@@ -134,20 +160,31 @@ fn turn_on_monitor() {
     }
 }
 
-/// Turn all monitors off via SC_MONITORPOWER (lParam 2 = power off).
-pub fn monitor_off() {
-    info!("MonitorOff: turning displays off");
-    unsafe {
-        SendMessageTimeoutW(
-            HWND_BROADCAST,
-            WM_SYSCOMMAND,
-            WPARAM(SC_MONITORPOWER),
-            LPARAM(MONITOR_OFF),
-            SMTO_ABORTIFHUNG | SMTO_BLOCK,
-            2000,
-            None,
-        );
+/// True when there was keyboard/mouse input in the last `USER_ACTIVE_IDLE_MS`.
+/// A failed query counts as not active, so the full wake sequence runs.
+fn user_active() -> bool {
+    use windows::Win32::System::SystemInformation::GetTickCount64;
+    use windows::Win32::UI::Input::KeyboardAndMouse::{GetLastInputInfo, LASTINPUTINFO};
+
+    let mut lii = LASTINPUTINFO {
+        cbSize: std::mem::size_of::<LASTINPUTINFO>() as u32,
+        dwTime: 0,
+    };
+    // SAFETY: lii is a stack out-struct with cbSize set.
+    if !unsafe { GetLastInputInfo(&raw mut lii) }.as_bool() {
+        return false;
     }
+    // dwTime is the low 32 bits of the millisecond tick count; match it.
+    let idle_ms = (unsafe { GetTickCount64() } as u32).wrapping_sub(lii.dwTime);
+    debug!("WakeDisplay: idle {}ms at resume", idle_ms);
+    idle_ms < USER_ACTIVE_IDLE_MS
+}
+
+/// Mark the user active now: the system idle timer (and with it `lastactive`
+/// and the screensaver countdown) restarts from zero.
+pub fn reset_idle() {
+    info!("ResetIdle: sending F15 to reset the idle timer");
+    send_benign_keypress();
 }
 
 /// Send F15 keypress to register user activity
@@ -184,6 +221,12 @@ fn prevent_sleep_temporary(duration: Duration) {
         SetThreadExecutionState,
     };
 
+    // The agent is stopping: don't start a hold nobody will release.
+    let (released, _) = &SLEEP_PREVENTION_RELEASED;
+    if *released.lock().unwrap_or_else(|e| e.into_inner()) {
+        return;
+    }
+
     // Only spawn one prevention thread at a time
     if SLEEP_PREVENTION_ACTIVE
         .compare_exchange(false, true, Ordering::SeqCst, Ordering::SeqCst)
@@ -206,7 +249,10 @@ fn prevent_sleep_temporary(duration: Duration) {
                     return;
                 }
 
-                std::thread::sleep(duration);
+                // Hold for `duration`, or until the agent stops.
+                let (released, cvar) = &SLEEP_PREVENTION_RELEASED;
+                let guard = released.lock().unwrap_or_else(|e| e.into_inner());
+                drop(cvar.wait_timeout_while(guard, duration, |released| !*released));
 
                 // Reset to allow sleep again
                 SetThreadExecutionState(ES_CONTINUOUS);
@@ -221,3 +267,17 @@ fn prevent_sleep_temporary(duration: Duration) {
         }
     }
 }
+
+/// End any sleep prevention early and wait (briefly) for its thread to reset
+/// the execution state, so a PC isn't kept awake by an agent that has exited
+/// mid-wake. Called on shutdown; blocking.
+pub fn release_sleep_prevention() {
+    let (released, cvar) = &SLEEP_PREVENTION_RELEASED;
+    *released.lock().unwrap_or_else(|e| e.into_inner()) = true;
+    cvar.notify_all();
+
+    let deadline = Instant::now() + SLEEP_PREVENTION_RELEASE_WAIT;
+    while SLEEP_PREVENTION_ACTIVE.load(Ordering::SeqCst) && Instant::now() < deadline {
+        std::thread::sleep(Duration::from_millis(10));
+    }
+}
@@ -26,6 +26,35 @@ pub fn wake_display() {
         let _ = Command::new("xdotool").args(["key", "shift"]).status();
         let _ = Command::new("xset").args(["dpms", "force", "on"]).status();
     }
+    dismiss_screensaver();
+
+    info!("WakeDisplay: Wake sequence completed");
+}
+
+/// Mark the user active now: a fake Shift tap on X11 (`xdotool` fallback).
+/// Wayland has no input injection for us, so it only resets the screensaver.
+pub fn reset_idle() {
+    info!("ResetIdle: resetting the idle timer (Linux)");
+    if crate::linux_wayland::is_wayland_session() {
+        let _ = Command::new("dbus-send")
+            .args([
+                "--session",
+                "--dest=org.freedesktop.ScreenSaver",
+                "--type=method_call",
+                "/org/freedesktop/ScreenSaver",
+                "org.freedesktop.ScreenSaver.SimulateUserActivity",
+            ])
+            .status();
+        return;
+    }
+    if !crate::linux_x11::reset_idle() {
+        let _ = Command::new("xdotool").args(["key", "shift"]).status();
+    }
+}
+
+/// Ask the session screensaver (GNOME/KDE D-Bus interface) to deactivate,
+/// without touching display power.
+pub fn dismiss_screensaver() {
     let _ = Command::new("dbus-send")
         .args([
             "--session",
@@ -36,8 +65,6 @@ pub fn wake_display() {
             "boolean:false",
         ])
         .status();
-
-    info!("WakeDisplay: Wake sequence completed");
 }
 
 /// Turn the display off (bundled X11 DPMS on X11 / wlr on Wayland, `xset` fallback).
@@ -54,3 +81,21 @@ pub fn monitor_off() {
         let _ = Command::new("xset").args(["dpms", "force", "off"]).status();
     }
 }
+
+/// Put the display in standby. wlr-output-power only knows on and off, so on
+/// Wayland this is the same as `monitor_off`.
+pub fn monitor_standby() {
+    info!("MonitorStandby: putting display in standby (Linux)");
+    let wayland = crate::linux_wayland::is_wayland_session();
+    if !wayland && crate::linux_x11::dpms_standby() {
+        return;
+    }
+    if crate::linux_wayland::set_dpms(false) {
+        return;
+    }
+    if !wayland {
+        let _ = Command::new("xset")
+            .args(["dpms", "force", "standby"])
+            .status();
+    }
+}
@@ -6,6 +6,13 @@
 //! Also monitors display power state via GUID_CONSOLE_DISPLAY_STATE to detect
 //! when Windows turns off the monitor (separate from screensaver).
 //!
+//! Suspend/resume arrive two ways, deduplicated by the state machine:
+//! `WM_POWERBROADCAST` to a hidden window, and a `RegisterSuspendResumeNotification`
+//! callback. The window only gets the broadcast if it is a real top-level window
+//! (see [`PowerEventListener::create_power_window`]); the callback doesn't depend
+//! on any window and keeps sleep/wake working on builds where the broadcast stops
+//! arriving.
+//!
 //! Sleep event publishing uses a **synchronous TCP connection** from the
 //! power-events thread to guarantee the MQTT PUBLISH packet reaches the
 //! broker before `wnd_proc` returns. The async event loop cannot provide
@@ -17,15 +24,20 @@ use std::sync::Arc;
 use std::sync::atomic::{AtomicU8, Ordering};
 use tokio::sync::mpsc;
 use windows::Win32::Foundation::{HANDLE, HWND, LPARAM, LRESULT, WPARAM};
-use windows::Win32::System::Power::RegisterPowerSettingNotification;
+use windows::Win32::System::Power::{
+    DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS, RegisterPowerSettingNotification,
+    RegisterSuspendResumeNotification, UnregisterSuspendResumeNotification,
+};
 use windows::Win32::UI::WindowsAndMessaging::{
     CreateWindowExW, DEVICE_NOTIFY_WINDOW_HANDLE, DefWindowProcW, DestroyWindow, DispatchMessageW,
-    GWLP_USERDATA, GetMessageW, GetWindowLongPtrW, MSG, PostMessageW, RegisterClassExW,
-    SetWindowLongPtrW, TranslateMessage, WINDOW_EX_STYLE, WINDOW_STYLE, WM_USER, WNDCLASSEXW,
+    GWLP_USERDATA, GetMessageW, GetWindowLongPtrW, MSG, PostMessageW, REGISTER_NOTIFICATION_FLAGS,
+    RegisterClassExW, SetWindowLongPtrW, TranslateMessage, WINDOW_EX_STYLE, WINDOW_STYLE, WM_USER,
+    WNDCLASSEXW,
 };
 
 use super::display::wake_display_with_retry;
-use super::sync_mqtt::{SyncMqttConfig, parse_broker_url, sync_mqtt_publish_sleep};
+use super::resume::WakeEpoch;
+use super::sync_mqtt::{SyncMqttConfig, sync_mqtt_publish_sleep};
 use crate::AppState;
 
 const WM_POWERBROADCAST: u32 = 0x218;
@@ -34,6 +46,14 @@ const PBT_APMRESUMEAUTO: usize = 0x12;
 const PBT_APMRESUMESUSPEND: usize = 7;
 const PBT_POWERSETTINGCHANGE: usize = 0x8013;
 
+/// How long shutdown waits for the message pump to unregister and exit. A
+/// wedged pump is logged and left behind rather than holding up the stop.
+const PUMP_STOP_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(1);
+
+/// `RegisterSuspendResumeNotification` flag: the recipient is a
+/// `DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS` callback rather than a window.
+const DEVICE_NOTIFY_CALLBACK: REGISTER_NOTIFICATION_FLAGS = REGISTER_NOTIFICATION_FLAGS(2);
+
 /// GUID_CONSOLE_DISPLAY_STATE: {6FE69556-704A-47A0-8F24-C28D936FDA47}
 /// Data values: 0 = off, 1 = on, 2 = dimmed
 const GUID_CONSOLE_DISPLAY_STATE: windows::core::GUID = windows::core::GUID::from_values(
@@ -43,6 +63,25 @@ const GUID_CONSOLE_DISPLAY_STATE: windows::core::GUID = windows::core::GUID::fro
     [0x8F, 0x24, 0xC2, 0x8D, 0x93, 0x6F, 0xDA, 0x47],
 );
 
+/// GUID_SYSTEM_AWAYMODE: {98A7F580-01F7-48AA-9C0F-44352C29E5C0}
+/// Data values: 1 = entering away mode, 0 = leaving it
+const GUID_SYSTEM_AWAYMODE: windows::core::GUID = windows::core::GUID::from_values(
+    0x98A7_F580,
+    0x01F7,
+    0x48AA,
+    [0x9C, 0x0F, 0x44, 0x35, 0x2C, 0x29, 0xE5, 0xC0],
+);
+
+/// GUID_LIDSWITCH_STATE_CHANGE: {BA3E0F4D-B817-4094-A2D1-D56379E6A0F3}
+/// Data values: 0 = closed, 1 = open. Sent once with the current state on
+/// registration; only laptops send it.
+const GUID_LIDSWITCH_STATE_CHANGE: windows::core::GUID = windows::core::GUID::from_values(
+    0xBA3E_0F4D,
+    0xB817,
+    0x4094,
+    [0xA2, 0xD1, 0xD5, 0x63, 0x79, 0xE6, 0xA0, 0xF3],
+);
+
 /// Layout of the POWERBROADCAST_SETTING structure from WM_POWERBROADCAST/PBT_POWERSETTINGCHANGE
 #[repr(C)]
 struct PowerBroadcastSetting {
@@ -57,9 +96,31 @@ pub enum PowerEvent {
     Wake,
     DisplayOff,
     DisplayOn,
+    /// Away mode entered (`true`) or left
+    AwayMode(bool),
+    /// Lid opened (`true`) or closed
+    Lid(bool),
 }
 
-/// Context stored in the power-monitor window's user data.
+/// Whether the machine is in standby without having suspended: away mode,
+/// or on a modern standby (S0 low power idle) system, display off. Those
+/// systems never send PBT_APMSUSPEND, so `sleep_state` stays "awake" with the
+/// lid shut; `away_mode` is the signal that they are effectively asleep.
+fn in_standby(away_mode: bool, display_off: bool, modern_standby: bool) -> bool {
+    away_mode || (modern_standby && display_off)
+}
+
+/// True on a modern standby (AOAC, "always on, always connected") system.
+fn supports_modern_standby() -> bool {
+    use windows::Win32::System::Power::{GetPwrCapabilities, SYSTEM_POWER_CAPABILITIES};
+
+    let mut caps = SYSTEM_POWER_CAPABILITIES::default();
+    // SAFETY: caps is a stack out-struct.
+    unsafe { GetPwrCapabilities(&raw mut caps).as_bool() && caps.AoAc.as_bool() }
+}
+
+/// Context stored in the power-monitor window's user data (and passed to the
+/// suspend/resume callback).
 struct WndProcContext {
     event_tx: mpsc::Sender<PowerEvent>,
     sync_mqtt: SyncMqttConfig,
@@ -101,33 +162,19 @@ impl PowerEventListener {
         // Build sync MQTT config for the power-events thread.
         // This lets wnd_proc publish the sleep message over a dedicated TCP
         // connection, independent of the async event loop.
-        let sync_mqtt = {
-            let config = self.state.config.read().await;
-            let broker = &config.mqtt.broker;
-            let (host, port, use_tls) = parse_broker_url(broker);
-            SyncMqttConfig {
-                host,
-                port,
-                use_tls,
-                user: config.mqtt.user.clone(),
-                pass: config.mqtt.pass.clone(),
-                // Use a distinct client_id so the broker doesn't kick our main connection
-                client_id: format!("{}-sleep", config.client_id()),
-                sleep_topic: format!(
-                    "homeassistant/sensor/{}/sleep_state/state",
-                    config.device_name
-                ),
-            }
-        };
+        let sync_mqtt = SyncMqttConfig::from_config(&*self.state.config.read().await);
 
         // Spawn blocking thread for Windows message pump
         // Store hwnd so we can post WM_QUIT on shutdown
         let (hwnd_tx, hwnd_rx) = tokio::sync::oneshot::channel::<isize>();
+        // Dropped when the pump thread returns, however it returns.
+        let (pump_done_tx, pump_done_rx) = tokio::sync::oneshot::channel::<()>();
 
         match std::thread::Builder::new()
             .name("power-events".into())
             .stack_size(256 * 1024)
             .spawn(move || {
+                let _done = pump_done_tx;
                 Self::message_pump(event_tx, sync_mqtt, hwnd_tx);
             }) {
             Ok(_) => {}
@@ -154,12 +201,34 @@ impl PowerEventListener {
             });
         }
 
-        // Handle events (no debouncing needed - state machine handles deduplication)
+        let modern_standby = supports_modern_standby();
+        info!("Modern standby (S0 low power idle): {}", modern_standby);
+        let mut away_mode = false;
+        let mut display_off = false;
+        let mut standby = false;
+        // Last lid state; None until the report Windows sends on registration,
+        // which is the current state rather than a change.
+        let mut lid_open: Option<bool> = None;
+
+        // The latest wake's "awake" republish task, kept to abort at shutdown.
+        let mut awake_retries: Option<tokio::task::JoinHandle<()>> = None;
+        // Every sleep and handled wake advances this. The work a wake starts
+        // (display wake sequence, "awake" retries) stops once its token is
+        // stale: after a quick suspend/resume blip the retries would otherwise
+        // overwrite "sleeping", and a second wake restarts the sequence rather
+        // than running alongside the first.
+        let epoch = WakeEpoch::default();
+
+        // Handle events (no debouncing needed - the state machine in
+        // handle_power_broadcast drops a second resume for the same suspend).
         loop {
             tokio::select! {
                 biased;
                 _ = shutdown_rx.recv() => {
                     debug!("Power listener shutting down");
+                    if let Some(retries) = awake_retries.take() {
+                        retries.abort();
+                    }
                     // Post WM_QUIT to unblock GetMessageW
                     if let Some(hwnd_val) = pump_hwnd {
                         unsafe {
@@ -167,51 +236,106 @@ impl PowerEventListener {
                             let _ = PostMessageW(hwnd, WM_USER, WPARAM(0), LPARAM(0));
                         }
                     }
+                    // Bounded: a pump stuck in a hung DispatchMessageW must not
+                    // keep the service in StopPending.
+                    if tokio::time::timeout(PUMP_STOP_TIMEOUT, pump_done_rx).await.is_err() {
+                        warn!(
+                            "Power listener: message pump did not exit within {}s, abandoning it",
+                            PUMP_STOP_TIMEOUT.as_secs()
+                        );
+                    }
                     break;
                 }
                 Some(event) = event_rx.recv() => {
                     match event {
                         PowerEvent::Sleep => {
                             info!("Power event: SLEEP (async fallback - sync TCP already attempted in wnd_proc)");
+                            epoch.advance();
                             // Fallback publish via the async client. Harmless if the
                             // sync TCP publish already landed (retained = last-write-wins).
                             // Catches cases where sync fails (TLS broker, Modern Standby, etc.).
                             self.state.mqtt.publish_sensor_retained("sleep_state", "sleeping").await;
+                            self.trigger("went_to_sleep").await;
                         }
                         PowerEvent::Wake => {
                             info!("Power event: WAKE");
+                            let token = epoch.advance();
+                            if self.state.config.read().await.reconnect_on_wake {
+                                self.state.mqtt.reconnect_now();
+                            }
                             // Wake display on blocking thread to avoid stalling async runtime
-                            tokio::task::spawn_blocking(|| {
-                                wake_display_with_retry(3, std::time::Duration::from_millis(500));
+                            let skip_when_active = self.state.config.read().await.wake_skip_when_active;
+                            let display_token = token.clone();
+                            tokio::task::spawn_blocking(move || {
+                                wake_display_with_retry(
+                                    3,
+                                    std::time::Duration::from_millis(500),
+                                    skip_when_active,
+                                    &display_token,
+                                );
                             });
 
                             // Publish wake state with retries in background task
                             // so the event handler stays responsive to new events
                             let mqtt = &self.state.mqtt;
                             mqtt.publish_sensor_retained("sleep_state", "awake").await;
-                            info!("Published awake state");
+                            debug!("Published awake state");
+                            self.trigger("woke").await;
                             let state = Arc::clone(&self.state);
-                            tokio::spawn(async move {
+                            awake_retries = Some(tokio::spawn(async move {
                                 for delay_secs in [2, 5, 10] {
                                     tokio::time::sleep(std::time::Duration::from_secs(delay_secs)).await;
+                                    if !token.is_current() {
+                                        debug!("Awake republish superseded by a later power event");
+                                        return;
+                                    }
                                     state.mqtt.publish_sensor_retained("sleep_state", "awake").await;
                                 }
-                            });
+                            }));
                         }
                         PowerEvent::DisplayOff => {
                             info!("Power event: DISPLAY OFF");
+                            display_off = true;
                             self.state.mqtt.publish_sensor_retained("display", "off").await;
                         }
                         PowerEvent::DisplayOn => {
                             info!("Power event: DISPLAY ON");
+                            display_off = false;
                             self.state.mqtt.publish_sensor_retained("display", "on").await;
                         }
+                        PowerEvent::AwayMode(on) => {
+                            info!("Power event: AWAY MODE {}", if on { "ON" } else { "OFF" });
+                            away_mode = on;
+                        }
+                        PowerEvent::Lid(open) => {
+                            if lid_open.is_some_and(|was_open| was_open != open) {
+                                info!("Power event: LID {}", if open { "OPENED" } else { "CLOSED" });
+                                self.trigger(if open { "lid_opened" } else { "lid_closed" }).await;
+                            }
+                            lid_open = Some(open);
+                        }
+                    }
+                    let now = in_standby(away_mode, display_off, modern_standby);
+                    if now != standby {
+                        standby = now;
+                        info!("Standby without suspend: {}", standby);
+                        self.state
+                            .mqtt
+                            .publish_sensor_retained("away_mode", if standby { "on" } else { "off" })
+                            .await;
                     }
                 }
             }
         }
     }
 
+    /// Fire a device trigger, if `device_triggers` is on.
+    async fn trigger(&self, name: &str) {
+        if self.state.config.read().await.features.device_triggers {
+            self.state.mqtt.fire_trigger(name).await;
+        }
+    }
+
     fn message_pump(
         event_tx: mpsc::Sender<PowerEvent>,
         sync_mqtt: SyncMqttConfig,
@@ -229,21 +353,7 @@ impl PowerEventListener {
 
             RegisterClassExW(&raw const wc);
 
-            // Create a real window to receive power broadcasts
-            let hwnd = match CreateWindowExW(
-                WINDOW_EX_STYLE::default(),
-                class_name,
-                windows::core::w!("PC Agent Power Monitor"),
-                WINDOW_STYLE::default(),
-                0,
-                0,
-                0,
-                0,
-                None,
-                None,
-                None,
-                None,
-            ) {
+            let hwnd = match Self::create_power_window(class_name) {
                 Ok(h) => h,
                 Err(e) => {
                     error!("Failed to create power monitor window: {:?}", e);
@@ -261,6 +371,20 @@ impl PowerEventListener {
             } else {
                 info!("Registered for display power state notifications");
             }
+            if let Err(e) = RegisterPowerSettingNotification(
+                HANDLE(hwnd.0),
+                &GUID_SYSTEM_AWAYMODE,
+                DEVICE_NOTIFY_WINDOW_HANDLE,
+            ) {
+                warn!("Failed to register away mode notification: {:?}", e);
+            }
+            if let Err(e) = RegisterPowerSettingNotification(
+                HANDLE(hwnd.0),
+                &GUID_LIDSWITCH_STATE_CHANGE,
+                DEVICE_NOTIFY_WINDOW_HANDLE,
+            ) {
+                debug!("Failed to register lid switch notification: {:?}", e);
+            }
 
             // Store context (event_tx + sync mqtt config) in window's user data
             let ctx = Box::new(WndProcContext {
@@ -270,6 +394,30 @@ impl PowerEventListener {
             let ctx_ptr = Box::into_raw(ctx);
             SetWindowLongPtrW(hwnd, GWLP_USERDATA, ctx_ptr as isize);
 
+            // Suspend/resume callback, independent of the window. Windows keeps
+            // the recipient pointer, so the parameters live until unregistered.
+            let params = Box::into_raw(Box::new(DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS {
+                Callback: Some(Self::suspend_resume_callback),
+                Context: ctx_ptr.cast(),
+            }));
+            let suspend_resume = match RegisterSuspendResumeNotification(
+                HANDLE(params.cast()),
+                DEVICE_NOTIFY_CALLBACK,
+            ) {
+                Ok(h) => {
+                    info!("Registered suspend/resume callback");
+                    Some(h)
+                }
+                Err(e) => {
+                    // Pre-Windows 8: the window broadcast is all there is.
+                    warn!(
+                        "Suspend/resume callback unavailable, relying on WM_POWERBROADCAST: {:?}",
+                        e
+                    );
+                    None
+                }
+            };
+
             info!("Power event listener started (hwnd: {:?})", hwnd);
 
             // Send hwnd back so async side can post WM_USER to unblock GetMessageW
@@ -291,12 +439,60 @@ impl PowerEventListener {
                 DispatchMessageW(&raw const msg);
             }
 
-            // Cleanup
+            // Cleanup: unregister before freeing what the callback points at.
+            if let Some(h) = suspend_resume {
+                let _ = UnregisterSuspendResumeNotification(h);
+            }
+            let _ = Box::from_raw(params);
             let _ = Box::from_raw(ctx_ptr);
             let _ = DestroyWindow(hwnd);
         }
     }
 
+    /// Create the hidden window that receives `WM_POWERBROADCAST`.
+    ///
+    /// It must be a real top-level window: no parent, and in particular NOT a
+    /// message-only window (`HWND_MESSAGE` parent). Message-only windows are
+    /// skipped by broadcasts, so they never see suspend/resume or display
+    /// power changes. No `WS_VISIBLE` and a zero size keep it invisible; it
+    /// doesn't need to be shown to receive broadcasts.
+    unsafe fn create_power_window(
+        class_name: windows::core::PCWSTR,
+    ) -> windows::core::Result<HWND> {
+        unsafe {
+            CreateWindowExW(
+                WINDOW_EX_STYLE::default(),
+                class_name,
+                windows::core::w!("PC Agent Power Monitor"),
+                WINDOW_STYLE::default(),
+                0,
+                0,
+                0,
+                0,
+                None, // parent: none -> top-level (never HWND_MESSAGE)
+                None,
+                None,
+                None,
+            )
+        }
+    }
+
+    /// `RegisterSuspendResumeNotification` callback. `context` is the
+    /// `WndProcContext`; `setting` is unused for suspend/resume events.
+    unsafe extern "system" fn suspend_resume_callback(
+        context: *const core::ffi::c_void,
+        event: u32,
+        _setting: *const core::ffi::c_void,
+    ) -> u32 {
+        // SAFETY: context is the ctx_ptr registered in message_pump, which is
+        // only freed after the callback is unregistered.
+        if let Some(ctx) = unsafe { context.cast::<WndProcContext>().as_ref() } {
+            debug!("Suspend/resume callback (event={})", event);
+            unsafe { Self::handle_power_broadcast(ctx, event as usize, std::ptr::null()) };
+        }
+        0 // ERROR_SUCCESS
+    }
+
     unsafe extern "system" fn wnd_proc(
         hwnd: HWND,
         msg: u32,
@@ -307,82 +503,114 @@ impl PowerEventListener {
             if msg == WM_POWERBROADCAST {
                 let ctx_ptr = GetWindowLongPtrW(hwnd, GWLP_USERDATA) as *const WndProcContext;
 
-                if !ctx_ptr.is_null() {
-                    let ctx = &*ctx_ptr;
-
-                    match wparam.0 {
-                        PBT_APMSUSPEND => {
-                            debug!("Received PBT_APMSUSPEND");
-                            // Only fire if transitioning from awake to sleeping
-                            if try_transition_to_sleep() {
-                                info!("State transition: awake -> sleeping");
-                                // Synchronous MQTT publish over a dedicated TCP connection.
-                                // This blocks wnd_proc until the packet is on the wire,
-                                // guaranteeing delivery before Windows suspends the NIC.
-                                match sync_mqtt_publish_sleep(&ctx.sync_mqtt) {
-                                    Ok(()) => info!("Sleep state published via sync TCP"),
-                                    Err(e) => warn!("Sync MQTT publish failed: {}", e),
-                                }
-                                // Also notify the async handler (redundant publish + logging)
-                                let _ = ctx.event_tx.blocking_send(PowerEvent::Sleep);
-                            } else {
-                                debug!("Ignoring duplicate sleep event");
-                            }
+                if let Some(ctx) = ctx_ptr.as_ref() {
+                    Self::handle_power_broadcast(
+                        ctx,
+                        wparam.0,
+                        lparam.0 as *const PowerBroadcastSetting,
+                    );
+                }
+            }
+
+            DefWindowProcW(hwnd, msg, wparam, lparam)
+        }
+    }
+
+    /// Handle one power event, from either the window broadcast or the
+    /// suspend/resume callback. `setting` is only read for
+    /// `PBT_POWERSETTINGCHANGE` and may be null.
+    unsafe fn handle_power_broadcast(
+        ctx: &WndProcContext,
+        event: usize,
+        setting: *const PowerBroadcastSetting,
+    ) {
+        unsafe {
+            match event {
+                PBT_APMSUSPEND => {
+                    debug!("Received PBT_APMSUSPEND");
+                    // Only fire if transitioning from awake to sleeping
+                    if try_transition_to_sleep() {
+                        info!("State transition: awake -> sleeping");
+                        // Synchronous MQTT publish over a dedicated TCP connection.
+                        // This blocks the caller (wnd_proc or the callback) until the
+                        // packet is on the wire, guaranteeing delivery before Windows
+                        // suspends the NIC.
+                        match sync_mqtt_publish_sleep(&ctx.sync_mqtt) {
+                            Ok(()) => info!("Sleep state published via sync TCP"),
+                            Err(e) => warn!("Sync MQTT publish failed: {}", e),
                         }
-                        PBT_APMRESUMEAUTO | PBT_APMRESUMESUSPEND => {
-                            debug!("Received PBT_APMRESUME* (wparam={})", wparam.0);
-                            // Only fire if transitioning from sleeping to awake
-                            if try_transition_to_awake() {
-                                info!("State transition: sleeping -> awake");
-                                let _ = ctx.event_tx.blocking_send(PowerEvent::Wake);
-                            } else {
-                                debug!("Ignoring duplicate wake event");
+                        // Also notify the async handler (redundant publish + logging)
+                        let _ = ctx.event_tx.blocking_send(PowerEvent::Sleep);
+                    } else {
+                        debug!("Ignoring duplicate sleep event");
+                    }
+                }
+                PBT_APMRESUMEAUTO | PBT_APMRESUMESUSPEND => {
+                    debug!("Received PBT_APMRESUME* (event={})", event);
+                    // Only fire if transitioning from sleeping to awake
+                    if try_transition_to_awake() {
+                        info!("State transition: sleeping -> awake");
+                        let _ = ctx.event_tx.blocking_send(PowerEvent::Wake);
+                    } else {
+                        debug!("Ignoring duplicate wake event");
+                    }
+                }
+                PBT_POWERSETTINGCHANGE => {
+                    if let Some(setting) = setting.as_ref()
+                        && setting.power_setting == GUID_SYSTEM_AWAYMODE
+                        && setting.data_length >= 1
+                    {
+                        let on = setting.data[0] != 0;
+                        debug!("Away mode change: {}", on);
+                        let _ = ctx.event_tx.blocking_send(PowerEvent::AwayMode(on));
+                        return;
+                    }
+                    if let Some(setting) = setting.as_ref()
+                        && setting.power_setting == GUID_LIDSWITCH_STATE_CHANGE
+                        && setting.data_length >= 1
+                    {
+                        let open = setting.data[0] != 0;
+                        debug!(
+                            "Lid switch change: {}",
+                            if open { "open" } else { "closed" }
+                        );
+                        let _ = ctx.event_tx.blocking_send(PowerEvent::Lid(open));
+                        return;
+                    }
+                    // Display power state change notification
+                    if let Some(setting) = setting.as_ref()
+                        && setting.power_setting == GUID_CONSOLE_DISPLAY_STATE
+                        && setting.data_length >= 1
+                    {
+                        let display_state = setting.data[0];
+                        debug!(
+                            "Display power state change: {}",
+                            match display_state {
+                                0 => "off",
+                                1 => "on",
+                                2 => "dimmed",
+                                _ => "unknown",
                             }
-                        }
-                        PBT_POWERSETTINGCHANGE => {
-                            // Display power state change notification
-                            let pbs = lparam.0 as *const PowerBroadcastSetting;
-                            if !pbs.is_null() {
-                                let setting = &*pbs;
-                                if setting.power_setting == GUID_CONSOLE_DISPLAY_STATE
-                                    && setting.data_length >= 1
-                                {
-                                    let display_state = setting.data[0];
-                                    debug!(
-                                        "Display power state change: {}",
-                                        match display_state {
-                                            0 => "off",
-                                            1 => "on",
-                                            2 => "dimmed",
-                                            _ => "unknown",
-                                        }
-                                    );
-                                    match display_state {
-                                        0 => {
-                                            let _ =
-                                                ctx.event_tx.blocking_send(PowerEvent::DisplayOff);
-                                        }
-                                        1 => {
-                                            let _ =
-                                                ctx.event_tx.blocking_send(PowerEvent::DisplayOn);
-                                        }
-                                        2 => {
-                                            // Dimmed - treat as still on (display is visible)
-                                            debug!("Display dimmed, treating as on");
-                                        }
-                                        _ => {
-                                            debug!("Unknown display state: {}", display_state);
-                                        }
-                                    }
-                                }
+                        );
+                        match display_state {
+                            0 => {
+                                let _ = ctx.event_tx.blocking_send(PowerEvent::DisplayOff);
+                            }
+                            1 => {
+                                let _ = ctx.event_tx.blocking_send(PowerEvent::DisplayOn);
+                            }
+                            2 => {
+                                // Dimmed - treat as still on (display is visible)
+                                debug!("Display dimmed, treating as on");
+                            }
+                            _ => {
+                                debug!("Unknown display state: {}", display_state);
                             }
                         }
-                        _ => {}
                     }
                 }
+                _ => {}
             }
-
-            DefWindowProcW(hwnd, msg, wparam, lparam)
         }
     }
 }
@@ -391,6 +619,36 @@ impl PowerEventListener {
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_power_window_is_top_level() {
+        use windows::Win32::UI::WindowsAndMessaging::{GA_PARENT, GetAncestor, GetDesktopWindow};
+
+        // WM_POWERBROADCAST only reaches top-level windows: the power window's
+        // parent must be the desktop, not the message-only root (HWND_MESSAGE).
+        unsafe {
+            let class_name = windows::core::w!("PCAgentPowerMonitorTest");
+            let wc = WNDCLASSEXW {
+                cbSize: std::mem::size_of::<WNDCLASSEXW>() as u32,
+                lpfnWndProc: Some(PowerEventListener::wnd_proc),
+                lpszClassName: class_name,
+                ..Default::default()
+            };
+            RegisterClassExW(&raw const wc);
+            let hwnd = PowerEventListener::create_power_window(class_name).unwrap();
+            assert_eq!(GetAncestor(hwnd, GA_PARENT), GetDesktopWindow());
+            let _ = DestroyWindow(hwnd);
+        }
+    }
+
+    #[test]
+    fn test_in_standby() {
+        assert!(in_standby(true, false, false));
+        assert!(in_standby(false, true, true));
+        // A desktop with its monitor off is just idle.
+        assert!(!in_standby(false, true, false));
+        assert!(!in_standby(false, false, true));
+    }
+
     #[test]
     fn test_state_machine_transitions() {
         // Reset to known state
@@ -398,8 +656,15 @@ mod tests {
 
         assert!(try_transition_to_sleep());
         assert!(!try_transition_to_sleep()); // duplicate
+        // PBT_APMRESUMEAUTO then PBT_APMRESUMESUSPEND for the same suspend:
+        // only the first reaches the async side.
         assert!(try_transition_to_awake());
         assert!(!try_transition_to_awake()); // duplicate
+        // A resume with no sleep before it is dropped too.
+        assert!(!try_transition_to_awake());
+        // The next suspend/resume is a real one again.
+        assert!(try_transition_to_sleep());
+        assert!(try_transition_to_awake());
 
         // Reset for other tests
         POWER_STATE.store(0, Ordering::SeqCst);
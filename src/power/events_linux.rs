@@ -15,7 +15,7 @@ use std::sync::atomic::{AtomicBool, Ordering};
 use std::sync::{Arc, Mutex};
 
 use crate::AppState;
-use crate::power::sync_mqtt::{SyncMqttConfig, parse_broker_url, sync_mqtt_publish_sleep};
+use crate::power::sync_mqtt::{SyncMqttConfig, sync_mqtt_publish_sleep};
 
 /// Power-related events from D-Bus monitor threads
 enum PowerEvent {
@@ -155,22 +155,7 @@ impl PowerEventListener {
                             // Guaranteed-delivery sync publish (fresh TCP) before we
                             // release the inhibitor and the system suspends. Offloaded
                             // so the blocking connect doesn't stall the runtime.
-                            let cfg = {
-                                let config = self.state.config.read().await;
-                                let (host, port, use_tls) = parse_broker_url(&config.mqtt.broker);
-                                SyncMqttConfig {
-                                    host,
-                                    port,
-                                    use_tls,
-                                    user: config.mqtt.user.clone(),
-                                    pass: config.mqtt.pass.clone(),
-                                    client_id: format!("{}-sleep", config.client_id()),
-                                    sleep_topic: format!(
-                                        "homeassistant/sensor/{}/sleep_state/state",
-                                        config.device_name
-                                    ),
-                                }
-                            };
+                            let cfg = SyncMqttConfig::from_config(&*self.state.config.read().await);
                             match tokio::task::spawn_blocking(move || sync_mqtt_publish_sleep(&cfg))
                                 .await
                             {
@@ -179,13 +164,18 @@ impl PowerEventListener {
                                 Err(e) => warn!("Sync publish task join error: {}", e),
                             }
                             self.state.mqtt.publish_sensor_retained("sleep_state", "sleeping").await;
+                            self.trigger("went_to_sleep").await;
                             // Drop the fd to release the delay-inhibitor: logind now
                             // proceeds to suspend.
                             drop(sleep_inhibitor.take());
                         }
                         PowerEvent::Wake => {
                             info!("Power event: WAKE");
+                            if self.state.config.read().await.reconnect_on_wake {
+                                self.state.mqtt.reconnect_now();
+                            }
                             self.state.mqtt.publish_sensor_retained("sleep_state", "awake").await;
+                            self.trigger("woke").await;
                             // Re-arm the inhibitor for the next suspend, off the
                             // runtime (the D-Bus connect+call is blocking).
                             sleep_inhibitor = tokio::task::spawn_blocking(Self::take_sleep_inhibitor)
@@ -207,6 +197,13 @@ impl PowerEventListener {
         }
     }
 
+    /// Fire a device trigger, if `device_triggers` is on.
+    async fn trigger(&self, name: &str) {
+        if self.state.config.read().await.features.device_triggers {
+            self.state.mqtt.fire_trigger(name).await;
+        }
+    }
+
     /// Blocking thread: runs `gdbus monitor` and parses PrepareForSleep signals.
     ///
     /// Signal format:
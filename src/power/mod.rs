@@ -4,6 +4,8 @@
 #[cfg_attr(not(windows), allow(dead_code))]
 pub mod sync_mqtt;
 
+mod resume;
+
 #[cfg(windows)]
 mod display;
 #[cfg(windows)]
@@ -15,11 +17,16 @@ mod display_linux;
 mod events_linux;
 
 #[cfg(windows)]
-pub use display::{monitor_off, wake_display};
+pub use display::{
+    dismiss_screensaver, monitor_off, monitor_standby, release_sleep_prevention, reset_idle,
+    wake_display,
+};
 #[cfg(windows)]
 pub use events::PowerEventListener;
 
 #[cfg(unix)]
-pub use display_linux::{monitor_off, wake_display};
+pub use display_linux::{
+    dismiss_screensaver, monitor_off, monitor_standby, reset_idle, wake_display,
+};
 #[cfg(unix)]
 pub use events_linux::PowerEventListener;
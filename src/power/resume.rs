@@ -0,0 +1,65 @@
+//! Resume handling for the power listener.
+//!
+//! A wake reported twice (PBT_APMRESUMEAUTO and PBT_APMRESUMESUSPEND for one
+//! suspend) is already dropped by the sleeping/awake state machine in
+//! `events.rs`. Past that, the latest sleep/wake wins: each one advances a
+//! [`WakeEpoch`], and the work an earlier wake started (the display wake
+//! sequence on a blocking thread, the "awake" republish task) checks its
+//! [`WakeToken`] and stops once it's stale. One guard covers both, so a
+//! second wake during a long wake sequence restarts it instead of being
+//! dropped or running alongside it, and a sleep stops it.
+
+use std::sync::Arc;
+use std::sync::atomic::{AtomicU64, Ordering};
+
+/// Counts sleep/wake events; owned by the power listener. (Linux starts no
+/// background wake work, so only the Windows listener needs one.)
+#[cfg_attr(not(windows), allow(dead_code))]
+#[derive(Debug, Default)]
+pub(crate) struct WakeEpoch(Arc<AtomicU64>);
+
+#[cfg_attr(not(windows), allow(dead_code))]
+impl WakeEpoch {
+    /// Start a new epoch for a sleep or a handled wake, superseding every
+    /// earlier token.
+    pub(crate) fn advance(&self) -> WakeToken {
+        WakeToken {
+            epoch: Arc::clone(&self.0),
+            generation: self.0.fetch_add(1, Ordering::SeqCst) + 1,
+        }
+    }
+}
+
+/// Handed to the work one wake starts; cheap to check between steps.
+#[cfg_attr(not(windows), allow(dead_code))]
+#[derive(Debug, Clone)]
+pub(crate) struct WakeToken {
+    epoch: Arc<AtomicU64>,
+    generation: u64,
+}
+
+#[cfg_attr(not(windows), allow(dead_code))]
+impl WakeToken {
+    /// False once a later sleep or wake has arrived.
+    pub(crate) fn is_current(&self) -> bool {
+        self.epoch.load(Ordering::SeqCst) == self.generation
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_latest_wake_wins() {
+        let epoch = WakeEpoch::default();
+        let first = epoch.advance();
+        assert!(first.is_current());
+        let second = epoch.advance();
+        assert!(!first.is_current());
+        assert!(second.is_current());
+        // A sleep supersedes the wake before it too.
+        let _sleep = epoch.advance();
+        assert!(!second.is_current());
+    }
+}
@@ -8,6 +8,7 @@
 //! All functions are platform-independent and compiled on every target so
 //! that the full test suite runs on macOS/Linux CI as well as Windows.
 
+use log::warn;
 use std::io::{Read, Write};
 use std::net::{SocketAddr, TcpStream, ToSocketAddrs};
 use std::time::Duration;
@@ -23,6 +24,40 @@ pub struct SyncMqttConfig {
     pub pass: String,
     pub client_id: String,
     pub sleep_topic: String,
+    /// TLS config presenting `mqtt.client_cert`, the same identity as the main
+    /// connection. None uses plain native-tls with no client certificate.
+    pub client_tls: Option<crate::mqtt::ClientTlsConfig>,
+}
+
+impl SyncMqttConfig {
+    /// Settings for the main broker in `config`. A blank broker is resolved
+    /// over mDNS, which can block; call this off the runtime or with the
+    /// broker already cached.
+    pub fn from_config(config: &crate::config::Config) -> Self {
+        let (host, port, use_tls) = parse_broker_url(&config.mqtt.broker_url());
+        let client_tls = if use_tls {
+            crate::mqtt::MqttClient::client_tls(&config.mqtt).unwrap_or_else(|e| {
+                warn!("Sync MQTT publish: client certificate unavailable: {e}");
+                None
+            })
+        } else {
+            None
+        };
+        Self {
+            host,
+            port,
+            use_tls,
+            user: config.mqtt.user.clone(),
+            pass: config.mqtt.pass.clone(),
+            // A distinct client_id so the broker doesn't kick our main connection
+            client_id: format!("{}-sleep", config.client_id()),
+            sleep_topic: format!(
+                "homeassistant/sensor/{}/sleep_state/state",
+                config.device_name
+            ),
+            client_tls,
+        }
+    }
 }
 
 /// Parse a broker URL like "tcp://host:port" into (host, port, use_tls).
@@ -75,6 +110,12 @@ pub fn parse_broker_url(url: &str) -> (String, u16, bool) {
 /// that the PUBLISH packet is guaranteed to be on the wire before `wnd_proc`
 /// returns and the OS powers down the NIC.
 pub fn sync_mqtt_publish_sleep(cfg: &SyncMqttConfig) -> std::io::Result<()> {
+    sync_mqtt_publish_state(cfg, b"sleeping")
+}
+
+/// Publish `state` (retained) to the sleep_state topic the same way, for other
+/// announcements that must land before the machine goes down (`shutting_down`).
+pub fn sync_mqtt_publish_state(cfg: &SyncMqttConfig, state: &[u8]) -> std::io::Result<()> {
     let addr = format!("{}:{}", cfg.host, cfg.port);
     let timeout = Duration::from_secs(2);
 
@@ -89,6 +130,19 @@ pub fn sync_mqtt_publish_sleep(cfg: &SyncMqttConfig) -> std::io::Result<()> {
     stream.set_read_timeout(Some(timeout))?;
     stream.set_nodelay(true)?;
 
+    #[cfg(windows)]
+    if cfg.use_tls
+        && let Some(client_tls) = &cfg.client_tls
+    {
+        let server_name = rustls::pki_types::ServerName::try_from(cfg.host.clone())
+            .map_err(|e| std::io::Error::new(std::io::ErrorKind::InvalidInput, e))?;
+        let conn = rustls::ClientConnection::new(client_tls.clone(), server_name)
+            .map_err(|e| std::io::Error::other(format!("TLS init failed: {e}")))?;
+        // The handshake runs on the first write, inside the exchange.
+        let mut tls_stream = rustls::StreamOwned::new(conn, stream);
+        return do_mqtt_exchange(&mut tls_stream, cfg, state);
+    }
+
     if cfg.use_tls {
         let connector = native_tls::TlsConnector::new()
             .map_err(|e| std::io::Error::other(format!("TLS init failed: {e}")))?;
@@ -98,10 +152,10 @@ pub fn sync_mqtt_publish_sleep(cfg: &SyncMqttConfig) -> std::io::Result<()> {
                 format!("TLS handshake failed: {e}"),
             )
         })?;
-        do_mqtt_exchange(&mut tls_stream, cfg)
+        do_mqtt_exchange(&mut tls_stream, cfg, state)
     } else {
         let mut stream = stream;
-        do_mqtt_exchange(&mut stream, cfg)
+        do_mqtt_exchange(&mut stream, cfg, state)
     }
 }
 
@@ -131,7 +185,11 @@ fn resolve_timeout(addr: &str, timeout: Duration) -> std::io::Result<SocketAddr>
 
 /// Perform the MQTT CONNECT/CONNACK/PUBLISH/DISCONNECT exchange over any
 /// Read+Write stream (plain TCP or TLS-wrapped).
-fn do_mqtt_exchange(stream: &mut (impl Read + Write), cfg: &SyncMqttConfig) -> std::io::Result<()> {
+fn do_mqtt_exchange(
+    stream: &mut (impl Read + Write),
+    cfg: &SyncMqttConfig,
+    state: &[u8],
+) -> std::io::Result<()> {
     // --- CONNECT ---
     let connect = build_mqtt_connect(&cfg.client_id, &cfg.user, &cfg.pass);
     stream.write_all(&connect)?;
@@ -154,7 +212,7 @@ fn do_mqtt_exchange(stream: &mut (impl Read + Write), cfg: &SyncMqttConfig) -> s
     }
 
     // --- PUBLISH (QoS 0, retained) ---
-    let publish = build_mqtt_publish(&cfg.sleep_topic, b"sleeping", true);
+    let publish = build_mqtt_publish(&cfg.sleep_topic, state, true);
     stream.write_all(&publish)?;
     stream.flush()?;
 
@@ -531,6 +589,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-sleep".into(),
                 sleep_topic: "homeassistant/sensor/test-pc/sleep_state/state".into(),
+                client_tls: None,
             };
 
             let broker_handle = std::thread::spawn(move || run_mini_broker(listener));
@@ -548,6 +607,33 @@ mod tests {
             assert!(received[0].retain, "Sleep message must be retained");
         }
 
+        #[test]
+        fn sync_publish_state_delivers_shutting_down() {
+            let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+            let port = listener.local_addr().unwrap().port();
+
+            let cfg = SyncMqttConfig {
+                host: "127.0.0.1".into(),
+                port,
+                use_tls: false,
+                user: String::new(),
+                pass: String::new(),
+                client_id: "test-shutdown".into(),
+                sleep_topic: "homeassistant/sensor/test-pc/sleep_state/state".into(),
+                client_tls: None,
+            };
+
+            let broker_handle = std::thread::spawn(move || run_mini_broker(listener));
+
+            let result = sync_mqtt_publish_state(&cfg, b"shutting_down");
+            assert!(result.is_ok(), "sync publish failed: {:?}", result.err());
+
+            let received = broker_handle.join().unwrap();
+            assert_eq!(received.len(), 1, "Expected 1 publish, got {received:?}");
+            assert_eq!(received[0].payload, b"shutting_down");
+            assert!(received[0].retain, "shutting_down must be retained");
+        }
+
         #[test]
         fn sync_publish_with_auth() {
             let listener = TcpListener::bind("127.0.0.1:0").unwrap();
@@ -561,6 +647,7 @@ mod tests {
                 pass: "testpass".into(),
                 client_id: "test-auth".into(),
                 sleep_topic: "test/sleep".into(),
+                client_tls: None,
             };
 
             let broker_handle = std::thread::spawn(move || run_mini_broker(listener));
@@ -591,6 +678,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-fail".into(),
                 sleep_topic: "test/sleep".into(),
+                client_tls: None,
             };
 
             let result = sync_mqtt_publish_sleep(&cfg);
@@ -616,6 +704,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-timing".into(),
                 sleep_topic: "test/timing".into(),
+                client_tls: None,
             };
 
             let start = std::time::Instant::now();
@@ -688,6 +777,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-nic-death".into(),
                 sleep_topic: "test/nic-death".into(),
+                client_tls: None,
             };
 
             let result = sync_mqtt_publish_sleep(&cfg);
@@ -747,6 +837,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-reject".into(),
                 sleep_topic: "test/sleep".into(),
+                client_tls: None,
             };
 
             let result = sync_mqtt_publish_sleep(&cfg);
@@ -785,6 +876,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-bad-connack".into(),
                 sleep_topic: "test/sleep".into(),
+                client_tls: None,
             };
 
             let result = sync_mqtt_publish_sleep(&cfg);
@@ -822,6 +914,7 @@ mod tests {
                 pass: String::new(),
                 client_id: "test-wrong-type".into(),
                 sleep_topic: "test/sleep".into(),
+                client_tls: None,
             };
 
             let result = sync_mqtt_publish_sleep(&cfg);
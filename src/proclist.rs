@@ -0,0 +1,262 @@
+//! Process list helpers shared by the single-instance check, the process
+//! watcher, screensaver dismissal, `SetPriority`, `MoveWindow`,
+//! `RestartExplorer`, `Logoff` and the fullscreen sensor.
+//!
+//! Windows code takes one ToolHelp snapshot via [`snapshot`]; the matching on
+//! top of it is plain data so it can be tested with a fake process list.
+#![cfg_attr(not(windows), allow(dead_code))]
+
+use std::path::Path;
+
+/// Exe names earlier releases shipped under; instances running under any of
+/// them are still "us".
+const KNOWN_EXE_NAMES: [&str; 3] = ["pc-bridge.exe", "pc bridge.exe", "pc-agent.exe"];
+
+/// One process from a snapshot.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct ProcessEntry {
+    pub pid: u32,
+    /// Image name as reported by the OS, e.g. `pc-bridge.exe`
+    pub name: String,
+    pub threads: u32,
+}
+
+/// Decode a fixed-size, NUL-terminated UTF-16 name buffer (`szExeFile`).
+/// Only the part before the first NUL is the name: the rest of the buffer is
+/// not guaranteed to be zeroed, and converting it would leave trailing junk
+/// that defeats exact matching.
+pub(crate) fn exe_name_from_wide(buf: &[u16]) -> String {
+    let nul = buf.iter().position(|&c| c == 0).unwrap_or(buf.len());
+    String::from_utf16_lossy(&buf[..nul])
+}
+
+/// Take a single ToolHelp snapshot of every running process.
+#[cfg(windows)]
+pub(crate) fn snapshot() -> anyhow::Result<Vec<ProcessEntry>> {
+    use windows::Win32::Foundation::CloseHandle;
+    use windows::Win32::System::Diagnostics::ToolHelp::{
+        CreateToolhelp32Snapshot, PROCESSENTRY32W, Process32FirstW, Process32NextW,
+        TH32CS_SNAPPROCESS,
+    };
+
+    let mut processes = Vec::new();
+
+    // SAFETY: standard ToolHelp walk over a stack-allocated entry with dwSize
+    // set; the snapshot handle is closed before returning.
+    unsafe {
+        let snapshot = CreateToolhelp32Snapshot(TH32CS_SNAPPROCESS, 0)?;
+        let mut entry = PROCESSENTRY32W {
+            dwSize: std::mem::size_of::<PROCESSENTRY32W>() as u32,
+            ..Default::default()
+        };
+        if Process32FirstW(snapshot, &raw mut entry).is_ok() {
+            loop {
+                processes.push(ProcessEntry {
+                    pid: entry.th32ProcessID,
+                    name: exe_name_from_wide(&entry.szExeFile),
+                    threads: entry.cntThreads,
+                });
+                if Process32NextW(snapshot, &raw mut entry).is_err() {
+                    break;
+                }
+            }
+        }
+        let _ = CloseHandle(snapshot);
+    }
+
+    Ok(processes)
+}
+
+/// Forcefully end a process. False if it couldn't be opened for termination
+/// (already gone, or not ours to end).
+#[cfg(windows)]
+pub(crate) fn terminate(pid: u32) -> bool {
+    use windows::Win32::Foundation::CloseHandle;
+    use windows::Win32::System::Threading::{OpenProcess, PROCESS_TERMINATE, TerminateProcess};
+
+    // SAFETY: the handle is closed right after use.
+    unsafe {
+        let Ok(handle) = OpenProcess(PROCESS_TERMINATE, false, pid) else {
+            return false;
+        };
+        let ended = TerminateProcess(handle, 0).is_ok();
+        let _ = CloseHandle(handle);
+        ended
+    }
+}
+
+/// Remote Desktop session a process runs in.
+#[cfg(windows)]
+pub(crate) fn session_of(pid: u32) -> Option<u32> {
+    use windows::Win32::System::RemoteDesktop::ProcessIdToSessionId;
+
+    let mut session = 0;
+    // SAFETY: writes only to `session`.
+    unsafe { ProcessIdToSessionId(pid, &raw mut session) }
+        .is_ok()
+        .then_some(session)
+}
+
+/// Whether the agent runs in session 0, where services live: nothing it
+/// shows (toasts, launched apps, the tray icon) reaches the user's desktop.
+#[cfg(windows)]
+pub(crate) fn in_session_0() -> bool {
+    session_of(std::process::id()) == Some(0)
+}
+
+/// Every visible, non-minimized top-level window with its owning pid, in
+/// z-order (topmost first).
+#[cfg(windows)]
+pub(crate) fn visible_windows() -> Vec<(windows::Win32::Foundation::HWND, u32)> {
+    use windows::Win32::Foundation::{BOOL, HWND, LPARAM};
+    use windows::Win32::UI::WindowsAndMessaging::{
+        EnumWindows, GetWindowThreadProcessId, IsIconic, IsWindowVisible,
+    };
+
+    unsafe extern "system" fn push_window(hwnd: HWND, lparam: LPARAM) -> BOOL {
+        // SAFETY: lparam is the &mut Vec passed to EnumWindows below, which
+        // outlives the (synchronous) enumeration.
+        let windows = unsafe { &mut *(lparam.0 as *mut Vec<(HWND, u32)>) };
+        unsafe {
+            if IsWindowVisible(hwnd).as_bool() && !IsIconic(hwnd).as_bool() {
+                let mut pid = 0u32;
+                GetWindowThreadProcessId(hwnd, Some(&raw mut pid));
+                if pid != 0 {
+                    windows.push((hwnd, pid));
+                }
+            }
+        }
+        BOOL(1) // keep enumerating
+    }
+
+    let mut windows: Vec<(HWND, u32)> = Vec::new();
+    // SAFETY: `push_window` only touches `windows` through the pointer, and only
+    // while EnumWindows runs.
+    unsafe {
+        let _ = EnumWindows(Some(push_window), LPARAM(&raw mut windows as isize));
+    }
+    windows
+}
+
+/// File name of the running executable (`pc-bridge.exe`, or whatever the user
+/// renamed it to). Empty if it can't be determined.
+pub(crate) fn own_exe_name() -> String {
+    std::env::current_exe()
+        .ok()
+        .as_deref()
+        .and_then(Path::file_name)
+        .map(|n| n.to_string_lossy().into_owned())
+        .unwrap_or_default()
+}
+
+/// Other running copies of the agent: processes whose image name equals one
+/// of the known exe names or our own exe name (case-insensitive, whole name
+/// only), excluding `my_pid`.
+pub(crate) fn other_instances<'a>(
+    processes: &'a [ProcessEntry],
+    my_pid: u32,
+    own_exe: &str,
+) -> Vec<&'a ProcessEntry> {
+    processes
+        .iter()
+        .filter(|p| p.pid != my_pid && !p.name.is_empty())
+        .filter(|p| {
+            KNOWN_EXE_NAMES
+                .iter()
+                .any(|known| p.name.eq_ignore_ascii_case(known))
+                || (!own_exe.is_empty() && p.name.eq_ignore_ascii_case(own_exe))
+        })
+        .collect()
+}
+
+/// Processes whose image name is exactly `name` (case-insensitive).
+pub(crate) fn named<'a>(processes: &'a [ProcessEntry], name: &str) -> Vec<&'a ProcessEntry> {
+    processes
+        .iter()
+        .filter(|p| p.name.eq_ignore_ascii_case(name))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn proc(pid: u32, name: &str) -> ProcessEntry {
+        ProcessEntry {
+            pid,
+            name: name.to_string(),
+            threads: 1,
+        }
+    }
+
+    fn pids(found: &[&ProcessEntry]) -> Vec<u32> {
+        found.iter().map(|p| p.pid).collect()
+    }
+
+    #[test]
+    fn test_exe_name_stops_at_nul() {
+        // A shorter name written over a longer one leaves the old tail behind
+        // the terminator.
+        let mut buf = [0u16; 32];
+        for (i, c) in "pc-bridge.exe\0per.exe".encode_utf16().enumerate() {
+            buf[i] = c;
+        }
+        assert_eq!(exe_name_from_wide(&buf), "pc-bridge.exe");
+        // No terminator at all: the whole buffer is the name.
+        let full: Vec<u16> = "abc".encode_utf16().collect();
+        assert_eq!(exe_name_from_wide(&full), "abc");
+    }
+
+    #[test]
+    fn test_other_instances_known_names() {
+        let list = [
+            proc(4, "System"),
+            proc(100, "PC-Bridge.exe"),
+            proc(200, "pc bridge.exe"),
+            proc(300, "pc-agent.exe"),
+            proc(400, "explorer.exe"),
+        ];
+        assert_eq!(
+            pids(&other_instances(&list, 999, "pc-bridge.exe")),
+            [100, 200, 300]
+        );
+    }
+
+    #[test]
+    fn test_other_instances_skips_self() {
+        let list = [proc(100, "pc-bridge.exe"), proc(200, "pc-bridge.exe")];
+        assert_eq!(pids(&other_instances(&list, 100, "pc-bridge.exe")), [200]);
+    }
+
+    #[test]
+    fn test_other_instances_renamed_copy() {
+        // Running as a renamed exe: older copies of that name are ours too.
+        let list = [proc(100, "HomeBridge.exe"), proc(200, "homebridge.exe")];
+        assert_eq!(pids(&other_instances(&list, 100, "HomeBridge.exe")), [200]);
+    }
+
+    #[test]
+    fn test_other_instances_no_near_misses() {
+        let list = [
+            proc(100, "pc-bridge-helper.exe"),
+            proc(200, "my-pc-bridge.exe"),
+            proc(300, "pc-bridge.exe.bak"),
+            proc(400, "pc-bridge"),
+            proc(500, ""),
+        ];
+        assert!(other_instances(&list, 999, "pc-bridge.exe").is_empty());
+        // An unknown own name must not turn into a wildcard.
+        assert!(other_instances(&list, 999, "").is_empty());
+    }
+
+    #[test]
+    fn test_named_whole_name_only() {
+        let list = [
+            proc(100, "explorer.exe"),
+            proc(200, "EXPLORER.EXE"),
+            proc(300, "iexplorer.exe"),
+            proc(400, "explorer.exe.bak"),
+        ];
+        assert_eq!(pids(&named(&list, "explorer.exe")), [100, 200]);
+    }
+}
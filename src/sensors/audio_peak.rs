@@ -0,0 +1,82 @@
+//! Audio peak meter sensor - Windows only.
+//!
+//! Publishes the default output's master peak level (0-100) to the
+//! `audio_peak` sensor, sampled every `intervals.audio_peak` seconds. Unlike
+//! now-playing metadata this reflects whether sound is actually coming out, so
+//! an automation can trigger on `audio_peak > N`. Uses
+//! `IAudioMeterInformation::GetPeakValue` via `audio::get_peak`; while there is
+//! no render device the sample is skipped and the last value is left alone.
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+pub struct AudioPeakSensor {
+    state: Arc<AppState>,
+}
+
+impl AudioPeakSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut interval_secs = self.state.config.read().await.intervals.audio_peak.max(1);
+        let mut tick = interval(Duration::from_secs(interval_secs));
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut config_rx = self.state.config_generation.subscribe();
+        let mut prev = String::new();
+        let mut have_device = true;
+
+        info!(
+            "Audio peak sensor started (polled every {}s)",
+            interval_secs
+        );
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Audio peak sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev.clear();
+                }
+                Ok(()) = config_rx.recv() => {
+                    let new_secs = self.state.config.read().await.intervals.audio_peak.max(1);
+                    if new_secs != interval_secs {
+                        interval_secs = new_secs;
+                        tick = interval(Duration::from_secs(interval_secs));
+                        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+                        info!("Audio peak interval changed to {}s", interval_secs);
+                    }
+                }
+                _ = tick.tick() => {
+                    // COM call; keep it off the single-threaded async runtime.
+                    let peak = tokio::task::spawn_blocking(crate::audio::get_peak)
+                        .await
+                        .ok()
+                        .flatten();
+                    let Some(peak) = peak else {
+                        if have_device {
+                            debug!("Audio peak: no render device - skipping samples");
+                            have_device = false;
+                        }
+                        continue;
+                    };
+                    have_device = true;
+                    let value = (peak.round() as i64).clamp(0, 100).to_string();
+                    if value != prev {
+                        self.state.mqtt.publish_sensor("audio_peak", &value).await;
+                        prev = value;
+                    }
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,67 @@
+//! Command slots sensor
+//!
+//! Publishes how many of the executor's concurrent command slots are taken
+//! to `command_slots_used`, with the slot count and the commands dropped so
+//! far (every slot busy, or over a `command_rate_limits` budget) as
+//! attributes. Polled every 5s and published when anything changes, so a
+//! command that never ran can be told apart from one that was dropped.
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+use crate::commands::SlotUsage;
+
+const POLL_INTERVAL: Duration = Duration::from_secs(5);
+
+pub struct CommandSlotsSensor {
+    state: Arc<AppState>,
+}
+
+impl CommandSlotsSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut tick = interval(POLL_INTERVAL);
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev: Option<SlotUsage> = None;
+
+        info!(
+            "Command slots sensor started (polled every {}s)",
+            POLL_INTERVAL.as_secs()
+        );
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Command slots sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev = None;
+                }
+                _ = tick.tick() => {
+                    let usage = self.state.command_slots.snapshot();
+                    if prev == Some(usage) {
+                        continue;
+                    }
+                    self.state
+                        .mqtt
+                        .publish_sensor("command_slots_used", &usage.used.to_string())
+                        .await;
+                    self.state
+                        .mqtt
+                        .publish_sensor_attributes("command_slots_used", &usage.attributes())
+                        .await;
+                    prev = Some(usage);
+                }
+            }
+        }
+    }
+}
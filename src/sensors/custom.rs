@@ -11,6 +11,16 @@ use crate::config::{CustomSensor, CustomSensorType};
 #[cfg(windows)]
 const CREATE_NO_WINDOW: u32 = 0x08000000;
 
+/// Environment variable carrying a PowerShell sensor's script to the child.
+#[cfg(windows)]
+const SCRIPT_ENV: &str = "PC_BRIDGE_SCRIPT";
+
+/// `-Command` for PowerShell sensors: UTF-8 output, then the user's script
+/// (from [`SCRIPT_ENV`]) as an unmodified script block.
+#[cfg(windows)]
+const POWERSHELL_UTF8_RUNNER: &str = "[Console]::OutputEncoding = [System.Text.Encoding]::UTF8; \
+     & ([ScriptBlock]::Create($env:PC_BRIDGE_SCRIPT))";
+
 /// Case-insensitive ASCII substring search without allocation.
 /// Uses byte-level sliding window comparison.
 #[cfg(windows)]
@@ -166,6 +176,13 @@ impl CustomSensorManager {
             .clone()
             .ok_or_else(|| "no script".to_string())?;
 
+        // The script text reaches PowerShell intact (CreateProcessW passes
+        // UTF-16), but its stdout is encoded in the console code page, which
+        // turns anything outside it into '?' or mojibake. Switch the output
+        // to UTF-8 first so it decodes as the UTF-8 we read it as. The script
+        // itself runs as its own script block (handed over in an environment
+        // variable), so a leading `using` or `param(...)` still comes first.
+
         // tokio::process with kill_on_drop: if this sensor is disabled mid-poll the
         // supervisor drops this future, and the child is killed - a std::process
         // child inside spawn_blocking would instead detach and leak a powershell.exe
@@ -173,7 +190,8 @@ impl CustomSensorManager {
         // script). The timeout bounds a hanging script too: on timeout the future is
         // dropped and kill_on_drop terminates the child.
         let mut cmd = tokio::process::Command::new("powershell");
-        cmd.args(["-NoProfile", "-Command", &script])
+        cmd.args(["-NoProfile", "-Command", POWERSHELL_UTF8_RUNNER])
+            .env(SCRIPT_ENV, &script)
             .creation_flags(CREATE_NO_WINDOW)
             .kill_on_drop(true);
 
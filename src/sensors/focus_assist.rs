@@ -0,0 +1,113 @@
+//! Focus Assist (Do Not Disturb) sensor - Windows only.
+//!
+//! Publishes "off" / "priority" / "alarms" to the `focus_assist` sensor. Windows
+//! keeps the active quiet-hours profile in the undocumented WNF state
+//! `WNF_SHEL_QUIETHOURS_ACTIVE_PROFILE_CHANGED`; the registry copy is a CloudStore
+//! blob that lags behind, so we query WNF directly through ntdll.
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+/// `WNF_SHEL_QUIETHOURS_ACTIVE_PROFILE_CHANGED`. Its data is a u32 profile:
+/// 0 = off, 1 = priority only, 2 = alarms only.
+const WNF_SHEL_QUIETHOURS_ACTIVE_PROFILE_CHANGED: u64 = 0x0D83_063E_A3BF_1C75;
+
+#[link(name = "ntdll", kind = "raw-dylib")]
+unsafe extern "system" {
+    fn NtQueryWnfStateData(
+        state_name: *const u64,
+        type_id: *const core::ffi::c_void,
+        explicit_scope: *const core::ffi::c_void,
+        change_stamp: *mut u32,
+        buffer: *mut core::ffi::c_void,
+        buffer_size: *mut u32,
+    ) -> i32;
+}
+
+pub struct FocusAssistSensor {
+    state: Arc<AppState>,
+}
+
+impl FocusAssistSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut tick = interval(Duration::from_secs(5));
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev = String::new();
+
+        info!("Focus Assist sensor started (polled every 5s)");
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Focus Assist sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev.clear();
+                }
+                _ = tick.tick() => {
+                    let now = query_profile().map_or("unavailable", profile_state);
+                    if now != prev {
+                        self.state.mqtt.publish_sensor_retained("focus_assist", now).await;
+                        prev = now.to_string();
+                    }
+                }
+            }
+        }
+    }
+}
+
+/// Read the active quiet-hours profile, or None if WNF refused the query
+/// (pre-1803 builds that predate the state name).
+fn query_profile() -> Option<u32> {
+    let mut profile: u32 = 0;
+    let mut change_stamp: u32 = 0;
+    let mut size = std::mem::size_of::<u32>() as u32;
+    // SAFETY: every pointer references a live local; `size` tells ntdll the
+    // buffer is exactly one u32, so it can't write past `profile`.
+    let status = unsafe {
+        NtQueryWnfStateData(
+            &WNF_SHEL_QUIETHOURS_ACTIVE_PROFILE_CHANGED,
+            std::ptr::null(),
+            std::ptr::null(),
+            &mut change_stamp,
+            (&raw mut profile).cast(),
+            &mut size,
+        )
+    };
+    // A never-written state returns success with size 0: Focus Assist was never
+    // touched since boot, which is "off".
+    (status >= 0).then_some(if size == 0 { 0 } else { profile })
+}
+
+fn profile_state(profile: u32) -> &'static str {
+    match profile {
+        0 => "off",
+        1 => "priority",
+        2 => "alarms",
+        _ => "unknown",
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::profile_state;
+
+    #[test]
+    fn test_profile_state() {
+        assert_eq!(profile_state(0), "off");
+        assert_eq!(profile_state(1), "priority");
+        assert_eq!(profile_state(2), "alarms");
+        assert_eq!(profile_state(7), "unknown");
+    }
+}
@@ -0,0 +1,140 @@
+//! Per-game hooks: run the `game_hooks` commands when a game starts or stops.
+//!
+//! The game sensor reports every detection result to [`GameHookRunner`]; a
+//! game only counts as started (or stopped) once detection has held still for
+//! `DEBOUNCE`, so a launcher handing off to the game, or a one-scan detection
+//! gap, doesn't fire hooks. The commands go through the normal executor via
+//! `MqttClient::dispatch_local`, so feature gates and `command_rate_limits`
+//! apply exactly as for a command from Home Assistant.
+//!
+//! Hooks are looked up when they fire, so a hot-reloaded `game_hooks` applies
+//! from the next start or exit. The runner lives as long as the game sensor.
+//! A game already running when the sensor starts gets its `on_start` hooks;
+//! stopping the sensor (feature off, shutdown) doesn't run `on_exit`.
+
+use log::{debug, info};
+use std::collections::{BTreeSet, HashMap};
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::sync::watch;
+
+use crate::AppState;
+use crate::config::{GameHooks, HookCommand};
+
+/// How long the detected game set must stay unchanged before hooks fire.
+const DEBOUNCE: Duration = Duration::from_secs(5);
+
+pub(crate) struct GameHookRunner {
+    detected: watch::Sender<BTreeSet<String>>,
+}
+
+impl GameHookRunner {
+    /// Start the runner task; it exits when this handle is dropped.
+    pub(crate) fn spawn(state: Arc<AppState>) -> Self {
+        let (detected, rx) = watch::channel(BTreeSet::new());
+        tokio::spawn(run(state, rx));
+        Self { detected }
+    }
+
+    /// Report the `(game_id, display_name)` pairs detected now.
+    pub(crate) fn observe(&self, games: &[(String, String)]) {
+        let ids: BTreeSet<String> = games.iter().map(|(id, _)| id.clone()).collect();
+        // Only a real change restarts the debounce.
+        self.detected.send_if_modified(|current| {
+            if *current == ids {
+                return false;
+            }
+            *current = ids;
+            true
+        });
+    }
+}
+
+async fn run(state: Arc<AppState>, mut rx: watch::Receiver<BTreeSet<String>>) {
+    // Games whose on_start hooks have run (and on_exit not yet).
+    let mut active = BTreeSet::new();
+    while rx.changed().await.is_ok() {
+        // Wait out the flapping: every further change restarts the clock.
+        loop {
+            match tokio::time::timeout(DEBOUNCE, rx.changed()).await {
+                Ok(Ok(())) => {}
+                Ok(Err(_)) => return,
+                Err(_) => break,
+            }
+        }
+        let detected = rx.borrow_and_update().clone();
+        {
+            let (started, stopped) = transitions(&active, &detected);
+            if !started.is_empty() || !stopped.is_empty() {
+                let hooks = state.config.read().await.game_hooks.clone();
+                for game in stopped {
+                    let commands = hooks_for(&hooks, game).map(|h| &h.on_exit);
+                    fire(&state, game, "exit", commands);
+                }
+                for game in started {
+                    let commands = hooks_for(&hooks, game).map(|h| &h.on_start);
+                    fire(&state, game, "start", commands);
+                }
+            }
+        }
+        active = detected;
+    }
+    debug!("Game hook runner stopped");
+}
+
+/// Games that appeared and disappeared between `active` and `detected`.
+fn transitions<'a>(
+    active: &'a BTreeSet<String>,
+    detected: &'a BTreeSet<String>,
+) -> (Vec<&'a str>, Vec<&'a str>) {
+    let started = detected.difference(active).map(String::as_str).collect();
+    let stopped = active.difference(detected).map(String::as_str).collect();
+    (started, stopped)
+}
+
+/// `game_hooks` entry for `game_id`, matched case-insensitively like
+/// `game_priority`.
+fn hooks_for<'a>(hooks: &'a HashMap<String, GameHooks>, game_id: &str) -> Option<&'a GameHooks> {
+    hooks
+        .iter()
+        .find(|(id, _)| id.eq_ignore_ascii_case(game_id))
+        .map(|(_, h)| h)
+}
+
+fn fire(state: &AppState, game: &str, event: &str, commands: Option<&Vec<HookCommand>>) {
+    for hook in commands.into_iter().flatten() {
+        info!(
+            "Game hook: {} {} -> {} {}",
+            game, event, hook.command, hook.payload
+        );
+        state.mqtt.dispatch_local(&hook.command, &hook.payload);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn set(ids: &[&str]) -> BTreeSet<String> {
+        ids.iter().map(|s| s.to_string()).collect()
+    }
+
+    #[test]
+    fn test_transitions() {
+        let active = set(&["cs2", "steam_overlay"]);
+        let detected = set(&["cs2", "fortnite"]);
+        assert_eq!(
+            transitions(&active, &detected),
+            (vec!["fortnite"], vec!["steam_overlay"])
+        );
+        assert_eq!(transitions(&active, &active), (vec![], vec![]));
+    }
+
+    #[test]
+    fn test_hooks_for_ignores_case() {
+        let mut hooks = HashMap::new();
+        hooks.insert("CS2".to_string(), GameHooks::default());
+        assert!(hooks_for(&hooks, "cs2").is_some());
+        assert!(hooks_for(&hooks, "fortnite").is_none());
+    }
+}
@@ -13,6 +13,7 @@ use serde::Serialize;
 use std::collections::HashSet;
 use std::sync::Arc;
 
+use super::game_hooks::GameHookRunner;
 use crate::AppState;
 
 #[derive(Serialize)]
@@ -30,14 +31,21 @@ struct CatalogEntry {
 
 /// Cached lowered game patterns to avoid recomputing on every WMI event
 struct CachedGamePatterns {
-    /// (lowered_pattern, game_id, display_name)
+    /// (lowered_pattern, game_id, display_name) in detection order (see
+    /// `config::prioritized_games`): the first pattern a process matches wins.
     patterns: Vec<(String, String, String)>,
+    /// Lowered `game_exclusions` substrings, checked before any pattern.
+    exclusions: Vec<String>,
 }
 
 impl CachedGamePatterns {
-    fn build(games: &std::collections::HashMap<String, crate::config::GameConfig>) -> Self {
-        let patterns = games
-            .iter()
+    fn build(
+        games: &std::collections::HashMap<String, crate::config::GameConfig>,
+        exclusions: Vec<String>,
+        priority: &[String],
+    ) -> Self {
+        let patterns = crate::config::prioritized_games(games, priority)
+            .into_iter()
             .map(|(pattern, gc)| {
                 (
                     pattern.to_lowercase(),
@@ -46,7 +54,10 @@ impl CachedGamePatterns {
                 )
             })
             .collect();
-        Self { patterns }
+        Self {
+            patterns,
+            exclusions,
+        }
     }
 }
 
@@ -68,13 +79,28 @@ impl GameSensor {
         // Build cached patterns once at startup
         // Clone the games map and drop the read lock before any async
         // work (MQTT publish) to avoid holding the lock across await points.
-        let games = self.state.config.read().await.games.clone();
-        let mut cached = CachedGamePatterns::build(&games);
+        let (games, exclusions, priority) = self.game_config_snapshot().await;
+        let mut cached = CachedGamePatterns::build(&games, exclusions, &priority);
         self.publish_game_catalog(&games).await;
 
+        // Runs `game_hooks` as detected games come and go.
+        let hooks = GameHookRunner::spawn(Arc::clone(&self.state));
+
         // Publish initial state
         let games = self.detect_game(&cached).await;
-        self.publish_game(&games).await;
+        self.publish_game(&games, &hooks).await;
+
+        // process_count reads the watcher's PID set (no extra walk) on the
+        // game_sensor interval: republishing on every process event would
+        // flood the broker on a busy machine.
+        let interval_secs = self.state.config.read().await.intervals.game_sensor.max(1);
+        let mut counts_tick = tokio::time::interval(std::time::Duration::from_secs(interval_secs));
+        counts_tick.set_missed_tick_behavior(tokio::time::MissedTickBehavior::Skip);
+        let mut counts_on = self.state.config.read().await.features.process_count;
+        let mut last_counts = None;
+        if counts_on {
+            self.publish_process_count(&mut last_counts).await;
+        }
 
         // Track last published state (joined ids) to avoid duplicate messages
         let mut last_game_id = running_state(&games).0;
@@ -95,17 +121,21 @@ impl GameSensor {
                     if !matches!(r, Ok(()) | Err(tokio::sync::broadcast::error::RecvError::Lagged(_))) {
                         continue;
                     }
-                    let games = self.state.config.read().await.games.clone();
-                    cached = CachedGamePatterns::build(&games);
+                    let (games, exclusions, priority) = self.game_config_snapshot().await;
+                    cached = CachedGamePatterns::build(&games, exclusions, &priority);
                     self.publish_game_catalog(&games).await;
                     debug!("Game sensor: rebuilt cached patterns");
                     // Re-detect with new patterns
                     let games = self.detect_game(&cached).await;
                     let key = running_state(&games).0;
                     if key != last_game_id {
-                        self.publish_game(&games).await;
+                        self.publish_game(&games, &hooks).await;
                         last_game_id = key;
                     }
+                    counts_on = self.state.config.read().await.features.process_count;
+                    if counts_on {
+                        self.publish_process_count(&mut last_counts).await;
+                    }
                 }
                 // MQTT reconnected - force republish retained state
                 Ok(()) = reconnect_rx.recv() => {
@@ -113,8 +143,15 @@ impl GameSensor {
                     let games = self.state.config.read().await.games.clone();
                     self.publish_game_catalog(&games).await;
                     let games = self.detect_game(&cached).await;
-                    self.publish_game(&games).await;
+                    self.publish_game(&games, &hooks).await;
                     last_game_id = running_state(&games).0;
+                    if counts_on {
+                        last_counts = None;
+                        self.publish_process_count(&mut last_counts).await;
+                    }
+                }
+                _ = counts_tick.tick(), if counts_on => {
+                    self.publish_process_count(&mut last_counts).await;
                 }
                 result = process_rx.recv() => {
                     match result {
@@ -123,7 +160,7 @@ impl GameSensor {
                             let games = self.detect_game(&cached).await;
                             let key = running_state(&games).0;
                             if key != last_game_id {
-                                self.publish_game(&games).await;
+                                self.publish_game(&games, &hooks).await;
                                 last_game_id = key;
                             }
                         }
@@ -133,7 +170,7 @@ impl GameSensor {
                             let games = self.detect_game(&cached).await;
                             let key = running_state(&games).0;
                             if key != last_game_id {
-                                self.publish_game(&games).await;
+                                self.publish_game(&games, &hooks).await;
                                 last_game_id = key;
                             }
                         }
@@ -147,8 +184,17 @@ impl GameSensor {
         }
     }
 
-    async fn publish_game(&self, games: &[(String, String)]) {
+    async fn publish_game(&self, games: &[(String, String)], hooks: &GameHookRunner) {
+        hooks.observe(games);
+        // The task also runs for game_catalog / process_count alone; don't
+        // bring back an entity discovery just removed.
+        if !self.state.config.read().await.features.running_game {
+            return;
+        }
         let (state, display_names) = running_state(games);
+        // Only called when the set changes (or on startup/reconnect), so this
+        // stays at info without repeating every poll.
+        info!("Running games: {}", display_names);
         self.state
             .mqtt
             .publish_sensor_retained("runninggames", &state)
@@ -176,6 +222,9 @@ impl GameSensor {
         &self,
         games: &std::collections::HashMap<String, crate::config::GameConfig>,
     ) {
+        if !self.state.config.read().await.features.game_catalog {
+            return;
+        }
         // Collect into typed structs, sort by name, then serialize once
         let mut entries: Vec<CatalogEntry> = games
             .iter()
@@ -196,9 +245,12 @@ impl GameSensor {
             .mqtt
             .publish_sensor_retained("game_catalog", &count.to_string())
             .await;
+        // `configured` includes hidden games; 0 means detection can't match
+        // anything (e.g. an emptied games map).
         let attrs = serde_json::json!({
             "games": entries,
             "count": count,
+            "configured": games.len(),
         });
         self.state
             .mqtt
@@ -207,6 +259,46 @@ impl GameSensor {
         debug!("Published game catalog with {} exposed games", count);
     }
 
+    /// Snapshot the games map, lowered exclusions and game priority under one
+    /// read lock.
+    async fn game_config_snapshot(
+        &self,
+    ) -> (
+        std::collections::HashMap<String, crate::config::GameConfig>,
+        Vec<String>,
+        Vec<String>,
+    ) {
+        let config = self.state.config.read().await;
+        (
+            config.games.clone(),
+            config.lowered_game_exclusions(),
+            config.game_priority.clone(),
+        )
+    }
+
+    /// Publish `process_count` (thread total as an attribute) if either number
+    /// moved since `last`. Thread counts refresh on the watcher's reconcile.
+    async fn publish_process_count(&self, last: &mut Option<(usize, u32)>) {
+        let counts = {
+            let proc_state = self.state.process_watcher.state();
+            let guard = proc_state.read().await;
+            (guard.process_count(), guard.thread_count())
+        };
+        if *last == Some(counts) {
+            return;
+        }
+        *last = Some(counts);
+        self.state
+            .mqtt
+            .publish_sensor_retained("process_count", &counts.0.to_string())
+            .await;
+        let attrs = serde_json::json!({ "threads": counts.1 });
+        self.state
+            .mqtt
+            .publish_sensor_attributes("process_count", &attrs)
+            .await;
+    }
+
     async fn detect_game(&self, cached: &CachedGamePatterns) -> Vec<(String, String)> {
         // Access process list by reference - no HashSet clone
         let proc_state = self.state.process_watcher.state();
@@ -223,10 +315,15 @@ fn match_games_pairs(
     process_names: &HashSet<Arc<str>>,
     cached: &CachedGamePatterns,
 ) -> Vec<(String, String)> {
-    let mut found_games: Vec<(String, String)> = Vec::with_capacity(2);
+    // (pattern index, game_id, display_name): sorted by index at the end so
+    // the reported order doesn't depend on HashSet iteration either.
+    let mut found_games: Vec<(usize, String, String)> = Vec::with_capacity(2);
     let mut seen_ids: HashSet<&str> = HashSet::with_capacity(cached.patterns.len());
 
     for proc_name in process_names {
+        if crate::config::is_excluded_process(proc_name, &cached.exclusions) {
+            continue;
+        }
         // Strip .exe suffix without allocating (case-insensitive for all casings)
         let base_name = if proc_name.len() > 4
             && proc_name.as_bytes()[proc_name.len() - 4..].eq_ignore_ascii_case(b".exe")
@@ -236,18 +333,37 @@ fn match_games_pairs(
             proc_name
         };
 
-        for (pattern_lower, game_id, display_name) in &cached.patterns {
-            // Case-insensitive comparison without allocation
-            let matches = starts_with_ignore_ascii_case(proc_name, pattern_lower)
-                || base_name.eq_ignore_ascii_case(pattern_lower);
-            if matches && seen_ids.insert(game_id.as_str()) {
-                found_games.push((game_id.clone(), display_name.clone()));
-                break; // This process matched - no need to check remaining patterns
-            }
+        // The first (highest-priority) matching pattern claims the process,
+        // even if its game was already found via another process.
+        if let Some((index, (_, game_id, display_name))) =
+            cached
+                .patterns
+                .iter()
+                .enumerate()
+                .find(|(_, (pattern_lower, _, _))| {
+                    match crate::config::game_glob(pattern_lower) {
+                        Some(glob) => {
+                            crate::config::glob_match(glob, proc_name)
+                                || crate::config::glob_match(glob, base_name)
+                        }
+                        // Case-insensitive comparison without allocation
+                        None => {
+                            starts_with_ignore_ascii_case(proc_name, pattern_lower)
+                                || base_name.eq_ignore_ascii_case(pattern_lower)
+                        }
+                    }
+                })
+            && seen_ids.insert(game_id.as_str())
+        {
+            found_games.push((index, game_id.clone(), display_name.clone()));
         }
     }
 
+    found_games.sort_by_key(|(index, _, _)| *index);
     found_games
+        .into_iter()
+        .map(|(_, game_id, display_name)| (game_id, display_name))
+        .collect()
 }
 
 /// The retained sensor value (comma-joined ids) and display string (", "-joined
@@ -292,7 +408,7 @@ mod tests {
             .iter()
             .map(|(k, v)| (k.to_string(), v.clone()))
             .collect();
-        CachedGamePatterns::build(&map)
+        CachedGamePatterns::build(&map, Vec::new(), &[])
     }
 
     /// Helper: build a process set from string slices
@@ -394,6 +510,17 @@ mod tests {
         assert_eq!(names, "Battlefield 6");
     }
 
+    #[test]
+    fn test_glob_pattern_match() {
+        let cached = make_patterns(&[("glob:*apex*", GameConfig::Simple("apex_legends".into()))]);
+        let (ids, _) = match_games_in_processes(&procs(&["r5apex_dx12.exe"]), &cached);
+        assert_eq!(ids, "apex_legends");
+        // No prefix matching for globs: the pattern has to cover the name.
+        let cached = make_patterns(&[("glob:r5apex", GameConfig::Simple("apex_legends".into()))]);
+        let (ids, _) = match_games_in_processes(&procs(&["r5apex_dx12.exe"]), &cached);
+        assert_eq!(ids, "none");
+    }
+
     #[test]
     fn test_game_with_full_config_and_display_name() {
         let cached = make_patterns(&[(
@@ -450,6 +577,39 @@ mod tests {
         assert!(names.contains("Call Of Duty Mw"));
     }
 
+    #[test]
+    fn test_most_specific_pattern_wins() {
+        let games = [
+            ("rocket", GameConfig::Simple("rocket_launcher".into())),
+            ("rocketleague", GameConfig::Simple("rocket_league".into())),
+        ];
+        let processes = procs(&["RocketLeague.exe"]);
+        for _ in 0..10 {
+            // Fresh map each time: HashMap order varies, the result must not.
+            let (ids, _) = match_games_in_processes(&processes, &make_patterns(&games));
+            assert_eq!(ids, "rocket_league");
+        }
+        // An explicit priority overrides specificity.
+        let map: HashMap<String, GameConfig> = games
+            .iter()
+            .map(|(k, v)| (k.to_string(), v.clone()))
+            .collect();
+        let cached = CachedGamePatterns::build(&map, Vec::new(), &["rocket_launcher".into()]);
+        let (ids, _) = match_games_in_processes(&processes, &cached);
+        assert_eq!(ids, "rocket_launcher");
+    }
+
+    #[test]
+    fn test_multiple_games_reported_in_pattern_order() {
+        let cached = make_patterns(&[
+            ("cod_mw", GameConfig::Simple("call_of_duty_mw".into())),
+            ("bf2042", GameConfig::Simple("battlefield_6".into())),
+        ]);
+        let processes = procs(&["cod_mw.exe", "bf2042.exe"]);
+        let (ids, _) = match_games_in_processes(&processes, &cached);
+        assert_eq!(ids, "battlefield_6,call_of_duty_mw");
+    }
+
     // ===== Deduplication =====
 
     #[test]
@@ -514,9 +674,30 @@ mod tests {
         assert_eq!(cached.patterns[0].2, "Battlefield 6"); // display_name
     }
 
+    // ===== Exclusions =====
+
+    #[test]
+    fn test_excluded_process_never_matches() {
+        // "fortnite" prefix-matches the launcher helper too; the exclusion wins.
+        let map: HashMap<String, GameConfig> = [(
+            "fortnite".to_string(),
+            GameConfig::Simple("fortnite".into()),
+        )]
+        .into();
+        let cached = CachedGamePatterns::build(&map, vec!["launcher".to_string()], &[]);
+        let (ids, _) = match_games_in_processes(&procs(&["FortniteLauncher.exe"]), &cached);
+        assert_eq!(ids, "none");
+
+        let (ids, _) = match_games_in_processes(
+            &procs(&["FortniteLauncher.exe", "FortniteClient-Win64-Shipping.exe"]),
+            &cached,
+        );
+        assert_eq!(ids, "fortnite");
+    }
+
     #[test]
     fn test_cached_patterns_empty_map() {
-        let cached = CachedGamePatterns::build(&HashMap::new());
+        let cached = CachedGamePatterns::build(&HashMap::new(), Vec::new(), &[]);
         assert!(cached.patterns.is_empty());
     }
 
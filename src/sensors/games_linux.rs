@@ -13,6 +13,7 @@ use std::fs;
 use std::sync::Arc;
 use tokio::time::{Duration, interval};
 
+use super::game_hooks::GameHookRunner;
 use crate::AppState;
 
 #[derive(Serialize)]
@@ -28,14 +29,21 @@ struct CatalogEntry {
 
 /// Cached lowered game patterns - rebuilt only when config changes via config_generation.
 struct CachedGamePatterns {
-    /// (lowered_pattern, game_id, display_name)
+    /// (lowered_pattern, game_id, display_name) in detection order (see
+    /// `config::prioritized_games`): the first pattern a process matches wins.
     patterns: Vec<(String, String, String)>,
+    /// Lowered `game_exclusions` substrings, checked before any pattern.
+    exclusions: Vec<String>,
 }
 
 impl CachedGamePatterns {
-    fn build(games: &std::collections::HashMap<String, crate::config::GameConfig>) -> Self {
-        let patterns = games
-            .iter()
+    fn build(
+        games: &std::collections::HashMap<String, crate::config::GameConfig>,
+        exclusions: Vec<String>,
+        priority: &[String],
+    ) -> Self {
+        let patterns = crate::config::prioritized_games(games, priority)
+            .into_iter()
             .map(|(pattern, gc)| {
                 (
                     pattern.to_lowercase(),
@@ -44,7 +52,10 @@ impl CachedGamePatterns {
                 )
             })
             .collect();
-        Self { patterns }
+        Self {
+            patterns,
+            exclusions,
+        }
     }
 }
 
@@ -61,7 +72,11 @@ impl GameSensor {
         let config = self.state.config.read().await;
         let interval_secs = config.intervals.game_sensor.max(1); // Prevent panic on 0
         let games = config.games.clone();
-        let mut cached = CachedGamePatterns::build(&games);
+        let mut cached = CachedGamePatterns::build(
+            &games,
+            config.lowered_game_exclusions(),
+            &config.game_priority,
+        );
         drop(config);
         self.publish_game_catalog(&games).await;
 
@@ -73,9 +88,19 @@ impl GameSensor {
         let mut config_rx = self.state.config_generation.subscribe();
         let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
 
+        // Runs `game_hooks` as detected games come and go.
+        let hooks = GameHookRunner::spawn(Arc::clone(&self.state));
+
         // Publish initial state
-        let running = self.detect_game(&cached).await;
-        self.publish_game(&running).await;
+        let (running, procs) = self.detect_game(&cached).await;
+        self.publish_game(&running, &hooks).await;
+
+        // process_count piggybacks on the /proc walk the game scan already does.
+        let mut counts_on = self.state.config.read().await.features.process_count;
+        let mut last_counts = None;
+        if counts_on {
+            publish_process_count(&self.state, procs, &mut last_counts).await;
+        }
 
         // Track last published state (joined ids) to avoid duplicate messages
         let mut last_game_id = running_state(&running).0;
@@ -89,40 +114,63 @@ impl GameSensor {
                 }
                 // Rebuild cached patterns when config changes
                 Ok(()) = config_rx.recv() => {
-                    let games = self.state.config.read().await.games.clone();
-                    cached = CachedGamePatterns::build(&games);
+                    let config = self.state.config.read().await;
+                    let games = config.games.clone();
+                    let exclusions = config.lowered_game_exclusions();
+                    cached = CachedGamePatterns::build(&games, exclusions, &config.game_priority);
+                    drop(config);
                     self.publish_game_catalog(&games).await;
                     debug!("Game sensor: rebuilt cached patterns");
-                    let running = self.detect_game(&cached).await;
+                    let (running, procs) = self.detect_game(&cached).await;
                     let key = running_state(&running).0;
                     if key != last_game_id {
-                        self.publish_game(&running).await;
+                        self.publish_game(&running, &hooks).await;
                         last_game_id = key;
                     }
+                    counts_on = self.state.config.read().await.features.process_count;
+                    if counts_on {
+                        publish_process_count(&self.state, procs, &mut last_counts).await;
+                    }
                 }
                 // MQTT reconnected - force republish retained state
                 Ok(()) = reconnect_rx.recv() => {
                     info!("Game sensor: MQTT reconnected, republishing current state");
                     let games = self.state.config.read().await.games.clone();
                     self.publish_game_catalog(&games).await;
-                    let running = self.detect_game(&cached).await;
-                    self.publish_game(&running).await;
+                    let (running, procs) = self.detect_game(&cached).await;
+                    self.publish_game(&running, &hooks).await;
                     last_game_id = running_state(&running).0;
+                    if counts_on {
+                        last_counts = None;
+                        publish_process_count(&self.state, procs, &mut last_counts).await;
+                    }
                 }
                 _ = tick.tick() => {
-                    let running = self.detect_game(&cached).await;
+                    let (running, procs) = self.detect_game(&cached).await;
                     let key = running_state(&running).0;
                     if key != last_game_id {
-                        self.publish_game(&running).await;
+                        self.publish_game(&running, &hooks).await;
                         last_game_id = key;
                     }
+                    if counts_on {
+                        publish_process_count(&self.state, procs, &mut last_counts).await;
+                    }
                 }
             }
         }
     }
 
-    async fn publish_game(&self, games: &[(String, String)]) {
+    async fn publish_game(&self, games: &[(String, String)], hooks: &GameHookRunner) {
+        hooks.observe(games);
+        // The task also runs for game_catalog / process_count alone; don't
+        // bring back an entity discovery just removed.
+        if !self.state.config.read().await.features.running_game {
+            return;
+        }
         let (state, display_names) = running_state(games);
+        // Only called when the set changes (or on startup/reconnect), so this
+        // stays at info without repeating every poll.
+        info!("Running games: {}", display_names);
         self.state
             .mqtt
             .publish_sensor_retained("runninggames", &state)
@@ -150,6 +198,9 @@ impl GameSensor {
         &self,
         games: &std::collections::HashMap<String, crate::config::GameConfig>,
     ) {
+        if !self.state.config.read().await.features.game_catalog {
+            return;
+        }
         let mut entries: Vec<CatalogEntry> = games
             .iter()
             .filter(|(_, gc)| gc.is_exposed())
@@ -169,9 +220,12 @@ impl GameSensor {
             .mqtt
             .publish_sensor_retained("game_catalog", &count.to_string())
             .await;
+        // `configured` includes hidden games; 0 means detection can't match
+        // anything (e.g. an emptied games map).
         let attrs = serde_json::json!({
             "games": entries,
             "count": count,
+            "configured": games.len(),
         });
         self.state
             .mqtt
@@ -180,32 +234,52 @@ impl GameSensor {
         debug!("Published game catalog with {} exposed games", count);
     }
 
-    async fn detect_game(&self, cached: &CachedGamePatterns) -> Vec<(String, String)> {
+    /// Running games plus the number of processes seen by the same /proc walk.
+    async fn detect_game(&self, cached: &CachedGamePatterns) -> (Vec<(String, String)>, usize) {
         // Enumerate processes via /proc
         let processes = match self.get_process_names().await {
             Ok(p) => p,
             Err(e) => {
                 error!("Failed to enumerate processes: {}", e);
-                return Vec::new();
+                return (Vec::new(), 0);
             }
         };
 
-        let mut found_games: Vec<(String, String)> = Vec::with_capacity(2);
+        // (pattern index, game_id, display_name), reported in pattern order.
+        let mut found_games: Vec<(usize, String, String)> = Vec::with_capacity(2);
         let mut seen_ids: HashSet<&str> = HashSet::with_capacity(cached.patterns.len());
 
         for proc_name in &processes {
-            for (pattern_lower, game_id, display_name) in &cached.patterns {
-                // Case-insensitive prefix match OR exact match (matches Windows behavior)
-                let matches = starts_with_ignore_ascii_case(proc_name, pattern_lower)
-                    || proc_name.eq_ignore_ascii_case(pattern_lower);
-                if matches && seen_ids.insert(game_id.as_str()) {
-                    found_games.push((game_id.clone(), display_name.clone()));
-                    break; // This process matched - no need to check remaining patterns
-                }
+            if crate::config::is_excluded_process(proc_name, &cached.exclusions) {
+                continue;
+            }
+            // The first (highest-priority) matching pattern claims the process.
+            if let Some((index, (_, game_id, display_name))) = cached
+                .patterns
+                .iter()
+                .enumerate()
+                .find(|(_, (pattern_lower, _, _))| {
+                    match crate::config::game_glob(pattern_lower) {
+                        Some(glob) => crate::config::glob_match(glob, proc_name),
+                        // Case-insensitive prefix match OR exact match (matches Windows behavior)
+                        None => {
+                            starts_with_ignore_ascii_case(proc_name, pattern_lower)
+                                || proc_name.eq_ignore_ascii_case(pattern_lower)
+                        }
+                    }
+                })
+                && seen_ids.insert(game_id.as_str())
+            {
+                found_games.push((index, game_id.clone(), display_name.clone()));
             }
         }
 
-        found_games
+        found_games.sort_by_key(|(index, _, _)| *index);
+        let found_games = found_games
+            .into_iter()
+            .map(|(_, game_id, display_name)| (game_id, display_name))
+            .collect();
+        (found_games, processes.len())
     }
 
     async fn get_process_names(&self) -> anyhow::Result<Vec<String>> {
@@ -260,6 +334,43 @@ impl GameSensor {
     }
 }
 
+/// Publish `process_count` if it (or the thread total) moved since `last`.
+/// Threads come from `/proc/loadavg`, whose 4th field is "running/total"
+/// scheduling entities - one read instead of a stat per PID.
+async fn publish_process_count(
+    state: &AppState,
+    processes: usize,
+    last: &mut Option<(usize, Option<u32>)>,
+) {
+    let threads = fs::read_to_string("/proc/loadavg")
+        .ok()
+        .and_then(|s| parse_loadavg_threads(&s));
+    if *last == Some((processes, threads)) {
+        return;
+    }
+    *last = Some((processes, threads));
+    state
+        .mqtt
+        .publish_sensor_retained("process_count", &processes.to_string())
+        .await;
+    let attrs = serde_json::json!({ "threads": threads });
+    state
+        .mqtt
+        .publish_sensor_attributes("process_count", &attrs)
+        .await;
+}
+
+/// Total thread count from `/proc/loadavg` ("0.52 0.58 0.59 2/1107 52341").
+fn parse_loadavg_threads(loadavg: &str) -> Option<u32> {
+    loadavg
+        .split_whitespace()
+        .nth(3)?
+        .split_once('/')?
+        .1
+        .parse()
+        .ok()
+}
+
 /// Case-insensitive ASCII prefix check without allocation. An empty prefix never
 /// matches - otherwise a blank/misconfigured game pattern reports every process.
 fn starts_with_ignore_ascii_case(haystack: &str, prefix: &str) -> bool {
@@ -284,3 +395,18 @@ fn running_state(games: &[(String, String)]) -> (String, String) {
 pub(crate) fn current_process_names() -> Vec<String> {
     GameSensor::get_process_names_blocking().unwrap_or_default()
 }
+
+#[cfg(test)]
+mod tests {
+    use super::parse_loadavg_threads;
+
+    #[test]
+    fn test_parse_loadavg_threads() {
+        assert_eq!(
+            parse_loadavg_threads("0.52 0.58 0.59 2/1107 52341\n"),
+            Some(1107)
+        );
+        assert_eq!(parse_loadavg_threads("0.52 0.58"), None);
+        assert_eq!(parse_loadavg_threads(""), None);
+    }
+}
@@ -0,0 +1,61 @@
+//! Heartbeat sensor
+//!
+//! Publishes a counter to `heartbeat` every `intervals.heartbeat` seconds,
+//! 1 on startup and one higher each beat. Availability only reports whether
+//! the MQTT connection is up; an agent that is connected but has stopped
+//! publishing (a blocked runtime, a wedged publish path) still shows "online".
+//! The heartbeat goes through the same runtime and publish path as every
+//! other sensor, so HA can alert when it stops advancing.
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+pub struct HeartbeatSensor {
+    state: Arc<AppState>,
+}
+
+impl HeartbeatSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut interval_secs = self.state.config.read().await.intervals.heartbeat.max(1);
+        let mut tick = interval(Duration::from_secs(interval_secs));
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut config_rx = self.state.config_generation.subscribe();
+        let mut beats: u64 = 0;
+
+        info!("Heartbeat sensor started (every {}s)", interval_secs);
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Heartbeat sensor shutting down");
+                    break;
+                }
+                Ok(()) = config_rx.recv() => {
+                    let new_secs = self.state.config.read().await.intervals.heartbeat.max(1);
+                    if new_secs != interval_secs {
+                        interval_secs = new_secs;
+                        tick = interval(Duration::from_secs(interval_secs));
+                        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+                        info!("Heartbeat interval changed to {}s", interval_secs);
+                    }
+                }
+                _ = tick.tick() => {
+                    beats += 1;
+                    self.state
+                        .mqtt
+                        .publish_sensor("heartbeat", &beats.to_string())
+                        .await;
+                }
+            }
+        }
+    }
+}
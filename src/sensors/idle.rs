@@ -6,6 +6,12 @@
 //!   - `idle_seconds`: seconds since last keyboard/mouse input (numeric, HA-friendly)
 //!   - `lastactive`:   RFC3339 timestamp of last input (frozen while idle)
 //!
+//! GetLastInputInfo never sees game controllers, so with `idle_include_gamepad`
+//! every tick also polls XInput. A controller counts as input if its packet
+//! number moved since the last tick (any input at all, so taps between ticks
+//! still count), or if a button is held, a trigger pulled or a stick outside
+//! its dead zone right now.
+//!
 //! IMPORTANT: GetLastInputInfo only reports input for the session the calling
 //! process is attached to. If the bridge ever runs outside the interactive user
 //! session (e.g. as a session-0 service) the call fails; we surface that as a
@@ -17,11 +23,82 @@ use std::time::Duration;
 use time::OffsetDateTime;
 use time::format_description::well_known::Rfc3339;
 use tokio::time::{MissedTickBehavior, interval};
+use windows::Win32::Foundation::ERROR_SUCCESS;
 use windows::Win32::System::SystemInformation::GetTickCount64;
 use windows::Win32::UI::Input::KeyboardAndMouse::{GetLastInputInfo, LASTINPUTINFO};
+use windows::Win32::UI::Input::XboxController::{XINPUT_GAMEPAD, XINPUT_STATE, XInputGetState};
 
 use crate::AppState;
 
+/// XInput.h's recommended dead zones: stick deflection or trigger pull below
+/// these is noise from an idle controller, not a player.
+const LEFT_THUMB_DEADZONE: i64 = 7849;
+const RIGHT_THUMB_DEADZONE: i64 = 8689;
+const TRIGGER_THRESHOLD: u8 = 30;
+/// XInput serves at most four controllers.
+const XUSER_MAX_COUNT: u32 = 4;
+
+/// Last time any controller was seen in use (`idle_include_gamepad`).
+#[derive(Default)]
+struct GamepadActivity {
+    /// GetTickCount64 at the last poll that found a controller in use
+    last_active_tick: Option<u64>,
+    /// Each slot's `dwPacketNumber` at the previous poll (None: not connected)
+    last_packets: [Option<u32>; XUSER_MAX_COUNT as usize],
+}
+
+impl GamepadActivity {
+    /// Poll the controllers; milliseconds since one was last in use, or
+    /// `None` if none has been since the sensor started.
+    fn idle_ms(&mut self) -> Option<i64> {
+        // SAFETY: GetTickCount64 has no preconditions.
+        let now = unsafe { GetTickCount64() };
+        if self.poll_any_active() {
+            self.last_active_tick = Some(now);
+        }
+        self.last_active_tick
+            .map(|tick| now.saturating_sub(tick) as i64)
+    }
+
+    /// Read every slot, remembering its packet number for the next poll.
+    fn poll_any_active(&mut self) -> bool {
+        let mut active = false;
+        for (slot, last_packet) in (0..XUSER_MAX_COUNT).zip(&mut self.last_packets) {
+            let mut state = XINPUT_STATE::default();
+            // SAFETY: state is a stack out-struct of the type XInput fills; an
+            // empty slot just returns ERROR_DEVICE_NOT_CONNECTED.
+            let status = unsafe { XInputGetState(slot, &raw mut state) };
+            let packet = (status == ERROR_SUCCESS.0).then_some(state.dwPacketNumber);
+            let previous = std::mem::replace(last_packet, packet);
+            if let Some(packet) = packet {
+                active |= packet_changed(previous, packet) || gamepad_engaged(&state.Gamepad);
+            }
+        }
+        active
+    }
+}
+
+/// Whether a controller's input changed since the previous poll. XInput bumps
+/// the packet number on every change; a controller that just connected has
+/// nothing to compare against yet.
+fn packet_changed(previous: Option<u32>, packet: u32) -> bool {
+    previous.is_some_and(|previous| previous != packet)
+}
+
+/// Whether a controller is being used right now: any button down, or a
+/// trigger or stick past its dead zone.
+fn gamepad_engaged(pad: &XINPUT_GAMEPAD) -> bool {
+    let outside = |x: i16, y: i16, deadzone: i64| {
+        let (x, y) = (i64::from(x), i64::from(y));
+        x * x + y * y > deadzone * deadzone
+    };
+    pad.wButtons.0 != 0
+        || pad.bLeftTrigger > TRIGGER_THRESHOLD
+        || pad.bRightTrigger > TRIGGER_THRESHOLD
+        || outside(pad.sThumbLX, pad.sThumbLY, LEFT_THUMB_DEADZONE)
+        || outside(pad.sThumbRX, pad.sThumbRY, RIGHT_THUMB_DEADZONE)
+}
+
 /// Format an OffsetDateTime as RFC 3339 string
 fn format_rfc3339(dt: OffsetDateTime) -> String {
     dt.format(&Rfc3339).unwrap_or_else(|_| dt.to_string())
@@ -39,6 +116,7 @@ impl IdleSensor {
     pub async fn run(self) {
         let config = self.state.config.read().await;
         let interval_secs = config.intervals.last_active.max(1); // Prevent panic on 0
+        let mut gamepad = config.idle_include_gamepad.then(GamepadActivity::default);
         drop(config);
 
         let mut tick = interval(Duration::from_secs(interval_secs));
@@ -61,6 +139,7 @@ impl IdleSensor {
             &mut prev_idle_secs,
             &mut prev_lastactive_secs,
             &mut query_failed,
+            gamepad.as_mut(),
         )
         .await;
 
@@ -87,6 +166,11 @@ impl IdleSensor {
                 Ok(()) = config_rx.recv() => {
                     let config = self.state.config.read().await;
                     let new_interval = config.intervals.last_active.max(1);
+                    if config.idle_include_gamepad != gamepad.is_some() {
+                        gamepad = config
+                            .idle_include_gamepad
+                            .then(GamepadActivity::default);
+                    }
                     drop(config);
                     tick = interval(Duration::from_secs(new_interval));
                     tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
@@ -99,7 +183,13 @@ impl IdleSensor {
                     prev_lastactive_secs = i64::MIN;
                 }
                 _ = tick.tick() => {
-                    self.publish_idle(&mut prev_idle_secs, &mut prev_lastactive_secs, &mut query_failed).await;
+                    self.publish_idle(
+                        &mut prev_idle_secs,
+                        &mut prev_lastactive_secs,
+                        &mut query_failed,
+                        gamepad.as_mut(),
+                    )
+                    .await;
                 }
                 result = process_rx.recv() => {
                     // Process list changed - check screensaver state immediately
@@ -133,7 +223,8 @@ impl IdleSensor {
         }
     }
 
-    /// Poll idle time and publish `idle_seconds` + `lastactive`.
+    /// Poll idle time and publish `idle_seconds` + `lastactive`. With
+    /// `gamepad`, controller input counts as input too.
     ///
     /// On query failure we keep the last published value rather than fabricating
     /// "active now" - the old behaviour made the PC look perpetually busy, which
@@ -143,8 +234,9 @@ impl IdleSensor {
         prev_idle_secs: &mut i64,
         prev_lastactive_secs: &mut i64,
         query_failed: &mut bool,
+        gamepad: Option<&mut GamepadActivity>,
     ) {
-        let Some(idle_ms) = self.get_idle_ms() else {
+        let Some(mut idle_ms) = Self::get_idle_ms() else {
             if !*query_failed {
                 warn!(
                     "GetLastInputInfo failed - pausing idle updates (last values retained). \
@@ -159,6 +251,10 @@ impl IdleSensor {
             *query_failed = false;
         }
 
+        if let Some(pad_ms) = gamepad.and_then(GamepadActivity::idle_ms) {
+            idle_ms = idle_ms.min(pad_ms);
+        }
+
         let idle_secs = (idle_ms / 1000).max(0);
         debug!("Idle: {idle_secs}s since last input");
 
@@ -185,7 +281,7 @@ impl IdleSensor {
 
     /// Milliseconds since the last keyboard/mouse input, or `None` if the query
     /// failed (e.g. no access to the interactive input desktop).
-    fn get_idle_ms(&self) -> Option<i64> {
+    pub(crate) fn get_idle_ms() -> Option<i64> {
         unsafe {
             let mut lii = LASTINPUTINFO {
                 cbSize: std::mem::size_of::<LASTINPUTINFO>() as u32,
@@ -202,3 +298,42 @@ impl IdleSensor {
         }
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use windows::Win32::UI::Input::XboxController::XINPUT_GAMEPAD_A;
+
+    #[test]
+    fn test_gamepad_engaged() {
+        let resting = XINPUT_GAMEPAD {
+            sThumbLX: 1200, // typical stick drift
+            sThumbRY: -900,
+            bLeftTrigger: 4,
+            ..Default::default()
+        };
+        assert!(!gamepad_engaged(&resting));
+        assert!(gamepad_engaged(&XINPUT_GAMEPAD {
+            wButtons: XINPUT_GAMEPAD_A,
+            ..resting
+        }));
+        assert!(gamepad_engaged(&XINPUT_GAMEPAD {
+            sThumbLX: 6000,
+            sThumbLY: 6000, // past the dead zone only diagonally
+            ..resting
+        }));
+        assert!(gamepad_engaged(&XINPUT_GAMEPAD {
+            bRightTrigger: 200,
+            ..resting
+        }));
+    }
+
+    #[test]
+    fn test_packet_changed() {
+        // A tap between polls leaves the pad at rest but moves the packet number.
+        assert!(packet_changed(Some(41), 42));
+        assert!(!packet_changed(Some(42), 42));
+        // Newly connected: no baseline, so not activity by itself.
+        assert!(!packet_changed(None, 7));
+    }
+}
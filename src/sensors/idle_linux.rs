@@ -151,7 +151,7 @@ impl IdleSensor {
             .flatten()
     }
 
-    fn get_idle_seconds_blocking() -> Option<i64> {
+    pub(crate) fn get_idle_seconds_blocking() -> Option<i64> {
         // On Wayland, XWayland's screensaver counter doesn't track Wayland-native
         // input, so the X11 paths (x11rb/xprintidle) would report the user as idle
         // while active. Use the compositor's D-Bus idle there; on X11, x11rb is
@@ -0,0 +1,150 @@
+//! Metered connection sensor - Windows only.
+//!
+//! Publishes "on" to `metered_connection` while the internet connection
+//! profile has a cost (a phone hotspot, or a network the user marked as
+//! metered), with the cost type and roaming/data-limit flags as attributes.
+//! Read from WinRT `NetworkInformation::GetInternetConnectionProfile()`
+//! every 30s; with no internet connection at all it reports "off".
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+const POLL_INTERVAL: Duration = Duration::from_secs(30);
+
+/// Cost of the current internet connection profile.
+#[derive(Debug, Clone, PartialEq, Eq, Default)]
+struct ConnectionCost {
+    /// `unrestricted`, `fixed`, `variable` or `unknown`; `none` without a
+    /// connection.
+    cost_type: &'static str,
+    roaming: bool,
+    over_data_limit: bool,
+    approaching_data_limit: bool,
+}
+
+impl ConnectionCost {
+    /// Windows treats a fixed (data cap) or variable (pay per byte) plan as
+    /// metered, and so does roaming or being over the cap on any plan.
+    fn metered(&self) -> bool {
+        matches!(self.cost_type, "fixed" | "variable") || self.roaming || self.over_data_limit
+    }
+
+    fn attributes(&self) -> serde_json::Value {
+        serde_json::json!({
+            "cost_type": self.cost_type,
+            "roaming": self.roaming,
+            "over_data_limit": self.over_data_limit,
+            "approaching_data_limit": self.approaching_data_limit,
+        })
+    }
+}
+
+pub struct MeteredSensor {
+    state: Arc<AppState>,
+}
+
+impl MeteredSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut tick = interval(POLL_INTERVAL);
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev: Option<ConnectionCost> = None;
+
+        info!(
+            "Metered connection sensor started (polled every {}s)",
+            POLL_INTERVAL.as_secs()
+        );
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Metered connection sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev = None;
+                }
+                _ = tick.tick() => {
+                    // WinRT activation + profile query; keep it off the runtime.
+                    let Ok(cost) = tokio::task::spawn_blocking(read_cost).await else {
+                        continue;
+                    };
+                    if prev.as_ref() == Some(&cost) {
+                        continue;
+                    }
+                    let state = if cost.metered() { "on" } else { "off" };
+                    self.state
+                        .mqtt
+                        .publish_sensor_retained("metered_connection", state)
+                        .await;
+                    self.state
+                        .mqtt
+                        .publish_sensor_attributes("metered_connection", &cost.attributes())
+                        .await;
+                    prev = Some(cost);
+                }
+            }
+        }
+    }
+}
+
+fn read_cost() -> ConnectionCost {
+    use windows::Networking::Connectivity::{NetworkCostType, NetworkInformation};
+
+    // Fails (null profile) when there is no internet connection.
+    let Ok(cost) =
+        NetworkInformation::GetInternetConnectionProfile().and_then(|p| p.GetConnectionCost())
+    else {
+        return ConnectionCost {
+            cost_type: "none",
+            ..Default::default()
+        };
+    };
+    let cost_type = match cost.NetworkCostType() {
+        Ok(NetworkCostType::Unrestricted) => "unrestricted",
+        Ok(NetworkCostType::Fixed) => "fixed",
+        Ok(NetworkCostType::Variable) => "variable",
+        _ => "unknown",
+    };
+    ConnectionCost {
+        cost_type,
+        roaming: cost.Roaming().unwrap_or(false),
+        over_data_limit: cost.OverDataLimit().unwrap_or(false),
+        approaching_data_limit: cost.ApproachingDataLimit().unwrap_or(false),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn cost(cost_type: &'static str) -> ConnectionCost {
+        ConnectionCost {
+            cost_type,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_metered() {
+        assert!(!cost("unrestricted").metered());
+        assert!(!cost("none").metered());
+        assert!(!cost("unknown").metered());
+        assert!(cost("fixed").metered());
+        assert!(cost("variable").metered());
+        let roaming = ConnectionCost {
+            roaming: true,
+            ..cost("unrestricted")
+        };
+        assert!(roaming.metered());
+    }
+}
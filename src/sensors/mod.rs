@@ -2,26 +2,43 @@
 
 mod audio_device;
 mod capture;
+mod command_slots;
 mod custom;
 mod disk;
+mod game_hooks;
 mod gpu;
+mod heartbeat;
 mod network;
 mod now_playing;
 mod system;
+mod tcp_connections;
 mod uptime;
 mod volume;
+mod vram;
 
 pub mod hwinfo;
 
+#[cfg(windows)]
+mod audio_peak;
+#[cfg(windows)]
+mod focus_assist;
 #[cfg(windows)]
 mod games;
 #[cfg(windows)]
 mod idle;
 #[cfg(windows)]
+mod metered;
+#[cfg(windows)]
 mod process_watcher;
 #[cfg(windows)]
+mod remote_session;
+#[cfg(windows)]
 mod session;
 mod steam;
+#[cfg(windows)]
+mod window_fullscreen;
+#[cfg(windows)]
+mod windows_version;
 
 #[cfg(unix)]
 mod games_linux;
@@ -32,24 +49,43 @@ mod session_linux;
 
 pub use audio_device::AudioDeviceSensor;
 pub use capture::CaptureSensor;
+pub use command_slots::CommandSlotsSensor;
 pub use custom::CustomSensorManager;
 pub use disk::DiskSensor;
 pub use gpu::GpuSensor;
+pub use heartbeat::HeartbeatSensor;
 pub use network::NetworkSensor;
 pub use now_playing::NowPlayingSensor;
 pub use system::{ActiveWindowSensor, SystemSensor};
+pub use tcp_connections::TcpConnectionsSensor;
 pub use uptime::UptimeSensor;
+pub(crate) use uptime::get_system_uptime;
 pub use volume::VolumeSensor;
+pub use vram::VramSensor;
 
+#[cfg(windows)]
+pub use audio_peak::AudioPeakSensor;
+#[cfg(windows)]
+pub use focus_assist::FocusAssistSensor;
 #[cfg(windows)]
 pub use games::GameSensor;
 #[cfg(windows)]
 pub use idle::IdleSensor;
 #[cfg(windows)]
+pub use metered::MeteredSensor;
+#[cfg(windows)]
 pub use process_watcher::ProcessWatcher;
 #[cfg(windows)]
+pub use remote_session::RemoteSessionSensor;
+#[cfg(windows)]
 pub use session::SessionSensor;
 pub use steam::SteamSensor;
+#[cfg(windows)]
+pub use window_fullscreen::WindowFullscreenSensor;
+#[cfg(windows)]
+pub use windows_version::WindowsVersionSensor;
+#[cfg(windows)]
+pub(crate) use windows_version::os_label as windows_version_label;
 
 #[cfg(unix)]
 pub use games_linux::GameSensor;
@@ -1,7 +1,8 @@
 //! Now Playing (media session) sensor.
 //!
 //! Publishes "playing: Artist - Title" / "paused: ..." / "idle" to the
-//! `now_playing` sensor.
+//! `now_playing` sensor, with `status` / `artist` / `title` as separate
+//! attributes so dashboards can lay them out individually.
 //! - Windows: System Media Transport Controls (GSMTC), on a dedicated MTA
 //!   thread so we init COM once, cache the session manager, and never land on
 //!   an STA blocking-pool thread (where a WinRT async `.get()` would hang with
@@ -19,6 +20,54 @@ use tokio::time::{Duration, MissedTickBehavior, interval};
 #[cfg(unix)]
 static PLAYERCTL_WARNED: std::sync::atomic::AtomicBool = std::sync::atomic::AtomicBool::new(false);
 
+/// One media-session snapshot. Both platforms fill this in so the state string
+/// and the attributes are derived the same way.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+struct MediaInfo {
+    status: String,
+    artist: String,
+    title: String,
+}
+
+impl MediaInfo {
+    fn new(status: &str, artist: &str, title: &str) -> Self {
+        Self {
+            status: status.trim().to_string(),
+            artist: artist.trim().to_string(),
+            title: title.trim().to_string(),
+        }
+    }
+
+    fn is_idle(&self) -> bool {
+        self.status.is_empty() || (self.artist.is_empty() && self.title.is_empty())
+    }
+
+    /// Sensor value: "status: Artist - Title", collapsing an empty artist or
+    /// title (no dangling " - "), or "idle" when nothing is playing.
+    fn state(&self) -> String {
+        if self.is_idle() {
+            return "idle".to_string();
+        }
+        let label = match (self.artist.is_empty(), self.title.is_empty()) {
+            (false, false) => format!("{} - {}", self.artist, self.title),
+            (true, _) => self.title.clone(),
+            (false, true) => self.artist.clone(),
+        };
+        format!("{}: {label}", self.status)
+    }
+
+    fn attributes(&self) -> serde_json::Value {
+        if self.is_idle() {
+            return serde_json::json!({ "status": "idle", "artist": "", "title": "" });
+        }
+        serde_json::json!({
+            "status": self.status,
+            "artist": self.artist,
+            "title": self.title,
+        })
+    }
+}
+
 pub struct NowPlayingSensor {
     state: Arc<AppState>,
 }
@@ -34,10 +83,10 @@ impl NowPlayingSensor {
 
         let mut shutdown_rx = shutdown.subscribe();
         let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
-        let mut prev = String::new();
+        let mut prev: Option<MediaInfo> = None;
 
         let stop = Arc::new(AtomicBool::new(false));
-        let (tx, mut rx) = tokio::sync::mpsc::channel::<String>(4);
+        let (tx, mut rx) = tokio::sync::mpsc::channel::<MediaInfo>(4);
         let thread_stop = Arc::clone(&stop);
         if let Err(e) = std::thread::Builder::new()
             .name("now-playing".into())
@@ -70,15 +119,12 @@ impl NowPlayingSensor {
                     break;
                 }
                 Ok(()) = reconnect_rx.recv() => {
-                    prev.clear();
+                    prev = None;
                 }
                 Some(now) = rx.recv() => {
-                    if now != prev {
-                        self.state
-                            .mqtt
-                            .publish_sensor_retained("now_playing", &now)
-                            .await;
-                        prev = now;
+                    if prev.as_ref() != Some(&now) {
+                        self.publish(&now).await;
+                        prev = Some(now);
                     }
                 }
             }
@@ -91,7 +137,7 @@ impl NowPlayingSensor {
         tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
         let mut shutdown_rx = shutdown.subscribe();
         let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
-        let mut prev = String::new();
+        let mut prev: Option<MediaInfo> = None;
 
         info!("Now playing sensor started (Linux playerctl, polled every 5s)");
 
@@ -103,24 +149,32 @@ impl NowPlayingSensor {
                     break;
                 }
                 Ok(()) = reconnect_rx.recv() => {
-                    prev.clear();
+                    prev = None;
                 }
                 _ = tick.tick() => {
                     // The subprocess blocks; keep it off the async runtime.
                     let now = tokio::task::spawn_blocking(read_now_playing)
                         .await
-                        .unwrap_or_else(|_| "idle".to_string());
-                    if now != prev {
-                        self.state
-                            .mqtt
-                            .publish_sensor_retained("now_playing", &now)
-                            .await;
-                        prev = now;
+                        .unwrap_or_default();
+                    if prev.as_ref() != Some(&now) {
+                        self.publish(&now).await;
+                        prev = Some(now);
                     }
                 }
             }
         }
     }
+
+    async fn publish(&self, info: &MediaInfo) {
+        self.state
+            .mqtt
+            .publish_sensor_retained("now_playing", &info.state())
+            .await;
+        self.state
+            .mqtt
+            .publish_sensor_attributes("now_playing", &info.attributes())
+            .await;
+    }
 }
 
 /// Dedicated-thread loop: init COM (MTA) once, request the GSMTC manager once,
@@ -129,7 +183,7 @@ impl NowPlayingSensor {
 #[cfg(windows)]
 fn windows_media_loop(
     stop: &std::sync::atomic::AtomicBool,
-    tx: &tokio::sync::mpsc::Sender<String>,
+    tx: &tokio::sync::mpsc::Sender<MediaInfo>,
 ) {
     use std::sync::atomic::Ordering;
     use windows::Media::Control::GlobalSystemMediaTransportControlsSessionManager as Manager;
@@ -146,10 +200,10 @@ fn windows_media_loop(
             // still None (initial activation failure).
             manager = Manager::RequestAsync().ok().and_then(|op| op.get().ok());
         }
-        let value = manager.as_ref().map_or_else(
-            || "idle".to_string(),
-            |m| read_session(m).unwrap_or_else(|_| "idle".to_string()),
-        );
+        let value = manager
+            .as_ref()
+            .and_then(|m| read_session(m).ok())
+            .unwrap_or_default();
         if tx.blocking_send(value).is_err() {
             break; // async side dropped
         }
@@ -174,34 +228,28 @@ fn windows_media_loop(
 #[cfg(windows)]
 fn read_session(
     manager: &windows::Media::Control::GlobalSystemMediaTransportControlsSessionManager,
-) -> windows_core::Result<String> {
+) -> windows_core::Result<MediaInfo> {
     use windows::Media::Control::GlobalSystemMediaTransportControlsSessionPlaybackStatus as Status;
 
     let session = manager.GetCurrentSession()?;
-    let status = session.GetPlaybackInfo()?.PlaybackStatus()?;
+    let playback = session.GetPlaybackInfo()?.PlaybackStatus()?;
     let props = session.TryGetMediaPropertiesAsync()?.get()?;
     let title = props.Title()?.to_string();
     let artist = props.Artist()?.to_string();
 
-    let label = match (artist.trim().is_empty(), title.trim().is_empty()) {
-        (false, false) => format!("{} - {}", artist.trim(), title.trim()),
-        (true, false) => title.trim().to_string(),
-        (false, true) => artist.trim().to_string(),
-        (true, true) => return Ok("idle".to_string()),
-    };
-    let prefix = if status == Status::Playing {
+    let status = if playback == Status::Playing {
         "playing"
-    } else if status == Status::Paused {
+    } else if playback == Status::Paused {
         "paused"
     } else {
         "stopped"
     };
-    Ok(format!("{prefix}: {label}"))
+    Ok(MediaInfo::new(status, &artist, &title))
 }
 
-/// MPRIS via `playerctl`. Returns "idle" when no player is active.
+/// MPRIS via `playerctl`. Returns an idle snapshot when no player is active.
 #[cfg(unix)]
-fn read_now_playing() -> String {
+fn read_now_playing() -> MediaInfo {
     use std::process::Command;
     // Tab-delimited fields so empty artist/title can be collapsed the same way
     // the Windows branch does (a combined "artist - title" string would be
@@ -223,56 +271,76 @@ fn read_now_playing() -> String {
                     "playerctl not found; now-playing will report 'idle' (install playerctl)"
                 );
             }
-            return "idle".to_string();
+            return MediaInfo::default();
         }
     };
     if !out.status.success() {
-        return "idle".to_string();
+        return MediaInfo::default();
     }
     parse_playerctl(&String::from_utf8_lossy(&out.stdout))
 }
 
-/// Turn a tab-delimited "status\tartist\ttitle" line into a sensor value,
-/// collapsing empty artist/title exactly like the Windows branch.
+/// Split a tab-delimited "status\tartist\ttitle" line into a snapshot.
 #[cfg(unix)]
-fn parse_playerctl(raw: &str) -> String {
+fn parse_playerctl(raw: &str) -> MediaInfo {
     let line = raw.trim_end_matches(['\n', '\r']);
     let mut parts = line.splitn(3, '\t');
-    let status = parts.next().unwrap_or("").trim();
-    let artist = parts.next().unwrap_or("").trim();
-    let title = parts.next().unwrap_or("").trim();
-
-    let label = match (artist.is_empty(), title.is_empty()) {
-        (false, false) => format!("{artist} - {title}"),
-        (true, false) => title.to_string(),
-        (false, true) => artist.to_string(),
-        (true, true) => return "idle".to_string(),
-    };
-    if status.is_empty() {
-        "idle".to_string()
-    } else {
-        format!("{status}: {label}")
-    }
+    let status = parts.next().unwrap_or("");
+    let artist = parts.next().unwrap_or("");
+    let title = parts.next().unwrap_or("");
+    MediaInfo::new(status, artist, title)
 }
 
-#[cfg(all(test, unix))]
+#[cfg(test)]
 mod tests {
-    use super::parse_playerctl;
+    use super::MediaInfo;
 
     #[test]
-    fn test_parse_playerctl() {
+    fn test_media_info_state() {
         assert_eq!(
-            parse_playerctl("playing\tQueen\tBohemian Rhapsody\n"),
+            MediaInfo::new("playing", "Queen", "Bohemian Rhapsody").state(),
             "playing: Queen - Bohemian Rhapsody"
         );
         // Empty artist / empty title collapse (no dangling " - ").
         assert_eq!(
-            parse_playerctl("playing\t\tBohemian Rhapsody"),
+            MediaInfo::new("playing", "", "Bohemian Rhapsody").state(),
             "playing: Bohemian Rhapsody"
         );
-        assert_eq!(parse_playerctl("paused\tArtist\t"), "paused: Artist");
-        // No metadata / no player -> idle.
-        assert_eq!(parse_playerctl("playing\t\t"), "idle");
-        assert_eq!(parse_playerctl(""), "idle");
+        assert_eq!(
+            MediaInfo::new("paused", "Artist", "").state(),
+            "paused: Artist"
+        );
+        // No metadata / no status -> idle.
+        assert_eq!(MediaInfo::new("playing", "", "").state(), "idle");
+        assert_eq!(MediaInfo::default().state(), "idle");
+    }
+
+    #[test]
+    fn test_media_info_attributes() {
+        let attrs = MediaInfo::new("playing", " Queen ", "Bohemian Rhapsody").attributes();
+        assert_eq!(attrs["status"], "playing");
+        assert_eq!(attrs["artist"], "Queen");
+        assert_eq!(attrs["title"], "Bohemian Rhapsody");
+
+        // Idle never leaks a stale status alongside empty fields.
+        let idle = MediaInfo::new("stopped", "", "").attributes();
+        assert_eq!(idle["status"], "idle");
+        assert_eq!(idle["title"], "");
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_parse_playerctl() {
+        use super::parse_playerctl;
+
+        assert_eq!(
+            parse_playerctl("playing\tQueen\tBohemian Rhapsody\n"),
+            MediaInfo::new("playing", "Queen", "Bohemian Rhapsody")
+        );
+        assert_eq!(
+            parse_playerctl("paused\t\tTitle\r\n").state(),
+            "paused: Title"
+        );
+        assert_eq!(parse_playerctl("").state(), "idle");
     }
 }
@@ -15,10 +15,6 @@ use std::collections::HashSet;
 use std::sync::Arc;
 use std::time::{Duration, Instant};
 use tokio::sync::{RwLock, broadcast, mpsc};
-use windows::Win32::Foundation::CloseHandle;
-use windows::Win32::System::Diagnostics::ToolHelp::{
-    CreateToolhelp32Snapshot, PROCESSENTRY32W, Process32FirstW, Process32NextW, TH32CS_SNAPPROCESS,
-};
 use wmi::{COMLibrary, WMIConnection};
 
 /// Notification sent when process list changes
@@ -59,6 +55,9 @@ pub struct ProcessState {
     name_counts: std::collections::HashMap<Arc<str>, u32>,
     /// Count of running .scr (screensaver) processes for O(1) lookup
     scr_count: u32,
+    /// Threads across all processes as of the last ToolHelp snapshot. WMI
+    /// events don't carry thread counts, so this only moves on reconcile.
+    thread_count: u32,
     /// Last update time (for diagnostics)
     last_updated: Instant,
 }
@@ -70,6 +69,7 @@ impl ProcessState {
             pid_to_name: std::collections::HashMap::new(),
             name_counts: std::collections::HashMap::new(),
             scr_count: 0,
+            thread_count: 0,
             last_updated: Instant::now(),
         }
     }
@@ -124,6 +124,16 @@ impl ProcessState {
     pub fn names(&self) -> &HashSet<Arc<str>> {
         &self.names
     }
+
+    /// Number of running processes (one per tracked PID)
+    pub fn process_count(&self) -> usize {
+        self.pid_to_name.len()
+    }
+
+    /// Total thread count from the most recent snapshot
+    pub fn thread_count(&self) -> u32 {
+        self.thread_count
+    }
 }
 
 /// Event sent from WMI threads to the async event processor
@@ -192,18 +202,20 @@ impl ProcessWatcher {
     /// Perform initial process enumeration using ToolHelp API.
     /// Reuses `snapshot_all_processes` to avoid code duplication.
     async fn initial_enumeration(state: &Arc<RwLock<ProcessState>>) {
-        let processes = match tokio::task::spawn_blocking(Self::snapshot_all_processes).await {
-            Ok(s) => s,
-            Err(e) => {
-                error!("Initial process enumeration failed: {}", e);
-                return;
-            }
-        };
+        let (processes, threads) =
+            match tokio::task::spawn_blocking(Self::snapshot_all_processes).await {
+                Ok(s) => s,
+                Err(e) => {
+                    error!("Initial process enumeration failed: {}", e);
+                    return;
+                }
+            };
 
         let mut guard = state.write().await;
         for (pid, name) in processes {
             guard.add_process(name, pid);
         }
+        guard.thread_count = threads;
 
         info!(
             "Initial process enumeration: {} processes",
@@ -436,12 +448,14 @@ impl ProcessWatcher {
     /// and prune stale PID entries (prevents memory leak from WMI event loss).
     /// Returns (pruned, added) counts for callers to decide whether to notify.
     async fn reconcile(state: &Arc<RwLock<ProcessState>>) -> (usize, usize) {
-        let snapshot = match tokio::task::spawn_blocking(Self::snapshot_all_processes).await {
-            Ok(s) => s,
-            Err(_) => return (0, 0),
-        };
+        let (snapshot, threads) =
+            match tokio::task::spawn_blocking(Self::snapshot_all_processes).await {
+                Ok(s) => s,
+                Err(_) => return (0, 0),
+            };
 
         let mut guard = state.write().await;
+        guard.thread_count = threads;
 
         // Remove PIDs no longer running
         let expired: Vec<u32> = guard
@@ -479,43 +493,19 @@ impl ProcessWatcher {
         (pruned, added)
     }
 
-    /// Take a full process snapshot using ToolHelp API
-    fn snapshot_all_processes() -> std::collections::HashMap<u32, String> {
-        let mut pids = std::collections::HashMap::new();
-
-        // SAFETY: CreateToolhelp32Snapshot and Process32 enumeration are
-        // standard Win32 APIs for process listing. Handle is properly closed.
-        unsafe {
-            if let Ok(snapshot) = CreateToolhelp32Snapshot(TH32CS_SNAPPROCESS, 0) {
-                let mut entry = PROCESSENTRY32W {
-                    dwSize: std::mem::size_of::<PROCESSENTRY32W>() as u32,
-                    ..Default::default()
-                };
-
-                if Process32FirstW(snapshot, &raw mut entry).is_ok() {
-                    loop {
-                        // Slice to null terminator before converting, avoiding
-                        // a 260-char allocation for every process entry.
-                        let nul_pos = entry
-                            .szExeFile
-                            .iter()
-                            .position(|&c| c == 0)
-                            .unwrap_or(entry.szExeFile.len());
-                        let name = String::from_utf16_lossy(&entry.szExeFile[..nul_pos]);
-                        if !name.is_empty() {
-                            pids.insert(entry.th32ProcessID, name);
-                        }
-                        if Process32NextW(snapshot, &raw mut entry).is_err() {
-                            break;
-                        }
-                    }
-                }
-
-                let _ = CloseHandle(snapshot);
-            }
-        }
-
-        pids
+    /// Take a full process snapshot (`proclist::snapshot`). Also returns the
+    /// thread total (summed `cntThreads`), which the walk gives us for free.
+    fn snapshot_all_processes() -> (std::collections::HashMap<u32, String>, u32) {
+        let processes = crate::proclist::snapshot().unwrap_or_default();
+        let threads = processes
+            .iter()
+            .fold(0u32, |acc, p| acc.saturating_add(p.threads));
+        let pids = processes
+            .into_iter()
+            .filter(|p| !p.name.is_empty())
+            .map(|p| (p.pid, p.name))
+            .collect();
+        (pids, threads)
     }
 
     /// Polling fallback if WMI events aren't available.
@@ -0,0 +1,135 @@
+//! Remote session sensor - Windows only.
+//!
+//! Publishes "on" to `remote_session` while the bridge's session is a Remote
+//! Desktop session (`GetSystemMetrics(SM_REMOTESESSION)`), with the RDP
+//! client's machine name as an attribute, so presence automations can tell
+//! "at the PC" from "RDP'd in". Polled every 5s; running as a service
+//! (session 0) it always reports "off".
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+const POLL_INTERVAL: Duration = Duration::from_secs(5);
+
+#[derive(Debug, Clone, PartialEq, Eq, Default)]
+struct RemoteSession {
+    remote: bool,
+    /// Name of the machine the RDP client runs on; `None` at the console.
+    client_name: Option<String>,
+}
+
+impl RemoteSession {
+    fn attributes(&self) -> serde_json::Value {
+        serde_json::json!({
+            "client_name": self.client_name,
+        })
+    }
+}
+
+pub struct RemoteSessionSensor {
+    state: Arc<AppState>,
+}
+
+impl RemoteSessionSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut tick = interval(POLL_INTERVAL);
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev: Option<RemoteSession> = None;
+
+        info!(
+            "Remote session sensor started (polled every {}s)",
+            POLL_INTERVAL.as_secs()
+        );
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Remote session sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev = None;
+                }
+                _ = tick.tick() => {
+                    let session = read_session();
+                    if prev.as_ref() == Some(&session) {
+                        continue;
+                    }
+                    let state = if session.remote { "on" } else { "off" };
+                    self.state
+                        .mqtt
+                        .publish_sensor_retained("remote_session", state)
+                        .await;
+                    self.state
+                        .mqtt
+                        .publish_sensor_attributes("remote_session", &session.attributes())
+                        .await;
+                    prev = Some(session);
+                }
+            }
+        }
+    }
+}
+
+fn read_session() -> RemoteSession {
+    use windows::Win32::UI::WindowsAndMessaging::{GetSystemMetrics, SM_REMOTESESSION};
+
+    // SAFETY: GetSystemMetrics only reads system state.
+    let remote = unsafe { GetSystemMetrics(SM_REMOTESESSION) } != 0;
+    RemoteSession {
+        remote,
+        client_name: if remote { client_name() } else { None },
+    }
+}
+
+/// `WTSClientName` of the current session.
+fn client_name() -> Option<String> {
+    use windows::Win32::System::RemoteDesktop::{
+        WTS_CURRENT_SERVER_HANDLE, WTS_CURRENT_SESSION, WTSClientName, WTSFreeMemory,
+        WTSQuerySessionInformationW,
+    };
+    use windows::core::PWSTR;
+
+    let mut buf = PWSTR::null();
+    let mut len = 0u32;
+    // SAFETY: on success WTS allocates `buf`, a NUL-terminated string we read
+    // once and hand back to WTSFreeMemory.
+    unsafe {
+        WTSQuerySessionInformationW(
+            WTS_CURRENT_SERVER_HANDLE,
+            WTS_CURRENT_SESSION,
+            WTSClientName,
+            &raw mut buf,
+            &raw mut len,
+        )
+        .ok()?;
+        let name = buf.to_string().ok();
+        WTSFreeMemory(buf.0.cast());
+        name.map(|n| n.trim().to_string()).filter(|n| !n.is_empty())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_attributes() {
+        let remote = RemoteSession {
+            remote: true,
+            client_name: Some("LAPTOP-7F3K".to_string()),
+        };
+        assert_eq!(remote.attributes()["client_name"], "LAPTOP-7F3K");
+        assert!(RemoteSession::default().attributes()["client_name"].is_null());
+    }
+}
@@ -1,6 +1,6 @@
 //! System sensors - CPU, memory, battery, active window
 //!
-//! - CPU/memory: polled (inherently sampled metrics)
+//! - CPU/memory: polled (inherently sampled metrics); CPU clock rides the CPU tick
 //! - Battery: event-driven via RegisterPowerSettingNotification (instant on plug/unplug/level change)
 //! - Active window: event-driven via SetWinEventHook(EVENT_SYSTEM_FOREGROUND) (instant on focus change)
 
@@ -21,6 +21,8 @@ pub struct SystemSensor {
 /// Tracks previous sensor values to skip duplicate MQTT publishes
 struct PrevSystemValues {
     cpu: String,
+    cpu_mhz: String,
+    cpu_clock: Option<CpuClock>,
     mem: String,
     battery_level: String,
     battery_charging: String,
@@ -31,6 +33,8 @@ impl PrevSystemValues {
     fn new() -> Self {
         Self {
             cpu: String::new(),
+            cpu_mhz: String::new(),
+            cpu_clock: None,
             mem: String::new(),
             battery_level: String::new(),
             battery_charging: String::new(),
@@ -209,6 +213,27 @@ impl SystemSensor {
             self.state.mqtt.publish_sensor("cpu_usage", &cpu_str).await;
             prev.cpu = cpu_str;
         }
+
+        // Clock speed: dips under load show thermal or power throttling that
+        // usage alone doesn't.
+        let clock = get_cpu_clock();
+        let mhz_str =
+            clock.map_or_else(|| "unavailable".to_string(), |c| c.current_mhz.to_string());
+        if mhz_str != prev.cpu_mhz {
+            self.state.mqtt.publish_sensor("cpu_mhz", &mhz_str).await;
+            prev.cpu_mhz = mhz_str;
+        }
+        if let Some(clock) = clock
+            && prev
+                .cpu_clock
+                .is_none_or(|p| p.max_mhz != clock.max_mhz || p.limit_mhz != clock.limit_mhz)
+        {
+            self.state
+                .mqtt
+                .publish_sensor_attributes("cpu_mhz", &clock.attributes())
+                .await;
+        }
+        prev.cpu_clock = clock;
     }
 
     async fn publish_memory(&self, prev: &mut PrevSystemValues) {
@@ -788,6 +813,133 @@ fn calculate_cpu_usage(prev: &mut CpuTimes) -> f64 {
     usage.clamp(0.0, 100.0)
 }
 
+// ============================================================================
+// CPU Clock - Native via CallNtPowerInformation (powrprof)
+// ============================================================================
+
+/// Clock speed averaged over the logical processors.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+struct CpuClock {
+    current_mhz: u32,
+    /// Rated maximum; on Windows this is usually the base clock
+    max_mhz: Option<u32>,
+    /// Current cap from the power plan or a thermal limit
+    limit_mhz: Option<u32>,
+}
+
+impl CpuClock {
+    /// Average of the per-processor readings; `None` when there are none.
+    fn average(cores: &[Self]) -> Option<Self> {
+        let count = u64::try_from(cores.len()).ok().filter(|&n| n > 0)?;
+        let total: u64 = cores.iter().map(|c| u64::from(c.current_mhz)).sum();
+        Some(Self {
+            current_mhz: u32::try_from(total / count).unwrap_or(u32::MAX),
+            max_mhz: cores.iter().filter_map(|c| c.max_mhz).max(),
+            limit_mhz: cores.iter().filter_map(|c| c.limit_mhz).max(),
+        })
+    }
+
+    fn attributes(&self) -> serde_json::Value {
+        serde_json::json!({
+            "max_mhz": self.max_mhz,
+            "limit_mhz": self.limit_mhz,
+        })
+    }
+}
+
+/// Mirrors `PROCESSOR_POWER_INFORMATION` (one per logical processor).
+#[cfg(windows)]
+#[repr(C)]
+#[derive(Default, Clone, Copy)]
+struct ProcessorPowerInformation {
+    number: u32,
+    max_mhz: u32,
+    current_mhz: u32,
+    mhz_limit: u32,
+    max_idle_state: u32,
+    current_idle_state: u32,
+}
+
+#[cfg(windows)]
+fn get_cpu_clock() -> Option<CpuClock> {
+    use windows::Win32::System::Power::{CallNtPowerInformation, ProcessorInformation};
+    use windows::Win32::System::SystemInformation::{GetSystemInfo, SYSTEM_INFO};
+
+    let mut info = SYSTEM_INFO::default();
+    // SAFETY: GetSystemInfo only fills the struct.
+    unsafe { GetSystemInfo(&raw mut info) };
+    // The call fails unless the buffer holds one entry per processor.
+    let mut cores = vec![ProcessorPowerInformation::default(); info.dwNumberOfProcessors as usize];
+    let len = u32::try_from(std::mem::size_of_val(cores.as_slice())).ok()?;
+    // SAFETY: the output buffer is `len` bytes of PROCESSOR_POWER_INFORMATION.
+    let status = unsafe {
+        CallNtPowerInformation(
+            ProcessorInformation,
+            None,
+            0,
+            Some(cores.as_mut_ptr().cast()),
+            len,
+        )
+    };
+    if status.is_err() {
+        return None;
+    }
+    let cores: Vec<CpuClock> = cores
+        .iter()
+        .map(|c| CpuClock {
+            current_mhz: c.current_mhz,
+            max_mhz: Some(c.max_mhz).filter(|&m| m > 0),
+            limit_mhz: Some(c.mhz_limit).filter(|&m| m > 0),
+        })
+        .collect();
+    CpuClock::average(&cores)
+}
+
+/// From cpufreq (`scaling_cur_freq`, in kHz), falling back to the
+/// `cpu MHz` lines of /proc/cpuinfo on VMs without cpufreq.
+#[cfg(unix)]
+fn get_cpu_clock() -> Option<CpuClock> {
+    let khz = |path: std::path::PathBuf| -> Option<u32> {
+        let v: u32 = std::fs::read_to_string(path).ok()?.trim().parse().ok()?;
+        Some(v / 1000).filter(|&m| m > 0)
+    };
+    let mut cores = Vec::new();
+    if let Ok(entries) = std::fs::read_dir("/sys/devices/system/cpu") {
+        for entry in entries.flatten() {
+            let freq = entry.path().join("cpufreq");
+            if let Some(current_mhz) = khz(freq.join("scaling_cur_freq")) {
+                cores.push(CpuClock {
+                    current_mhz,
+                    max_mhz: khz(freq.join("cpuinfo_max_freq")),
+                    limit_mhz: khz(freq.join("scaling_max_freq")),
+                });
+            }
+        }
+    }
+    if cores.is_empty() {
+        let cpuinfo = std::fs::read_to_string("/proc/cpuinfo").ok()?;
+        cores = parse_cpuinfo_mhz(&cpuinfo)
+            .into_iter()
+            .map(|current_mhz| CpuClock {
+                current_mhz,
+                max_mhz: None,
+                limit_mhz: None,
+            })
+            .collect();
+    }
+    CpuClock::average(&cores)
+}
+
+#[cfg(unix)]
+fn parse_cpuinfo_mhz(cpuinfo: &str) -> Vec<u32> {
+    cpuinfo
+        .lines()
+        .filter(|line| line.starts_with("cpu MHz"))
+        .filter_map(|line| line.split(':').nth(1)?.trim().parse::<f64>().ok())
+        .map(|mhz| mhz.round() as u32)
+        .collect()
+}
+
 // ============================================================================
 // Memory Usage - Native via GlobalMemoryStatusEx
 // ============================================================================
@@ -1189,6 +1341,33 @@ mod tests {
         assert_eq!(parse_meminfo_value("MemTotal: not-a-number kB"), 0);
     }
 
+    #[test]
+    fn test_cpu_clock_average() {
+        let core = |current_mhz, max_mhz| CpuClock {
+            current_mhz,
+            max_mhz,
+            limit_mhz: None,
+        };
+        let clock = CpuClock::average(&[
+            core(3600, Some(4200)),
+            core(4700, None),
+            core(800, Some(4200)),
+        ])
+        .unwrap();
+        assert_eq!(clock.current_mhz, 3033);
+        assert_eq!(clock.max_mhz, Some(4200));
+        assert_eq!(clock.limit_mhz, None);
+        assert!(CpuClock::average(&[]).is_none());
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_parse_cpuinfo_mhz() {
+        let cpuinfo = "processor\t: 0\ncpu MHz\t\t: 3599.998\ncache size\t: 512 KB\n\nprocessor\t: 1\ncpu MHz\t\t: 2200.000\n";
+        assert_eq!(parse_cpuinfo_mhz(cpuinfo), vec![3600, 2200]);
+        assert!(parse_cpuinfo_mhz("model name\t: ARMv8").is_empty());
+    }
+
     #[cfg(windows)]
     #[test]
     fn test_filetime_to_u64_combines_high_and_low() {
@@ -0,0 +1,304 @@
+//! TCP connections sensor
+//!
+//! Publishes the number of established TCP connections (IPv4 and IPv6) to
+//! `tcp_connections`, with the number of listening sockets as a `listening`
+//! attribute. Loopback traffic - local services talking to each other, and
+//! listeners only reachable from this PC - is left out, so the count follows
+//! actual network activity. Polled at `intervals.network`.
+//! - Windows: GetExtendedTcpTable (IP Helper API)
+//! - Linux: /proc/net/tcp and /proc/net/tcp6
+
+use log::{debug, info};
+use std::net::IpAddr;
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+pub struct TcpConnectionsSensor {
+    state: Arc<AppState>,
+}
+
+impl TcpConnectionsSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let interval_secs = self.state.config.read().await.intervals.network.max(1);
+        let mut tick = interval(Duration::from_secs(interval_secs));
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev: Option<TcpCounts> = None;
+
+        info!(
+            "TCP connections sensor started (polled every {}s)",
+            interval_secs
+        );
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("TCP connections sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev = None;
+                }
+                _ = tick.tick() => {
+                    // Walks the whole connection table; keep it off the runtime.
+                    let Ok(Some(counts)) = tokio::task::spawn_blocking(read_counts).await else {
+                        continue;
+                    };
+                    if prev == Some(counts) {
+                        continue;
+                    }
+                    self.state
+                        .mqtt
+                        .publish_sensor("tcp_connections", &counts.established.to_string())
+                        .await;
+                    let attrs = serde_json::json!({ "listening": counts.listening });
+                    self.state
+                        .mqtt
+                        .publish_sensor_attributes("tcp_connections", &attrs)
+                        .await;
+                    prev = Some(counts);
+                }
+            }
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+struct TcpCounts {
+    established: u32,
+    listening: u32,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum TcpState {
+    Established,
+    Listen,
+    Other,
+}
+
+/// Count `(state, local, remote)` socket rows, skipping loopback ones.
+fn tally(rows: impl IntoIterator<Item = (TcpState, IpAddr, IpAddr)>) -> TcpCounts {
+    let mut counts = TcpCounts::default();
+    for (state, local, remote) in rows {
+        match state {
+            TcpState::Established if !is_loopback(remote) => counts.established += 1,
+            TcpState::Listen if !is_loopback(local) => counts.listening += 1,
+            _ => {}
+        }
+    }
+    counts
+}
+
+/// Loopback, including IPv4 loopback mapped into IPv6 (`::ffff:127.0.0.1`).
+fn is_loopback(addr: IpAddr) -> bool {
+    match addr {
+        IpAddr::V4(v4) => v4.is_loopback(),
+        IpAddr::V6(v6) => {
+            v6.is_loopback() || v6.to_ipv4_mapped().is_some_and(|v4| v4.is_loopback())
+        }
+    }
+}
+
+#[cfg(windows)]
+fn read_counts() -> Option<TcpCounts> {
+    use std::net::{Ipv4Addr, Ipv6Addr};
+    use windows::Win32::NetworkManagement::IpHelper::{
+        MIB_TCP6ROW_OWNER_PID, MIB_TCP6TABLE_OWNER_PID, MIB_TCPROW_OWNER_PID,
+        MIB_TCPTABLE_OWNER_PID,
+    };
+    use windows::Win32::Networking::WinSock::{AF_INET, AF_INET6};
+
+    let v4 = tcp_table(AF_INET.0.into())?;
+    let v6 = tcp_table(AF_INET6.0.into())?;
+    // SAFETY: each buffer holds the table GetExtendedTcpTable wrote for its
+    // family, `dwNumEntries` rows long, and is u32-aligned.
+    let (v4_rows, v6_rows) = unsafe {
+        let t4 = &*v4.as_ptr().cast::<MIB_TCPTABLE_OWNER_PID>();
+        let t6 = &*v6.as_ptr().cast::<MIB_TCP6TABLE_OWNER_PID>();
+        (
+            std::slice::from_raw_parts::<MIB_TCPROW_OWNER_PID>(
+                t4.table.as_ptr(),
+                t4.dwNumEntries as usize,
+            ),
+            std::slice::from_raw_parts::<MIB_TCP6ROW_OWNER_PID>(
+                t6.table.as_ptr(),
+                t6.dwNumEntries as usize,
+            ),
+        )
+    };
+
+    // Addresses are in network byte order.
+    let v4_addr = |a: u32| IpAddr::V4(Ipv4Addr::from(a.to_ne_bytes()));
+    let rows = v4_rows
+        .iter()
+        .map(|r| {
+            (
+                windows_state(r.dwState),
+                v4_addr(r.dwLocalAddr),
+                v4_addr(r.dwRemoteAddr),
+            )
+        })
+        .chain(v6_rows.iter().map(|r| {
+            (
+                windows_state(r.dwState),
+                IpAddr::V6(Ipv6Addr::from(r.ucLocalAddr)),
+                IpAddr::V6(Ipv6Addr::from(r.ucRemoteAddr)),
+            )
+        }));
+    Some(tally(rows))
+}
+
+/// MIB_TCP_STATE values: 2 = LISTEN, 5 = ESTAB.
+#[cfg(windows)]
+fn windows_state(state: u32) -> TcpState {
+    match state {
+        5 => TcpState::Established,
+        2 => TcpState::Listen,
+        _ => TcpState::Other,
+    }
+}
+
+/// The TCP table for one address family, as u32s so the rows are aligned.
+#[cfg(windows)]
+fn tcp_table(family: u32) -> Option<Vec<u32>> {
+    use windows::Win32::Foundation::{ERROR_INSUFFICIENT_BUFFER, NO_ERROR};
+    use windows::Win32::NetworkManagement::IpHelper::{
+        GetExtendedTcpTable, TCP_TABLE_OWNER_PID_ALL,
+    };
+
+    let mut size = 0u32;
+    // The first call only reports the size; the table can grow before the
+    // next one, so retry a couple of times.
+    for _ in 0..3 {
+        let mut buf = vec![0u32; (size as usize).div_ceil(4)];
+        let ptr = (!buf.is_empty()).then(|| buf.as_mut_ptr().cast());
+        // SAFETY: `buf` is at least `size` bytes, as the API requires.
+        let ret = unsafe {
+            GetExtendedTcpTable(
+                ptr,
+                &raw mut size,
+                false,
+                family,
+                TCP_TABLE_OWNER_PID_ALL,
+                0,
+            )
+        };
+        if ret == NO_ERROR.0 && !buf.is_empty() {
+            return Some(buf);
+        }
+        if ret != ERROR_INSUFFICIENT_BUFFER.0 {
+            return None;
+        }
+    }
+    None
+}
+
+#[cfg(unix)]
+fn read_counts() -> Option<TcpCounts> {
+    let v4 = std::fs::read_to_string("/proc/net/tcp").ok()?;
+    // No IPv6 in the kernel: no tcp6 file.
+    let v6 = std::fs::read_to_string("/proc/net/tcp6").unwrap_or_default();
+    Some(tally(
+        parse_proc_net_tcp(&v4).chain(parse_proc_net_tcp(&v6)),
+    ))
+}
+
+/// Rows of a `/proc/net/tcp` or `/proc/net/tcp6` table.
+#[cfg(unix)]
+fn parse_proc_net_tcp(content: &str) -> impl Iterator<Item = (TcpState, IpAddr, IpAddr)> + '_ {
+    content.lines().skip(1).filter_map(|line| {
+        let mut fields = line.split_whitespace().skip(1);
+        let local = parse_proc_addr(fields.next()?)?;
+        let remote = parse_proc_addr(fields.next()?)?;
+        let state = match fields.next()? {
+            "01" => TcpState::Established,
+            "0A" => TcpState::Listen,
+            _ => TcpState::Other,
+        };
+        Some((state, local, remote))
+    })
+}
+
+/// `ADDR:PORT` as /proc prints it: the address is hex, one 32-bit word (tcp)
+/// or four (tcp6), each in host byte order.
+#[cfg(unix)]
+fn parse_proc_addr(field: &str) -> Option<IpAddr> {
+    let (hex, _port) = field.split_once(':')?;
+    let word = |i: usize| u32::from_str_radix(hex.get(i * 8..i * 8 + 8)?, 16).ok();
+    match hex.len() {
+        8 => Some(IpAddr::from(word(0)?.to_ne_bytes())),
+        32 => {
+            let mut bytes = [0u8; 16];
+            for (i, chunk) in bytes.chunks_exact_mut(4).enumerate() {
+                chunk.copy_from_slice(&word(i)?.to_ne_bytes());
+            }
+            Some(IpAddr::from(bytes))
+        }
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_tally_skips_loopback() {
+        let ip = |s: &str| s.parse::<IpAddr>().unwrap();
+        let rows = [
+            (TcpState::Established, ip("192.168.1.5"), ip("140.82.112.3")),
+            (TcpState::Established, ip("127.0.0.1"), ip("127.0.0.1")),
+            (TcpState::Established, ip("::1"), ip("::1")),
+            (
+                TcpState::Established,
+                ip("::ffff:127.0.0.1"),
+                ip("::ffff:127.0.0.1"),
+            ),
+            (TcpState::Established, ip("fe80::1"), ip("fe80::2")),
+            (TcpState::Listen, ip("0.0.0.0"), ip("0.0.0.0")),
+            (TcpState::Listen, ip("127.0.0.1"), ip("0.0.0.0")),
+            (TcpState::Other, ip("192.168.1.5"), ip("1.1.1.1")),
+        ];
+        assert_eq!(
+            tally(rows),
+            TcpCounts {
+                established: 2,
+                listening: 1,
+            }
+        );
+    }
+
+    #[cfg(all(unix, target_endian = "little"))]
+    #[test]
+    fn test_parse_proc_net_tcp() {
+        let v4 = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   122        0 23851 1 0000000000000000 100 0 0 10 0
+   1: 0501A8C0:D2F0 03704C8C:01BB 01 00000000:00000000 02:000A7D1E 00000000  1000        0 91425 2 0000000000000000 20 4 30 10 -1
+   2: 0100007F:9C40 0100007F:0CEA 01 00000000:00000000 00:00000000 00000000  1000        0 91426 1 0000000000000000 20 4 30 10 -1";
+        let v6 = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 18313 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000001000000:0277 00000000000000000000000001000000:D3A2 01 00000000:00000000 00:00000000 00000000     0        0 18314 1 0000000000000000 100 0 0 10 0";
+        let rows: Vec<_> = parse_proc_net_tcp(v4).collect();
+        assert_eq!(rows.len(), 3);
+        assert_eq!(rows[1].2, "140.76.112.3".parse::<IpAddr>().unwrap());
+        assert_eq!(
+            parse_proc_net_tcp(v6).nth(1).unwrap().1,
+            "::1".parse::<IpAddr>().unwrap()
+        );
+        assert_eq!(
+            tally(parse_proc_net_tcp(v4).chain(parse_proc_net_tcp(v6))),
+            TcpCounts {
+                established: 1,
+                listening: 1,
+            }
+        );
+    }
+}
@@ -63,13 +63,13 @@ impl UptimeSensor {
 }
 
 #[cfg(windows)]
-fn get_system_uptime() -> Option<u64> {
+pub(crate) fn get_system_uptime() -> Option<u64> {
     // GetTickCount64 returns milliseconds since system boot
     Some(unsafe { windows::Win32::System::SystemInformation::GetTickCount64() / 1000 })
 }
 
 #[cfg(unix)]
-fn get_system_uptime() -> Option<u64> {
+pub(crate) fn get_system_uptime() -> Option<u64> {
     let content = std::fs::read_to_string("/proc/uptime").ok()?;
     parse_proc_uptime(&content)
 }
@@ -0,0 +1,295 @@
+//! GPU memory (VRAM) sensor
+//!
+//! Publishes `vram_used_mb` and `vram_total_mb` (MiB) for the primary GPU.
+//!
+//! - Windows: DXGI picks the hardware adapter with the most dedicated memory
+//!   and reports its size, so it works the same on NVIDIA, AMD and Intel.
+//!   Usage comes from the `\GPU Adapter Memory(*)\Dedicated Usage` PDH counter
+//!   for that adapter's LUID: `IDXGIAdapter3::QueryVideoMemoryInfo` only
+//!   reports the calling process's own usage, which for the agent is ~0.
+//! - Linux: reads amdgpu's `mem_info_vram_used`/`mem_info_vram_total` from
+//!   /sys/class/drm/card0/device, or nvidia-smi.
+//!
+//! If neither source is available both sensors read "unavailable".
+
+use log::{debug, info};
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+
+use crate::AppState;
+
+const MIB: u64 = 1024 * 1024;
+
+pub struct VramSensor {
+    state: Arc<AppState>,
+}
+
+impl VramSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let config = self.state.config.read().await;
+        if !config.features.vram_sensor {
+            return;
+        }
+        // Shares the GPU poll interval; VRAM is graphed next to GPU usage.
+        let interval_secs = config.intervals.gpu.max(1);
+        drop(config);
+
+        let mut tick = interval(Duration::from_secs(interval_secs));
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        let mut prev_used = String::new();
+        let mut prev_total = String::new();
+
+        info!("VRAM sensor started (polled every {}s)", interval_secs);
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("VRAM sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev_used.clear();
+                    prev_total.clear();
+                }
+                _ = tick.tick() => {
+                    // DXGI/PDH on Windows, sysfs or an nvidia-smi fork on Linux.
+                    let Ok((used, total)) = tokio::task::spawn_blocking(get_vram).await else {
+                        continue;
+                    };
+                    if used != prev_used {
+                        self.state.mqtt.publish_sensor("vram_used_mb", &used).await;
+                        prev_used = used;
+                    }
+                    if total != prev_total {
+                        self.state.mqtt.publish_sensor("vram_total_mb", &total).await;
+                        prev_total = total;
+                    }
+                }
+            }
+        }
+    }
+}
+
+fn unavailable() -> (String, String) {
+    ("unavailable".to_string(), "unavailable".to_string())
+}
+
+/// (used, total) in MiB as sensor state strings.
+#[cfg(windows)]
+fn get_vram() -> (String, String) {
+    let Some((luid, total_bytes)) = primary_adapter() else {
+        return unavailable();
+    };
+    let used = adapter_dedicated_usage(&luid_instance_prefix(luid.HighPart, luid.LowPart))
+        .map_or_else(|| "unavailable".to_string(), |b| (b / MIB).to_string());
+    (used, (total_bytes / MIB).to_string())
+}
+
+/// The hardware adapter with the most dedicated VRAM (the discrete GPU on a
+/// hybrid laptop), skipping WARP / Basic Render Driver.
+#[cfg(windows)]
+fn primary_adapter() -> Option<(windows::Win32::Foundation::LUID, u64)> {
+    use windows::Win32::Graphics::Dxgi::{
+        CreateDXGIFactory1, DXGI_ADAPTER_FLAG_SOFTWARE, IDXGIFactory1,
+    };
+
+    // SAFETY: plain COM calls on interfaces owned by this function; DXGI
+    // factories don't need COM to be initialized on the calling thread.
+    unsafe {
+        let factory: IDXGIFactory1 = match CreateDXGIFactory1() {
+            Ok(f) => f,
+            Err(e) => {
+                debug!("DXGI unavailable: {}", e);
+                return None;
+            }
+        };
+        let mut best: Option<(windows::Win32::Foundation::LUID, u64)> = None;
+        let mut index = 0;
+        while let Ok(adapter) = factory.EnumAdapters1(index) {
+            index += 1;
+            let Ok(desc) = adapter.GetDesc1() else {
+                continue;
+            };
+            if desc.Flags & DXGI_ADAPTER_FLAG_SOFTWARE.0 as u32 != 0 {
+                continue;
+            }
+            let dedicated = desc.DedicatedVideoMemory as u64;
+            if best.is_none_or(|(_, b)| dedicated > b) {
+                best = Some((desc.AdapterLuid, dedicated));
+            }
+        }
+        best.filter(|&(_, total)| total > 0)
+    }
+}
+
+/// Sum of the `Dedicated Usage` counter instances (one per physical adapter
+/// behind a LUID) belonging to the adapter, in bytes.
+#[cfg(windows)]
+fn adapter_dedicated_usage(prefix: &str) -> Option<u64> {
+    use windows::Win32::System::Performance::{
+        PDH_CSTATUS_NEW_DATA, PDH_CSTATUS_VALID_DATA, PDH_FMT_COUNTERVALUE_ITEM_W, PDH_FMT_LARGE,
+        PdhAddEnglishCounterW, PdhCloseQuery, PdhCollectQueryData, PdhGetFormattedCounterArrayW,
+        PdhOpenQueryW,
+    };
+
+    // PDH "more data" - returned by the array getter's first (sizing) call.
+    const PDH_MORE_DATA: u32 = 0x8000_07D2;
+
+    // A raw (non-rate) counter: one sample is enough, so unlike the GPU usage
+    // query nothing has to persist between ticks.
+    //
+    // SAFETY: the query is closed on every path; the item buffer is sized from
+    // PDH's own byte count, as in gpu.rs.
+    unsafe {
+        let mut query: isize = 0;
+        if PdhOpenQueryW(None, 0, &raw mut query) != 0 {
+            return None;
+        }
+        let result = (|| {
+            let mut counter: isize = 0;
+            let path = windows::core::w!("\\GPU Adapter Memory(*)\\Dedicated Usage");
+            if PdhAddEnglishCounterW(query, path, 0, &raw mut counter) != 0
+                || PdhCollectQueryData(query) != 0
+            {
+                return None;
+            }
+            let mut buf_size: u32 = 0;
+            let mut item_count: u32 = 0;
+            let status = PdhGetFormattedCounterArrayW(
+                counter,
+                PDH_FMT_LARGE,
+                &raw mut buf_size,
+                &raw mut item_count,
+                None,
+            );
+            if status != PDH_MORE_DATA || buf_size == 0 {
+                return None;
+            }
+            let elem = std::mem::size_of::<PDH_FMT_COUNTERVALUE_ITEM_W>();
+            let mut buffer: Vec<PDH_FMT_COUNTERVALUE_ITEM_W> =
+                Vec::with_capacity((buf_size as usize).div_ceil(elem).max(1));
+            let status = PdhGetFormattedCounterArrayW(
+                counter,
+                PDH_FMT_LARGE,
+                &raw mut buf_size,
+                &raw mut item_count,
+                Some(buffer.as_mut_ptr()),
+            );
+            if status != 0 {
+                return None;
+            }
+            let items = std::slice::from_raw_parts(buffer.as_ptr(), item_count as usize);
+            let mut total = None;
+            for item in items {
+                if !matches!(
+                    item.FmtValue.CStatus,
+                    PDH_CSTATUS_VALID_DATA | PDH_CSTATUS_NEW_DATA
+                ) {
+                    continue;
+                }
+                let name = item.szName.to_string().unwrap_or_default();
+                if name.to_ascii_lowercase().starts_with(prefix) {
+                    let bytes = item.FmtValue.Anonymous.largeValue.max(0) as u64;
+                    total = Some(total.unwrap_or(0) + bytes);
+                }
+            }
+            total
+        })();
+        let _ = PdhCloseQuery(query);
+        result
+    }
+}
+
+/// `GPU Adapter Memory` instances are named `luid_0x<high>_0x<low>_phys_<n>`.
+#[cfg(windows)]
+fn luid_instance_prefix(high: i32, low: u32) -> String {
+    format!("luid_0x{:08x}_0x{:08x}_", high as u32, low)
+}
+
+#[cfg(unix)]
+fn get_vram() -> (String, String) {
+    use std::sync::atomic::{AtomicBool, Ordering};
+    // Once we learn nvidia-smi isn't installed, stop forking it every tick.
+    static NVIDIA_ABSENT: AtomicBool = AtomicBool::new(false);
+
+    let sysfs = |file: &str| {
+        std::fs::read_to_string(format!("/sys/class/drm/card0/device/{file}"))
+            .ok()
+            .and_then(|s| s.trim().parse::<u64>().ok())
+    };
+    if let (Some(used), Some(total)) = (sysfs("mem_info_vram_used"), sysfs("mem_info_vram_total"))
+        && total > 0
+    {
+        return ((used / MIB).to_string(), (total / MIB).to_string());
+    }
+
+    if !NVIDIA_ABSENT.load(Ordering::Relaxed) {
+        match std::process::Command::new("nvidia-smi")
+            .args([
+                "--query-gpu=memory.used,memory.total",
+                "--format=csv,noheader,nounits",
+            ])
+            .output()
+        {
+            Ok(output) if output.status.success() => {
+                if let Some((used, total)) =
+                    parse_nvidia_smi_memory(&String::from_utf8_lossy(&output.stdout))
+                {
+                    return (used.to_string(), total.to_string());
+                }
+            }
+            // Only a missing binary latches; see gpu.rs.
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => {
+                NVIDIA_ABSENT.store(true, Ordering::Relaxed);
+            }
+            _ => {}
+        }
+    }
+
+    unavailable()
+}
+
+/// Parse `nvidia-smi --query-gpu=memory.used,memory.total` CSV (MiB). Multi-GPU
+/// systems print one line per GPU; the first is reported.
+#[cfg(unix)]
+fn parse_nvidia_smi_memory(output: &str) -> Option<(u64, u64)> {
+    let (used, total) = output.lines().next()?.split_once(',')?;
+    Some((used.trim().parse().ok()?, total.trim().parse().ok()?))
+}
+
+#[cfg(test)]
+mod tests {
+    #[cfg(unix)]
+    use super::parse_nvidia_smi_memory;
+
+    #[cfg(unix)]
+    #[test]
+    fn test_parse_nvidia_smi_memory() {
+        assert_eq!(
+            parse_nvidia_smi_memory("3012, 12282\n"),
+            Some((3012, 12282))
+        );
+        assert_eq!(
+            parse_nvidia_smi_memory("100, 8192\n200, 24576\n"),
+            Some((100, 8192))
+        );
+        assert_eq!(parse_nvidia_smi_memory("[N/A], [N/A]\n"), None);
+        assert_eq!(parse_nvidia_smi_memory(""), None);
+    }
+
+    #[cfg(windows)]
+    #[test]
+    fn test_luid_instance_prefix() {
+        assert_eq!(
+            super::luid_instance_prefix(0, 0xD1A4),
+            "luid_0x00000000_0x0000d1a4_"
+        );
+    }
+}
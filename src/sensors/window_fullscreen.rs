@@ -0,0 +1,212 @@
+//! Per-window fullscreen sensor - Windows only.
+//!
+//! For every process in `fullscreen_windows`, publishes `fullscreen_<name>`
+//! as "on" while one of its visible windows covers a whole monitor (exclusive
+//! or borderless fullscreen alike), with the monitor's device name and whether
+//! it is the primary one as attributes. So "my game is fullscreen on the main
+//! monitor" is `state == on` and `primary == true`, while the same game
+//! windowed, or fullscreen on a side monitor, isn't.
+//!
+//! A window counts as fullscreen when its `GetWindowRect` contains the full
+//! `GetMonitorInfoW` rect of the monitor it is on. A maximized window must
+//! match it exactly: with the taskbar auto-hidden, a plain maximized window
+//! overhangs the monitor by its frame. Polled on the `game_sensor` interval;
+//! the watch list is re-read every poll, so a hot-reload applies on the next
+//! one.
+
+use log::{debug, info};
+use std::collections::HashMap;
+use std::sync::Arc;
+use tokio::time::{Duration, MissedTickBehavior, interval};
+use windows::Win32::Foundation::{HWND, RECT};
+
+use crate::AppState;
+use crate::config::fullscreen_sensor_id;
+
+/// `MONITORINFO::dwFlags` bit set on the primary monitor.
+const MONITORINFOF_PRIMARY: u32 = 1;
+
+/// The monitor a watched window is fullscreen on.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Placement {
+    /// GDI device name without the `\\.\` prefix, e.g. `DISPLAY1`
+    monitor: String,
+    primary: bool,
+}
+
+pub struct WindowFullscreenSensor {
+    state: Arc<AppState>,
+}
+
+impl WindowFullscreenSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let interval_secs = self.state.config.read().await.intervals.game_sensor.max(1);
+        let mut tick = interval(Duration::from_secs(interval_secs));
+        tick.set_missed_tick_behavior(MissedTickBehavior::Skip);
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+        // sensor id -> last published placement (None = "off")
+        let mut prev: HashMap<String, Option<Placement>> = HashMap::new();
+
+        info!(
+            "Window fullscreen sensor started (polled every {}s)",
+            interval_secs
+        );
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Window fullscreen sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    prev.clear();
+                }
+                _ = tick.tick() => {
+                    let watched = self.state.config.read().await.fullscreen_windows.clone();
+                    if watched.is_empty() {
+                        continue;
+                    }
+                    // ToolHelp snapshot + EnumWindows; keep them off the runtime.
+                    let Ok(placements) =
+                        tokio::task::spawn_blocking(move || scan(&watched)).await
+                    else {
+                        continue;
+                    };
+                    for (id, process, placement) in placements {
+                        if prev.get(&id) == Some(&placement) {
+                            continue;
+                        }
+                        let state = if placement.is_some() { "on" } else { "off" };
+                        let attrs = serde_json::json!({
+                            "process": process,
+                            "monitor": placement.as_ref().map(|p| p.monitor.as_str()),
+                            "primary": placement.as_ref().is_some_and(|p| p.primary),
+                        });
+                        self.state.mqtt.publish_sensor_retained(&id, state).await;
+                        self.state.mqtt.publish_sensor_attributes(&id, &attrs).await;
+                        prev.insert(id, placement);
+                    }
+                }
+            }
+        }
+    }
+}
+
+/// `(sensor id, configured process, placement)` for every watched process.
+fn scan(watched: &[String]) -> Vec<(String, String, Option<Placement>)> {
+    let processes = crate::proclist::snapshot().unwrap_or_default();
+    let windows = crate::proclist::visible_windows();
+    watched
+        .iter()
+        .filter_map(|process| {
+            let id = fullscreen_sensor_id(process)?;
+            let lower = process.trim().to_ascii_lowercase();
+            let stem = lower.strip_suffix(".exe").unwrap_or(&lower);
+            let placement = processes
+                .iter()
+                .filter(|p| {
+                    let name = p.name.to_ascii_lowercase();
+                    name.strip_suffix(".exe").unwrap_or(&name) == stem
+                })
+                .find_map(|p| {
+                    windows
+                        .iter()
+                        .filter(|(_, pid)| *pid == p.pid)
+                        .find_map(|(hwnd, _)| fullscreen_placement(*hwnd))
+                });
+            Some((id, process.trim().to_string(), placement))
+        })
+        .collect()
+}
+
+/// The monitor `hwnd` fills completely, if it does.
+fn fullscreen_placement(hwnd: HWND) -> Option<Placement> {
+    use windows::Win32::Graphics::Gdi::{
+        GetMonitorInfoW, MONITOR_DEFAULTTONULL, MONITORINFO, MONITORINFOEXW, MonitorFromWindow,
+    };
+    use windows::Win32::UI::WindowsAndMessaging::{GetWindowRect, IsZoomed};
+
+    // SAFETY: RECT/MONITORINFOEXW are stack out-structs; cbSize tells
+    // GetMonitorInfoW it may fill the EX variant.
+    unsafe {
+        let mut window = RECT::default();
+        GetWindowRect(hwnd, &raw mut window).ok()?;
+        let monitor = MonitorFromWindow(hwnd, MONITOR_DEFAULTTONULL);
+        if monitor.is_invalid() {
+            return None;
+        }
+        let mut info = MONITORINFOEXW::default();
+        info.monitorInfo.cbSize = std::mem::size_of::<MONITORINFOEXW>() as u32;
+        if !GetMonitorInfoW(monitor, (&raw mut info).cast::<MONITORINFO>()).as_bool() {
+            return None;
+        }
+        let maximized = IsZoomed(hwnd).as_bool();
+        covers(&window, &info.monitorInfo.rcMonitor, maximized).then(|| Placement {
+            monitor: device_name(&info.szDevice),
+            primary: info.monitorInfo.dwFlags & MONITORINFOF_PRIMARY != 0,
+        })
+    }
+}
+
+/// True when `window` contains all of `monitor` (fullscreen windows often
+/// overhang by their invisible border). A `maximized` window only counts
+/// when it matches exactly: overhanging by its frame is just a maximized
+/// window over an auto-hidden taskbar.
+fn covers(window: &RECT, monitor: &RECT, maximized: bool) -> bool {
+    if maximized {
+        return window == monitor;
+    }
+    window.left <= monitor.left
+        && window.top <= monitor.top
+        && window.right >= monitor.right
+        && window.bottom >= monitor.bottom
+}
+
+/// `\\.\DISPLAY1` -> `DISPLAY1`.
+fn device_name(raw: &[u16]) -> String {
+    let name = crate::proclist::exe_name_from_wide(raw);
+    name.strip_prefix(r"\\.\")
+        .map(str::to_string)
+        .unwrap_or(name)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn rect(left: i32, top: i32, right: i32, bottom: i32) -> RECT {
+        RECT {
+            left,
+            top,
+            right,
+            bottom,
+        }
+    }
+
+    #[test]
+    fn test_covers() {
+        let main = rect(0, 0, 2560, 1440);
+        assert!(covers(&rect(0, 0, 2560, 1440), &main, false));
+        assert!(covers(&rect(-8, -8, 2568, 1448), &main, false)); // border overhang
+        assert!(!covers(&rect(0, 0, 2560, 1400), &main, false)); // taskbar visible
+        // Fullscreen on a side monitor doesn't cover the main one.
+        assert!(!covers(&rect(2560, 0, 4480, 1080), &main, false));
+        // Maximized with the taskbar auto-hidden: the frame overhangs, but
+        // it's a normal window.
+        assert!(!covers(&rect(-8, -8, 2568, 1448), &main, true));
+        // Borderless fullscreen that is also maximized.
+        assert!(covers(&rect(0, 0, 2560, 1440), &main, true));
+    }
+
+    #[test]
+    fn test_device_name() {
+        let raw: Vec<u16> = r"\\.\DISPLAY2".encode_utf16().chain([0, 0]).collect();
+        assert_eq!(device_name(&raw), "DISPLAY2");
+    }
+}
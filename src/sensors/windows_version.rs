@@ -0,0 +1,168 @@
+//! Windows version sensor - Windows only.
+//!
+//! Publishes the OS release to the retained `windows_version` sensor, e.g.
+//! "Windows 11 23H2, build 22631", with the full build (update revision
+//! included) and edition as attributes. Read from
+//! `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion` when the sensor starts
+//! and republished on reconnect; the version only changes across a reboot.
+//!
+//! `ProductName` in that key still says "Windows 10" on Windows 11, so the
+//! major version comes from the build number instead (22000 and up is 11).
+
+use log::{debug, info, warn};
+use std::sync::Arc;
+
+use crate::AppState;
+
+/// First Windows 11 build.
+const WINDOWS_11_BUILD: u32 = 22_000;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct OsVersion {
+    build: u32,
+    /// Update build revision, the part after the dot in `22631.4317`
+    ubr: Option<u32>,
+    /// Feature release, e.g. `23H2` (`ReleaseId` like `1809` on older builds)
+    display_version: Option<String>,
+    /// e.g. `Professional`
+    edition: Option<String>,
+}
+
+impl OsVersion {
+    fn read() -> Option<Self> {
+        use winreg::RegKey;
+        use winreg::enums::HKEY_LOCAL_MACHINE;
+
+        let key = RegKey::predef(HKEY_LOCAL_MACHINE)
+            .open_subkey(r"SOFTWARE\Microsoft\Windows NT\CurrentVersion")
+            .ok()?;
+        let text = |name: &str| {
+            key.get_value::<String, _>(name)
+                .ok()
+                .map(|v| v.trim().to_string())
+                .filter(|v| !v.is_empty())
+        };
+        Some(Self {
+            build: text("CurrentBuild")?.parse().ok()?,
+            ubr: key.get_value::<u32, _>("UBR").ok(),
+            display_version: text("DisplayVersion").or_else(|| text("ReleaseId")),
+            edition: text("EditionID"),
+        })
+    }
+
+    /// Sensor state, e.g. "Windows 11 23H2, build 22631".
+    fn label(&self) -> String {
+        let major = if self.build >= WINDOWS_11_BUILD {
+            11
+        } else {
+            10
+        };
+        match &self.display_version {
+            Some(release) => format!("Windows {} {}, build {}", major, release, self.build),
+            None => format!("Windows {}, build {}", major, self.build),
+        }
+    }
+
+    fn attributes(&self) -> serde_json::Value {
+        let build = match self.ubr {
+            Some(ubr) => format!("{}.{}", self.build, ubr),
+            None => self.build.to_string(),
+        };
+        serde_json::json!({
+            "build": build,
+            "display_version": self.display_version,
+            "edition": self.edition,
+        })
+    }
+}
+
+/// The sensor's label ("Windows 11 23H2, build 22631"), for callers outside
+/// the sensor.
+pub(crate) fn os_label() -> Option<String> {
+    OsVersion::read().map(|v| v.label())
+}
+
+pub struct WindowsVersionSensor {
+    state: Arc<AppState>,
+}
+
+impl WindowsVersionSensor {
+    pub fn new(state: Arc<AppState>) -> Self {
+        Self { state }
+    }
+
+    pub async fn run(self) {
+        let mut shutdown_rx = self.state.shutdown_tx.subscribe();
+        let mut reconnect_rx = self.state.mqtt.subscribe_reconnect();
+
+        let Some(version) = OsVersion::read() else {
+            warn!("Windows version sensor: CurrentVersion registry key unreadable");
+            self.state
+                .mqtt
+                .publish_sensor_retained("windows_version", "unavailable")
+                .await;
+            return;
+        };
+        info!("Windows version sensor started ({})", version.label());
+        self.publish(&version).await;
+
+        loop {
+            tokio::select! {
+                biased;
+                _ = shutdown_rx.recv() => {
+                    debug!("Windows version sensor shutting down");
+                    break;
+                }
+                Ok(()) = reconnect_rx.recv() => {
+                    self.publish(&version).await;
+                }
+            }
+        }
+    }
+
+    async fn publish(&self, version: &OsVersion) {
+        self.state
+            .mqtt
+            .publish_sensor_retained("windows_version", &version.label())
+            .await;
+        self.state
+            .mqtt
+            .publish_sensor_attributes("windows_version", &version.attributes())
+            .await;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn version(build: u32, display_version: Option<&str>) -> OsVersion {
+        OsVersion {
+            build,
+            ubr: Some(4317),
+            display_version: display_version.map(str::to_string),
+            edition: Some("Professional".to_string()),
+        }
+    }
+
+    #[test]
+    fn test_label() {
+        assert_eq!(
+            version(22631, Some("23H2")).label(),
+            "Windows 11 23H2, build 22631"
+        );
+        assert_eq!(
+            version(19045, Some("22H2")).label(),
+            "Windows 10 22H2, build 19045"
+        );
+        assert_eq!(version(17763, None).label(), "Windows 10, build 17763");
+    }
+
+    #[test]
+    fn test_attributes() {
+        let attrs = version(22631, Some("23H2")).attributes();
+        assert_eq!(attrs["build"], "22631.4317");
+        assert_eq!(attrs["display_version"], "23H2");
+        assert_eq!(attrs["edition"], "Professional");
+    }
+}
@@ -389,7 +389,10 @@ fn run_wizard_flow(existing_config: bool) -> Option<SetupConfig> {
 
 /// Save the setup configuration to disk
 pub fn save_setup_config(config: &SetupConfig) -> std::io::Result<PathBuf> {
-    use crate::config::{Config, FeatureConfig, IntervalConfig, MqttConfig};
+    use crate::config::{
+        CommandAuthConfig, Config, DeviceConfig, FeatureConfig, GameModeConfig, IntervalConfig,
+        LoggingConfig, MqttConfig,
+    };
     use std::collections::HashMap;
 
     let full_config = Config {
@@ -399,6 +402,7 @@ pub fn save_setup_config(config: &SetupConfig) -> std::io::Result<PathBuf> {
             user: config.mqtt_user.clone(),
             pass: config.mqtt_pass.clone(),
             client_id: None,
+            client_cert: None,
         },
         intervals: IntervalConfig::default(),
         features: FeatureConfig {
@@ -434,6 +438,27 @@ pub fn save_setup_config(config: &SetupConfig) -> std::io::Result<PathBuf> {
             disk_sensor: false,
             uptime_sensor: false,
             hwinfo_sensor: false,
+            focus_assist: false,
+            process_count: false,
+            cmd_priority: false,
+            vram_sensor: false,
+            cmd_service: false,
+            audio_peak: false,
+            window_fullscreen: false,
+            cmd_window: false,
+            windows_version: false,
+            cmd_mouse: false,
+            metered_connection: false,
+            remote_session: false,
+            device_triggers: false,
+            cmd_registry: false,
+            heartbeat: false,
+            night_light: false,
+            game_mode: false,
+            command_slots: false,
+            cmd_explorer: false,
+            tcp_connections: false,
+            keep_awake: false,
         },
         games: HashMap::new(),
         custom_sensors_enabled: false,
@@ -452,6 +477,30 @@ pub fn save_setup_config(config: &SetupConfig) -> std::io::Result<PathBuf> {
         custom_commands: Vec::new(),
         update_channel: crate::config::default_update_channel(),
         disk_sensor_paths: Vec::new(),
+        game_exclusions: Vec::new(),
+        command_rate_limits: HashMap::new(),
+        custom_subscriptions: Vec::new(),
+        shutdown_grace_secs: 0,
+        wake_turns_on_display: true,
+        controllable_services: Vec::new(),
+        logging: LoggingConfig::default(),
+        game_priority: Vec::new(),
+        fullscreen_windows: Vec::new(),
+        bundle_state: false,
+        game_hooks: HashMap::new(),
+        idle_include_gamepad: false,
+        wake_skip_when_active: true,
+        reconnect_on_wake: false,
+        entities: HashMap::new(),
+        keep_games_on_empty_reload: true,
+        device: DeviceConfig::default(),
+        mirror: None,
+        notification_topics: Vec::new(),
+        max_notifications_per_minute: 10,
+        readable_registry_keys: Vec::new(),
+        button_payloads: vec!["PRESS".to_string()],
+        game_mode: GameModeConfig::default(),
+        command_auth: CommandAuthConfig::default(),
     };
 
     // Validate before saving so the wizard can't produce a config that then
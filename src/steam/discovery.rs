@@ -942,4 +942,58 @@ mod tests {
         };
         assert!(discovery.lookup("nonexistent.exe").is_none());
     }
+
+    // -- merging into the config --
+
+    #[test]
+    fn test_merge_keeps_manual_games() {
+        use crate::config::{Config, GameConfig};
+
+        let mut games = HashMap::new();
+        let lib = PathBuf::from("C:\\Steam");
+        for (app_id, name, exe) in [
+            (730, "Counter-Strike 2", "cs2.exe"),
+            (1086940, "Baldur's Gate 3", "bg3.exe"),
+        ] {
+            SteamGameDiscovery::add_game(
+                &mut games,
+                app_id,
+                name.to_string(),
+                exe.to_string(),
+                &lib,
+            );
+        }
+        let discovery = SteamGameDiscovery {
+            games,
+            build_time_ms: 0,
+            game_count: 2,
+            from_cache: false,
+        };
+
+        let mut config = Config::default();
+        config
+            .games
+            .insert("cs2".to_string(), GameConfig::Simple("cs".into()));
+        config
+            .games
+            .insert("osu".to_string(), GameConfig::Simple("osu".into()));
+        assert_eq!(config.merge_steam_games(&discovery), (1, 0));
+        // Discovered games are added alongside; a manual entry for the same
+        // key wins.
+        assert_eq!(config.games["cs2"].game_id(), "cs");
+        assert_eq!(config.games["bg3"].game_id(), "baldurs_gate_3");
+        assert!(config.games["bg3"].is_auto_discovered());
+
+        // Only discovered entries go when a game leaves the library.
+        let empty = SteamGameDiscovery {
+            games: HashMap::new(),
+            build_time_ms: 0,
+            game_count: 0,
+            from_cache: false,
+        };
+        assert_eq!(config.merge_steam_games(&empty), (0, 1));
+        let mut keys: Vec<_> = config.games.keys().map(String::as_str).collect();
+        keys.sort_unstable();
+        assert_eq!(keys, ["cs2", "osu"]);
+    }
 }
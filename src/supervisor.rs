@@ -2,8 +2,9 @@
 //! change, so enabling/disabling a feature takes effect live (no restart).
 //!
 //! Two kinds of supervised task:
-//! - Pure-async polling sensors (gpu, network, disk, uptime, games, custom,
-//!   steam, idle, volume, audio_device, capture) hold no per-task OS thread, so
+//! - Pure-async polling sensors (gpu, network, tcp_connections, disk, uptime,
+//!   heartbeat, command_slots, games, custom, steam, idle, volume, audio_device,
+//!   audio_peak, capture, window_fullscreen) hold no per-task OS thread, so
 //!   they're cancelled by dropping their future (`cancelable` selects the run()
 //!   future against a per-task cancel) - zero changes to those sensors.
 //! - Thread-holding sensors (system, session, now_playing, power) take the
@@ -23,12 +24,19 @@ use tokio::sync::broadcast;
 use tokio::task::JoinHandle;
 
 use crate::AppState;
+use crate::commands::switch::{SwitchStateSync, enabled_switches};
 use crate::config::Config;
 use crate::power::PowerEventListener;
 use crate::sensors::{
-    ActiveWindowSensor, AudioDeviceSensor, CaptureSensor, CustomSensorManager, DiskSensor,
-    GameSensor, GpuSensor, IdleSensor, NetworkSensor, NowPlayingSensor, SessionSensor, SteamSensor,
-    SystemSensor, UptimeSensor, VolumeSensor,
+    ActiveWindowSensor, AudioDeviceSensor, CaptureSensor, CommandSlotsSensor, CustomSensorManager,
+    DiskSensor, GameSensor, GpuSensor, HeartbeatSensor, IdleSensor, NetworkSensor,
+    NowPlayingSensor, SessionSensor, SteamSensor, SystemSensor, TcpConnectionsSensor, UptimeSensor,
+    VolumeSensor, VramSensor,
+};
+#[cfg(windows)]
+use crate::sensors::{
+    AudioPeakSensor, FocusAssistSensor, MeteredSensor, RemoteSessionSensor, WindowFullscreenSensor,
+    WindowsVersionSensor,
 };
 
 /// Run `fut` until it finishes on its own (global shutdown, handled inside the
@@ -60,11 +68,31 @@ const TASKS: &[TaskDef] = &[
         enabled: |c| c.features.gpu_sensor,
         spawn: |s, c| tokio::spawn(cancelable(GpuSensor::new(s).run(), c.subscribe())),
     },
+    TaskDef {
+        name: "switches",
+        enabled: |c| !enabled_switches(&c.features).is_empty(),
+        spawn: |s, c| tokio::spawn(cancelable(SwitchStateSync::new(s).run(), c.subscribe())),
+    },
+    TaskDef {
+        name: "vram",
+        enabled: |c| c.features.vram_sensor,
+        spawn: |s, c| tokio::spawn(cancelable(VramSensor::new(s).run(), c.subscribe())),
+    },
     TaskDef {
         name: "network",
         enabled: |c| c.features.network_sensor,
         spawn: |s, c| tokio::spawn(cancelable(NetworkSensor::new(s).run(), c.subscribe())),
     },
+    TaskDef {
+        name: "tcp_connections",
+        enabled: |c| c.features.tcp_connections,
+        spawn: |s, c| {
+            tokio::spawn(cancelable(
+                TcpConnectionsSensor::new(s).run(),
+                c.subscribe(),
+            ))
+        },
+    },
     TaskDef {
         name: "disk",
         enabled: |c| c.features.disk_sensor,
@@ -75,9 +103,19 @@ const TASKS: &[TaskDef] = &[
         enabled: |c| c.features.uptime_sensor,
         spawn: |s, c| tokio::spawn(cancelable(UptimeSensor::new(s).run(), c.subscribe())),
     },
+    TaskDef {
+        name: "heartbeat",
+        enabled: |c| c.features.heartbeat,
+        spawn: |s, c| tokio::spawn(cancelable(HeartbeatSensor::new(s).run(), c.subscribe())),
+    },
+    TaskDef {
+        name: "command_slots",
+        enabled: |c| c.features.command_slots,
+        spawn: |s, c| tokio::spawn(cancelable(CommandSlotsSensor::new(s).run(), c.subscribe())),
+    },
     TaskDef {
         name: "games",
-        enabled: |c| c.features.running_game || c.features.game_catalog,
+        enabled: |c| c.features.running_game || c.features.game_catalog || c.features.process_count,
         spawn: |s, c| tokio::spawn(cancelable(GameSensor::new(s).run(), c.subscribe())),
     },
     TaskDef {
@@ -114,6 +152,56 @@ const TASKS: &[TaskDef] = &[
         enabled: |c| c.features.mic || c.features.webcam,
         spawn: |s, c| tokio::spawn(cancelable(CaptureSensor::new(s).run(), c.subscribe())),
     },
+    // Focus Assist lives in Windows notification state; there's no Linux producer.
+    #[cfg(windows)]
+    TaskDef {
+        name: "focus_assist",
+        enabled: |c| c.features.focus_assist,
+        spawn: |s, c| tokio::spawn(cancelable(FocusAssistSensor::new(s).run(), c.subscribe())),
+    },
+    // WASAPI peak meter; pactl has no equivalent cheap one-shot read.
+    #[cfg(windows)]
+    TaskDef {
+        name: "audio_peak",
+        enabled: |c| c.features.audio_peak,
+        spawn: |s, c| tokio::spawn(cancelable(AudioPeakSensor::new(s).run(), c.subscribe())),
+    },
+    // Registry read once at start, republished on reconnect.
+    #[cfg(windows)]
+    TaskDef {
+        name: "windows_version",
+        enabled: |c| c.features.windows_version,
+        spawn: |s, c| {
+            tokio::spawn(cancelable(
+                WindowsVersionSensor::new(s).run(),
+                c.subscribe(),
+            ))
+        },
+    },
+    // WinRT connection profile, polled.
+    #[cfg(windows)]
+    TaskDef {
+        name: "metered_connection",
+        enabled: |c| c.features.metered_connection,
+        spawn: |s, c| tokio::spawn(cancelable(MeteredSensor::new(s).run(), c.subscribe())),
+    },
+    #[cfg(windows)]
+    TaskDef {
+        name: "remote_session",
+        enabled: |c| c.features.remote_session,
+        spawn: |s, c| tokio::spawn(cancelable(RemoteSessionSensor::new(s).run(), c.subscribe())),
+    },
+    #[cfg(windows)]
+    TaskDef {
+        name: "window_fullscreen",
+        enabled: |c| c.features.window_fullscreen && !c.fullscreen_windows.is_empty(),
+        spawn: |s, c| {
+            tokio::spawn(cancelable(
+                WindowFullscreenSensor::new(s).run(),
+                c.subscribe(),
+            ))
+        },
+    },
     // Thread-holding sensors: run() takes the per-task shutdown SENDER and uses it
     // (loop + OS threads) instead of state.shutdown_tx, so firing it stops them.
     TaskDef {
@@ -416,15 +416,17 @@ fn unsupported_features() -> Vec<&'static str> {
 /// fixed interval with no configurable poll (e.g. uptime, hwinfo).
 fn feature_interval_field(id: &str) -> Option<&'static str> {
     Some(match id {
-        "gpu" => "gpu",
+        "gpu" | "vram" => "gpu",
         "network" => "network",
         "disks" => "disk",
         "cpu" => "cpu",
         "memory" => "memory",
         "idle" => "last_active",
+        "audio_peak" => "audio_peak",
+        "heartbeat" => "heartbeat",
         // (steam downloads is event-driven, interval == 0, so it never reaches
         // this mapping - there's deliberately no arm for it.)
-        "running_game" | "game_catalog" => "game_sensor",
+        "running_game" | "game_catalog" | "window_fullscreen" => "game_sensor",
         _ => return None,
     })
 }
@@ -440,6 +442,8 @@ fn interval_field_get(iv: &crate::config::IntervalConfig, field: &str) -> u32 {
         "last_active" => iv.last_active,
         "steam_check" => iv.steam_check,
         "game_sensor" => iv.game_sensor,
+        "audio_peak" => iv.audio_peak,
+        "heartbeat" => iv.heartbeat,
         _ => 0,
     };
     v.min(u64::from(u32::MAX)) as u32
@@ -457,6 +461,8 @@ fn interval_field_set(iv: &mut crate::config::IntervalConfig, field: &str, v: u3
         "last_active" => iv.last_active = v,
         "steam_check" => iv.steam_check = v,
         "game_sensor" => iv.game_sensor = v,
+        "audio_peak" => iv.audio_peak = v,
+        "heartbeat" => iv.heartbeat = v,
         _ => {}
     }
 }
@@ -468,6 +474,13 @@ fn flag_get(f: &FeatureConfig, id: &str) -> Option<bool> {
         "disks" => f.disk_sensor,
         "uptime" => f.uptime_sensor,
         "hwinfo" => f.hwinfo_sensor,
+        "focus_assist" => f.focus_assist,
+        "process_count" => f.process_count,
+        "windows_version" => f.windows_version,
+        "metered_connection" => f.metered_connection,
+        "remote_session" => f.remote_session,
+        "device_triggers" => f.device_triggers,
+        "vram" => f.vram_sensor,
         "cpu" => f.cpu_sensor,
         "memory" => f.memory_sensor,
         "active_window" => f.active_window,
@@ -483,6 +496,8 @@ fn flag_get(f: &FeatureConfig, id: &str) -> Option<bool> {
         "launch_game" => f.launch_game,
         "close_game" => f.close_game,
         "volume" => f.volume,
+        "audio_peak" => f.audio_peak,
+        "window_fullscreen" => f.window_fullscreen,
         "media_controls" => f.media_controls,
         "steam_downloads" => f.steam_updates,
         "notifications" => f.notifications,
@@ -494,6 +509,18 @@ fn flag_get(f: &FeatureConfig, id: &str) -> Option<bool> {
         "lock" => f.cmd_lock,
         "logoff" => f.cmd_logoff,
         "monitor" => f.cmd_monitor,
+        "set_priority" => f.cmd_priority,
+        "service_control" => f.cmd_service,
+        "read_registry" => f.cmd_registry,
+        "heartbeat" => f.heartbeat,
+        "night_light" => f.night_light,
+        "game_mode" => f.game_mode,
+        "command_slots" => f.command_slots,
+        "restart_explorer" => f.cmd_explorer,
+        "tcp_connections" => f.tcp_connections,
+        "keep_awake" => f.keep_awake,
+        "move_window" => f.cmd_window,
+        "mouse" => f.cmd_mouse,
         _ => return None,
     })
 }
@@ -505,6 +532,13 @@ fn flag_set(f: &mut FeatureConfig, id: &str, v: bool) {
         "disks" => f.disk_sensor = v,
         "uptime" => f.uptime_sensor = v,
         "hwinfo" => f.hwinfo_sensor = v,
+        "focus_assist" => f.focus_assist = v,
+        "process_count" => f.process_count = v,
+        "windows_version" => f.windows_version = v,
+        "metered_connection" => f.metered_connection = v,
+        "remote_session" => f.remote_session = v,
+        "device_triggers" => f.device_triggers = v,
+        "vram" => f.vram_sensor = v,
         "cpu" => f.cpu_sensor = v,
         "memory" => f.memory_sensor = v,
         "active_window" => f.active_window = v,
@@ -520,6 +554,8 @@ fn flag_set(f: &mut FeatureConfig, id: &str, v: bool) {
         "launch_game" => f.launch_game = v,
         "close_game" => f.close_game = v,
         "volume" => f.volume = v,
+        "audio_peak" => f.audio_peak = v,
+        "window_fullscreen" => f.window_fullscreen = v,
         "media_controls" => f.media_controls = v,
         "steam_downloads" => f.steam_updates = v,
         "notifications" => f.notifications = v,
@@ -531,6 +567,18 @@ fn flag_set(f: &mut FeatureConfig, id: &str, v: bool) {
         "lock" => f.cmd_lock = v,
         "logoff" => f.cmd_logoff = v,
         "monitor" => f.cmd_monitor = v,
+        "set_priority" => f.cmd_priority = v,
+        "service_control" => f.cmd_service = v,
+        "read_registry" => f.cmd_registry = v,
+        "heartbeat" => f.heartbeat = v,
+        "night_light" => f.night_light = v,
+        "game_mode" => f.game_mode = v,
+        "command_slots" => f.command_slots = v,
+        "restart_explorer" => f.cmd_explorer = v,
+        "tcp_connections" => f.tcp_connections = v,
+        "keep_awake" => f.keep_awake = v,
+        "move_window" => f.cmd_window = v,
+        "mouse" => f.cmd_mouse = v,
         _ => {}
     }
 }
@@ -1050,6 +1098,8 @@ fn custom_view(app: &mut App, ui: &mut egui::Ui, master_on: bool, ct: Kind) {
                         path: None,
                         args: None,
                         command: None,
+                        wait: false,
+                        timeout_secs: None,
                     });
                 }
                 if let Some(i) = remove {
@@ -45,21 +45,33 @@ pub fn start(cfg: &Config) -> LiveView {
     let state = Arc::new(Mutex::new(LiveState::default()));
     let st = Arc::clone(&state);
     let dev = cfg.device_name.clone();
-    let broker = cfg.mqtt.broker.clone();
+    let mqtt = cfg.mqtt.clone();
     let user = cfg.mqtt.user.clone();
     let pass = cfg.mqtt.pass.clone();
-    std::thread::spawn(move || run(broker, user, pass, dev, st));
+    // broker_url may browse mDNS (blank broker); do it on this thread, not the UI's.
+    std::thread::spawn(move || run(mqtt.broker_url(), user, pass, dev, st));
     LiveView { state }
 }
 
-fn sub_topics(dev: &str) -> [String; 3] {
+fn sub_topics(dev: &str) -> [String; 4] {
     [
         format!("homeassistant/sensor/{dev}/availability"),
         format!("homeassistant/sensor/{dev}/runninggames/state"),
         format!("homeassistant/sensor/{dev}/steam_updating/attributes"),
+        // Bundled state (`bundle_state`): runninggames is a key in here.
+        format!("homeassistant/sensor/{dev}/state"),
     ]
 }
 
+/// Running game id from a `runninggames` state value; "none" and HA's
+/// placeholders mean nothing is running.
+fn running_game(val: &str) -> Option<String> {
+    match val {
+        "" | "none" | "None" | "unavailable" | "unknown" => None,
+        v => Some(v.to_string()),
+    }
+}
+
 fn run(broker: String, user: String, pass: String, dev: String, state: Arc<Mutex<LiveState>>) {
     // No broker configured (first run / load error): nothing to connect to.
     if broker.trim().is_empty() {
@@ -103,10 +115,13 @@ fn run(broker: String, user: String, pass: String, dev: String, state: Arc<Mutex
                 if p.topic.ends_with("/availability") {
                     s.agent_online = Some(val.eq_ignore_ascii_case("online"));
                 } else if p.topic.ends_with("/runninggames/state") {
-                    s.running_game_id = match val {
-                        "" | "none" | "None" | "unavailable" | "unknown" => None,
-                        v => Some(v.to_string()),
-                    };
+                    s.running_game_id = running_game(val);
+                } else if p.topic == subs[3]
+                    && let Some(val) = serde_json::from_str::<serde_json::Value>(&payload)
+                        .ok()
+                        .and_then(|v| v.get("runninggames")?.as_str().map(str::to_string))
+                {
+                    s.running_game_id = running_game(&val);
                 } else if p.topic.ends_with("/steam_updating/attributes") {
                     s.updating_games = serde_json::from_str::<serde_json::Value>(&payload)
                         .ok()
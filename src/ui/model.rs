@@ -262,6 +262,18 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "PowerShell CloseMainWindow()",
         ),
+        a(
+            "game_mode",
+            "Game Mode",
+            "One switch that runs the game_mode on/off command steps.",
+            Games,
+            false,
+            false,
+            "ON",
+            "switch.dank0i_pc_gamemode",
+            "",
+            "Runs each step through the command path",
+        ),
         // Hardware (polled telemetry)
         s(
             "gpu",
@@ -276,6 +288,19 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "NVML / driver query",
         ),
+        s(
+            "vram",
+            "VRAM",
+            "Used and total GPU memory.",
+            Hardware,
+            false,
+            Running,
+            "6144 / 12282 MiB",
+            5,
+            "sensor.dank0i_pc_vram_used_mb",
+            "",
+            "DXGI adapter + PDH (Windows), sysfs / nvidia-smi (Linux)",
+        ),
         s(
             "cpu",
             "CPU",
@@ -341,6 +366,97 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "",
         ),
+        s(
+            "heartbeat",
+            "Heartbeat",
+            "Counter that advances while the agent is publishing.",
+            Hardware,
+            false,
+            Running,
+            "1042",
+            60,
+            "sensor.dank0i_pc_heartbeat",
+            "",
+            "",
+        ),
+        s(
+            "command_slots",
+            "Command Slots",
+            "Commands running at once, and how many were dropped.",
+            Hardware,
+            false,
+            Running,
+            "0",
+            5,
+            "sensor.dank0i_pc_command_slots_used",
+            "",
+            "Executor slot count, polled every 5s",
+        ),
+        s(
+            "tcp_connections",
+            "TCP Connections",
+            "Established connections to other machines, and open listeners.",
+            Hardware,
+            false,
+            Running,
+            "42",
+            5,
+            "sensor.dank0i_pc_tcp_connections",
+            "",
+            "GetExtendedTcpTable / /proc/net/tcp",
+        ),
+        s(
+            "process_count",
+            "Process Count",
+            "Running processes, with the thread total.",
+            Hardware,
+            false,
+            Running,
+            "312",
+            0,
+            "sensor.dank0i_pc_process_count",
+            "",
+            "Reuses the game-detection process walk",
+        ),
+        s(
+            "windows_version",
+            "Windows Version",
+            "OS release and build, e.g. Windows 11 23H2.",
+            Hardware,
+            false,
+            Running,
+            "Windows 11 23H2, build 22631",
+            0,
+            "sensor.dank0i_pc_windows_version",
+            "Windows",
+            "CurrentVersion registry key, read at start",
+        ),
+        s(
+            "metered_connection",
+            "Metered Connection",
+            "On while the internet connection is metered (hotspot, data cap).",
+            Hardware,
+            false,
+            Running,
+            "off",
+            0,
+            "sensor.dank0i_pc_metered_connection",
+            "Windows",
+            "WinRT connection cost, polled every 30s",
+        ),
+        s(
+            "remote_session",
+            "Remote Session",
+            "On while you're connected over Remote Desktop.",
+            Hardware,
+            false,
+            Running,
+            "off",
+            0,
+            "sensor.dank0i_pc_remote_session",
+            "Windows",
+            "SM_REMOTESESSION, polled every 5s",
+        ),
         s(
             "hwinfo",
             "HWiNFO Bridge",
@@ -381,6 +497,19 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "Endpoint volume notifications",
         ),
+        s(
+            "audio_peak",
+            "Audio Peak",
+            "Output peak level - is sound playing right now.",
+            Audio,
+            false,
+            Running,
+            "37%",
+            2,
+            "sensor.dank0i_pc_audio_peak",
+            "Windows",
+            "WASAPI peak meter (IAudioMeterInformation)",
+        ),
         s(
             "now_playing",
             "Now Playing",
@@ -459,6 +588,19 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "Foreground-window change events",
         ),
+        s(
+            "window_fullscreen",
+            "Window Fullscreen",
+            "Whether a watched game fills a monitor, and which one.",
+            Presence,
+            false,
+            Running,
+            "on",
+            5,
+            "sensor.dank0i_pc_fullscreen_*",
+            "Windows, fullscreen_windows in config",
+            "Window rect vs monitor rect",
+        ),
         s(
             "session",
             "Session State",
@@ -472,6 +614,19 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "Session notifications",
         ),
+        s(
+            "focus_assist",
+            "Focus Assist",
+            "Do Not Disturb: off, priority, or alarms.",
+            Presence,
+            false,
+            Running,
+            "off",
+            5,
+            "sensor.dank0i_pc_focus_assist",
+            "Windows 10 1803 or later",
+            "Quiet-hours profile (WNF)",
+        ),
         // Power (event-driven state + actions)
         s(
             "sleep_wake",
@@ -486,6 +641,19 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "Power-broadcast events",
         ),
+        s(
+            "device_triggers",
+            "Device Triggers",
+            "Woke up / going to sleep / lid triggers for the automation editor.",
+            Power,
+            false,
+            Running,
+            "",
+            0,
+            "",
+            "Sleep / Wake",
+            "MQTT device triggers",
+        ),
         s(
             "display_state",
             "Display State",
@@ -562,7 +730,7 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
         a(
             "monitor",
             "Monitor On / Off",
-            "Turn displays on or off.",
+            "Turn displays on or off, or put them in standby.",
             Power,
             false,
             true,
@@ -571,6 +739,102 @@ pub fn registry(device_id: &str) -> Vec<Feature> {
             "",
             "Monitor power message",
         ),
+        a(
+            "set_priority",
+            "Set Process Priority",
+            "Change a running process's priority, e.g. cs2:high.",
+            Power,
+            false,
+            false,
+            "cs2:high",
+            "text.dank0i_pc_setpriority",
+            "",
+            "SetPriorityClass / setpriority",
+        ),
+        a(
+            "service_control",
+            "Service Control",
+            "Start, stop or restart a service listed in controllable_services.",
+            Power,
+            true,
+            false,
+            "Spooler:restart",
+            "select.dank0i_pc_servicecontrol",
+            "",
+            "Service Control Manager (Windows), systemctl (Linux)",
+        ),
+        a(
+            "read_registry",
+            "Read Registry",
+            "Read a value under readable_registry_keys; the reply carries it.",
+            Power,
+            true,
+            false,
+            r#"{"key":"HKCU\Software\App","value":"Setting"}"#,
+            "",
+            "Windows",
+            "RegQueryValueEx, reply_to envelope",
+        ),
+        a(
+            "move_window",
+            "Move Window",
+            "Move and resize a process's window, e.g. onto another monitor, or bring it to the front.",
+            Power,
+            false,
+            false,
+            r#"{"process":"msedge","x":0,"y":0,"w":800,"h":600}"#,
+            "text.dank0i_pc_movewindow",
+            "Windows",
+            "EnumWindows + SetWindowPos / SetForegroundWindow",
+        ),
+        a(
+            "mouse",
+            "Mouse Control",
+            "Move the cursor and click, e.g. to dismiss a dialog remotely.",
+            Power,
+            false,
+            false,
+            r#"{"x":960,"y":540,"button":"left"}"#,
+            "text.dank0i_pc_mousemove",
+            "Windows",
+            "SetCursorPos + SendInput",
+        ),
+        a(
+            "night_light",
+            "Night Light",
+            "Switch Windows Night Light on or off; follows changes made on the PC.",
+            Power,
+            false,
+            false,
+            "ON",
+            "switch.dank0i_pc_nightlight",
+            "Windows",
+            "CloudStore bluelightreduction state blob",
+        ),
+        a(
+            "keep_awake",
+            "Keep Awake",
+            "Switch that stops the PC sleeping or blanking the display while on.",
+            Power,
+            false,
+            false,
+            "ON",
+            "switch.dank0i_pc_keepawake",
+            "",
+            "SetThreadExecutionState / logind inhibitor",
+        ),
+        a(
+            "restart_explorer",
+            "Restart Explorer",
+            "Restart a hung taskbar and desktop shell without signing out.",
+            Power,
+            false,
+            false,
+            "PRESS",
+            "button.dank0i_pc_restartexplorer",
+            "Windows",
+            "Ends explorer.exe, waits for the taskbar",
+        ),
         // Notifications
         a(
             "notifications",
@@ -155,24 +155,21 @@ pub fn cleanup_old_files() {
     }
 }
 
+/// Whether `update_channel` allows contacting GitHub at all. `"disabled"`
+/// turns off both the startup check and the `CheckUpdate` command.
+pub(crate) fn updates_enabled(update_channel: &str) -> bool {
+    update_channel != "disabled"
+}
+
 /// Check for updates and download if available.
 /// `update_channel`: "stable" (default), "beta", or "disabled".
 pub async fn check_for_updates(update_channel: String) {
-    if update_channel == "disabled" {
+    if !updates_enabled(&update_channel) {
         info!("Update checking disabled by config");
         return;
     }
 
-    // Stable resolves the version via the CDN-served redirect (no API limit).
-    // Beta still needs the API, since there's no static URL for "latest
-    // prerelease" - that path can hit the unauthenticated rate limit.
-    let remote_version = if update_channel == "beta" {
-        resolve_latest_via_api().await
-    } else {
-        resolve_latest_via_redirect().await
-    };
-
-    let remote_version = match remote_version {
+    let remote_version = match resolve_latest(&update_channel).await {
         Ok(v) => v,
         Err(e) => {
             warn!("Failed to check for updates: {}", e);
@@ -242,6 +239,30 @@ pub async fn check_for_updates(update_channel: String) {
     }
 }
 
+/// Latest released version on `update_channel`, and whether it is newer than
+/// the running build. Report-only (the `CheckUpdate` command): nothing is
+/// downloaded. Refused without a request when updates are `"disabled"`.
+pub(crate) async fn check_latest(update_channel: &str) -> anyhow::Result<(String, bool)> {
+    if !updates_enabled(update_channel) {
+        anyhow::bail!("update checks are disabled (update_channel is \"disabled\")");
+    }
+    let remote_version = resolve_latest(update_channel).await?;
+    let newer = is_newer_version(&remote_version, CURRENT_VERSION);
+    Ok((remote_version, newer))
+}
+
+/// Latest version on the channel (tag-derived, so unsigned).
+async fn resolve_latest(update_channel: &str) -> anyhow::Result<String> {
+    // Stable resolves the version via the CDN-served redirect (no API limit).
+    // Beta still needs the API, since there's no static URL for "latest
+    // prerelease" - that path can hit the unauthenticated rate limit.
+    if update_channel == "beta" {
+        resolve_latest_via_api().await
+    } else {
+        resolve_latest_via_redirect().await
+    }
+}
+
 /// Resolve the latest STABLE version by following the `releases/latest`
 /// redirect on the GitHub web host (CDN-served, no API rate limit).
 async fn resolve_latest_via_redirect() -> anyhow::Result<String> {
@@ -642,6 +663,24 @@ mod tests {
         );
     }
 
+    #[tokio::test(flavor = "current_thread")]
+    async fn test_check_latest_disabled_makes_no_request() {
+        assert!(updates_enabled("stable"));
+        assert!(updates_enabled("beta"));
+        assert!(!updates_enabled("disabled"));
+        // Fails before resolving anything, so this needs no network.
+        let err = check_latest("disabled").await.unwrap_err();
+        assert!(err.to_string().contains("disabled"), "{err}");
+    }
+
+    #[test]
+    fn test_is_newer_version_against_running_build() {
+        // What CheckUpdate reports as update_available.
+        assert!(!is_newer_version(CURRENT_VERSION, CURRENT_VERSION));
+        assert!(is_newer_version("999.0.0", CURRENT_VERSION));
+        assert!(!is_newer_version("0.0.1", CURRENT_VERSION));
+    }
+
     #[test]
     fn test_is_newer_version_major_bump() {
         assert!(is_newer_version("3.0.0", "2.7.0"));